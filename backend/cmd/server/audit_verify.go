@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"dvr-manager/internal/audit"
+	"dvr-manager/internal/repository"
+	"dvr-manager/internal/service"
+	"dvr-manager/pkg/db"
+)
+
+// runAuditVerify audit-verify 子命令：校验审计哈希链与签名检查点，返回进程退出码（0 完整，1 发现断点，2 无法校验）。
+// 须使用与服务相同的 DATA_DIR / AUDIT_SIGNING_KEY / AUDIT_TRUSTED_KEYS；服务运行中也可执行（只读）。
+func runAuditVerify(dataDir string, args []string) int {
+	fs := flag.NewFlagSet("audit-verify", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "以 JSON 输出校验结果")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if err := db.InitDB(dataDir); err != nil {
+		fmt.Fprintf(os.Stderr, "audit-verify: %v\n", err)
+		return 2
+	}
+	defer db.Close()
+	signer, err := audit.LoadSigner(dataDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "audit-verify: %v\n", err)
+		return 2
+	}
+	chain := service.NewAuditChainService(repository.NewAuditRepository(), repository.NewAuditCheckpointRepository(), signer)
+	report, err := chain.Verify()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "audit-verify: %v\n", err)
+		return 2
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(report)
+	} else if report.OK {
+		fmt.Printf("audit chain OK: %d records (#%d..#%d), %d checkpoints, truncated through #%d, key %s\n",
+			report.Rows, report.FirstID, report.LastID, report.Checkpoints, report.TruncatedThrough, report.KeyID)
+	} else {
+		fmt.Printf("audit chain BROKEN at record #%d (%s): %s\n", report.Broken.ID, report.Broken.Reason, report.Broken.Message)
+		fmt.Printf("verified %d records before the break, %d checkpoints, key %s\n", report.Rows, report.Checkpoints, report.KeyID)
+	}
+	if !report.OK {
+		return 1
+	}
+	return 0
+}
@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strconv"
+	"syscall"
 	"time"
 
 	"dvr-manager/internal/audit"
@@ -14,15 +17,14 @@ import (
 	"dvr-manager/internal/config"
 	"dvr-manager/internal/repository"
 	"dvr-manager/internal/router"
+	"dvr-manager/internal/service"
 	"dvr-manager/pkg/db"
 )
 
 func main() {
-	dataDir := "../data"
-	if dataDirEnv := os.Getenv("DATA_DIR"); dataDirEnv != "" {
-		dataDir = dataDirEnv
-	} else if _, err := os.Stat("/app/data"); err == nil {
-		dataDir = "/app/data"
+	dataDir := resolveDataDir()
+	if len(os.Args) > 1 && os.Args[1] == "audit-verify" {
+		os.Exit(runAuditVerify(dataDir, os.Args[2:]))
 	}
 
 	if err := os.MkdirAll(dataDir, 0755); err != nil {
@@ -38,15 +40,39 @@ func main() {
 
 	auditRetentionMonths := audit.RetentionMonths()
 	auditRepo := repository.NewAuditRepository()
-	log.Printf("Audit log retention: %d months (AUDIT_RETENTION_MONTHS); startup + daily 00:00 cleanup enabled",
-		auditRetentionMonths)
-	if n, err := auditRepo.DeleteOlderThan(audit.RetentionCutoff()); err != nil {
-		log.Printf("[Audit] startup cleanup warning: %v", err)
-	} else {
-		log.Printf("[Audit] startup cleanup: deleted=%d cutoff_before=%s",
-			n, audit.RetentionCutoff().Format("2006-01-02"))
+	auditSigner, err := audit.LoadSigner(dataDir)
+	if err != nil {
+		log.Fatalf("Failed to load audit signing key: %v", err)
+	}
+	auditChain := service.NewAuditChainService(auditRepo, repository.NewAuditCheckpointRepository(), auditSigner)
+	archiveDir := filepath.Join(dataDir, service.AuditArchiveDirName)
+	auditArchives := service.NewAuditArchiveService(auditRepo, auditChain, archiveDir)
+	log.Printf("Audit log retention: %d months (AUDIT_RETENTION_MONTHS); startup + daily 00:00 cleanup enabled, expired records archived to %s",
+		auditRetentionMonths, archiveDir)
+	// 先迁移历史记录，使归档中的记录都带原因码与 metadata
+	if n, err := auditRepo.MigrateLegacy(); err != nil {
+		log.Printf("[Audit] legacy detail migration warning: %v", err)
+	} else if n > 0 {
+		log.Printf("[Audit] migrated %d legacy records to reason codes + metadata", n)
+	}
+	if n, err := auditRepo.BackfillChain(); err != nil {
+		log.Fatalf("Failed to build audit hash chain: %v", err)
+	} else if n > 0 {
+		log.Printf("[Audit] hash chain built for %d existing records", n)
 	}
-	go runAuditDailyCleanup(auditRepo)
+	checkpointInterval := audit.CheckpointInterval()
+	log.Printf("Audit hash chain: checkpoints every %s signed by key %s (AUDIT_CHECKPOINT_INTERVAL / AUDIT_SIGNING_KEY)",
+		checkpointInterval, auditSigner.KeyID())
+	archiveExpiredAudit(auditArchives, "startup")
+	go runAuditDailyCleanup(auditArchives)
+	go runAuditCheckpoints(auditChain, checkpointInterval)
+
+	// 请求路径上的审计只入队，由后台写入器批量落库；进程退出前写完队列
+	writerCfg := audit.WriterConfigFromEnv()
+	auditWriter := audit.NewWriter(auditRepo, writerCfg)
+	bufferedAudit := repository.NewBufferedAuditRepository(auditRepo, auditWriter)
+	log.Printf("Audit writer: queue=%d batch=%d flush=%s overflow=%s (AUDIT_QUEUE_SIZE / AUDIT_BATCH_SIZE / AUDIT_FLUSH_INTERVAL / AUDIT_OVERFLOW)",
+		writerCfg.QueueSize, writerCfg.BatchSize, writerCfg.FlushInterval, writerCfg.Overflow)
 
 	cacheTTLDays := recordingCacheTTLDays()
 	recordingCacheRepo := repository.NewRecordingCacheRepository()
@@ -57,6 +83,17 @@ func main() {
 	}
 	go runRecordingCacheDailyCleanup(recordingCacheRepo)
 
+	refreshTokenRepo := repository.NewRefreshTokenRepository()
+	sessionRepo := repository.NewSessionRepository()
+	loginAttemptRepo := repository.NewLoginAttemptRepository()
+	cleanupExpiredSessions(refreshTokenRepo, sessionRepo, loginAttemptRepo, "startup")
+	go runSessionDailyCleanup(refreshTokenRepo, sessionRepo, loginAttemptRepo)
+
+	userRepo := repository.NewUserRepository()
+	userSessions := service.NewSessionService(sessionRepo, refreshTokenRepo, userRepo)
+	disableExpiredUsers(userRepo, userSessions, bufferedAudit, "startup")
+	go runUserExpiryCheck(userRepo, userSessions, bufferedAudit)
+
 	configRepo := repository.NewConfigRepository()
 	dvrRepo := repository.NewDVRRepository()
 	cfg, err := configRepo.GetConfig()
@@ -68,15 +105,31 @@ func main() {
 	}
 	config.SetConfig(cfg)
 
-	jwt := auth.NewJWT(os.Getenv("JWT_SECRET"))
+	jwt, keyService := setupJWT()
+	if keyService != nil {
+		go runKeyRotation(keyService)
+	}
+	lifetimes := auth.LifetimesForRole("")
+	log.Printf("Token lifetimes: access=%s refresh=%s (ACCESS_TOKEN_TTL / REFRESH_TOKEN_TTL, per-role *_<ROLE>)",
+		lifetimes.Access, lifetimes.Refresh)
 
 	log.Printf("Loaded %d DVR servers from database", len(cfg.DVRServers))
 	log.Printf("Recording cache TTL: %d days (RECORD_CACHE_TTL_DAYS)", cacheTTLDays)
+	loginPolicy := service.LoginPolicyFromEnv()
+	log.Printf("Login throttling: lockout after %d failures per user / %d per IP for %s (LOGIN_MAX_FAILURES / LOGIN_IP_MAX_FAILURES / LOGIN_LOCKOUT)",
+		loginPolicy.MaxFailures, loginPolicy.IPMaxFailures, loginPolicy.Lockout)
+	if roles := service.MFARequiredRoles(); len(roles) > 0 {
+		log.Printf("MFA required for roles: %v (MFA_REQUIRED_ROLES)", roles)
+	}
 	if config.RequireAuthForPlayEnabled() {
 		log.Printf("Play/stream endpoints require authentication (REQUIRE_AUTH_FOR_PLAY)")
 	}
 
-	r := router.NewRouter(cfg, cacheTTLDays, jwt)
+	r, err := router.NewRouter(cfg, cacheTTLDays, jwt, bufferedAudit, auditWriter, auditArchives, auditChain)
+	if err != nil {
+		log.Fatalf("Failed to initialize router: %v", err)
+	}
+	warnDefaultCredentials()
 
 	addr := fmt.Sprintf(":%d", cfg.Server.Port)
 	readTimeout := cfg.Server.Timeout
@@ -99,31 +152,136 @@ func main() {
 		ReadHeaderTimeout: readTimeout,
 		ReadTimeout:       readTimeout,
 	}
-	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		log.Fatal("Failed to start server:", err)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal("Failed to start server:", err)
+		}
+	}()
+	<-ctx.Done()
+	shutdown(srv, auditWriter, auditChain)
+}
+
+// resolveDataDir DATA_DIR，未设置时依次使用 /app/data（容器）与 ../data
+func resolveDataDir() string {
+	if dataDirEnv := os.Getenv("DATA_DIR"); dataDirEnv != "" {
+		return dataDirEnv
+	}
+	if _, err := os.Stat("/app/data"); err == nil {
+		return "/app/data"
 	}
+	return "../data"
 }
 
-func runAuditDailyCleanup(auditRepo repository.AuditRepository) {
-	for {
-		now := time.Now()
-		next := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
-		d := time.Until(next)
-		if d < 0 {
-			d = 0
-		}
-		time.Sleep(d)
-		cutoff := audit.RetentionCutoff()
-		n, err := auditRepo.DeleteOlderThan(cutoff)
+// shutdown 停止接收请求，等待进行中的请求结束后写完审计队列，并为链头写入检查点
+func shutdown(srv *http.Server, auditWriter *audit.Writer, auditChain service.AuditChainService) {
+	log.Printf("Shutting down...")
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("HTTP server shutdown: %v", err)
+	}
+	// 长时间的流代理可能耗尽上面的等待时间，审计落库单独计时
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelDrain()
+	if err := auditWriter.Close(drainCtx); err != nil {
+		log.Printf("[Audit] drain incomplete: %v (queue depth %d)", err, auditWriter.Stats().QueueDepth)
+		return
+	}
+	stats := auditWriter.Stats()
+	log.Printf("[Audit] writer drained: written=%d dropped=%d failed=%d", stats.Written, stats.Dropped, stats.Failed)
+	if _, err := auditChain.Checkpoint(); err != nil {
+		log.Printf("[Audit] shutdown checkpoint error: %v", err)
+	}
+}
+
+// setupJWT 按 JWT_ALG 创建签发器；非对称模式返回密钥服务用于定时轮换
+func setupJWT() (*auth.JWT, service.KeyService) {
+	alg, err := auth.SigningAlgorithm()
+	if err != nil {
+		log.Fatalf("Invalid JWT configuration: %v", err)
+	}
+	if alg == auth.AlgHS256 {
+		secret, insecure, err := auth.HMACSecret()
 		if err != nil {
-			log.Printf("[Audit] daily cleanup error: %v", err)
+			log.Fatalf("Refusing to start: %v", err)
+		}
+		if insecure {
+			log.Printf("[WARN] JWT signing: HS256 with the built-in default secret (JWT_ALLOW_DEFAULT_SECRET)")
 		} else {
-			log.Printf("[Audit] daily cleanup: deleted=%d cutoff_before=%s",
-				n, cutoff.Format("2006-01-02"))
+			log.Printf("JWT signing: HS256 (JWT_SECRET)")
+		}
+		jwt, err := auth.NewJWT(secret)
+		if err != nil {
+			log.Fatalf("Invalid JWT configuration: %v", err)
+		}
+		return jwt, nil
+	}
+
+	rotation := auth.KeyRotationInterval()
+	grace := auth.KeyGracePeriod()
+	if maxTTL := auth.MaxAccessTokenTTL(); grace < maxTTL {
+		log.Printf("[WARN] JWT_KEY_GRACE=%s is shorter than the longest access token lifetime %s; using %s", grace, maxTTL, maxTTL)
+		grace = maxTTL
+	}
+	jwt := auth.NewAsymmetricJWT()
+	keyService := service.NewKeyService(jwt, repository.NewJWTKeyRepository(), alg, rotation, grace)
+	if err := keyService.Load(); err != nil {
+		log.Fatalf("Failed to load JWT signing keys: %v", err)
+	}
+	if _, err := keyService.RotateIfDue(time.Now()); err != nil {
+		log.Printf("[AUTH] startup key rotation warning: %v", err)
+	}
+	log.Printf("JWT signing: %s, key rotation=%s grace=%s (JWT_ALG / JWT_KEY_ROTATION / JWT_KEY_GRACE); JWKS at /.well-known/jwks.json",
+		alg, rotation, grace)
+	return jwt, keyService
+}
+
+// runKeyRotation 每小时检查签名密钥是否到期轮换
+func runKeyRotation(keyService service.KeyService) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		if _, err := keyService.RotateIfDue(now); err != nil {
+			log.Printf("[AUTH] key rotation error: %v", err)
+		}
+	}
+}
+
+func runAuditDailyCleanup(archives service.AuditArchiveService) {
+	for {
+		sleepUntilMidnight()
+		archiveExpiredAudit(archives, "daily")
+	}
+}
+
+// runAuditCheckpoints 定期对审计哈希链头签名（没有新记录时跳过）
+func runAuditCheckpoints(chain service.AuditChainService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		cp, err := chain.Checkpoint()
+		if err != nil {
+			log.Printf("[Audit] checkpoint error: %v", err)
+		} else if cp != nil {
+			log.Printf("[Audit] checkpoint #%d at record #%d", cp.ID, cp.LastID)
 		}
 	}
 }
 
+// archiveExpiredAudit 将超过保留期的审计记录写入归档后删除；归档失败时不删除
+func archiveExpiredAudit(archives service.AuditArchiveService, when string) {
+	cutoff := audit.RetentionCutoff()
+	archived, deleted, err := archives.ArchiveExpired(cutoff)
+	if err != nil {
+		log.Printf("[Audit] %s cleanup error: %v (archived=%d deleted=%d)", when, err, archived, deleted)
+		return
+	}
+	log.Printf("[Audit] %s cleanup: archived=%d deleted=%d cutoff_before=%s",
+		when, archived, deleted, cutoff.Format("2006-01-02"))
+}
+
 func recordingCacheTTLDays() int {
 	const defaultDays = 30
 	if s := os.Getenv("RECORD_CACHE_TTL_DAYS"); s != "" {
@@ -137,13 +295,7 @@ func recordingCacheTTLDays() int {
 
 func runRecordingCacheDailyCleanup(repo repository.RecordingCacheRepository) {
 	for {
-		now := time.Now()
-		next := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
-		d := time.Until(next)
-		if d < 0 {
-			d = 0
-		}
-		time.Sleep(d)
+		sleepUntilMidnight()
 		n, err := repo.DeleteExpired(time.Now())
 		if err != nil {
 			log.Printf("[RecordingCache] daily cleanup error: %v", err)
@@ -152,3 +304,77 @@ func runRecordingCacheDailyCleanup(repo repository.RecordingCacheRepository) {
 		}
 	}
 }
+
+func runSessionDailyCleanup(refreshRepo repository.RefreshTokenRepository, sessionRepo repository.SessionRepository, loginRepo repository.LoginAttemptRepository) {
+	for {
+		sleepUntilMidnight()
+		cleanupExpiredSessions(refreshRepo, sessionRepo, loginRepo, "daily")
+	}
+}
+
+// cleanupExpiredSessions 删除已过期的刷新令牌、会话与登录失败记录
+func cleanupExpiredSessions(refreshRepo repository.RefreshTokenRepository, sessionRepo repository.SessionRepository, loginRepo repository.LoginAttemptRepository, when string) {
+	now := time.Now()
+	if n, err := refreshRepo.DeleteExpired(now); err != nil {
+		log.Printf("[Auth] %s refresh token cleanup error: %v", when, err)
+	} else if n > 0 {
+		log.Printf("[Auth] %s cleanup: removed %d expired refresh tokens", when, n)
+	}
+	if n, err := sessionRepo.DeleteExpired(now); err != nil {
+		log.Printf("[Auth] %s session cleanup error: %v", when, err)
+	} else if n > 0 {
+		log.Printf("[Auth] %s cleanup: removed %d expired sessions", when, n)
+	}
+	if n, err := loginRepo.DeleteStale(now.Add(-service.LoginPolicyFromEnv().Window)); err != nil {
+		log.Printf("[Auth] %s login attempt cleanup error: %v", when, err)
+	} else if n > 0 {
+		log.Printf("[Auth] %s cleanup: removed %d stale login attempts", when, n)
+	}
+}
+
+// runUserExpiryCheck 每小时停用已到期的账号
+func runUserExpiryCheck(userRepo repository.UserRepository, sessions service.SessionService, auditRepo repository.AuditRepository) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for range ticker.C {
+		disableExpiredUsers(userRepo, sessions, auditRepo, "hourly")
+	}
+}
+
+// disableExpiredUsers 停用已到期的账号、吊销其会话并审计 user_disable
+func disableExpiredUsers(userRepo repository.UserRepository, sessions service.SessionService, auditRepo repository.AuditRepository, when string) {
+	users, err := service.DisableExpiredUsers(userRepo, sessions, time.Now())
+	if err != nil {
+		log.Printf("[Auth] %s account expiry check error: %v", when, err)
+	}
+	for _, u := range users {
+		_ = auditRepo.Insert(&audit.Event{
+			Action: "user_disable", Username: "system", Resource: u.Username,
+			Status: audit.StatusSuccess, Reason: audit.ReasonExpired,
+		})
+	}
+	if len(users) > 0 {
+		log.Printf("[Auth] %s expiry check: disabled %d expired accounts", when, len(users))
+	}
+}
+
+// warnDefaultCredentials 仍可使用内置默认密码登录的账号时输出醒目警告
+func warnDefaultCredentials() {
+	names := service.DefaultCredentialsInUse(repository.NewUserRepository())
+	if len(names) == 0 {
+		return
+	}
+	log.Printf("[SECURITY] ************************************************************")
+	log.Printf("[SECURITY] DEFAULT CREDENTIALS ARE STILL VALID FOR: %v", names)
+	log.Printf("[SECURITY] Log in and change these passwords immediately, or set ADMIN_PASSWORD / USER_PASSWORD before first start.")
+	log.Printf("[SECURITY] ************************************************************")
+}
+
+// sleepUntilMidnight 阻塞到进程本地时区的下一个 00:00
+func sleepUntilMidnight() {
+	now := time.Now()
+	next := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+	if d := time.Until(next); d > 0 {
+		time.Sleep(d)
+	}
+}
@@ -0,0 +1,84 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// 检查点类型
+const (
+	CheckpointPeriodic  = "periodic"  // 定期（及进程退出时）对链头签名
+	CheckpointRetention = "retention" // 保留期清理前对将被删除的前缀签名
+)
+
+// 链校验发现的断点原因
+const (
+	BreakMissingHash         = "missing_hash"         // 记录没有哈希（绕过应用写入）
+	BreakHashMismatch        = "hash_mismatch"        // 记录内容被修改
+	BreakPrevMismatch        = "prev_mismatch"        // 前一条记录被删除或插入了记录
+	BreakPrefixDeleted       = "prefix_deleted"       // 最早的记录被删除且没有保留期检查点
+	BreakCheckpointSignature = "checkpoint_signature" // 检查点签名无效或签名密钥不受信任
+	BreakCheckpointMismatch  = "checkpoint_mismatch"  // 记录哈希与已签名检查点不一致（整链被重算）
+	BreakRowDeleted          = "row_deleted"          // 检查点指向的记录已不存在
+)
+
+// ChainRecord 参与哈希的一条 audit_log 记录，各字段为入库后的文本形式
+type ChainRecord struct {
+	ID           int64
+	CreatedAt    string
+	Action       string
+	Username     string
+	Role         string
+	ClientIP     string
+	Resource     string
+	Detail       string
+	Status       string
+	Reason       string
+	Metadata     string
+	APITokenID   *int64
+	Impersonator string
+
+	PrevHash string // 前一条记录的哈希；链的第一条为空
+	Hash     string
+}
+
+// ChainHash 记录哈希 = SHA-256(前一条哈希 + "\n" + 各字段的 JSON 数组)，十六进制小写
+func ChainHash(prev string, r *ChainRecord) string {
+	token := ""
+	if r.APITokenID != nil {
+		token = strconv.FormatInt(*r.APITokenID, 10)
+	}
+	fields, _ := json.Marshal([]string{
+		strconv.FormatInt(r.ID, 10), r.CreatedAt, r.Action, r.Username, r.Role, r.ClientIP,
+		r.Resource, r.Detail, r.Status, r.Reason, r.Metadata, token, r.Impersonator,
+	})
+	h := sha256.New()
+	h.Write([]byte(prev))
+	h.Write([]byte{'\n'})
+	h.Write(fields)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// CheckpointPayload 检查点的签名内容
+func CheckpointPayload(kind, createdAt string, lastID int64, lastHash, keyID string) []byte {
+	return []byte(fmt.Sprintf("dvr-manager audit checkpoint v1\n%s\n%s\n%d\n%s\n%s", kind, createdAt, lastID, lastHash, keyID))
+}
+
+const DefaultCheckpointInterval = time.Hour
+
+// CheckpointInterval 审计哈希链定期签名检查点的间隔，默认 1h；可通过 AUDIT_CHECKPOINT_INTERVAL 配置。
+func CheckpointInterval() time.Duration {
+	if s := os.Getenv("AUDIT_CHECKPOINT_INTERVAL"); s != "" {
+		if d, err := time.ParseDuration(s); err == nil && d > 0 {
+			return d
+		}
+		log.Printf("[Audit] invalid AUDIT_CHECKPOINT_INTERVAL=%q, using default %s", s, DefaultCheckpointInterval)
+	}
+	return DefaultCheckpointInterval
+}
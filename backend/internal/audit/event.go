@@ -0,0 +1,135 @@
+package audit
+
+import "time"
+
+// 审计结果
+const (
+	StatusSuccess = "success"
+	StatusFail    = "fail"
+)
+
+// 原因码：机器可读、稳定不变，统计与筛选只依赖原因码与 Metadata，不再解析描述文本
+const (
+	ReasonOK = "ok" // 无需进一步区分的成功操作
+
+	// 录像查询 / 流代理
+	ReasonRecordFound    = "record_found"
+	ReasonRecordNotFound = "record_not_found"
+	ReasonBatchCompleted = "batch_completed"
+	ReasonUpstreamError  = "upstream_error" // DVR 拉流失败
+	ReasonPolicyDenied   = "policy_denied"  // 访问策略不允许
+
+	// 登录方式（login_success）
+	ReasonPassword     = "password"
+	ReasonTOTP         = "totp"
+	ReasonRecoveryCode = "recovery_code"
+	ReasonMFAEnrolled  = "mfa_enrolled" // 登录时完成强制绑定
+	ReasonSSO          = "sso"
+	ReasonSSOLinked    = "sso_linked" // 确认关联 SSO 身份后登录
+
+	// 登录与认证失败
+	ReasonInvalidCredentials = "invalid_credentials"
+	ReasonThrottled          = "throttled"
+	ReasonLocked             = "locked"
+	ReasonAccountDisabled    = "account_disabled"
+	ReasonAccountExpired     = "account_expired"
+	ReasonLoginHours         = "login_hours"
+	ReasonLoginIP            = "login_ip"
+	ReasonMFAPending         = "mfa_pending"         // 密码通过，等待二次验证
+	ReasonMFAEnrollRequired  = "mfa_enroll_required" // 密码通过，角色要求绑定二次验证
+	ReasonMFAInvalid         = "mfa_invalid"
+	ReasonIdPError           = "idp_error"         // IdP 回调携带 error
+	ReasonSSOFailed          = "sso_failed"        // 回调 / 断言校验失败
+	ReasonSSOLinkRequired    = "sso_link_required" // 同名账号待确认关联
+	ReasonNoRoleMatch        = "no_role_match"
+	ReasonTokenReuse         = "token_reuse"
+
+	// 管理操作
+	ReasonLogin       = "login"        // 在登录流程中完成（如强制绑定二次验证）
+	ReasonSelf        = "self"         // 由账号本人完成（如确认关联外部身份）
+	ReasonAllSessions = "all_sessions" // 吊销用户全部会话
+	ReasonExpired     = "expired"      // 账号到期自动停用
+	ReasonIdPMapping  = "idp_mapping"  // 按 IdP 映射同步
+	ReasonReactivated = "reactivated"  // SCIM 重新启用
+	ReasonNotFound    = "not_found"
+	ReasonConflict    = "conflict"
+	ReasonBuiltIn     = "builtin"
+	ReasonInvalid     = "invalid"
+	ReasonError       = "error" // 未归类的失败，原文见 Metadata.Error
+
+	// ReasonLegacy 迁移前的记录中无法解析的描述，原文保存在 Metadata.Message
+	ReasonLegacy = "legacy"
+)
+
+// 录像访问入口（access_denied 的 Metadata.Channel）
+const (
+	ChannelPlay      = "play"
+	ChannelPlayBatch = "play_batch"
+	ChannelStream    = "stream"
+)
+
+// Event 一条审计事件；展示给人看的描述由 Message 按 Action / Reason / Metadata 渲染，不入库
+type Event struct {
+	// Time 事件发生时间（异步写入时在入队时确定，落库为 created_at）
+	Time     time.Time
+	Action   string
+	Username string
+	Role     string
+	ClientIP string
+	Resource string
+	Status   string
+	Reason   string
+	Metadata Metadata
+	// APITokenID 经 API 令牌认证时记录令牌 ID
+	APITokenID *int64
+	// Impersonator 模拟登录期间的真实管理员，Username 为被模拟的用户
+	Impersonator string
+}
+
+// Metadata 审计事件的结构化附加信息（以 JSON 存储，字段均可选）
+type Metadata struct {
+	Count      int    `json:"count,omitempty"`       // 批量查询条数、服务器数、吊销会话数、成员数
+	Found      int    `json:"found,omitempty"`       // 批量查询找到的条数
+	Server     string `json:"server,omitempty"`      // 命中的 DVR 服务器（scheme://host）
+	Channel    string `json:"channel,omitempty"`     // 录像访问入口：play / play_batch / stream
+	DurationMS int64  `json:"duration_ms,omitempty"` // 耗时（毫秒）
+	Bytes      int64  `json:"bytes,omitempty"`       // 流代理传输字节数
+	ErrorCode  string `json:"error_code,omitempty"`  // 外部错误码（IdP error、SCIM scimType 等）
+	Error      string `json:"error,omitempty"`       // 错误原文
+	RetryAfter int    `json:"retry_after,omitempty"` // 登录限流剩余秒数
+
+	Role        string   `json:"role,omitempty"`
+	OldRole     string   `json:"old_role,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	Source      string   `json:"source,omitempty"`   // SSO 来源（oidc:<id> / saml:<id>）或提供商类型
+	Provider    string   `json:"provider,omitempty"` // 外部身份所属提供商
+	Subject     string   `json:"subject,omitempty"`  // 外部身份 subject / 访问策略主体
+	Target      string   `json:"target,omitempty"`   // 关联用户（组成员、令牌所属用户）或会话客户端 IP
+	Name        string   `json:"name,omitempty"`
+	OldName     string   `json:"old_name,omitempty"`
+	IdPGroup    string   `json:"idp_group,omitempty"`
+	Added       []string `json:"added,omitempty"`
+	Removed     []string `json:"removed,omitempty"`
+	Servers     []string `json:"servers,omitempty"`
+	GroupIDs    []int64  `json:"group_ids,omitempty"`
+	Patterns    []string `json:"patterns,omitempty"`
+	Scopes      []string `json:"scopes,omitempty"`
+	TokenID     int64    `json:"token_id,omitempty"`
+	ExternalID  string   `json:"external_id,omitempty"`
+	Enabled     *bool    `json:"enabled,omitempty"` // 启用状态（SSO 提供商、访问策略、SCIM active）
+	ExpiresAt   string   `json:"expires_at,omitempty"`
+	ExpiresIn   int64    `json:"expires_in,omitempty"` // 有效期（秒）
+	LoginHours  string   `json:"login_hours,omitempty"`
+	CIDRs       []string `json:"cidrs,omitempty"`
+	Note        string   `json:"note,omitempty"`   // 操作者填写的说明（停用原因、模拟登录原因）
+	Format      string   `json:"format,omitempty"` // 导出格式（csv / jsonl）
+	Filter      string   `json:"filter,omitempty"` // 导出的筛选条件（查询串）
+
+	// Message 迁移前记录的原始描述
+	Message string `json:"message,omitempty"`
+}
+
+// Bool 返回 b 的指针，用于 Metadata.Enabled
+func Bool(b bool) *bool {
+	return &b
+}
@@ -0,0 +1,101 @@
+package audit
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	legacyBatchRe    = regexp.MustCompile(`^批量查询 (\d+) 条，找到 (\d+) 条`)
+	legacyThrottleRe = regexp.MustCompile(`^登录受限，(\d+) 秒后可重试`)
+)
+
+var legacyChannels = map[string]string{
+	"录像查询":   ChannelPlay,
+	"批量录像查询": ChannelPlayBatch,
+	"流代理":    ChannelStream,
+}
+
+var legacyLoginReasons = map[string]string{}
+
+// 迁移前账号限制类失败的描述即错误原文
+var legacyFailReasons = map[string]string{
+	"账号已停用，请联系管理员":     ReasonAccountDisabled,
+	"账号已过期，请联系管理员":     ReasonAccountExpired,
+	"当前时段不允许登录":        ReasonLoginHours,
+	"当前网络不允许登录":        ReasonLoginIP,
+	"验证码错误":            ReasonMFAInvalid,
+	"账号不满足任何角色规则，拒绝登录": ReasonNoRoleMatch,
+	"该账号不属于任何已授权的目录组":  ReasonNoRoleMatch,
+}
+
+func init() {
+	for reason, label := range loginLabels {
+		legacyLoginReasons[label] = reason
+	}
+}
+
+// ParseLegacy 将迁移前的自由文本描述解析为事件的动作、原因码与结构化信息。
+// 旧版把流代理记为 play（描述以“流代理:”开头），迁移时改为 stream；
+// 无法识别的描述原文保存在 Metadata.Message，原因码为 legacy（失败时为 error，原文存入 Metadata.Error）。
+func ParseLegacy(action, status, detail string) (string, string, Metadata) {
+	var md Metadata
+	detail = strings.TrimSpace(detail)
+
+	switch action {
+	case "play", "stream":
+		if rest, ok := strings.CutPrefix(detail, "流代理:"); ok {
+			action, detail = "stream", strings.TrimSpace(rest)
+		}
+		switch detail {
+		case "录像已找到":
+			return action, ReasonRecordFound, md
+		case "录像未找到":
+			return action, ReasonRecordNotFound, md
+		}
+	case "play_batch":
+		if m := legacyBatchRe.FindStringSubmatch(detail); m != nil {
+			md.Count, _ = strconv.Atoi(m[1])
+			md.Found, _ = strconv.Atoi(m[2])
+			return action, ReasonBatchCompleted, md
+		}
+	case "access_denied":
+		if via, ok := strings.CutSuffix(detail, ": 访问策略不允许"); ok {
+			md.Channel = legacyChannels[via]
+			if md.Channel == "" {
+				md.Channel = via
+			}
+			return action, ReasonPolicyDenied, md
+		}
+	case "login_success":
+		if reason, ok := legacyLoginReasons[detail]; ok {
+			return action, reason, md
+		}
+	case "login_fail":
+		if detail == "登录失败" {
+			return action, ReasonInvalidCredentials, md
+		}
+		if m := legacyThrottleRe.FindStringSubmatch(detail); m != nil {
+			md.RetryAfter, _ = strconv.Atoi(m[1])
+			return action, ReasonThrottled, md
+		}
+		if detail == "IdP 身份未关联且用户名已被占用，等待确认关联" {
+			return action, ReasonSSOLinkRequired, md
+		}
+	case "account_locked":
+		return action, ReasonLocked, md
+	case "token_reuse":
+		return action, ReasonTokenReuse, md
+	}
+
+	if status == StatusFail {
+		md.Error = detail
+		if reason, ok := legacyFailReasons[detail]; ok {
+			return action, reason, md
+		}
+		return action, ReasonError, md
+	}
+	md.Message = detail
+	return action, ReasonLegacy, md
+}
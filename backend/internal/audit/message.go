@@ -0,0 +1,244 @@
+package audit
+
+import (
+	"fmt"
+	"strings"
+)
+
+var channelLabels = map[string]string{
+	ChannelPlay:      "录像查询",
+	ChannelPlayBatch: "批量录像查询",
+	ChannelStream:    "流代理",
+}
+
+var loginLabels = map[string]string{
+	ReasonPassword:     "登录成功",
+	ReasonTOTP:         "登录成功（TOTP）",
+	ReasonRecoveryCode: "登录成功（恢复码）",
+	ReasonMFAEnrolled:  "登录成功（绑定二次验证）",
+	ReasonSSO:          "SSO 登录成功",
+	ReasonSSOLinked:    "关联 SSO 身份后登录成功",
+}
+
+var simpleLabels = map[string]string{
+	"logout":                  "登出",
+	"impersonate_end":         "结束模拟登录",
+	"account_locked":          "连续登录失败，账号临时锁定",
+	"token_reuse":             "刷新令牌重放，令牌链已吊销",
+	"mfa_verify":              "二次验证通过",
+	"mfa_recovery_used":       "使用恢复码登录",
+	"mfa_disable":             "关闭二次验证",
+	"mfa_recovery_regenerate": "重新生成恢复码",
+	"mfa_reset":               "管理员重置二次验证",
+	"password_change":         "修改自己的密码",
+	"config_reload":           "重新加载配置",
+	"user_reset_password":     "重置密码",
+	"user_delete":             "删除用户",
+	"user_unlock":             "解除登录锁定",
+	"user_enable":             "启用账号",
+	"sso_update":              "更新 SSO 提供商",
+	"sso_delete":              "删除 SSO 提供商",
+	"role_delete":             "删除角色",
+	"dvr_group_delete":        "删除 DVR 分组",
+	"scim_user_deactivate":    "SCIM 停用账号，已吊销全部会话",
+	"scim_user_delete":        "SCIM 删除账号，已吊销全部会话",
+	"scim_group_delete":       "SCIM 删除用户组（管理员创建的组仅移除 SCIM 成员）",
+}
+
+// Message 渲染展示给人看的描述；失败事件优先展示错误原文，迁移前无法解析的记录展示原始描述
+func (e *Event) Message() string {
+	md := &e.Metadata
+	if md.Message != "" {
+		return md.Message
+	}
+	if s := e.outcomeMessage(); s != "" {
+		return s
+	}
+	if e.Status == StatusFail && md.Error != "" {
+		return md.Error
+	}
+	if s, ok := simpleLabels[e.Action]; ok {
+		return s
+	}
+	if s := e.adminMessage(); s != "" {
+		return s
+	}
+	if e.Status == StatusFail && e.Reason != "" {
+		return e.Reason
+	}
+	return ""
+}
+
+// outcomeMessage 录像查询、流代理与登录流程的描述
+func (e *Event) outcomeMessage() string {
+	md := &e.Metadata
+	switch e.Action {
+	case "play", "stream":
+		prefix := ""
+		if e.Action == "stream" {
+			prefix = "流代理: "
+		}
+		switch e.Reason {
+		case ReasonRecordFound:
+			return prefix + "录像已找到" + suffix(md)
+		case ReasonRecordNotFound:
+			return prefix + "录像未找到"
+		case ReasonUpstreamError:
+			return prefix + "拉取 DVR 视频失败" + suffix(md)
+		}
+	case "play_batch":
+		return fmt.Sprintf("批量查询 %d 条，找到 %d 条", md.Count, md.Found)
+	case "access_denied":
+		label := channelLabels[md.Channel]
+		if label == "" {
+			label = md.Channel
+		}
+		return label + ": 访问策略不允许"
+	case "login_success":
+		if s, ok := loginLabels[e.Reason]; ok {
+			return s
+		}
+	case "login_fail":
+		switch e.Reason {
+		case ReasonInvalidCredentials:
+			return "登录失败"
+		case ReasonThrottled:
+			return fmt.Sprintf("登录受限，%d 秒后可重试", md.RetryAfter)
+		case ReasonIdPError:
+			return md.ErrorCode + ": " + md.Error
+		case ReasonSSOLinkRequired:
+			return "IdP 身份未关联且用户名已被占用，等待确认关联"
+		}
+	case "mfa_challenge":
+		if e.Reason == ReasonMFAEnrollRequired {
+			return "密码验证通过，角色要求绑定二次验证"
+		}
+		return "密码验证通过，等待二次验证"
+	}
+	return ""
+}
+
+// adminMessage 管理操作的描述
+func (e *Event) adminMessage() string {
+	md := &e.Metadata
+	switch e.Action {
+	case "mfa_enroll":
+		if e.Reason == ReasonLogin {
+			return "登录时绑定二次验证"
+		}
+		return "启用二次验证"
+	case "api_token_create":
+		return fmt.Sprintf("创建 API 令牌 #%d（%v）", md.TokenID, md.Scopes)
+	case "api_token_revoke":
+		return fmt.Sprintf("吊销 API 令牌 #%d（所属用户 %s）", md.TokenID, md.Target)
+	case "config_save":
+		if e.Resource == "dvr_servers" {
+			return fmt.Sprintf("更新 DVR 服务器 %d 个", md.Count)
+		}
+		return "保存完整配置"
+	case "user_create":
+		return fmt.Sprintf("创建用户（角色=%s）", md.Role)
+	case "user_update_role":
+		if e.Reason == ReasonIdPMapping {
+			return fmt.Sprintf("IdP 角色映射：%s → %s", md.OldRole, md.Role)
+		}
+		return "修改角色为 " + md.Role
+	case "user_disable":
+		if e.Reason == ReasonExpired {
+			return "账号已到期，自动停用"
+		}
+		if md.Note != "" {
+			return "停用账号：" + md.Note
+		}
+		return "停用账号"
+	case "user_update_restrictions":
+		expires := md.ExpiresAt
+		if expires == "" {
+			expires = "长期"
+		}
+		return fmt.Sprintf("有效期=%s，登录时段=%s，来源网段=%v", expires, md.LoginHours, md.CIDRs)
+	case "session_revoke":
+		if e.Reason == ReasonAllSessions {
+			return fmt.Sprintf("吊销全部会话 %d 个", md.Count)
+		}
+		return "吊销会话（客户端 " + md.Target + "）"
+	case "impersonate_start":
+		return fmt.Sprintf("以 %s 身份登录，有效期 %d 分钟，原因：%s", e.Resource, md.ExpiresIn/60, md.Note)
+	case "identity_link":
+		if e.Reason == ReasonSelf {
+			return fmt.Sprintf("用户确认关联外部身份 %s（subject=%s）", md.Provider, md.Subject)
+		}
+		return fmt.Sprintf("管理员关联外部身份 %s（subject=%s）", md.Provider, md.Subject)
+	case "identity_unlink":
+		return fmt.Sprintf("解除外部身份 %s（subject=%s）", md.Provider, md.Subject)
+	case "sso_create":
+		return fmt.Sprintf("新建 SSO 提供商（%s）", md.Source)
+	case "sso_toggle":
+		if md.Enabled != nil && *md.Enabled {
+			return "已启用"
+		}
+		return "已停用"
+	case "role_create":
+		return "新建角色，权限: " + strings.Join(md.Permissions, ",")
+	case "role_update":
+		return "修改角色权限为: " + strings.Join(md.Permissions, ",")
+	case "dvr_group_create":
+		return fmt.Sprintf("新建 DVR 分组（%d 个服务器）", len(md.Servers))
+	case "dvr_group_update":
+		return "服务器: " + strings.Join(md.Servers, ", ")
+	case "access_policy_create", "access_policy_update", "access_policy_delete":
+		enabled := md.Enabled != nil && *md.Enabled
+		return fmt.Sprintf("主体 %s，DVR 分组 %v，录像模式 %v，启用 %t", md.Subject, md.GroupIDs, md.Patterns, enabled)
+	case "group_create":
+		return fmt.Sprintf("新建用户组（角色=%s，IdP 组=%s）", md.Role, md.IdPGroup)
+	case "group_update":
+		return fmt.Sprintf("角色 %s → %s，IdP 组=%s", md.OldRole, md.Role, md.IdPGroup)
+	case "group_delete":
+		return fmt.Sprintf("删除用户组（%d 名成员）", md.Count)
+	case "group_member_add":
+		return "添加成员 " + md.Target
+	case "group_member_remove":
+		return "移除成员 " + md.Target
+	case "group_sync":
+		return fmt.Sprintf("IdP 组同步：加入 %v，移出 %v", md.Added, md.Removed)
+	case "scim_user_create":
+		return fmt.Sprintf("SCIM 创建账号（externalId=%s，active=%t）", md.ExternalID, md.Enabled != nil && *md.Enabled)
+	case "scim_user_update":
+		if e.Reason == ReasonReactivated {
+			return "SCIM 重新启用账号"
+		}
+		return fmt.Sprintf("SCIM 更新账号（externalId=%s，active=%t）", md.ExternalID, md.Enabled != nil && *md.Enabled)
+	case "audit_export":
+		filter := md.Filter
+		if filter == "" {
+			filter = "全部"
+		}
+		return fmt.Sprintf("导出审计日志 %d 条（%s，筛选：%s）", md.Count, md.Format, filter)
+	case "scim_group_create":
+		return fmt.Sprintf("SCIM 创建用户组（%d 个成员）", md.Count)
+	case "scim_group_update":
+		if md.OldName != "" && md.OldName != md.Name {
+			return fmt.Sprintf("SCIM 更新用户组：名称 %s → %s，加入 %v，移出 %v", md.OldName, md.Name, md.Added, md.Removed)
+		}
+		return fmt.Sprintf("SCIM 更新用户组：加入 %v，移出 %v", md.Added, md.Removed)
+	}
+	return ""
+}
+
+// suffix 录像命中的服务器与耗时
+func suffix(md *Metadata) string {
+	var parts []string
+	if md.Server != "" {
+		parts = append(parts, "服务器 "+md.Server)
+	}
+	if md.Bytes > 0 {
+		parts = append(parts, fmt.Sprintf("%d 字节", md.Bytes))
+	}
+	if md.DurationMS > 0 {
+		parts = append(parts, fmt.Sprintf("耗时 %d ms", md.DurationMS))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "（" + strings.Join(parts, "，") + "）"
+}
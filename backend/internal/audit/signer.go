@@ -0,0 +1,113 @@
+package audit
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SigningKeyFileName 未配置 AUDIT_SIGNING_KEY 时自动生成的检查点签名密钥（位于 DATA_DIR 下）
+const SigningKeyFileName = "audit-signing.key"
+
+// Signer 检查点签名（Ed25519）；除自身公钥外，还信任 AUDIT_TRUSTED_KEYS 中的历史公钥
+type Signer struct {
+	priv    ed25519.PrivateKey
+	keyID   string
+	trusted map[string]ed25519.PublicKey
+}
+
+// LoadSigner 按 AUDIT_SIGNING_KEY（base64 编码的 32 字节种子）加载签名密钥；
+// 未配置时读取 DATA_DIR/audit-signing.key，不存在则生成（0600）。
+// 密钥应与数据库分开保管：能改库但拿不到密钥的人无法伪造检查点。
+func LoadSigner(dataDir string) (*Signer, error) {
+	seed, err := loadSeed(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	s := &Signer{priv: ed25519.NewKeyFromSeed(seed), trusted: map[string]ed25519.PublicKey{}}
+	pub := s.priv.Public().(ed25519.PublicKey)
+	s.keyID = KeyID(pub)
+	s.trusted[s.keyID] = pub
+	for _, v := range strings.Split(os.Getenv("AUDIT_TRUSTED_KEYS"), ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		b, err := base64.StdEncoding.DecodeString(v)
+		if err != nil || len(b) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("AUDIT_TRUSTED_KEYS: invalid Ed25519 public key %q", v)
+		}
+		s.trusted[KeyID(b)] = ed25519.PublicKey(b)
+	}
+	return s, nil
+}
+
+func loadSeed(dataDir string) ([]byte, error) {
+	if v := strings.TrimSpace(os.Getenv("AUDIT_SIGNING_KEY")); v != "" {
+		seed, err := base64.StdEncoding.DecodeString(v)
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, errors.New("AUDIT_SIGNING_KEY must be a base64-encoded 32-byte Ed25519 seed")
+		}
+		return seed, nil
+	}
+	path := filepath.Join(dataDir, SigningKeyFileName)
+	data, err := os.ReadFile(path)
+	if err == nil {
+		seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("%s: invalid audit signing key", path)
+		}
+		return seed, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("read audit signing key: %w", err)
+	}
+	seed := make([]byte, ed25519.SeedSize)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(seed)+"\n"), 0600); err != nil {
+		return nil, fmt.Errorf("write audit signing key: %w", err)
+	}
+	return seed, nil
+}
+
+// KeyID 公钥指纹（SHA-256 前 8 字节，十六进制）
+func KeyID(pub []byte) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// KeyID 当前签名密钥的指纹
+func (s *Signer) KeyID() string {
+	return s.keyID
+}
+
+// PublicKey 当前签名公钥（base64），可配置到其他实例的 AUDIT_TRUSTED_KEYS 中离线校验
+func (s *Signer) PublicKey() string {
+	return base64.StdEncoding.EncodeToString(s.priv.Public().(ed25519.PublicKey))
+}
+
+// Sign 对 payload 签名，返回 base64 签名
+func (s *Signer) Sign(payload []byte) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(s.priv, payload))
+}
+
+// Verify 用 keyID 对应的受信任公钥校验签名
+func (s *Signer) Verify(keyID string, payload []byte, sig string) bool {
+	pub, ok := s.trusted[keyID]
+	if !ok {
+		return false
+	}
+	b, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	return ed25519.Verify(pub, payload, b)
+}
@@ -0,0 +1,251 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 队列满时的处理策略
+const (
+	OverflowBlock = "block" // 调用方等待队列腾出空间（不丢审计，突发时请求变慢）
+	OverflowDrop  = "drop"  // 直接丢弃并计数（请求不受影响）
+)
+
+const (
+	DefaultQueueSize     = 10000
+	DefaultBatchSize     = 200
+	DefaultFlushInterval = time.Second
+)
+
+var (
+	// ErrQueueFull drop 策略下队列已满，事件被丢弃
+	ErrQueueFull = errors.New("审计队列已满，事件已丢弃")
+	// ErrWriterClosed 写入器已关闭（进程退出中）
+	ErrWriterClosed = errors.New("审计写入器已关闭")
+)
+
+// Sink 批量落库：一批事件在同一事务中写入
+type Sink interface {
+	InsertBatch(events []*Event) error
+}
+
+// WriterConfig 异步写入配置
+type WriterConfig struct {
+	QueueSize     int
+	BatchSize     int
+	FlushInterval time.Duration
+	Overflow      string
+}
+
+// WriterConfigFromEnv 读取 AUDIT_QUEUE_SIZE / AUDIT_BATCH_SIZE / AUDIT_FLUSH_INTERVAL / AUDIT_OVERFLOW
+func WriterConfigFromEnv() WriterConfig {
+	overflow := strings.ToLower(strings.TrimSpace(os.Getenv("AUDIT_OVERFLOW")))
+	switch overflow {
+	case OverflowBlock, OverflowDrop:
+	case "":
+		overflow = OverflowBlock
+	default:
+		log.Printf("[Audit] invalid AUDIT_OVERFLOW=%q, using %s", overflow, OverflowBlock)
+		overflow = OverflowBlock
+	}
+	return WriterConfig{
+		QueueSize:     intEnv("AUDIT_QUEUE_SIZE", DefaultQueueSize),
+		BatchSize:     intEnv("AUDIT_BATCH_SIZE", DefaultBatchSize),
+		FlushInterval: durationEnv("AUDIT_FLUSH_INTERVAL", DefaultFlushInterval),
+		Overflow:      overflow,
+	}
+}
+
+func intEnv(key string, def int) int {
+	s := strings.TrimSpace(os.Getenv(key))
+	if s == "" {
+		return def
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		log.Printf("[Audit] invalid %s=%q, using default %d", key, s, def)
+		return def
+	}
+	return n
+}
+
+func durationEnv(key string, def time.Duration) time.Duration {
+	s := strings.TrimSpace(os.Getenv(key))
+	if s == "" {
+		return def
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		log.Printf("[Audit] invalid %s=%q, using default %s", key, s, def)
+		return def
+	}
+	return d
+}
+
+// WriterStats 审计写入队列指标
+type WriterStats struct {
+	QueueDepth      int    `json:"queue_depth"`
+	QueueCapacity   int    `json:"queue_capacity"`
+	BatchSize       int    `json:"batch_size"`
+	FlushIntervalMS int64  `json:"flush_interval_ms"`
+	Overflow        string `json:"overflow"`
+	Enqueued        int64  `json:"enqueued"`
+	Written         int64  `json:"written"`
+	Dropped         int64  `json:"dropped"`
+	Failed          int64  `json:"failed"` // 批量写入失败而丢失的事件数
+	LastError       string `json:"last_error,omitempty"`
+}
+
+// Writer 异步批量审计写入器：有界队列 + 后台协程按条数或时间间隔批量落库，关闭时写完队列中剩余事件
+type Writer struct {
+	sink  Sink
+	cfg   WriterConfig
+	queue chan *Event
+	done  chan struct{}
+
+	mu     sync.RWMutex // 保护 closed，避免向已关闭的队列发送
+	closed bool
+
+	enqueued atomic.Int64
+	written  atomic.Int64
+	dropped  atomic.Int64
+	failed   atomic.Int64
+	lastErr  atomic.Value // string
+}
+
+// NewWriter 创建并启动写入器
+func NewWriter(sink Sink, cfg WriterConfig) *Writer {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = DefaultQueueSize
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultBatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = DefaultFlushInterval
+	}
+	if cfg.Overflow != OverflowDrop {
+		cfg.Overflow = OverflowBlock
+	}
+	w := &Writer{
+		sink:  sink,
+		cfg:   cfg,
+		queue: make(chan *Event, cfg.QueueSize),
+		done:  make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Enqueue 将事件放入队列；drop 策略下队列已满返回 ErrQueueFull
+func (w *Writer) Enqueue(e *Event) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		w.dropped.Add(1)
+		return ErrWriterClosed
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if w.cfg.Overflow == OverflowDrop {
+		select {
+		case w.queue <- e:
+		default:
+			if n := w.dropped.Add(1); n == 1 || n%1000 == 0 {
+				log.Printf("[Audit] queue full (%d), dropped %d events so far (AUDIT_OVERFLOW=drop)", w.cfg.QueueSize, n)
+			}
+			return ErrQueueFull
+		}
+	} else {
+		w.queue <- e
+	}
+	w.enqueued.Add(1)
+	return nil
+}
+
+// Close 停止接收新事件并写完队列中剩余事件；ctx 到期时返回 ctx.Err()（剩余事件仍在后台继续写入）
+func (w *Writer) Close(ctx context.Context) error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mu.Unlock()
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stats 当前队列指标
+func (w *Writer) Stats() WriterStats {
+	s := WriterStats{
+		QueueDepth:      len(w.queue),
+		QueueCapacity:   cap(w.queue),
+		BatchSize:       w.cfg.BatchSize,
+		FlushIntervalMS: w.cfg.FlushInterval.Milliseconds(),
+		Overflow:        w.cfg.Overflow,
+		Enqueued:        w.enqueued.Load(),
+		Written:         w.written.Load(),
+		Dropped:         w.dropped.Load(),
+		Failed:          w.failed.Load(),
+	}
+	if v, ok := w.lastErr.Load().(string); ok {
+		s.LastError = v
+	}
+	return s
+}
+
+func (w *Writer) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Event, 0, w.cfg.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := w.sink.InsertBatch(batch); err == nil {
+			w.written.Add(int64(len(batch)))
+		} else {
+			// 整批失败时逐条重试，只丢弃自身无法写入的事件
+			log.Printf("[Audit] batch insert of %d events failed, retrying one by one: %v", len(batch), err)
+			for _, e := range batch {
+				if err := w.sink.InsertBatch([]*Event{e}); err != nil {
+					w.failed.Add(1)
+					w.lastErr.Store(err.Error())
+					log.Printf("[Audit] dropped %s event of %q: %v", e.Action, e.Username, err)
+					continue
+				}
+				w.written.Add(1)
+			}
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case e, ok := <-w.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, e)
+			if len(batch) >= w.cfg.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
@@ -1,62 +1,121 @@
 package auth
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
-	"os"
+	"io"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-const defaultSecret = "dvr-manager-secret-key-change-in-production"
-
-// Claims JWT 载荷
+// Claims JWT 载荷（RegisteredClaims.ID 即 jti，每个令牌唯一）
 type Claims struct {
-	Username string `json:"username"`
-	Role     string `json:"role"`
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	SessionID string `json:"sid,omitempty"` // 服务端会话 ID，用于吊销校验
+	// Purpose 非空表示专用令牌（如二次验证挑战），不能作为访问令牌使用
+	Purpose string `json:"pur,omitempty"`
+	// Actor 模拟登录时实际操作的管理员（RFC 8693 act 声明），普通令牌为空
+	Actor *Actor `json:"act,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// JWT 签发与校验
+// Actor 模拟登录的真实操作者
+type Actor struct {
+	Subject string `json:"sub"` // 管理员用户名
+	UserID  int64  `json:"uid"`
+}
+
+// 专用令牌用途
+const (
+	PurposeMFA       = "mfa"        // 密码已通过，等待 TOTP / 恢复码
+	PurposeMFAEnroll = "mfa_enroll" // 角色强制二次验证但尚未绑定，等待绑定
+)
+
+// JWT 签发与校验。
+// HS256 模式使用单一共享密钥；非对称模式（RS256 / EdDSA）由 SetKeys 注入按 kid 区分的密钥集，
+// 当前密钥签发，密钥集内全部密钥（含轮换宽限期内的旧密钥）均可验签。
 type JWT struct {
 	secret []byte
+
+	mu     sync.RWMutex
+	active *SigningKey
+	keys   map[string]*SigningKey
 }
 
-// NewJWT 从环境变量或参数创建 JWT 服务
-func NewJWT(secret string) *JWT {
+// ErrEmptySecret HS256 密钥为空
+var ErrEmptySecret = errors.New("JWT HS256 secret must not be empty")
+
+// NewJWT 创建 HS256 JWT 服务；secret 须显式给出（通常来自 HMACSecret），为空时返回 ErrEmptySecret
+func NewJWT(secret string) (*JWT, error) {
 	if secret == "" {
-		secret = os.Getenv("JWT_SECRET")
+		return nil, ErrEmptySecret
 	}
-	if secret == "" {
-		secret = defaultSecret
+	return &JWT{secret: []byte(secret)}, nil
+}
+
+// NewAsymmetricJWT 创建非对称签名 JWT 服务；签发前须通过 SetKeys 注入密钥
+func NewAsymmetricJWT() *JWT {
+	return &JWT{keys: map[string]*SigningKey{}}
+}
+
+// SetKeys 替换签名密钥集：active 用于签发，verify 中全部密钥可用于验签
+func (j *JWT) SetKeys(active *SigningKey, verify []*SigningKey) {
+	keys := make(map[string]*SigningKey, len(verify)+1)
+	for _, k := range verify {
+		keys[k.KID] = k
+	}
+	if active != nil {
+		keys[active.KID] = active
+	}
+	j.mu.Lock()
+	j.active = active
+	j.keys = keys
+	j.mu.Unlock()
+}
+
+// Generate 签发令牌：补全 jti 与时间字段（保留 Subject），ttl 为有效期（见 LifetimesForRole）
+func (j *JWT) Generate(claims Claims, ttl time.Duration) (string, error) {
+	if ttl <= 0 {
+		ttl = DefaultAccessTokenTTL
 	}
-	return &JWT{secret: []byte(secret)}
+	jti, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		Subject:   claims.Subject,
+		ID:        jti,
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+	}
+	return j.sign(claims)
 }
 
-// Generate 签发 Token（24h）
-func (j *JWT) Generate(username, role string) (string, error) {
-	claims := Claims{
-		Username: username,
-		Role:     role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
-		},
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(j.secret)
+func (j *JWT) sign(claims jwt.Claims) (string, error) {
+	if j.secret != nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(j.secret)
+	}
+	j.mu.RLock()
+	key := j.active
+	j.mu.RUnlock()
+	if key == nil {
+		return "", errors.New("no active signing key")
+	}
+	token := jwt.NewWithClaims(key.method(), claims)
+	token.Header["kid"] = key.KID
+	return token.SignedString(key.Private)
 }
 
 // Verify 校验 Token
 func (j *JWT) Verify(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("invalid signing method")
-		}
-		return j.secret, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, j.keyFunc)
 	if err != nil {
 		return nil, err
 	}
@@ -66,6 +125,47 @@ func (j *JWT) Verify(tokenString string) (*Claims, error) {
 	return nil, errors.New("invalid token")
 }
 
+func (j *JWT) keyFunc(token *jwt.Token) (interface{}, error) {
+	if j.secret != nil {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("invalid signing method")
+		}
+		return j.secret, nil
+	}
+	kid, _ := token.Header["kid"].(string)
+	j.mu.RLock()
+	key := j.keys[kid]
+	j.mu.RUnlock()
+	if key == nil {
+		return nil, errors.New("unknown signing key")
+	}
+	if token.Method.Alg() != key.Alg {
+		return nil, errors.New("invalid signing method")
+	}
+	return key.Public, nil
+}
+
+// JWKS 公开验签密钥集（HS256 模式下为空）
+func (j *JWT) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	for _, k := range j.keys {
+		if jwk, ok := k.JWK(); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
+
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
 // ExtractBearer 从 Authorization 头提取 Bearer Token
 func ExtractBearer(header string) string {
 	header = strings.TrimSpace(header)
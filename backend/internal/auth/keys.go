@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// 支持的签名算法（JWT_ALG）
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+const (
+	DefaultKeyRotation    = 30 * 24 * time.Hour
+	DefaultKeyGracePeriod = 24 * time.Hour
+)
+
+// SigningKey 非对称签名密钥
+type SigningKey struct {
+	KID       string
+	Alg       string
+	Private   crypto.Signer
+	Public    crypto.PublicKey
+	CreatedAt time.Time
+}
+
+func (k *SigningKey) method() jwt.SigningMethod {
+	if k.Alg == AlgRS256 {
+		return jwt.SigningMethodRS256
+	}
+	return jwt.SigningMethodEdDSA
+}
+
+// JWK 单个 JSON Web Key（仅公钥）
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKSet /.well-known/jwks.json 响应体
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWK 导出公钥
+func (k *SigningKey) JWK() (JWK, bool) {
+	switch pub := k.Public.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA", Use: "sig", Alg: k.Alg, Kid: k.KID,
+			N: base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}, true
+	case ed25519.PublicKey:
+		return JWK{
+			Kty: "OKP", Use: "sig", Alg: k.Alg, Kid: k.KID,
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(pub),
+		}, true
+	}
+	return JWK{}, false
+}
+
+// GenerateSigningKey 生成新的签名密钥；kid 取公钥 SHA-256 前 16 字节
+func GenerateSigningKey(alg string) (*SigningKey, error) {
+	var priv crypto.Signer
+	switch alg {
+	case AlgRS256:
+		k, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		priv = k
+	case AlgEdDSA:
+		_, k, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		priv = k
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", alg)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(priv.Public())
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(pubDER)
+	return &SigningKey{
+		KID:       base64.RawURLEncoding.EncodeToString(sum[:16]),
+		Alg:       alg,
+		Private:   priv,
+		Public:    priv.Public(),
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// MarshalPrivateKeyPEM 私钥编码为 PKCS#8 PEM
+func MarshalPrivateKeyPEM(k *SigningKey) (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(k.Private)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+// ParseSigningKey 从 PKCS#8 PEM 还原签名密钥
+func ParseSigningKey(kid, alg, privatePEM string, createdAt time.Time) (*SigningKey, error) {
+	block, _ := pem.Decode([]byte(privatePEM))
+	if block == nil {
+		return nil, errors.New("invalid private key pem")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	priv, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported private key type")
+	}
+	switch priv.(type) {
+	case *rsa.PrivateKey:
+		if alg != AlgRS256 {
+			return nil, fmt.Errorf("key %s: algorithm mismatch", kid)
+		}
+	case ed25519.PrivateKey:
+		if alg != AlgEdDSA {
+			return nil, fmt.Errorf("key %s: algorithm mismatch", kid)
+		}
+	default:
+		return nil, errors.New("unsupported private key type")
+	}
+	return &SigningKey{KID: kid, Alg: alg, Private: priv, Public: priv.Public(), CreatedAt: createdAt}, nil
+}
+
+// SortKeysNewestFirst 按创建时间倒序排序
+func SortKeysNewestFirst(keys []*SigningKey) {
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.After(keys[j].CreatedAt) })
+}
+
+// SigningAlgorithm 签名算法（JWT_ALG），默认 EdDSA；非法值回退默认并返回错误
+func SigningAlgorithm() (string, error) {
+	v := strings.TrimSpace(os.Getenv("JWT_ALG"))
+	switch strings.ToUpper(v) {
+	case "":
+		return AlgEdDSA, nil
+	case "HS256":
+		return AlgHS256, nil
+	case "RS256":
+		return AlgRS256, nil
+	case "EDDSA", "ED25519":
+		return AlgEdDSA, nil
+	}
+	return AlgEdDSA, fmt.Errorf("unsupported JWT_ALG=%q (HS256 / RS256 / EdDSA)", v)
+}
+
+// defaultSecret 内置默认 HS256 密钥，仅在 JWT_ALLOW_DEFAULT_SECRET=true 时由 HMACSecret 返回
+const defaultSecret = "dvr-manager-secret-key-change-in-production"
+
+// HMACSecret HS256 模式的共享密钥。
+// JWT_SECRET 未设置或等于内置默认值时拒绝启动，除非显式设置 JWT_ALLOW_DEFAULT_SECRET=true。
+// insecure 为 true 表示正在使用默认密钥。
+func HMACSecret() (secret string, insecure bool, err error) {
+	secret = os.Getenv("JWT_SECRET")
+	if secret != "" && secret != defaultSecret {
+		return secret, false, nil
+	}
+	if allow, _ := strconv.ParseBool(os.Getenv("JWT_ALLOW_DEFAULT_SECRET")); allow {
+		return defaultSecret, true, nil
+	}
+	return "", false, errors.New("JWT_ALG=HS256 requires JWT_SECRET (default secret refused; set JWT_ALLOW_DEFAULT_SECRET=true to override)")
+}
+
+// KeyRotationInterval 签名密钥轮换周期（JWT_KEY_ROTATION，Go duration；0 关闭自动轮换）
+func KeyRotationInterval() time.Duration {
+	if v := strings.TrimSpace(os.Getenv("JWT_KEY_ROTATION")); v == "0" {
+		return 0
+	}
+	if d, ok := parseDurationEnv("JWT_KEY_ROTATION"); ok {
+		return d
+	}
+	return DefaultKeyRotation
+}
+
+// KeyGracePeriod 旧密钥轮换后继续用于验签的时长（JWT_KEY_GRACE），不短于访问令牌有效期
+func KeyGracePeriod() time.Duration {
+	if d, ok := parseDurationEnv("JWT_KEY_GRACE"); ok {
+		return d
+	}
+	return DefaultKeyGracePeriod
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAsymmetricJWTRotation(t *testing.T) {
+	for _, alg := range []string{AlgEdDSA, AlgRS256} {
+		oldKey, err := GenerateSigningKey(alg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		j := NewAsymmetricJWT()
+		j.SetKeys(oldKey, nil)
+		token, err := j.Generate(Claims{Username: "alice", Role: "user"}, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// 轮换后旧密钥仍在宽限期内，旧令牌可验签
+		newKey, err := GenerateSigningKey(alg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		j.SetKeys(newKey, []*SigningKey{oldKey})
+		if _, err := j.Verify(token); err != nil {
+			t.Fatalf("%s: token signed by retired key rejected during grace: %v", alg, err)
+		}
+		if n := len(j.JWKS().Keys); n != 2 {
+			t.Fatalf("%s: jwks keys = %d, want 2", alg, n)
+		}
+
+		// 宽限期结束，旧令牌失效
+		j.SetKeys(newKey, nil)
+		if _, err := j.Verify(token); err == nil {
+			t.Fatalf("%s: token signed by expired key accepted", alg)
+		}
+	}
+}
+
+func TestAsymmetricJWTRejectsHMAC(t *testing.T) {
+	key, err := GenerateSigningKey(AlgEdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j := NewAsymmetricJWT()
+	j.SetKeys(key, nil)
+	hmac, err := NewJWT("attacker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, err := hmac.Generate(Claims{Username: "admin", Role: "admin"}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := j.Verify(forged); err == nil {
+		t.Fatal("HS256 token accepted by asymmetric verifier")
+	}
+}
+
+// NewJWT 不再回退到 JWT_SECRET 或内置默认密钥
+func TestNewJWTRequiresSecret(t *testing.T) {
+	t.Setenv("JWT_SECRET", "from-env")
+	if _, err := NewJWT(""); !errors.Is(err, ErrEmptySecret) {
+		t.Fatalf("err=%v want ErrEmptySecret", err)
+	}
+}
+
+func TestPEMRoundTrip(t *testing.T) {
+	key, err := GenerateSigningKey(AlgEdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemStr, err := MarshalPrivateKeyPEM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseSigningKey(key.KID, AlgRS256, pemStr, key.CreatedAt); err == nil {
+		t.Fatal("algorithm mismatch not detected")
+	}
+	parsed, err := ParseSigningKey(key.KID, AlgEdDSA, pemStr, key.CreatedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j := NewAsymmetricJWT()
+	j.SetKeys(key, nil)
+	token, _ := j.Generate(Claims{Username: "bob"}, time.Minute)
+	j.SetKeys(parsed, nil)
+	if _, err := j.Verify(token); err != nil {
+		t.Fatalf("token rejected after reload: %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultAccessTokenTTL  = 15 * time.Minute
+	DefaultRefreshTokenTTL = 7 * 24 * time.Hour
+
+	DefaultImpersonationTTL = 15 * time.Minute
+	MaxImpersonationTTL     = time.Hour
+)
+
+// TokenLifetimes 访问令牌 / 刷新令牌有效期
+type TokenLifetimes struct {
+	Access  time.Duration
+	Refresh time.Duration
+}
+
+// LifetimesForRole 按角色返回令牌有效期。
+// 全局默认值由 ACCESS_TOKEN_TTL / REFRESH_TOKEN_TTL 配置（Go duration，如 15m、168h），
+// 角色级覆盖使用 ACCESS_TOKEN_TTL_<ROLE> / REFRESH_TOKEN_TTL_<ROLE>（如 ACCESS_TOKEN_TTL_ADMIN=5m）。
+func LifetimesForRole(role string) TokenLifetimes {
+	suffix := strings.ToUpper(strings.TrimSpace(role))
+	return TokenLifetimes{
+		Access:  durationEnv("ACCESS_TOKEN_TTL", suffix, DefaultAccessTokenTTL),
+		Refresh: durationEnv("REFRESH_TOKEN_TTL", suffix, DefaultRefreshTokenTTL),
+	}
+}
+
+// LifetimesForRoles 持有多个角色（含用户组授予的角色）时，访问令牌与刷新令牌分别取各角色中最短的有效期
+func LifetimesForRoles(roles []string) TokenLifetimes {
+	if len(roles) == 0 {
+		return LifetimesForRole("")
+	}
+	lt := LifetimesForRole(roles[0])
+	for _, role := range roles[1:] {
+		r := LifetimesForRole(role)
+		if r.Access < lt.Access {
+			lt.Access = r.Access
+		}
+		if r.Refresh < lt.Refresh {
+			lt.Refresh = r.Refresh
+		}
+	}
+	return lt
+}
+
+func durationEnv(name, roleSuffix string, def time.Duration) time.Duration {
+	if roleSuffix != "" {
+		if d, ok := parseDurationEnv(name + "_" + roleSuffix); ok {
+			return d
+		}
+	}
+	if d, ok := parseDurationEnv(name); ok {
+		return d
+	}
+	return def
+}
+
+func parseDurationEnv(key string) (time.Duration, bool) {
+	s := strings.TrimSpace(os.Getenv(key))
+	if s == "" {
+		return 0, false
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		log.Printf("[AUTH] invalid %s=%q, ignored", key, s)
+		return 0, false
+	}
+	return d, true
+}
+
+// ImpersonationTTL 模拟登录令牌有效期：IMPERSONATION_TTL（Go duration），最长 1 小时，不可刷新
+func ImpersonationTTL() time.Duration {
+	d, ok := parseDurationEnv("IMPERSONATION_TTL")
+	if !ok {
+		return DefaultImpersonationTTL
+	}
+	if d > MaxImpersonationTTL {
+		return MaxImpersonationTTL
+	}
+	return d
+}
+
+// MaxAccessTokenTTL 所有角色中最长的访问令牌有效期（含模拟登录令牌；签名密钥轮换宽限期不应短于此值）
+func MaxAccessTokenTTL() time.Duration {
+	max := LifetimesForRole("").Access
+	if d := ImpersonationTTL(); d > max {
+		max = d
+	}
+	for _, kv := range os.Environ() {
+		key, _, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(key, "ACCESS_TOKEN_TTL_") {
+			continue
+		}
+		if d, ok := parseDurationEnv(key); ok && d > max {
+			max = d
+		}
+	}
+	return max
+}
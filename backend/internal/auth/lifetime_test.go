@@ -0,0 +1,21 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLifetimesForRoles_shortestAcrossRoles(t *testing.T) {
+	t.Setenv("ACCESS_TOKEN_TTL", "15m")
+	t.Setenv("REFRESH_TOKEN_TTL", "168h")
+	t.Setenv("ACCESS_TOKEN_TTL_ADMIN", "5m")
+	t.Setenv("REFRESH_TOKEN_TTL_OPERATOR", "8h")
+
+	lt := LifetimesForRoles([]string{"user", "admin", "operator"})
+	if lt.Access != 5*time.Minute || lt.Refresh != 8*time.Hour {
+		t.Fatalf("lifetimes = %+v, want access 5m refresh 8h", lt)
+	}
+	if lt := LifetimesForRoles([]string{"user"}); lt.Access != 15*time.Minute || lt.Refresh != 168*time.Hour {
+		t.Fatalf("lifetimes = %+v, want defaults", lt)
+	}
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"dvr-manager/internal/config"
+)
+
+//go:embed common_passwords.txt
+var commonPasswordList string
+
+var commonPasswords = func() map[string]struct{} {
+	set := map[string]struct{}{}
+	for _, line := range strings.Split(commonPasswordList, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		set[strings.ToLower(line)] = struct{}{}
+	}
+	return set
+}()
+
+// ErrPasswordCommon 密码在常见弱密码列表中
+var ErrPasswordCommon = errors.New("密码过于常见，请更换")
+
+// IsCommonPassword 是否为内置列表中的常见弱密码（不区分大小写）
+func IsCommonPassword(password string) bool {
+	_, ok := commonPasswords[strings.ToLower(password)]
+	return ok
+}
+
+// ValidatePassword 按策略校验密码强度（不含历史密码检查）
+func ValidatePassword(policy config.PasswordPolicy, username, password string) error {
+	policy.Normalize()
+	if n := len([]rune(password)); n < policy.MinLength {
+		return fmt.Errorf("密码长度至少 %d 位", policy.MinLength)
+	}
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case !unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	var missing []string
+	if policy.RequireUpper && !upper {
+		missing = append(missing, "大写字母")
+	}
+	if policy.RequireLower && !lower {
+		missing = append(missing, "小写字母")
+	}
+	if policy.RequireDigit && !digit {
+		missing = append(missing, "数字")
+	}
+	if policy.RequireSymbol && !symbol {
+		missing = append(missing, "特殊字符")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("密码须包含%s", strings.Join(missing, "、"))
+	}
+	if policy.DisallowUsername {
+		if u := strings.ToLower(strings.TrimSpace(username)); u != "" && strings.Contains(strings.ToLower(password), u) {
+			return errors.New("密码不能包含用户名")
+		}
+	}
+	if policy.DisallowCommon && IsCommonPassword(password) {
+		return ErrPasswordCommon
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"testing"
+
+	"dvr-manager/internal/config"
+)
+
+func TestValidatePassword(t *testing.T) {
+	policy := config.PasswordPolicy{
+		MinLength:        8,
+		RequireUpper:     true,
+		RequireDigit:     true,
+		DisallowCommon:   true,
+		DisallowUsername: true,
+	}
+	cases := []struct {
+		password string
+		ok       bool
+	}{
+		{"Short1", false},
+		{"alllowercase1", false},
+		{"NoDigitsHere", false},
+		{"Alice2026x", false}, // 含用户名
+		{"P@ssw0rd", false},   // 常见弱密码
+		{"Correct7Horse", true},
+	}
+	for _, tc := range cases {
+		err := ValidatePassword(policy, "alice", tc.password)
+		if (err == nil) != tc.ok {
+			t.Errorf("%q: err=%v want ok=%v", tc.password, err, tc.ok)
+		}
+	}
+}
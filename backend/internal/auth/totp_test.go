@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// RFC 6238 附录 B 测试向量（SHA1，取低 6 位）
+func TestTOTPCode_RFC6238(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	cases := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tc := range cases {
+		got, err := TOTPCode(secret, TOTPStep(time.Unix(tc.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Fatalf("t=%d code=%s want %s", tc.unix, got, tc.want)
+		}
+	}
+}
+
+func TestValidateTOTP_skew(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	prev, _ := TOTPCode(secret, TOTPStep(now)-1)
+	if step, ok := ValidateTOTP(secret, prev, now); !ok || step != TOTPStep(now)-1 {
+		t.Fatalf("previous step rejected: ok=%v step=%d", ok, step)
+	}
+	old, _ := TOTPCode(secret, TOTPStep(now)-3)
+	if _, ok := ValidateTOTP(secret, old, now); ok {
+		t.Fatal("code outside skew window accepted")
+	}
+}
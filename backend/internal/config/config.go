@@ -10,11 +10,12 @@ import (
 
 // Config 配置结构
 type Config struct {
-	Server             ServerConfig `json:"server"`
-	DVR                DVRConfig    `json:"dvr"`
-	DVRServers         []string     `json:"dvr_servers"`
-	CORS               CORSConfig   `json:"cors"`
-	RequireAuthForPlay bool         `json:"require_auth_for_play"`
+	Server             ServerConfig   `json:"server"`
+	DVR                DVRConfig      `json:"dvr"`
+	DVRServers         []string       `json:"dvr_servers"`
+	CORS               CORSConfig     `json:"cors"`
+	RequireAuthForPlay bool           `json:"require_auth_for_play"`
+	PasswordPolicy     PasswordPolicy `json:"password_policy"`
 }
 
 // ServerConfig 服务器配置
@@ -38,6 +39,61 @@ type CORSConfig struct {
 	AllowHeaders string `json:"allow_headers"`
 }
 
+// PasswordPolicy 本地账号密码策略
+type PasswordPolicy struct {
+	MinLength        int  `json:"min_length"`
+	RequireUpper     bool `json:"require_upper"`
+	RequireLower     bool `json:"require_lower"`
+	RequireDigit     bool `json:"require_digit"`
+	RequireSymbol    bool `json:"require_symbol"`
+	DisallowCommon   bool `json:"disallow_common"`   // 禁止常见弱密码（内置列表）
+	DisallowUsername bool `json:"disallow_username"` // 禁止包含用户名
+	HistorySize      int  `json:"history_size"`      // 禁止重复使用最近 N 次的密码（含当前密码），0 不限制
+	MaxAgeDays       int  `json:"max_age_days"`      // 密码最长有效天数，到期后下次登录须修改，0 不限制
+}
+
+// 密码策略取值范围
+const (
+	MinPasswordLength     = 6
+	MaxPasswordHistory    = 24
+	DefaultPasswordLength = 8
+)
+
+// DefaultPasswordPolicy 默认密码策略
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:        DefaultPasswordLength,
+		DisallowCommon:   true,
+		DisallowUsername: true,
+		HistorySize:      5,
+	}
+}
+
+// Normalize 将越界取值修正到允许范围
+func (p *PasswordPolicy) Normalize() {
+	if p.MinLength < MinPasswordLength {
+		p.MinLength = MinPasswordLength
+	}
+	if p.HistorySize < 0 {
+		p.HistorySize = 0
+	}
+	if p.HistorySize > MaxPasswordHistory {
+		p.HistorySize = MaxPasswordHistory
+	}
+	if p.MaxAgeDays < 0 {
+		p.MaxAgeDays = 0
+	}
+}
+
+// CurrentPasswordPolicy 当前生效的密码策略（未加载配置时为默认策略）
+func CurrentPasswordPolicy() PasswordPolicy {
+	cfg := GetConfig()
+	if cfg == nil {
+		return DefaultPasswordPolicy()
+	}
+	return cfg.PasswordPolicy
+}
+
 var (
 	mu           sync.RWMutex
 	globalConfig *Config
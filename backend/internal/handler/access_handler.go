@@ -0,0 +1,237 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"dvr-manager/internal/audit"
+	"dvr-manager/internal/repository"
+	"dvr-manager/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// callerScope 当前调用方（未登录时为匿名）的访问范围；查询失败时返回 500
+func callerScope(c *gin.Context, access service.AccessService) (*service.AccessScope, bool) {
+	if access == nil {
+		return nil, true
+	}
+	userID, _ := c.Get("user_id")
+	id, _ := userID.(int64)
+	scope, err := access.ScopeFor(id)
+	if err != nil {
+		log.Printf("[ERROR] 加载访问策略失败 - 用户 ID: %d, Error: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "加载访问策略失败"})
+		return nil, false
+	}
+	return scope, true
+}
+
+// auditAccessDenied 记录访问策略拒绝；channel 为访问入口（audit.Channel*）
+func auditAccessDenied(c *gin.Context, auditRepo repository.AuditRepository, recordID, channel string) {
+	if auditRepo == nil {
+		return
+	}
+	_ = auditRepo.Insert(newAuditEvent(c, "access_denied", recordID, audit.StatusFail, audit.ReasonPolicyDenied,
+		audit.Metadata{Channel: channel}))
+}
+
+// AccessHandler DVR 分组与访问策略管理
+type AccessHandler struct {
+	accessService service.AccessService
+	auditRepo     repository.AuditRepository
+}
+
+// NewAccessHandler 创建访问策略管理处理器
+func NewAccessHandler(accessService service.AccessService, auditRepo repository.AuditRepository) *AccessHandler {
+	return &AccessHandler{accessService: accessService, auditRepo: auditRepo}
+}
+
+// DVRGroupRequest 新建 / 更新 DVR 分组
+type DVRGroupRequest struct {
+	Name        string   `json:"name" binding:"required"`
+	Description string   `json:"description"`
+	Servers     []string `json:"servers" binding:"required"`
+}
+
+// AccessPolicyRequest 新建 / 更新访问策略；dvr_group_ids、record_patterns 为空表示不限
+type AccessPolicyRequest struct {
+	Name           string   `json:"name" binding:"required"`
+	SubjectType    string   `json:"subject_type" binding:"required"` // user / group / anonymous
+	SubjectID      int64    `json:"subject_id"`
+	DVRGroupIDs    []int64  `json:"dvr_group_ids"`
+	RecordPatterns []string `json:"record_patterns"`
+	Enabled        bool     `json:"enabled"`
+}
+
+// accessErrorStatus 访问策略操作错误对应的状态码
+func accessErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, repository.ErrDVRGroupNotFound), errors.Is(err, repository.ErrAccessPolicyNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, repository.ErrDVRGroupExists):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+func parseAccessID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "无效的 ID"})
+		return 0, false
+	}
+	return id, true
+}
+
+// ListGroups GET /api/admin/dvr-groups
+func (h *AccessHandler) ListGroups(c *gin.Context) {
+	list, err := h.accessService.ListGroups()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "list": list})
+}
+
+// CreateGroup POST /api/admin/dvr-groups
+func (h *AccessHandler) CreateGroup(c *gin.Context) {
+	var req DVRGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "请求参数错误"})
+		return
+	}
+	g, err := h.accessService.CreateGroup(req.Name, req.Description, req.Servers)
+	if err != nil {
+		auditFailure(h.auditRepo, c, "dvr_group_create", req.Name, err)
+		c.JSON(accessErrorStatus(err), gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	auditSuccess(h.auditRepo, c, "dvr_group_create", g.Name, audit.ReasonOK, audit.Metadata{Servers: g.Servers})
+	c.JSON(http.StatusOK, gin.H{"success": true, "group": g})
+}
+
+// UpdateGroup PUT /api/admin/dvr-groups/:id
+func (h *AccessHandler) UpdateGroup(c *gin.Context) {
+	id, ok := parseAccessID(c)
+	if !ok {
+		return
+	}
+	var req DVRGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "请求参数错误"})
+		return
+	}
+	g, err := h.accessService.UpdateGroup(id, req.Name, req.Description, req.Servers)
+	if err != nil {
+		auditFailure(h.auditRepo, c, "dvr_group_update", req.Name, err)
+		c.JSON(accessErrorStatus(err), gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	auditSuccess(h.auditRepo, c, "dvr_group_update", g.Name, audit.ReasonOK, audit.Metadata{Servers: g.Servers})
+	c.JSON(http.StatusOK, gin.H{"success": true, "group": g})
+}
+
+// DeleteGroup DELETE /api/admin/dvr-groups/:id
+func (h *AccessHandler) DeleteGroup(c *gin.Context) {
+	id, ok := parseAccessID(c)
+	if !ok {
+		return
+	}
+	g, err := h.accessService.DeleteGroup(id)
+	if err != nil {
+		auditFailure(h.auditRepo, c, "dvr_group_delete", c.Param("id"), err)
+		c.JSON(accessErrorStatus(err), gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	auditSuccess(h.auditRepo, c, "dvr_group_delete", g.Name, audit.ReasonOK, audit.Metadata{})
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// ListPolicies GET /api/admin/access-policies
+func (h *AccessHandler) ListPolicies(c *gin.Context) {
+	list, err := h.accessService.ListPolicies()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "list": list})
+}
+
+func (req *AccessPolicyRequest) policy(id int64) *repository.AccessPolicy {
+	return &repository.AccessPolicy{
+		ID:             id,
+		Name:           req.Name,
+		SubjectType:    req.SubjectType,
+		SubjectID:      req.SubjectID,
+		DVRGroupIDs:    req.DVRGroupIDs,
+		RecordPatterns: req.RecordPatterns,
+		Enabled:        req.Enabled,
+	}
+}
+
+// policyMetadata 访问策略审计信息
+func policyMetadata(p *repository.AccessPolicy) audit.Metadata {
+	subject := p.SubjectType
+	if p.SubjectName != "" {
+		subject += ":" + p.SubjectName
+	}
+	return audit.Metadata{Subject: subject, GroupIDs: p.DVRGroupIDs, Patterns: p.RecordPatterns, Enabled: audit.Bool(p.Enabled)}
+}
+
+// CreatePolicy POST /api/admin/access-policies
+func (h *AccessHandler) CreatePolicy(c *gin.Context) {
+	var req AccessPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "请求参数错误"})
+		return
+	}
+	p, err := h.accessService.CreatePolicy(req.policy(0))
+	if err != nil {
+		auditFailure(h.auditRepo, c, "access_policy_create", req.Name, err)
+		c.JSON(accessErrorStatus(err), gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	auditSuccess(h.auditRepo, c, "access_policy_create", p.Name, audit.ReasonOK, policyMetadata(p))
+	c.JSON(http.StatusOK, gin.H{"success": true, "policy": p})
+}
+
+// UpdatePolicy PUT /api/admin/access-policies/:id
+func (h *AccessHandler) UpdatePolicy(c *gin.Context) {
+	id, ok := parseAccessID(c)
+	if !ok {
+		return
+	}
+	var req AccessPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "请求参数错误"})
+		return
+	}
+	p, err := h.accessService.UpdatePolicy(req.policy(id))
+	if err != nil {
+		auditFailure(h.auditRepo, c, "access_policy_update", req.Name, err)
+		c.JSON(accessErrorStatus(err), gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	auditSuccess(h.auditRepo, c, "access_policy_update", p.Name, audit.ReasonOK, policyMetadata(p))
+	c.JSON(http.StatusOK, gin.H{"success": true, "policy": p})
+}
+
+// DeletePolicy DELETE /api/admin/access-policies/:id
+func (h *AccessHandler) DeletePolicy(c *gin.Context) {
+	id, ok := parseAccessID(c)
+	if !ok {
+		return
+	}
+	p, err := h.accessService.DeletePolicy(id)
+	if err != nil {
+		auditFailure(h.auditRepo, c, "access_policy_delete", c.Param("id"), err)
+		c.JSON(accessErrorStatus(err), gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	auditSuccess(h.auditRepo, c, "access_policy_delete", p.Name, audit.ReasonOK, policyMetadata(p))
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
@@ -1,11 +1,12 @@
 package handler
 
 import (
-	"fmt"
 	"log"
 	"net/http"
 	"time"
 
+	"dvr-manager/internal/audit"
+	"dvr-manager/internal/config"
 	"dvr-manager/internal/repository"
 	"dvr-manager/internal/service"
 
@@ -88,11 +89,7 @@ func (h *AdminHandler) UpdateDVRServers(c *gin.Context) {
 	}
 
 	if h.auditRepo != nil {
-		username, _ := c.Get("username")
-		userStr, _ := username.(string)
-		role, _ := c.Get("role")
-		roleStr, _ := role.(string)
-		_ = h.auditRepo.Insert("config_save", userStr, roleStr, c.ClientIP(), "dvr_servers", fmt.Sprintf("更新 DVR 服务器 %d 个", len(req.Servers)), "success")
+		_ = h.auditRepo.Insert(newAuditEvent(c, "config_save", "dvr_servers", audit.StatusSuccess, audit.ReasonOK, audit.Metadata{Count: len(req.Servers)}))
 	}
 	log.Printf("[INFO] DVR 服务器列表已更新 - IP: %s, 数量: %d", c.ClientIP(), len(req.Servers))
 	c.JSON(http.StatusOK, UpdateDVRServersResponse{
@@ -122,11 +119,12 @@ func (h *AdminHandler) GetConfig(c *gin.Context) {
 
 // UpdateConfigRequest 更新配置请求
 type UpdateConfigRequest struct {
-	Server             interface{} `json:"server"`
-	DVR                interface{} `json:"dvr"`
-	DVRServers         []string    `json:"dvr_servers"`
-	CORS               interface{} `json:"cors"`
-	RequireAuthForPlay *bool       `json:"require_auth_for_play"`
+	Server             interface{}            `json:"server"`
+	DVR                interface{}            `json:"dvr"`
+	DVRServers         []string               `json:"dvr_servers"`
+	CORS               interface{}            `json:"cors"`
+	RequireAuthForPlay *bool                  `json:"require_auth_for_play"`
+	PasswordPolicy     *config.PasswordPolicy `json:"password_policy"`
 }
 
 // UpdateConfig 更新完整配置
@@ -206,6 +204,12 @@ func (h *AdminHandler) UpdateConfig(c *gin.Context) {
 		cfg.RequireAuthForPlay = *req.RequireAuthForPlay
 	}
 
+	// 更新密码策略（越界取值自动修正）
+	if req.PasswordPolicy != nil {
+		cfg.PasswordPolicy = *req.PasswordPolicy
+		cfg.PasswordPolicy.Normalize()
+	}
+
 	// 保存配置
 	if err := h.configService.UpdateConfig(cfg); err != nil {
 		log.Printf("[ERROR] 更新配置失败 - IP: %s, Error: %v", c.ClientIP(), err)
@@ -217,11 +221,7 @@ func (h *AdminHandler) UpdateConfig(c *gin.Context) {
 	}
 
 	if h.auditRepo != nil {
-		username, _ := c.Get("username")
-		userStr, _ := username.(string)
-		role, _ := c.Get("role")
-		roleStr, _ := role.(string)
-		_ = h.auditRepo.Insert("config_save", userStr, roleStr, c.ClientIP(), "config", "保存完整配置", "success")
+		_ = h.auditRepo.Insert(newAuditEvent(c, "config_save", "config", audit.StatusSuccess, audit.ReasonOK, audit.Metadata{}))
 	}
 	log.Printf("[INFO] 配置已更新 - IP: %s", c.ClientIP())
 	c.JSON(http.StatusOK, gin.H{
@@ -241,11 +241,7 @@ func (h *AdminHandler) ReloadConfig(c *gin.Context) {
 		return
 	}
 	if h.auditRepo != nil {
-		username, _ := c.Get("username")
-		userStr, _ := username.(string)
-		role, _ := c.Get("role")
-		roleStr, _ := role.(string)
-		_ = h.auditRepo.Insert("config_reload", userStr, roleStr, c.ClientIP(), "", "重新加载配置", "success")
+		_ = h.auditRepo.Insert(newAuditEvent(c, "config_reload", "", audit.StatusSuccess, audit.ReasonOK, audit.Metadata{}))
 	}
 	log.Printf("[INFO] 配置已重新加载 - IP: %s", c.ClientIP())
 	c.JSON(http.StatusOK, gin.H{
@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"dvr-manager/internal/audit"
+	"dvr-manager/internal/repository"
+	"dvr-manager/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APITokenHandler 个人访问令牌 / 服务 API Key
+type APITokenHandler struct {
+	authService  service.AuthService
+	tokenService service.APITokenService
+	auditRepo    repository.AuditRepository
+}
+
+// NewAPITokenHandler 创建 API 令牌处理器
+func NewAPITokenHandler(authService service.AuthService, tokenService service.APITokenService, auditRepo repository.AuditRepository) *APITokenHandler {
+	return &APITokenHandler{authService: authService, tokenService: tokenService, auditRepo: auditRepo}
+}
+
+// CreateAPITokenRequest 创建 API 令牌请求；expires_in_days 为 0 表示永不过期
+type CreateAPITokenRequest struct {
+	Name          string   `json:"name" binding:"required"`
+	Scopes        []string `json:"scopes" binding:"required"`
+	ExpiresInDays int      `json:"expires_in_days" binding:"min=0,max=3650"`
+}
+
+// ListMine 当前用户的令牌
+func (h *APITokenHandler) ListMine(c *gin.Context) {
+	list, err := h.tokenService.List(c.GetInt64("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "list": list, "scopes": service.AllScopes()})
+}
+
+// Create 为当前用户创建令牌；明文令牌仅在响应中返回一次
+func (h *APITokenHandler) Create(c *gin.Context) {
+	var req CreateAPITokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "请求参数错误"})
+		return
+	}
+	user, err := h.authService.GetUserByID(c.GetInt64("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	var expiresAt *time.Time
+	if req.ExpiresInDays > 0 {
+		t := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		expiresAt = &t
+	}
+	t, raw, err := h.tokenService.Create(user, req.Name, req.Scopes, expiresAt)
+	if err != nil {
+		auditFailure(h.auditRepo, c, "api_token_create", req.Name, err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	auditSuccess(h.auditRepo, c, "api_token_create", req.Name, audit.ReasonOK, audit.Metadata{TokenID: t.ID, Scopes: t.Scopes})
+	c.JSON(http.StatusOK, gin.H{"success": true, "token": raw, "api_token": t})
+}
+
+// RevokeMine 吊销当前用户自己的令牌
+func (h *APITokenHandler) RevokeMine(c *gin.Context) {
+	h.revoke(c, c.GetInt64("user_id"))
+}
+
+// ListAll 全部用户的令牌（管理员）
+func (h *APITokenHandler) ListAll(c *gin.Context) {
+	list, err := h.tokenService.List(0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "list": list})
+}
+
+// Revoke 吊销任意令牌（管理员）
+func (h *APITokenHandler) Revoke(c *gin.Context) {
+	h.revoke(c, 0)
+}
+
+// revoke ownerID 非 0 时仅允许吊销该用户的令牌
+func (h *APITokenHandler) revoke(c *gin.Context, ownerID int64) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "无效的令牌 ID"})
+		return
+	}
+	t, err := h.tokenService.Get(id)
+	if err != nil || (ownerID != 0 && t.UserID != ownerID) {
+		if err == nil || errors.Is(err, repository.ErrAPITokenNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"success": false, "message": repository.ErrAPITokenNotFound.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	if _, err := h.tokenService.Revoke(id); err != nil {
+		auditFailure(h.auditRepo, c, "api_token_revoke", t.Name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	auditSuccess(h.auditRepo, c, "api_token_revoke", t.Name, audit.ReasonOK, audit.Metadata{TokenID: t.ID, Target: t.Username})
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"dvr-manager/internal/audit"
+	"dvr-manager/internal/repository"
+	"dvr-manager/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newAuditEvent 按当前请求的认证信息构造审计事件（用户、角色、客户端 IP、API 令牌；
+// 模拟登录会话同时记录被模拟的用户与真实管理员）
+func newAuditEvent(c *gin.Context, action, resource, status, reason string, md audit.Metadata) *audit.Event {
+	e := &audit.Event{
+		Action:       action,
+		Username:     c.GetString("username"),
+		Role:         c.GetString("role"),
+		ClientIP:     c.ClientIP(),
+		Resource:     resource,
+		Status:       status,
+		Reason:       reason,
+		Metadata:     md,
+		Impersonator: c.GetString("impersonator"),
+	}
+	if id, ok := c.Get("api_token_id"); ok {
+		if tokenID, ok := id.(int64); ok {
+			e.APITokenID = &tokenID
+		}
+	}
+	return e
+}
+
+// newLoginEvent 登录流程（请求尚未认证）的审计事件，用户名与角色由调用方给出
+func newLoginEvent(c *gin.Context, action, username, role, resource, status, reason string, md audit.Metadata) *audit.Event {
+	return &audit.Event{
+		Action:   action,
+		Username: username,
+		Role:     role,
+		ClientIP: c.ClientIP(),
+		Resource: resource,
+		Status:   status,
+		Reason:   reason,
+		Metadata: md,
+	}
+}
+
+// auditSuccess 记录当前请求的成功操作
+func auditSuccess(repo repository.AuditRepository, c *gin.Context, action, resource, reason string, md audit.Metadata) {
+	if repo == nil {
+		return
+	}
+	_ = repo.Insert(newAuditEvent(c, action, resource, audit.StatusSuccess, reason, md))
+}
+
+// auditFailure 记录当前请求的失败操作；原因码由错误类型得出，错误原文存入 metadata
+func auditFailure(repo repository.AuditRepository, c *gin.Context, action, resource string, err error) {
+	if repo == nil {
+		return
+	}
+	_ = repo.Insert(newAuditEvent(c, action, resource, audit.StatusFail, failureReason(err), failureMetadata(err)))
+}
+
+// failureMetadata 错误原文；SCIM 错误同时记录 scimType
+func failureMetadata(err error) audit.Metadata {
+	md := audit.Metadata{Error: err.Error()}
+	var se *service.SCIMError
+	if errors.As(err, &se) {
+		md.ErrorCode = se.Type
+	}
+	return md
+}
+
+// failureReason 错误对应的审计原因码
+func failureReason(err error) string {
+	switch {
+	case errors.Is(err, service.ErrAccountDisabled):
+		return audit.ReasonAccountDisabled
+	case errors.Is(err, service.ErrAccountExpired):
+		return audit.ReasonAccountExpired
+	case errors.Is(err, service.ErrLoginHoursForbidden):
+		return audit.ReasonLoginHours
+	case errors.Is(err, service.ErrLoginIPForbidden):
+		return audit.ReasonLoginIP
+	case errors.Is(err, service.ErrLoginThrottled):
+		return audit.ReasonThrottled
+	case errors.Is(err, service.ErrMFACodeInvalid), errors.Is(err, service.ErrMFAChallengeInvalid):
+		return audit.ReasonMFAInvalid
+	case errors.Is(err, service.ErrLDAPInvalidCredentials), errors.Is(err, service.ErrLDAPUserNotFound):
+		return audit.ReasonInvalidCredentials
+	case errors.Is(err, service.ErrSSONoRoleMatch), errors.Is(err, service.ErrLDAPNoRole):
+		return audit.ReasonNoRoleMatch
+	case errors.Is(err, service.ErrSSOLinkInvalid), errors.Is(err, service.ErrOIDCFlowInvalid):
+		return audit.ReasonSSOFailed
+	case errors.Is(err, service.ErrRefreshTokenReused):
+		return audit.ReasonTokenReuse
+	case errors.Is(err, service.ErrRoleBuiltIn):
+		return audit.ReasonBuiltIn
+	case errors.Is(err, service.ErrRoleInvalid), errors.Is(err, service.ErrAPITokenScope):
+		return audit.ReasonInvalid
+	case errors.Is(err, repository.ErrUserNotFound), errors.Is(err, repository.ErrRoleNotFound),
+		errors.Is(err, repository.ErrGroupNotFound), errors.Is(err, repository.ErrDVRGroupNotFound),
+		errors.Is(err, repository.ErrAccessPolicyNotFound), errors.Is(err, repository.ErrSSOProviderNotFound),
+		errors.Is(err, repository.ErrIdentityNotFound), errors.Is(err, repository.ErrAPITokenNotFound),
+		errors.Is(err, repository.ErrSessionNotFound):
+		return audit.ReasonNotFound
+	case errors.Is(err, repository.ErrUserExists), errors.Is(err, repository.ErrRoleExists),
+		errors.Is(err, repository.ErrGroupExists), errors.Is(err, repository.ErrDVRGroupExists),
+		errors.Is(err, repository.ErrIdentityExists):
+		return audit.ReasonConflict
+	}
+	var se *service.SCIMError
+	if errors.As(err, &se) {
+		switch {
+		case se.Type == "uniqueness":
+			return audit.ReasonConflict
+		case se.Status == http.StatusNotFound:
+			return audit.ReasonNotFound
+		}
+		return audit.ReasonInvalid
+	}
+	return audit.ReasonError
+}
@@ -1,23 +1,36 @@
 package handler
 
 import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"log"
+	"mime"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"dvr-manager/internal/audit"
 	"dvr-manager/internal/repository"
+	"dvr-manager/internal/service"
 
 	"github.com/gin-gonic/gin"
 )
 
 // AuditHandler 审计查询处理器
 type AuditHandler struct {
-	auditRepo repository.AuditRepository
+	auditRepo   repository.AuditRepository
+	auditWriter *audit.Writer
+	archives    service.AuditArchiveService
+	chain       service.AuditChainService
 }
 
-// NewAuditHandler 创建审计处理器
-func NewAuditHandler(auditRepo repository.AuditRepository) *AuditHandler {
-	return &AuditHandler{auditRepo: auditRepo}
+// NewAuditHandler 创建审计处理器；auditWriter 为空表示同步写入
+func NewAuditHandler(auditRepo repository.AuditRepository, auditWriter *audit.Writer, archives service.AuditArchiveService, chain service.AuditChainService) *AuditHandler {
+	return &AuditHandler{auditRepo: auditRepo, auditWriter: auditWriter, archives: archives, chain: chain}
 }
 
 // ListQuery 查询参数
@@ -30,6 +43,25 @@ type ListQuery struct {
 	PageSize int    `form:"page_size"`
 }
 
+// timeRange 解析 from / to（RFC3339，可选）
+func (q *ListQuery) timeRange() (from, to *time.Time, err error) {
+	if q.From != "" {
+		t, err := time.Parse(time.RFC3339, q.From)
+		if err != nil {
+			return nil, nil, errors.New("invalid from time")
+		}
+		from = &t
+	}
+	if q.To != "" {
+		t, err := time.Parse(time.RFC3339, q.To)
+		if err != nil {
+			return nil, nil, errors.New("invalid to time")
+		}
+		to = &t
+	}
+	return from, to, nil
+}
+
 // GetAudit 获取审计日志列表（分页，仅 3 个月内）
 func (h *AuditHandler) GetAudit(c *gin.Context) {
 	var q ListQuery
@@ -47,22 +79,10 @@ func (h *AuditHandler) GetAudit(c *gin.Context) {
 		q.PageSize = 100
 	}
 
-	var from, to *time.Time
-	if q.From != "" {
-		t, err := time.Parse(time.RFC3339, q.From)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "invalid from time"})
-			return
-		}
-		from = &t
-	}
-	if q.To != "" {
-		t, err := time.Parse(time.RFC3339, q.To)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "invalid to time"})
-			return
-		}
-		to = &t
+	from, to, err := q.timeRange()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		return
 	}
 
 	list, total, err := h.auditRepo.List(from, to, q.Action, q.Username, q.Page, q.PageSize)
@@ -80,16 +100,222 @@ func (h *AuditHandler) GetAudit(c *gin.Context) {
 	})
 }
 
-// Cleanup 清理超过保留期的审计记录（仅管理员）
+// Cleanup 归档并清理超过保留期的审计记录（仅管理员）
 func (h *AuditHandler) Cleanup(c *gin.Context) {
-	n, err := h.auditRepo.DeleteOlderThan(audit.RetentionCutoff())
+	archived, deleted, err := h.archives.ArchiveExpired(audit.RetentionCutoff())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": err.Error(), "archived": archived, "deleted": deleted})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"message":  "cleanup done",
+		"archived": archived,
+		"deleted":  deleted,
+	})
+}
+
+// Verify GET /api/admin/audit/verify 遍历审计哈希链与签名检查点，报告第一个断点（链完整时 report.ok 为 true）
+func (h *AuditHandler) Verify(c *gin.Context) {
+	report, err := h.chain.Verify()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "report": report})
+}
+
+// ListArchives GET /api/admin/audit/archives 归档文件清单（含记录数、id 与时间范围、SHA-256）
+func (h *AuditHandler) ListArchives(c *gin.Context) {
+	list, err := h.archives.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "list": list})
+}
+
+// QueryArchive GET /api/admin/audit/archives/:name 校验并查询一个归档文件，筛选与分页参数同 GetAudit（按 id 升序）
+func (h *AuditHandler) QueryArchive(c *gin.Context) {
+	var q ListQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "invalid query"})
+		return
+	}
+	if q.Page <= 0 {
+		q.Page = 1
+	}
+	if q.PageSize <= 0 {
+		q.PageSize = 20
+	}
+	if q.PageSize > 100 {
+		q.PageSize = 100
+	}
+	from, to, err := q.timeRange()
 	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+
+	list, total, err := h.archives.Query(c.Param("name"), from, to, q.Action, q.Username, q.Page, q.PageSize)
+	switch {
+	case errors.Is(err, service.ErrAuditArchiveNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": err.Error()})
+		return
+	case errors.Is(err, service.ErrAuditArchiveCorrupt):
+		c.JSON(http.StatusConflict, gin.H{"success": false, "message": err.Error()})
+		return
+	case err != nil:
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": "cleanup done",
-		"deleted": n,
+		"success":   true,
+		"list":      list,
+		"total":     total,
+		"page":      q.Page,
+		"page_size": q.PageSize,
 	})
 }
+
+// Metrics GET /api/admin/audit/metrics 异步写入队列深度、已写入 / 丢弃 / 写入失败的事件数
+func (h *AuditHandler) Metrics(c *gin.Context) {
+	if h.auditWriter == nil {
+		c.JSON(http.StatusOK, gin.H{"success": true, "async": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "async": true, "writer": h.auditWriter.Stats()})
+}
+
+// ExportQuery 导出参数：筛选条件同 ListQuery（忽略分页）
+type ExportQuery struct {
+	ListQuery
+	Format string `form:"format"` // csv（默认）或 jsonl
+	BOM    bool   `form:"bom"`    // CSV 前加 UTF-8 BOM，便于 Excel 识别编码
+}
+
+// auditCSVHeader CSV 列，与 AuditEntry 的 JSON 字段名一致
+var auditCSVHeader = []string{
+	"id", "created_at", "action", "username", "role", "client_ip", "resource",
+	"detail", "status", "reason", "metadata", "api_token_id", "impersonator",
+}
+
+// Export GET /api/admin/audit/export 按列表的筛选条件流式导出全部匹配记录（CSV 或 JSON Lines，不分页）；导出本身记入审计
+func (h *AuditHandler) Export(c *gin.Context) {
+	var q ExportQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "invalid query"})
+		return
+	}
+	q.Format = strings.ToLower(q.Format)
+	if q.Format == "" {
+		q.Format = "csv"
+	}
+	if q.Format != "csv" && q.Format != "jsonl" {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "format 仅支持 csv 或 jsonl"})
+		return
+	}
+	from, to, err := q.timeRange()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+
+	filename := "audit-" + time.Now().Format("20060102-150405") + "." + q.Format
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	c.Header("Cache-Control", "no-store")
+
+	start := time.Now()
+	var n int64
+	if q.Format == "csv" {
+		n, err = h.exportCSV(c, from, to, &q)
+	} else {
+		n, err = h.exportJSONL(c, from, to, &q)
+	}
+
+	md := audit.Metadata{Count: int(n), Format: q.Format, Filter: exportFilter(&q), DurationMS: time.Since(start).Milliseconds()}
+	if err != nil {
+		log.Printf("[Audit] export %s failed after %d rows: %v", q.Format, n, err)
+		md.Error = err.Error()
+		_ = h.auditRepo.Insert(newAuditEvent(c, "audit_export", "audit_log", audit.StatusFail, audit.ReasonError, md))
+		if !c.Writer.Written() {
+			c.Writer.Header().Del("Content-Type")
+			c.Writer.Header().Del("Content-Disposition")
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": err.Error()})
+		}
+		return
+	}
+	auditSuccess(h.auditRepo, c, "audit_export", "audit_log", audit.ReasonOK, md)
+}
+
+func (h *AuditHandler) exportCSV(c *gin.Context, from, to *time.Time, q *ExportQuery) (int64, error) {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	bw := bufio.NewWriter(c.Writer)
+	if q.BOM {
+		bw.WriteString("\uFEFF")
+	}
+	w := csv.NewWriter(bw)
+	if err := w.Write(auditCSVHeader); err != nil {
+		return 0, err
+	}
+	n, err := h.auditRepo.Export(from, to, q.Action, q.Username, func(e *repository.AuditEntry) error {
+		md := ""
+		if e.Metadata != nil {
+			data, err := json.Marshal(e.Metadata)
+			if err != nil {
+				return err
+			}
+			md = string(data)
+		}
+		tokenID := ""
+		if e.APITokenID != nil {
+			tokenID = strconv.FormatInt(*e.APITokenID, 10)
+		}
+		return w.Write([]string{
+			strconv.FormatInt(e.ID, 10), e.CreatedAt.UTC().Format(time.RFC3339),
+			csvCell(e.Action), csvCell(e.Username), csvCell(e.Role), csvCell(e.ClientIP), csvCell(e.Resource),
+			csvCell(e.Detail), e.Status, e.Reason, md, tokenID, csvCell(e.Impersonator),
+		})
+	})
+	w.Flush()
+	if err == nil {
+		err = w.Error()
+	}
+	if ferr := bw.Flush(); err == nil {
+		err = ferr
+	}
+	return n, err
+}
+
+func (h *AuditHandler) exportJSONL(c *gin.Context, from, to *time.Time, q *ExportQuery) (int64, error) {
+	c.Header("Content-Type", "application/x-ndjson; charset=utf-8")
+	bw := bufio.NewWriter(c.Writer)
+	enc := json.NewEncoder(bw)
+	enc.SetEscapeHTML(false)
+	n, err := h.auditRepo.Export(from, to, q.Action, q.Username, func(e *repository.AuditEntry) error {
+		return enc.Encode(e)
+	})
+	if ferr := bw.Flush(); err == nil {
+		err = ferr
+	}
+	return n, err
+}
+
+// csvCell 以 = + - @ 等开头的文本前加单引号，防止在 Excel 中被当作公式执行
+func csvCell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// exportFilter 导出使用的筛选条件（查询串形式，记入审计）
+func exportFilter(q *ExportQuery) string {
+	v := url.Values{}
+	for k, val := range map[string]string{"from": q.From, "to": q.To, "action": q.Action, "username": q.Username} {
+		if val != "" {
+			v.Set(k, val)
+		}
+	}
+	return v.Encode()
+}
@@ -1,9 +1,14 @@
 package handler
 
 import (
+	"errors"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
+	"dvr-manager/internal/audit"
 	"dvr-manager/internal/auth"
 	"dvr-manager/internal/repository"
 	"dvr-manager/internal/service"
@@ -13,17 +18,29 @@ import (
 
 // AuthHandler 认证处理器
 type AuthHandler struct {
-	authService service.AuthService
-	jwt         *auth.JWT
-	auditRepo   repository.AuditRepository
+	authService    service.AuthService
+	tokenService   service.TokenService
+	sessionService service.SessionService
+	mfaService     service.MFAService
+	throttle       service.LoginThrottleService
+	ssoService     service.SSOService
+	roleService    service.RoleService
+	jwt            *auth.JWT
+	auditRepo      repository.AuditRepository
 }
 
 // NewAuthHandler 创建认证处理器
-func NewAuthHandler(authService service.AuthService, jwt *auth.JWT, auditRepo repository.AuditRepository) *AuthHandler {
+func NewAuthHandler(authService service.AuthService, tokenService service.TokenService, sessionService service.SessionService, mfaService service.MFAService, throttle service.LoginThrottleService, ssoService service.SSOService, roleService service.RoleService, jwt *auth.JWT, auditRepo repository.AuditRepository) *AuthHandler {
 	return &AuthHandler{
-		authService: authService,
-		jwt:         jwt,
-		auditRepo:   auditRepo,
+		authService:    authService,
+		tokenService:   tokenService,
+		sessionService: sessionService,
+		mfaService:     mfaService,
+		throttle:       throttle,
+		ssoService:     ssoService,
+		roleService:    roleService,
+		jwt:            jwt,
+		auditRepo:      auditRepo,
 	}
 }
 
@@ -33,18 +50,79 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
-// LoginResponse 登录响应
+// LoginResponse 登录 / 刷新响应。
+// 启用二次验证的账号密码校验通过后仅返回 mfa_token（mfa_required 或 mfa_enroll_required），
+// 须再调用 /api/auth/login/mfa（或绑定流程）换取正式令牌。
 type LoginResponse struct {
-	Success bool     `json:"success"`
-	Token   string   `json:"token,omitempty"`
-	User    UserInfo `json:"user,omitempty"`
-	Message string   `json:"message,omitempty"`
+	Success           bool     `json:"success"`
+	Token             string   `json:"token,omitempty"`
+	RefreshToken      string   `json:"refresh_token,omitempty"`
+	ExpiresIn         int64    `json:"expires_in,omitempty"`
+	RefreshExpiresIn  int64    `json:"refresh_expires_in,omitempty"`
+	User              UserInfo `json:"user,omitempty"`
+	MFARequired       bool     `json:"mfa_required,omitempty"`
+	MFAEnrollRequired bool     `json:"mfa_enroll_required,omitempty"`
+	MFAToken          string   `json:"mfa_token,omitempty"`
+	RecoveryCodes     []string `json:"recovery_codes,omitempty"`
+	Message           string   `json:"message,omitempty"`
+}
+
+// MFALoginRequest 登录第二步：挑战令牌 + 验证码（TOTP 或恢复码）
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code"`
+}
+
+// RefreshRequest 刷新令牌请求
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// LogoutRequest 登出请求（refresh_token 可选，提供时吊销对应令牌链）
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func (h *AuthHandler) newLoginResponse(pair *service.TokenPair, user *service.User) LoginResponse {
+	return LoginResponse{
+		Success:          true,
+		Token:            pair.AccessToken,
+		RefreshToken:     pair.RefreshToken,
+		ExpiresIn:        pair.ExpiresIn,
+		RefreshExpiresIn: pair.RefreshExpiresIn,
+		User:             h.newUserInfo(user),
+	}
 }
 
-// UserInfo 用户信息
+// UserInfo 用户信息；password_change_required 为 true 时除修改密码外的接口均返回 403，
+// must_change_password 区分是初始 / 重置密码（否则为密码过期）；permissions 为角色与所在组授予角色的权限并集（前端据此展示菜单）
 type UserInfo struct {
-	Username string `json:"username"`
-	Role     string `json:"role"`
+	Username               string   `json:"username"`
+	Role                   string   `json:"role"`
+	Groups                 []string `json:"groups"`
+	Permissions            []string `json:"permissions"`
+	MustChangePassword     bool     `json:"must_change_password,omitempty"`
+	PasswordChangeRequired bool     `json:"password_change_required,omitempty"`
+	// Impersonator 模拟登录会话的真实管理员（前端据此显示模拟提示并提供退出）
+	Impersonator string `json:"impersonator,omitempty"`
+}
+
+func (h *AuthHandler) newUserInfo(user *service.User) UserInfo {
+	info := UserInfo{
+		Username:               user.Username,
+		Role:                   user.Role,
+		Groups:                 user.GroupNames(),
+		Permissions:            h.roleService.Permissions(user.Roles()...),
+		MustChangePassword:     user.MustChangePassword,
+		PasswordChangeRequired: user.PasswordChangeRequired,
+	}
+	// 模拟登录会话不能修改目标用户的密码，也不要求修改
+	if user.Impersonator != nil {
+		info.Impersonator = user.Impersonator.Username
+		info.MustChangePassword = false
+		info.PasswordChangeRequired = false
+	}
+	return info
 }
 
 // VerifyResponse 验证响应
@@ -62,33 +140,252 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	user, err := h.authService.Authenticate(req.Username, req.Password)
+	if h.throttled(c, req.Username) {
+		return
+	}
+
+	user, err := h.authService.Authenticate(req.Username, req.Password, clientIP)
+	if service.IsAccountRestricted(err) {
+		h.rejectRestricted(c, req.Username, err)
+		return
+	}
 	if err != nil {
 		if h.auditRepo != nil {
-			_ = h.auditRepo.Insert("login_fail", req.Username, "", clientIP, "", "登录失败", "fail")
+			_ = h.auditRepo.Insert(newLoginEvent(c, "login_fail", req.Username, "", "", audit.StatusFail,
+				audit.ReasonInvalidCredentials, audit.Metadata{Error: err.Error()}))
 		}
+		h.recordFailure(c, req.Username)
 		c.JSON(http.StatusUnauthorized, LoginResponse{Success: false, Message: "用户名或密码错误"})
 		return
 	}
 
-	token, err := h.jwt.Generate(user.Username, user.Role)
+	if user.MFAEnabled || h.mfaService.Required(user) {
+		h.mfaChallenge(c, user)
+		return
+	}
+	h.completeLogin(c, user, audit.ReasonPassword, nil)
+}
+
+// rejectRestricted 密码正确但账号已停用 / 过期或不满足登录限制：返回 403，不计入登录失败次数
+func (h *AuthHandler) rejectRestricted(c *gin.Context, username string, err error) {
+	if h.auditRepo != nil {
+		_ = h.auditRepo.Insert(newLoginEvent(c, "login_fail", username, "", "", audit.StatusFail, failureReason(err), failureMetadata(err)))
+	}
+	c.JSON(http.StatusForbidden, gin.H{"success": false, "message": err.Error(), "code": "account_restricted"})
+}
+
+// throttled 登录限流检查；受限时返回 429（带 Retry-After）并记录审计
+func (h *AuthHandler) throttled(c *gin.Context, username string) bool {
+	wait, err := h.throttle.Check(username, c.ClientIP())
+	if err == nil {
+		return false
+	}
+	if !errors.Is(err, service.ErrLoginThrottled) {
+		log.Printf("[AUTH] 登录限流检查失败 - 用户名: %s, Error: %v", username, err)
+		return false
+	}
+	seconds := int(math.Ceil(wait.Seconds()))
+	if h.auditRepo != nil {
+		_ = h.auditRepo.Insert(newLoginEvent(c, "login_fail", username, "", "", audit.StatusFail,
+			audit.ReasonThrottled, audit.Metadata{RetryAfter: seconds}))
+	}
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{"success": false, "message": service.ErrLoginThrottled.Error(), "retry_after": seconds})
+	return true
+}
+
+// recordFailure 记录登录失败；达到上限锁定账号时审计 account_locked
+func (h *AuthHandler) recordFailure(c *gin.Context, username string) {
+	locked, err := h.throttle.Fail(username, c.ClientIP())
+	if err != nil {
+		log.Printf("[AUTH] 记录登录失败出错 - 用户名: %s, Error: %v", username, err)
+		return
+	}
+	if locked {
+		log.Printf("[AUTH] 账号已临时锁定 - IP: %s, 用户名: %s", c.ClientIP(), username)
+		if h.auditRepo != nil {
+			_ = h.auditRepo.Insert(newLoginEvent(c, "account_locked", username, "", username, audit.StatusFail, audit.ReasonLocked, audit.Metadata{}))
+		}
+	}
+}
+
+// mfaChallenge 密码已通过：返回挑战令牌，等待验证码或强制绑定
+func (h *AuthHandler) mfaChallenge(c *gin.Context, user *service.User) {
+	purpose, reason, message := auth.PurposeMFA, audit.ReasonMFAPending, "密码验证通过，等待二次验证"
+	if !user.MFAEnabled {
+		purpose, reason, message = auth.PurposeMFAEnroll, audit.ReasonMFAEnrollRequired, "密码验证通过，角色要求绑定二次验证"
+	}
+	token, err := h.mfaService.Challenge(user, purpose)
+	if err != nil {
+		log.Printf("[AUTH] 签发二次验证挑战失败 - 用户名: %s, Error: %v", user.Username, err)
+		c.JSON(http.StatusInternalServerError, LoginResponse{Success: false, Message: "生成令牌失败"})
+		return
+	}
+	h.auditMFA(c, user, "mfa_challenge", audit.StatusSuccess, reason, audit.Metadata{})
+	c.JSON(http.StatusOK, LoginResponse{
+		Success:           true,
+		MFARequired:       user.MFAEnabled,
+		MFAEnrollRequired: !user.MFAEnabled,
+		MFAToken:          token,
+		Message:           message,
+	})
+}
+
+// completeLogin 签发正式令牌对；reason 为登录方式（audit.Reason*），recoveryCodes 仅在登录时完成绑定的场景下返回
+func (h *AuthHandler) completeLogin(c *gin.Context, user *service.User, reason string, recoveryCodes []string) {
+	clientIP := c.ClientIP()
+	pair, err := h.tokenService.Issue(user, clientIP, c.Request.UserAgent())
 	if err != nil {
+		log.Printf("[AUTH] 签发令牌失败 - 用户名: %s, Error: %v", user.Username, err)
 		c.JSON(http.StatusInternalServerError, LoginResponse{Success: false, Message: "生成令牌失败"})
 		return
 	}
 
+	if err := h.throttle.Succeed(user.Username); err != nil {
+		log.Printf("[AUTH] 清除登录失败计数出错 - 用户名: %s, Error: %v", user.Username, err)
+	}
 	if h.auditRepo != nil {
-		_ = h.auditRepo.Insert("login_success", user.Username, user.Role, clientIP, "", "登录成功", "success")
+		_ = h.auditRepo.Insert(newLoginEvent(c, "login_success", user.Username, user.Role, "", audit.StatusSuccess, reason, audit.Metadata{}))
 	}
 	log.Printf("[AUTH] 登录成功 - IP: %s, 用户名: %s", clientIP, user.Username)
-	c.JSON(http.StatusOK, LoginResponse{
-		Success: true,
-		Token:   token,
-		User:    UserInfo{Username: user.Username, Role: user.Role},
-	})
+	resp := h.newLoginResponse(pair, user)
+	resp.RecoveryCodes = recoveryCodes
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *AuthHandler) auditMFA(c *gin.Context, user *service.User, action, status, reason string, md audit.Metadata) {
+	if h.auditRepo == nil {
+		return
+	}
+	_ = h.auditRepo.Insert(newLoginEvent(c, action, user.Username, user.Role, user.Username, status, reason, md))
+}
+
+// challengeUser 解析二次验证挑战令牌（LoginMFA / LoginMFASetup / LoginMFAActivate 共用）：
+// 挑战有效期内账号被停用或不再满足登录限制时拒绝，并与密码登录共用失败计数与限流
+func (h *AuthHandler) challengeUser(c *gin.Context, token, purpose string) (*service.User, bool) {
+	user, err := h.mfaService.ParseChallenge(token, purpose)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, LoginResponse{Success: false, Message: service.ErrMFAChallengeInvalid.Error()})
+		return nil, false
+	}
+	if err := service.CheckUserAccess(user, c.ClientIP(), time.Now()); err != nil {
+		h.rejectRestricted(c, user.Username, err)
+		return nil, false
+	}
+	if h.throttled(c, user.Username) {
+		return nil, false
+	}
+	return user, true
+}
+
+// LoginMFA 登录第二步：校验 TOTP 验证码或恢复码
+func (h *AuthHandler) LoginMFA(c *gin.Context) {
+	var req MFALoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		c.JSON(http.StatusBadRequest, LoginResponse{Success: false, Message: "请求参数错误"})
+		return
+	}
+	user, ok := h.challengeUser(c, req.MFAToken, auth.PurposeMFA)
+	if !ok {
+		return
+	}
+	usedRecovery, err := h.mfaService.Verify(user, req.Code)
+	if err != nil {
+		h.auditMFA(c, user, "mfa_verify", audit.StatusFail, failureReason(err), failureMetadata(err))
+		if errors.Is(err, service.ErrMFACodeInvalid) {
+			h.recordFailure(c, user.Username)
+		}
+		if errors.Is(err, service.ErrMFACodeInvalid) || errors.Is(err, service.ErrMFANotEnabled) {
+			c.JSON(http.StatusUnauthorized, LoginResponse{Success: false, Message: err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, LoginResponse{Success: false, Message: "二次验证失败"})
+		return
+	}
+	reason := audit.ReasonTOTP
+	if usedRecovery {
+		reason = audit.ReasonRecoveryCode
+		h.auditMFA(c, user, "mfa_recovery_used", audit.StatusSuccess, audit.ReasonOK, audit.Metadata{})
+	} else {
+		h.auditMFA(c, user, "mfa_verify", audit.StatusSuccess, audit.ReasonOK, audit.Metadata{})
+	}
+	h.completeLogin(c, user, reason, nil)
+}
+
+// LoginMFASetup 强制绑定：凭挑战令牌生成密钥
+func (h *AuthHandler) LoginMFASetup(c *gin.Context) {
+	var req MFALoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "请求参数错误"})
+		return
+	}
+	user, ok := h.challengeUser(c, req.MFAToken, auth.PurposeMFAEnroll)
+	if !ok {
+		return
+	}
+	setup, err := h.mfaService.Setup(user)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "secret": setup.Secret, "otpauth_uri": setup.OTPAuthURI})
 }
 
-// Me 当前用户
+// LoginMFAActivate 强制绑定：确认验证码后启用并完成登录，同时返回恢复码
+func (h *AuthHandler) LoginMFAActivate(c *gin.Context) {
+	var req MFALoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		c.JSON(http.StatusBadRequest, LoginResponse{Success: false, Message: "请求参数错误"})
+		return
+	}
+	user, ok := h.challengeUser(c, req.MFAToken, auth.PurposeMFAEnroll)
+	if !ok {
+		return
+	}
+	codes, err := h.mfaService.Activate(user, req.Code)
+	if err != nil {
+		h.auditMFA(c, user, "mfa_enroll", audit.StatusFail, failureReason(err), failureMetadata(err))
+		if errors.Is(err, service.ErrMFACodeInvalid) {
+			h.recordFailure(c, user.Username)
+		}
+		c.JSON(http.StatusBadRequest, LoginResponse{Success: false, Message: err.Error()})
+		return
+	}
+	h.auditMFA(c, user, "mfa_enroll", audit.StatusSuccess, audit.ReasonLogin, audit.Metadata{})
+	user.MFAEnabled = true
+	h.completeLogin(c, user, audit.ReasonMFAEnrolled, codes)
+}
+
+// Refresh 使用刷新令牌换取新的令牌对（刷新令牌一次性使用）
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	clientIP := c.ClientIP()
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, LoginResponse{Success: false, Message: "请求参数错误"})
+		return
+	}
+
+	pair, user, err := h.tokenService.Refresh(req.RefreshToken, clientIP)
+	if err != nil {
+		if errors.Is(err, service.ErrRefreshTokenReused) {
+			if h.auditRepo != nil {
+				_ = h.auditRepo.Insert(newLoginEvent(c, "token_reuse", "", "", "", audit.StatusFail, audit.ReasonTokenReuse, audit.Metadata{}))
+			}
+			c.JSON(http.StatusUnauthorized, LoginResponse{Success: false, Message: err.Error()})
+			return
+		}
+		if errors.Is(err, service.ErrRefreshTokenInvalid) || service.IsAccountRestricted(err) {
+			c.JSON(http.StatusUnauthorized, LoginResponse{Success: false, Message: err.Error()})
+			return
+		}
+		log.Printf("[AUTH] 刷新令牌失败 - IP: %s, Error: %v", clientIP, err)
+		c.JSON(http.StatusInternalServerError, LoginResponse{Success: false, Message: "刷新令牌失败"})
+		return
+	}
+	c.JSON(http.StatusOK, h.newLoginResponse(pair, user))
+}
+
+// Me 当前用户（校验会话与账号访问限制）
 func (h *AuthHandler) Me(c *gin.Context) {
 	tokenString := auth.ExtractBearer(c.GetHeader("Authorization"))
 	if tokenString == "" {
@@ -100,21 +397,34 @@ func (h *AuthHandler) Me(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, VerifyResponse{Success: false})
 		return
 	}
+	user, err := h.sessionService.Validate(claims)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, VerifyResponse{Success: false})
+		return
+	}
+	// 与 AuthMiddleware 一致：账号已停用、已过期或不满足登录时段 / 来源 IP 限制时视为未登录；模拟登录按真实管理员校验
+	checked := user
+	if user.Impersonator != nil {
+		checked = user.Impersonator
+	}
+	if err := service.CheckUserAccess(checked, c.ClientIP(), time.Now()); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": err.Error()})
+		return
+	}
 	c.JSON(http.StatusOK, VerifyResponse{
 		Success: true,
-		User:    UserInfo{Username: claims.Username, Role: claims.Role},
+		User:    h.newUserInfo(user),
 	})
 }
 
 // ChangePasswordRequest 修改密码
 type ChangePasswordRequest struct {
 	OldPassword string `json:"old_password" binding:"required"`
-	NewPassword string `json:"new_password" binding:"required,min=6"`
+	NewPassword string `json:"new_password" binding:"required"`
 }
 
 // ChangePassword 修改密码
 func (h *AuthHandler) ChangePassword(c *gin.Context) {
-	clientIP := c.ClientIP()
 	usernameVal, _ := c.Get("username")
 	username, _ := usernameVal.(string)
 	if username == "" {
@@ -130,19 +440,118 @@ func (h *AuthHandler) ChangePassword(c *gin.Context) {
 
 	if err := h.authService.ChangePassword(username, req.OldPassword, req.NewPassword); err != nil {
 		if h.auditRepo != nil {
-			_ = h.auditRepo.Insert("password_change", username, "", clientIP, "", err.Error(), "fail")
+			_ = h.auditRepo.Insert(newAuditEvent(c, "password_change", "", audit.StatusFail, failureReason(err), failureMetadata(err)))
 		}
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
 		return
 	}
 
 	if h.auditRepo != nil {
-		_ = h.auditRepo.Insert("password_change", username, "", clientIP, "", "修改自己的密码", "success")
+		_ = h.auditRepo.Insert(newAuditEvent(c, "password_change", "", audit.StatusSuccess, audit.ReasonOK, audit.Metadata{}))
 	}
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "密码修改成功"})
 }
 
-// Logout 登出
+// Logout 登出：吊销当前访问令牌所属会话及其刷新令牌；访问令牌已过期时按请求体中的刷新令牌吊销。
+// 只校验访问令牌签名，不经过会话与账号访问限制校验，已停用或不满足登录限制的账号同样可以结束会话。
+// OIDC 会话在 IdP 支持 end_session_endpoint 时返回 logout_url，前端跳转以结束 IdP 会话。
 func (h *AuthHandler) Logout(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"success": true, "message": "登出成功"})
+	clientIP := c.ClientIP()
+	var req LogoutRequest
+	_ = c.ShouldBindJSON(&req)
+
+	var sess *repository.Session
+	if token := auth.ExtractBearer(c.GetHeader("Authorization")); token != "" && !service.IsAPIToken(token) {
+		if claims, err := h.jwt.Verify(token); err == nil && claims.SessionID != "" {
+			if s, err := h.sessionService.Get(claims.SessionID); err == nil && s != nil {
+				sess = s
+			}
+		}
+	}
+	action, reason := "logout", service.RevokeReasonLogout
+	logoutURL := ""
+	if sess != nil {
+		c.Set("username", sess.Username)
+		c.Set("role", sess.Role)
+		if sess.Impersonator != "" {
+			action, reason = "impersonate_end", service.RevokeReasonImpersonate
+			c.Set("impersonator", sess.Impersonator)
+		}
+		if sess.SSOSource != "" && h.ssoService != nil {
+			logoutURL = h.ssoService.OIDCLogoutURL(sess.SSOSource, sess.IDTokenHint)
+		}
+		if _, err := h.sessionService.Revoke(sess.ID, reason); err != nil {
+			log.Printf("[AUTH] 吊销会话失败 - IP: %s, Error: %v", clientIP, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "登出失败"})
+			return
+		}
+	}
+	if req.RefreshToken != "" {
+		if err := h.tokenService.Revoke(req.RefreshToken); err != nil {
+			log.Printf("[AUTH] 吊销刷新令牌失败 - IP: %s, Error: %v", clientIP, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "登出失败"})
+			return
+		}
+	}
+
+	if h.auditRepo != nil && (sess != nil || req.RefreshToken != "") {
+		_ = h.auditRepo.Insert(newAuditEvent(c, action, "", audit.StatusSuccess, audit.ReasonOK, audit.Metadata{}))
+	}
+	resp := gin.H{"success": true, "message": "登出成功"}
+	if logoutURL != "" {
+		resp["logout_url"] = logoutURL
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// ConfirmSSOLinkRequest 确认关联 SSO 身份请求
+type ConfirmSSOLinkRequest struct {
+	LinkToken string `json:"link_token" binding:"required"`
+	Password  string `json:"password" binding:"required"`
+}
+
+// ConfirmSSOLink SSO 登录遇到同名账号时，用户输入该账号密码确认关联；成功后按普通登录继续（含二次验证）
+func (h *AuthHandler) ConfirmSSOLink(c *gin.Context) {
+	clientIP := c.ClientIP()
+	var req ConfirmSSOLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, LoginResponse{Success: false, Message: "请求参数错误"})
+		return
+	}
+	username := h.authService.PendingSSOLinkUser(req.LinkToken)
+	if username == "" {
+		c.JSON(http.StatusBadRequest, LoginResponse{Success: false, Message: service.ErrSSOLinkInvalid.Error()})
+		return
+	}
+	if h.throttled(c, username) {
+		return
+	}
+
+	user, link, err := h.authService.ConfirmSSOLink(req.LinkToken, req.Password, clientIP)
+	if service.IsAccountRestricted(err) {
+		h.rejectRestricted(c, username, err)
+		return
+	}
+	if err != nil {
+		if h.auditRepo != nil {
+			_ = h.auditRepo.Insert(newLoginEvent(c, "identity_link", username, "", username, audit.StatusFail, failureReason(err), failureMetadata(err)))
+		}
+		if errors.Is(err, service.ErrSSOLinkInvalid) || errors.Is(err, repository.ErrIdentityExists) {
+			c.JSON(http.StatusBadRequest, LoginResponse{Success: false, Message: err.Error()})
+			return
+		}
+		h.recordFailure(c, username)
+		c.JSON(http.StatusUnauthorized, LoginResponse{Success: false, Message: "密码错误"})
+		return
+	}
+	if h.auditRepo != nil {
+		_ = h.auditRepo.Insert(newLoginEvent(c, "identity_link", user.Username, user.Role, user.Username, audit.StatusSuccess,
+			audit.ReasonSelf, audit.Metadata{Provider: link.Provider, Subject: link.Subject}))
+	}
+
+	if user.MFAEnabled || h.mfaService.Required(user) {
+		h.mfaChallenge(c, user)
+		return
+	}
+	h.completeLogin(c, user, audit.ReasonSSOLinked, nil)
 }
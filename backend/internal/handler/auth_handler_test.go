@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"dvr-manager/internal/auth"
+	"dvr-manager/internal/repository"
+	"dvr-manager/internal/service"
+	"dvr-manager/pkg/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAuthHandler_mfaEnrollThrottledAndRechecksAccess(t *testing.T) {
+	if err := db.InitDB(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	gin.SetMode(gin.TestMode)
+
+	jwt, err := auth.NewJWT("test-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := repository.NewUserRepository()
+	mfa := service.NewMFAService(repository.NewMFARepository(), users, jwt)
+	throttle := service.NewLoginThrottleService(repository.NewLoginAttemptRepository(), service.LoginPolicy{
+		MaxFailures: 2, IPMaxFailures: 100, Lockout: time.Minute, Window: time.Minute,
+	})
+	h := NewAuthHandler(nil, nil, nil, mfa, throttle, nil, nil, jwt, nil)
+
+	r := gin.New()
+	r.POST("/login/mfa/setup", h.LoginMFASetup)
+	r.POST("/login/mfa/activate", h.LoginMFAActivate)
+	do := func(path, body string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	challenge := func(username string) (int64, string) {
+		u, err := users.Create(username, "x", service.RoleAdmin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := mfa.Challenge(&service.User{ID: u.ID, Username: u.Username, Role: u.Role}, auth.PurposeMFAEnroll)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u.ID, `{"mfa_token":"` + token + `","code":"000000"}`
+	}
+
+	// 绑定确认的错误验证码计入登录失败，达到上限后绑定接口同样被限流
+	_, body := challenge("dave")
+	if code := do("/login/mfa/setup", body); code != http.StatusOK {
+		t.Fatalf("setup: status = %d, want 200", code)
+	}
+	for i := 0; i < 2; i++ {
+		if code := do("/login/mfa/activate", body); code != http.StatusBadRequest {
+			t.Fatalf("activate #%d: status = %d, want 400", i+1, code)
+		}
+	}
+	if code := do("/login/mfa/activate", body); code != http.StatusTooManyRequests {
+		t.Fatalf("activate after lockout: status = %d, want 429", code)
+	}
+	if code := do("/login/mfa/setup", body); code != http.StatusTooManyRequests {
+		t.Fatalf("setup after lockout: status = %d, want 429", code)
+	}
+
+	// 挑战有效期内被停用的账号不能继续完成登录
+	id, body := challenge("erin")
+	if err := users.SetDisabled(id, true, ""); err != nil {
+		t.Fatal(err)
+	}
+	if code := do("/login/mfa/setup", body); code != http.StatusForbidden {
+		t.Fatalf("setup for disabled account: status = %d, want 403", code)
+	}
+}
+
+func TestAuthHandler_logoutRevokesRestrictedUserSession(t *testing.T) {
+	if err := db.InitDB(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	gin.SetMode(gin.TestMode)
+
+	jwt, err := auth.NewJWT("test-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := repository.NewUserRepository()
+	sessionRepo := repository.NewSessionRepository()
+	refreshRepo := repository.NewRefreshTokenRepository()
+	sessions := service.NewSessionService(sessionRepo, refreshRepo, users)
+	tokens := service.NewTokenService(jwt, refreshRepo, sessionRepo, users)
+	h := NewAuthHandler(nil, tokens, sessions, nil, nil, nil, nil, jwt, nil)
+
+	u, err := users.Create("frank", "x", service.RoleUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair, err := tokens.Issue(&service.User{ID: u.ID, Username: u.Username, Role: u.Role}, "192.0.2.1", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 账号停用后访问令牌不再通过认证，但仍须能结束自己的会话
+	if err := users.SetDisabled(u.ID, true, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	r.POST("/logout", h.Logout)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/logout", nil)
+	req.Header.Set("Authorization", "Bearer "+pair.AccessToken)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("logout: status = %d, want 200", w.Code)
+	}
+
+	claims, err := jwt.Verify(pair.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sess, err := sessions.Get(claims.SessionID); err != nil || sess.RevokedAt == nil {
+		t.Fatalf("session not revoked: %+v err=%v", sess, err)
+	}
+	if _, _, err := tokens.Refresh(pair.RefreshToken, "192.0.2.1"); !errors.Is(err, service.ErrRefreshTokenInvalid) {
+		t.Fatalf("refresh after logout: err = %v, want ErrRefreshTokenInvalid", err)
+	}
+}
@@ -24,6 +24,8 @@ type ConfigResponse struct {
 	RetryEnabled bool   `json:"retry_enabled"`
 	RetryCount   int    `json:"retry_count"`
 	Version      string `json:"version"`
+	// PasswordPolicy 密码策略，供修改密码表单提示
+	PasswordPolicy config.PasswordPolicy `json:"password_policy"`
 }
 
 // Handle 返回公开配置信息
@@ -36,10 +38,11 @@ func (h *ConfigHandler) Handle(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, ConfigResponse{
-		ServerPort:   cfg.Server.Port,
-		DVRCount:     len(cfg.DVRServers),
-		RetryEnabled: cfg.DVR.Retry > 0,
-		RetryCount:   cfg.DVR.Retry,
-		Version:      "1.0.0",
+		ServerPort:     cfg.Server.Port,
+		DVRCount:       len(cfg.DVRServers),
+		RetryEnabled:   cfg.DVR.Retry > 0,
+		RetryCount:     cfg.DVR.Retry,
+		Version:        "1.0.0",
+		PasswordPolicy: cfg.PasswordPolicy,
 	})
 }
@@ -0,0 +1,208 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"dvr-manager/internal/audit"
+	"dvr-manager/internal/repository"
+	"dvr-manager/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GroupHandler 用户组与成员管理
+type GroupHandler struct {
+	groupService service.GroupService
+	authService  service.AuthService
+	roleService  service.RoleService
+	auditRepo    repository.AuditRepository
+}
+
+// NewGroupHandler 创建用户组管理处理器
+func NewGroupHandler(groupService service.GroupService, authService service.AuthService, roleService service.RoleService, auditRepo repository.AuditRepository) *GroupHandler {
+	return &GroupHandler{groupService: groupService, authService: authService, roleService: roleService, auditRepo: auditRepo}
+}
+
+// GroupRequest 新建 / 更新用户组；role 为空表示不授予角色，external_name 为空表示不随 SSO 同步
+type GroupRequest struct {
+	Name         string `json:"name" binding:"required"`
+	Description  string `json:"description"`
+	Role         string `json:"role"`
+	ExternalName string `json:"external_name"`
+}
+
+// GroupMemberRequest 添加组成员
+type GroupMemberRequest struct {
+	UserID int64 `json:"user_id" binding:"required"`
+}
+
+// groupErrorStatus 用户组操作错误对应的状态码
+func groupErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, repository.ErrGroupNotFound), errors.Is(err, repository.ErrUserNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, repository.ErrGroupExists):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// loadGroup 解析 :id 并查询用户组
+func (h *GroupHandler) loadGroup(c *gin.Context) (*repository.Group, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "无效的用户组 ID"})
+		return nil, false
+	}
+	g, err := h.groupService.Get(id)
+	if err != nil {
+		c.JSON(groupErrorStatus(err), gin.H{"success": false, "message": err.Error()})
+		return nil, false
+	}
+	return g, true
+}
+
+// List GET /api/admin/groups
+func (h *GroupHandler) List(c *gin.Context) {
+	list, err := h.groupService.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "list": list})
+}
+
+// Create POST /api/admin/groups
+func (h *GroupHandler) Create(c *gin.Context) {
+	var req GroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "请求参数错误"})
+		return
+	}
+	if !requireCovers(c, h.roleService, req.Role) {
+		return
+	}
+	g, err := h.groupService.Create(req.Name, req.Description, req.Role, req.ExternalName)
+	if err != nil {
+		auditFailure(h.auditRepo, c, "group_create", req.Name, err)
+		c.JSON(groupErrorStatus(err), gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	auditSuccess(h.auditRepo, c, "group_create", g.Name, audit.ReasonOK, audit.Metadata{Role: g.Role, IdPGroup: g.ExternalName})
+	c.JSON(http.StatusOK, gin.H{"success": true, "group": g})
+}
+
+// Update PUT /api/admin/groups/:id
+func (h *GroupHandler) Update(c *gin.Context) {
+	old, ok := h.loadGroup(c)
+	if !ok {
+		return
+	}
+	var req GroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "请求参数错误"})
+		return
+	}
+	if !requireCovers(c, h.roleService, old.Role, req.Role) {
+		return
+	}
+	g, err := h.groupService.Update(old.ID, req.Name, req.Description, req.Role, req.ExternalName)
+	if err != nil {
+		auditFailure(h.auditRepo, c, "group_update", old.Name, err)
+		c.JSON(groupErrorStatus(err), gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	auditSuccess(h.auditRepo, c, "group_update", g.Name, audit.ReasonOK, audit.Metadata{OldRole: old.Role, Role: g.Role, IdPGroup: g.ExternalName})
+	c.JSON(http.StatusOK, gin.H{"success": true, "group": g})
+}
+
+// Delete DELETE /api/admin/groups/:id
+func (h *GroupHandler) Delete(c *gin.Context) {
+	g, ok := h.loadGroup(c)
+	if !ok {
+		return
+	}
+	if !requireCovers(c, h.roleService, g.Role) {
+		return
+	}
+	if _, err := h.groupService.Delete(g.ID); err != nil {
+		auditFailure(h.auditRepo, c, "group_delete", g.Name, err)
+		c.JSON(groupErrorStatus(err), gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	auditSuccess(h.auditRepo, c, "group_delete", g.Name, audit.ReasonOK, audit.Metadata{Count: g.MemberCount})
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// ListMembers GET /api/admin/groups/:id/members
+func (h *GroupHandler) ListMembers(c *gin.Context) {
+	g, ok := h.loadGroup(c)
+	if !ok {
+		return
+	}
+	list, err := h.groupService.Members(g.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "list": list})
+}
+
+// AddMember POST /api/admin/groups/:id/members
+func (h *GroupHandler) AddMember(c *gin.Context) {
+	g, ok := h.loadGroup(c)
+	if !ok {
+		return
+	}
+	var req GroupMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "请求参数错误"})
+		return
+	}
+	target, err := h.authService.GetUserByID(req.UserID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	if !requireCovers(c, h.roleService, append(target.Roles(), g.Role)...) {
+		return
+	}
+	if err := h.groupService.AddMember(g.ID, target.ID); err != nil {
+		auditFailure(h.auditRepo, c, "group_member_add", g.Name, err)
+		c.JSON(groupErrorStatus(err), gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	auditSuccess(h.auditRepo, c, "group_member_add", g.Name, audit.ReasonOK, audit.Metadata{Target: target.Username})
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// RemoveMember DELETE /api/admin/groups/:id/members/:uid
+func (h *GroupHandler) RemoveMember(c *gin.Context) {
+	g, ok := h.loadGroup(c)
+	if !ok {
+		return
+	}
+	userID, err := strconv.ParseInt(c.Param("uid"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "无效的用户 ID"})
+		return
+	}
+	target, err := h.authService.GetUserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	if !requireCovers(c, h.roleService, append(target.Roles(), g.Role)...) {
+		return
+	}
+	if err := h.groupService.RemoveMember(g.ID, target.ID); err != nil {
+		auditFailure(h.auditRepo, c, "group_member_remove", g.Name, err)
+		c.JSON(groupErrorStatus(err), gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	auditSuccess(h.auditRepo, c, "group_member_remove", g.Name, audit.ReasonOK, audit.Metadata{Target: target.Username})
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
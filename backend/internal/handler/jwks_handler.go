@@ -0,0 +1,23 @@
+package handler
+
+import (
+	"dvr-manager/internal/auth"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JWKSHandler 公开 JWT 验签公钥（供内部服务校验本服务签发的令牌）
+type JWKSHandler struct {
+	jwt *auth.JWT
+}
+
+// NewJWKSHandler 创建 JWKS 处理器
+func NewJWKSHandler(jwt *auth.JWT) *JWKSHandler {
+	return &JWKSHandler{jwt: jwt}
+}
+
+// Handle GET /.well-known/jwks.json
+func (h *JWKSHandler) Handle(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(200, h.jwt.JWKS())
+}
@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"dvr-manager/internal/audit"
+	"dvr-manager/internal/repository"
+	"dvr-manager/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MFAHandler 二次验证自助管理与管理员重置
+type MFAHandler struct {
+	authService service.AuthService
+	mfaService  service.MFAService
+	auditRepo   repository.AuditRepository
+}
+
+// NewMFAHandler 创建二次验证处理器
+func NewMFAHandler(authService service.AuthService, mfaService service.MFAService, auditRepo repository.AuditRepository) *MFAHandler {
+	return &MFAHandler{authService: authService, mfaService: mfaService, auditRepo: auditRepo}
+}
+
+// MFACodeRequest 携带验证码（TOTP 或恢复码）的请求
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// currentUser 当前登录用户（以数据库为准）
+func (h *MFAHandler) currentUser(c *gin.Context) (*service.User, bool) {
+	user, err := h.authService.GetUserByID(c.GetInt64("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "未登录"})
+		return nil, false
+	}
+	return user, true
+}
+
+// mfaError 二次验证业务错误返回 400，其余返回 500
+func mfaError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrMFACodeInvalid),
+		errors.Is(err, service.ErrMFAAlreadyEnabled),
+		errors.Is(err, service.ErrMFANotEnabled),
+		errors.Is(err, service.ErrMFANotSetup),
+		errors.Is(err, service.ErrMFARequired),
+		errors.Is(err, service.ErrMFALocalOnly):
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": err.Error()})
+	}
+}
+
+// Status 当前用户二次验证状态
+func (h *MFAHandler) Status(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	st, err := h.mfaService.Status(user)
+	if err != nil {
+		mfaError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "mfa": st})
+}
+
+// Setup 生成待确认密钥（返回 otpauth URI 供前端生成二维码）
+func (h *MFAHandler) Setup(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	setup, err := h.mfaService.Setup(user)
+	if err != nil {
+		mfaError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "secret": setup.Secret, "otpauth_uri": setup.OTPAuthURI})
+}
+
+// Activate 确认验证码并启用，返回恢复码
+func (h *MFAHandler) Activate(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "请求参数错误"})
+		return
+	}
+	codes, err := h.mfaService.Activate(user, req.Code)
+	if err != nil {
+		auditFailure(h.auditRepo, c, "mfa_enroll", user.Username, err)
+		mfaError(c, err)
+		return
+	}
+	auditSuccess(h.auditRepo, c, "mfa_enroll", user.Username, audit.ReasonOK, audit.Metadata{})
+	c.JSON(http.StatusOK, gin.H{"success": true, "recovery_codes": codes})
+}
+
+// Disable 关闭二次验证（需验证码；强制角色不可关闭）
+func (h *MFAHandler) Disable(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "请求参数错误"})
+		return
+	}
+	if err := h.mfaService.Disable(user, req.Code); err != nil {
+		auditFailure(h.auditRepo, c, "mfa_disable", user.Username, err)
+		mfaError(c, err)
+		return
+	}
+	auditSuccess(h.auditRepo, c, "mfa_disable", user.Username, audit.ReasonOK, audit.Metadata{})
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码
+func (h *MFAHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "请求参数错误"})
+		return
+	}
+	codes, err := h.mfaService.RegenerateRecoveryCodes(user, req.Code)
+	if err != nil {
+		auditFailure(h.auditRepo, c, "mfa_recovery_regenerate", user.Username, err)
+		mfaError(c, err)
+		return
+	}
+	auditSuccess(h.auditRepo, c, "mfa_recovery_regenerate", user.Username, audit.ReasonOK, audit.Metadata{})
+	c.JSON(http.StatusOK, gin.H{"success": true, "recovery_codes": codes})
+}
+
+// Reset 管理员重置用户二次验证（丢失设备时使用；强制角色下次登录须重新绑定）
+func (h *MFAHandler) Reset(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "无效的用户 ID"})
+		return
+	}
+	target, err := h.authService.GetUserByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	if err := h.mfaService.Reset(id); err != nil {
+		auditFailure(h.auditRepo, c, "mfa_reset", target.Username, err)
+		mfaError(c, err)
+		return
+	}
+	auditSuccess(h.auditRepo, c, "mfa_reset", target.Username, audit.ReasonOK, audit.Metadata{})
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
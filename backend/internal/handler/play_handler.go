@@ -1,11 +1,15 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	neturl "net/url"
 	"strings"
 	"sync"
+	"time"
 
+	"dvr-manager/internal/audit"
 	"dvr-manager/internal/repository"
 	"dvr-manager/internal/service"
 	"dvr-manager/pkg/cache"
@@ -20,17 +24,19 @@ const (
 
 // PlayHandler 播放处理器
 type PlayHandler struct {
-	dvrService service.DVRService
-	cache      cache.Cache
-	auditRepo  repository.AuditRepository
+	dvrService    service.DVRService
+	accessService service.AccessService
+	cache         cache.Cache
+	auditRepo     repository.AuditRepository
 }
 
 // NewPlayHandler 创建播放处理器
-func NewPlayHandler(dvrService service.DVRService, cache cache.Cache, auditRepo repository.AuditRepository) *PlayHandler {
+func NewPlayHandler(dvrService service.DVRService, accessService service.AccessService, cache cache.Cache, auditRepo repository.AuditRepository) *PlayHandler {
 	return &PlayHandler{
-		dvrService: dvrService,
-		cache:      cache,
-		auditRepo:  auditRepo,
+		dvrService:    dvrService,
+		accessService: accessService,
+		cache:         cache,
+		auditRepo:     auditRepo,
 	}
 }
 
@@ -59,6 +65,7 @@ type BatchPlayResponse struct {
 type RecordingResult struct {
 	RecordID string `json:"record_id"`
 	Found    bool   `json:"found"`
+	Denied   bool   `json:"denied,omitempty"` // 访问策略不允许
 	ProxyURL string `json:"proxy_url,omitempty"`
 }
 
@@ -93,18 +100,29 @@ func (h *PlayHandler) Handle(c *gin.Context) {
 
 func (h *PlayHandler) handleSingle(c *gin.Context, recordID string) {
 	ctx := c.Request.Context()
-	userStr, roleStr := playActor(c)
+	scope, ok := callerScope(c, h.accessService)
+	if !ok {
+		return
+	}
 
-	url, err := h.dvrService.FindRecording(ctx, recordID)
+	start := time.Now()
+	url, err := h.dvrService.FindRecording(ctx, recordID, scope)
+	if errors.Is(err, service.ErrAccessDenied) {
+		auditAccessDenied(c, h.auditRepo, recordID, audit.ChannelPlay)
+		c.JSON(http.StatusForbidden, PlayResponse{Success: false, Message: err.Error()})
+		return
+	}
 	if err != nil {
-		h.auditPlay(c, userStr, roleStr, recordID, "录像未找到", "fail")
+		h.auditPlay(c, recordID, audit.StatusFail, audit.ReasonRecordNotFound,
+			audit.Metadata{DurationMS: time.Since(start).Milliseconds(), Error: err.Error()})
 		c.JSON(http.StatusNotFound, PlayResponse{Success: false, Message: "recording not found"})
 		return
 	}
 
 	proxyURL := fmt.Sprintf("/stream/%s.mp4", recordID)
 	h.cache.Set(recordID, url)
-	h.auditPlay(c, userStr, roleStr, recordID, "录像已找到", "success")
+	h.auditPlay(c, recordID, audit.StatusSuccess, audit.ReasonRecordFound,
+		audit.Metadata{Server: dvrServer(url), DurationMS: time.Since(start).Milliseconds()})
 
 	c.JSON(http.StatusOK, PlayResponse{
 		Success:  true,
@@ -124,7 +142,11 @@ func (h *PlayHandler) HandleBatch(c *gin.Context, recordIDs []string) {
 	}
 
 	ctx := c.Request.Context()
-	userStr, roleStr := playActor(c)
+	scope, ok := callerScope(c, h.accessService)
+	if !ok {
+		return
+	}
+	start := time.Now()
 	results := make([]RecordingResult, len(recordIDs))
 
 	sem := make(chan struct{}, batchPlayWorkers)
@@ -147,7 +169,11 @@ func (h *PlayHandler) HandleBatch(c *gin.Context, recordIDs []string) {
 				return
 			}
 
-			url, err := h.dvrService.FindRecording(ctx, rid)
+			url, err := h.dvrService.FindRecording(ctx, rid, scope)
+			if errors.Is(err, service.ErrAccessDenied) {
+				results[idx].Denied = true
+				return
+			}
 			if err != nil {
 				return
 			}
@@ -164,12 +190,14 @@ func (h *PlayHandler) HandleBatch(c *gin.Context, recordIDs []string) {
 		if r.Found {
 			foundCount++
 		}
+		if r.Denied {
+			auditAccessDenied(c, h.auditRepo, r.RecordID, audit.ChannelPlayBatch)
+		}
 	}
 
-	if h.auditRepo != nil {
-		detail := fmt.Sprintf("批量查询 %d 条，找到 %d 条", len(recordIDs), foundCount)
-		_ = h.auditRepo.Insert("play_batch", userStr, roleStr, c.ClientIP(), "", detail, "success")
-	}
+	auditSuccess(h.auditRepo, c, "play_batch", "", audit.ReasonBatchCompleted, audit.Metadata{
+		Count: len(recordIDs), Found: foundCount, DurationMS: time.Since(start).Milliseconds(),
+	})
 
 	c.JSON(http.StatusOK, BatchPlayResponse{
 		Success: true,
@@ -178,17 +206,18 @@ func (h *PlayHandler) HandleBatch(c *gin.Context, recordIDs []string) {
 	})
 }
 
-func playActor(c *gin.Context) (username, role string) {
-	u, _ := c.Get("username")
-	username, _ = u.(string)
-	r, _ := c.Get("role")
-	role, _ = r.(string)
-	return username, role
-}
-
-func (h *PlayHandler) auditPlay(c *gin.Context, user, role, recordID, detail, status string) {
+func (h *PlayHandler) auditPlay(c *gin.Context, recordID, status, reason string, md audit.Metadata) {
 	if h.auditRepo == nil {
 		return
 	}
-	_ = h.auditRepo.Insert("play", user, role, c.ClientIP(), recordID, detail, status)
+	_ = h.auditRepo.Insert(newAuditEvent(c, "play", recordID, status, reason, md))
+}
+
+// dvrServer 录像地址所在的 DVR 服务器（scheme://host），用于审计
+func dvrServer(rawURL string) string {
+	u, err := neturl.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host
 }
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"dvr-manager/internal/auth"
+	"dvr-manager/internal/config"
+	"dvr-manager/internal/middleware"
+	"dvr-manager/internal/repository"
+	"dvr-manager/internal/service"
+	"dvr-manager/pkg/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPlayHandler_restrictedUserCannotBypassPolicyAnonymously(t *testing.T) {
+	if err := db.InitDB(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	gin.SetMode(gin.TestMode)
+	prev := config.GetConfig()
+	config.SetConfig(&config.Config{DVRServers: []string{"http://dvr-a:8080/record", "http://dvr-b:8080/record"}})
+	t.Cleanup(func() { config.SetConfig(prev) })
+
+	jwt, err := auth.NewJWT("test-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := repository.NewUserRepository()
+	sessionRepo := repository.NewSessionRepository()
+	refreshRepo := repository.NewRefreshTokenRepository()
+	sessions := service.NewSessionService(sessionRepo, refreshRepo, users)
+	tokens := service.NewTokenService(jwt, refreshRepo, sessionRepo, users)
+	access := service.NewAccessService(repository.NewAccessRepository(), users, repository.NewGroupRepository())
+
+	contractor, err := users.Create("contractor", "x", service.RoleUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	siteA, err := access.CreateGroup("site-a", "", []string{"http://dvr-a:8080/record"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := access.CreatePolicy(&repository.AccessPolicy{
+		Name: "site A only", SubjectType: repository.AccessSubjectUser, SubjectID: contractor.ID,
+		DVRGroupIDs: []int64{siteA.ID}, RecordPatterns: []string{"A-*"}, Enabled: true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	pair, err := tokens.Issue(&service.User{ID: contractor.ID, Username: contractor.Username, Role: contractor.Role}, "192.0.2.1", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewPlayHandler(service.NewDVRService(nil, nil), access, nil, nil)
+	r := gin.New()
+	r.GET("/api/play", middleware.PlayAuthMiddleware(jwt, sessions, nil), h.Handle)
+	play := func(token string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/play?record_id=B-001", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := play(pair.AccessToken); code != http.StatusForbidden {
+		t.Fatalf("with token: status = %d, want 403", code)
+	}
+	// 不带令牌：没有匿名策略时匿名访问同样被拒绝
+	if code := play(""); code != http.StatusForbidden {
+		t.Fatalf("without token: status = %d, want 403", code)
+	}
+	// 无效令牌不降级为匿名
+	if code := play("invalid"); code != http.StatusUnauthorized {
+		t.Fatalf("invalid token: status = %d, want 401", code)
+	}
+}
@@ -1,10 +1,14 @@
 package handler
 
 import (
+	"errors"
 	"log"
+	"mime"
 	"net/http"
 	"strings"
+	"time"
 
+	"dvr-manager/internal/audit"
 	"dvr-manager/internal/repository"
 	"dvr-manager/internal/service"
 	"dvr-manager/pkg/cache"
@@ -14,24 +18,27 @@ import (
 
 // ProxyHandler 代理处理器
 type ProxyHandler struct {
-	proxyService service.ProxyService
-	dvrService   service.DVRService
-	cache        cache.Cache
-	auditRepo    repository.AuditRepository
+	proxyService  service.ProxyService
+	dvrService    service.DVRService
+	accessService service.AccessService
+	cache         cache.Cache
+	auditRepo     repository.AuditRepository
 }
 
 // NewProxyHandler 创建新的代理处理器
-func NewProxyHandler(proxyService service.ProxyService, dvrService service.DVRService, cache cache.Cache, auditRepo repository.AuditRepository) *ProxyHandler {
+func NewProxyHandler(proxyService service.ProxyService, dvrService service.DVRService, accessService service.AccessService, cache cache.Cache, auditRepo repository.AuditRepository) *ProxyHandler {
 	return &ProxyHandler{
-		proxyService: proxyService,
-		dvrService:   dvrService,
-		cache:        cache,
-		auditRepo:    auditRepo,
+		proxyService:  proxyService,
+		dvrService:    dvrService,
+		accessService: accessService,
+		cache:         cache,
+		auditRepo:     auditRepo,
 	}
 }
 
 // Handle 处理视频流代理请求
-// 直接 GET /stream/<recordID>.mp4 即可触发 DVR 查询并代理播放（无需先调用 /play）
+// 直接 GET /stream/<recordID>.mp4 即可触发 DVR 查询并代理播放（无需先调用 /play）；
+// download=1 时以附件形式返回（路由层校验 download 权限）
 func (h *ProxyHandler) Handle(c *gin.Context) {
 	filename := c.Param("filename")
 	recordID := strings.TrimSuffix(filename, ".mp4")
@@ -39,10 +46,21 @@ func (h *ProxyHandler) Handle(c *gin.Context) {
 
 	log.Printf("[INFO] 流代理请求 - IP: %s, 编号: %s", clientIP, recordID)
 
-	// 优先从缓存获取真实 URL，避免重复 DVR 查询
+	scope, ok := callerScope(c, h.accessService)
+	if !ok {
+		return
+	}
+
+	// 优先从缓存获取真实 URL，避免重复 DVR 查询；缓存的地址可能由其他用户查得，须按当前调用方的访问范围校验
 	realURL, exists := h.cache.Get(recordID)
+	if exists && !scope.AllowsURL(recordID, realURL) {
+		auditAccessDenied(c, h.auditRepo, recordID, audit.ChannelStream)
+		c.JSON(http.StatusForbidden, gin.H{"error": service.ErrAccessDenied.Error()})
+		return
+	}
 
-	// 缓存未命中：直接到 DVR 服务器查询
+	// 缓存未命中：直接到 DVR 服务器查询；拉流结束后审计命中的服务器、传输字节数与耗时
+	start := time.Now()
 	if !exists {
 		if h.dvrService == nil {
 			log.Printf("[WARN] 流代理失败 - 编号: %s, 原因: dvrService 未初始化", recordID)
@@ -51,16 +69,16 @@ func (h *ProxyHandler) Handle(c *gin.Context) {
 		}
 
 		log.Printf("[INFO] 缓存未命中，直接查询 DVR - 编号: %s", recordID)
-		username, _ := c.Get("username")
-		userStr, _ := username.(string)
-		role, _ := c.Get("role")
-		roleStr, _ := role.(string)
 
-		url, err := h.dvrService.FindRecording(c.Request.Context(), recordID)
+		url, err := h.dvrService.FindRecording(c.Request.Context(), recordID, scope)
+		if errors.Is(err, service.ErrAccessDenied) {
+			auditAccessDenied(c, h.auditRepo, recordID, audit.ChannelStream)
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
 		if err != nil {
-			if h.auditRepo != nil {
-				_ = h.auditRepo.Insert("stream", userStr, roleStr, clientIP, recordID, "流代理: 录像未找到", "fail")
-			}
+			h.auditStream(c, recordID, audit.StatusFail, audit.ReasonRecordNotFound,
+				audit.Metadata{DurationMS: time.Since(start).Milliseconds(), Error: err.Error()})
 			log.Printf("[WARN] 流代理失败 - 编号: %s, Error: %v", recordID, err)
 			c.JSON(http.StatusNotFound, gin.H{"error": "recording not found"})
 			return
@@ -68,14 +86,18 @@ func (h *ProxyHandler) Handle(c *gin.Context) {
 
 		realURL = url
 		h.cache.Set(recordID, realURL)
-		if h.auditRepo != nil {
-			_ = h.auditRepo.Insert("stream", userStr, roleStr, clientIP, recordID, "流代理: 录像已找到", "success")
-		}
 	}
 
+	if c.Query("download") == "1" {
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": recordID + ".mp4"}))
+	}
 	rangeHeader := c.GetHeader("Range")
 
-	if err := h.proxyService.ProxyStream(c.Request.Context(), recordID, realURL, c.Writer, rangeHeader); err != nil {
+	err := h.proxyService.ProxyStream(c.Request.Context(), recordID, realURL, c.Writer, rangeHeader)
+	if !exists {
+		h.auditProxied(c, recordID, realURL, start, err)
+	}
+	if err != nil {
 		log.Printf("[ERROR] 流代理失败 - 编号: %s, Error: %v", recordID, err)
 		if !c.Writer.Written() {
 			c.JSON(http.StatusBadGateway, gin.H{"error": "failed to fetch video from DVR server"})
@@ -83,3 +105,26 @@ func (h *ProxyHandler) Handle(c *gin.Context) {
 		return
 	}
 }
+
+// auditProxied 审计缓存未命中时的拉流结果；已向客户端写出数据后中断（如客户端断开）仍记为已找到
+func (h *ProxyHandler) auditProxied(c *gin.Context, recordID, realURL string, start time.Time, err error) {
+	md := audit.Metadata{Server: dvrServer(realURL), DurationMS: time.Since(start).Milliseconds()}
+	if n := c.Writer.Size(); n > 0 {
+		md.Bytes = int64(n)
+	}
+	if err != nil {
+		md.Error = err.Error()
+		if !c.Writer.Written() {
+			h.auditStream(c, recordID, audit.StatusFail, audit.ReasonUpstreamError, md)
+			return
+		}
+	}
+	h.auditStream(c, recordID, audit.StatusSuccess, audit.ReasonRecordFound, md)
+}
+
+func (h *ProxyHandler) auditStream(c *gin.Context, recordID, status, reason string, md audit.Metadata) {
+	if h.auditRepo == nil {
+		return
+	}
+	_ = h.auditRepo.Insert(newAuditEvent(c, "stream", recordID, status, reason, md))
+}
@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"dvr-manager/internal/audit"
+	"dvr-manager/internal/repository"
+	"dvr-manager/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RoleHandler 角色与权限管理
+type RoleHandler struct {
+	roleService service.RoleService
+	auditRepo   repository.AuditRepository
+}
+
+// NewRoleHandler 创建角色管理处理器
+func NewRoleHandler(roleService service.RoleService, auditRepo repository.AuditRepository) *RoleHandler {
+	return &RoleHandler{roleService: roleService, auditRepo: auditRepo}
+}
+
+// RoleRequest 新建 / 更新角色请求（更新时忽略 name）
+type RoleRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// roleErrorStatus 角色操作错误对应的状态码
+func roleErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, repository.ErrRoleNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, repository.ErrRoleExists):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// requirePermissions 当前用户的有效角色须拥有 perms 中的全部权限，否则返回 403
+// （roles:manage 不能用来新建或修改出超出自身的角色，再借用户组或自身角色提权）
+func requirePermissions(c *gin.Context, roleService service.RoleService, perms []string) bool {
+	actor := actorRoles(c)
+	if roleService.CoversPermissions(actor, perms) {
+		return true
+	}
+	for _, p := range perms {
+		if !roleService.CoversPermissions(actor, []string{p}) {
+			c.JSON(http.StatusForbidden, gin.H{"success": false, "message": fmt.Sprintf("无权授予权限 %s（权限超出当前角色）", p), "code": "permission_denied"})
+			return false
+		}
+	}
+	return true
+}
+
+// List GET /api/admin/roles（含全部可选权限）
+func (h *RoleHandler) List(c *gin.Context) {
+	list, err := h.roleService.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "list": list, "permissions": service.AllPermissions()})
+}
+
+// Create POST /api/admin/roles
+func (h *RoleHandler) Create(c *gin.Context) {
+	var req RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "请求参数错误"})
+		return
+	}
+	if !requirePermissions(c, h.roleService, req.Permissions) {
+		return
+	}
+	role, err := h.roleService.Create(req.Name, req.Description, req.Permissions)
+	if err != nil {
+		auditFailure(h.auditRepo, c, "role_create", req.Name, err)
+		c.JSON(roleErrorStatus(err), gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	auditSuccess(h.auditRepo, c, "role_create", role.Name, audit.ReasonOK, audit.Metadata{Permissions: role.Permissions})
+	c.JSON(http.StatusOK, gin.H{"success": true, "role": role})
+}
+
+// Update PUT /api/admin/roles/:name
+func (h *RoleHandler) Update(c *gin.Context) {
+	name := c.Param("name")
+	var req RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "请求参数错误"})
+		return
+	}
+	// 只能修改自身权限覆盖的角色（含自己持有的角色），且新权限集合不得超出自身
+	if !requireCovers(c, h.roleService, name) || !requirePermissions(c, h.roleService, req.Permissions) {
+		return
+	}
+	role, err := h.roleService.Update(name, req.Description, req.Permissions)
+	if err != nil {
+		auditFailure(h.auditRepo, c, "role_update", name, err)
+		c.JSON(roleErrorStatus(err), gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	auditSuccess(h.auditRepo, c, "role_update", role.Name, audit.ReasonOK, audit.Metadata{Permissions: role.Permissions})
+	c.JSON(http.StatusOK, gin.H{"success": true, "role": role})
+}
+
+// Delete DELETE /api/admin/roles/:name
+func (h *RoleHandler) Delete(c *gin.Context) {
+	name := c.Param("name")
+	if err := h.roleService.Delete(name); err != nil {
+		auditFailure(h.auditRepo, c, "role_delete", name, err)
+		c.JSON(roleErrorStatus(err), gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	auditSuccess(h.auditRepo, c, "role_delete", name, audit.ReasonOK, audit.Metadata{})
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"dvr-manager/internal/repository"
+	"dvr-manager/internal/service"
+	"dvr-manager/pkg/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRoleHandler_rejectsPermissionEscalation(t *testing.T) {
+	if err := db.InitDB(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	gin.SetMode(gin.TestMode)
+
+	roles := service.NewRoleService(repository.NewRoleRepository())
+	if _, err := roles.Create("role-admin", "仅管理角色", []string{service.PermRolesManage}); err != nil {
+		t.Fatal(err)
+	}
+	h := NewRoleHandler(roles, nil)
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("username", "alice")
+		c.Set("role", "role-admin")
+		c.Set("roles", []string{"role-admin"})
+		c.Next()
+	})
+	r.POST("/roles", h.Create)
+	r.PUT("/roles/:name", h.Update)
+
+	do := func(method, path, body string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := do(http.MethodPost, "/roles", `{"name":"escalate","permissions":["users:write"]}`); code != http.StatusForbidden {
+		t.Fatalf("create with users:write: status = %d, want 403", code)
+	}
+	if roles.Exists("escalate") {
+		t.Fatal("role must not be created")
+	}
+	// 修改自己持有的角色，加入自身没有的权限
+	if code := do(http.MethodPut, "/roles/role-admin", `{"permissions":["roles:manage","users:write"]}`); code != http.StatusForbidden {
+		t.Fatalf("update own role with users:write: status = %d, want 403", code)
+	}
+	if roles.HasPermission("role-admin", service.PermUsersWrite) {
+		t.Fatal("own role must not gain users:write")
+	}
+	// 不能修改权限高于自身的角色
+	if code := do(http.MethodPut, "/roles/operator", `{"permissions":["roles:manage"]}`); code != http.StatusForbidden {
+		t.Fatalf("update operator: status = %d, want 403", code)
+	}
+	if code := do(http.MethodPost, "/roles", `{"name":"helper","permissions":["roles:manage"]}`); code != http.StatusOK {
+		t.Fatalf("create within own permissions: status = %d, want 200", code)
+	}
+}
@@ -0,0 +1,451 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"dvr-manager/internal/audit"
+	"dvr-manager/internal/repository"
+	"dvr-manager/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	scimUserSchema   = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimGroupSchema  = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimListSchema   = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimErrorSchema  = "urn:ietf:params:scim:api:messages:2.0:Error"
+	scimConfigSchema = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	scimContentType  = "application/scim+json"
+)
+
+// SCIMHandler SCIM 2.0 预配接口（/scim/v2），由 IdP 以 SCIM_TOKEN 调用
+type SCIMHandler struct {
+	scim      service.SCIMService
+	auditRepo repository.AuditRepository
+}
+
+// NewSCIMHandler 创建 SCIM 处理器
+func NewSCIMHandler(scim service.SCIMService, auditRepo repository.AuditRepository) *SCIMHandler {
+	return &SCIMHandler{scim: scim, auditRepo: auditRepo}
+}
+
+// SCIMPatchRequest PATCH 请求体
+type SCIMPatchRequest struct {
+	Schemas    []string              `json:"schemas"`
+	Operations []service.SCIMPatchOp `json:"Operations"`
+}
+
+func scimJSON(c *gin.Context, status int, body interface{}) {
+	c.Header("Content-Type", scimContentType)
+	c.JSON(status, body)
+}
+
+// scimError 按 RFC 7644 §3.12 返回错误；非 SCIMError 视为 500
+func scimError(c *gin.Context, err error) {
+	status, scimType := http.StatusInternalServerError, ""
+	var se *service.SCIMError
+	if errors.As(err, &se) {
+		status, scimType = se.Status, se.Type
+	}
+	body := gin.H{"schemas": []string{scimErrorSchema}, "status": strconv.Itoa(status), "detail": err.Error()}
+	if scimType != "" {
+		body["scimType"] = scimType
+	}
+	scimJSON(c, status, body)
+}
+
+func scimBadRequest(c *gin.Context, scimType, detail string) {
+	scimError(c, &service.SCIMError{Status: http.StatusBadRequest, Type: scimType, Detail: detail})
+}
+
+// scimID 解析 :id；非数字的 id 不存在
+func scimID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		scimError(c, &service.SCIMError{Status: http.StatusNotFound, Detail: "资源不存在"})
+		return 0, false
+	}
+	return id, true
+}
+
+// scimQuery 解析 filter / startIndex / count
+func scimQuery(c *gin.Context) (service.SCIMQuery, bool) {
+	q := service.SCIMQuery{Filter: c.Query("filter"), StartIndex: 1, Count: service.SCIMDefaultCount}
+	for name, dst := range map[string]*int{"startIndex": &q.StartIndex, "count": &q.Count} {
+		if v := c.Query(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				scimBadRequest(c, "invalidValue", fmt.Sprintf("%s 须为整数", name))
+				return q, false
+			}
+			*dst = n
+		}
+	}
+	return q, true
+}
+
+// scimLocation 资源的绝对地址（反向代理须传递 X-Forwarded-Proto）
+func scimLocation(c *gin.Context, collection string, id int64) string {
+	scheme := "http"
+	if c.Request.TLS != nil || strings.EqualFold(c.GetHeader("X-Forwarded-Proto"), "https") {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s/scim/v2/%s/%d", scheme, c.Request.Host, collection, id)
+}
+
+func scimMeta(c *gin.Context, resourceType, collection string, id int64, created, modified time.Time) gin.H {
+	return gin.H{
+		"resourceType": resourceType,
+		"created":      created.UTC().Format(time.RFC3339),
+		"lastModified": modified.UTC().Format(time.RFC3339),
+		"location":     scimLocation(c, collection, id),
+	}
+}
+
+func userResource(c *gin.Context, u *service.SCIMUser) gin.H {
+	r := gin.H{
+		"schemas":  []string{scimUserSchema},
+		"id":       strconv.FormatInt(u.ID, 10),
+		"userName": u.UserName,
+		"active":   u.Active,
+		"meta":     scimMeta(c, "User", "Users", u.ID, u.Created, u.LastModified),
+	}
+	if u.ExternalID != "" {
+		r["externalId"] = u.ExternalID
+	}
+	if u.DisplayName != "" {
+		r["displayName"] = u.DisplayName
+		r["name"] = gin.H{"formatted": u.DisplayName}
+	}
+	if u.Email != "" {
+		r["emails"] = []gin.H{{"value": u.Email, "type": "work", "primary": true}}
+	}
+	groups := make([]gin.H, 0, len(u.Groups))
+	for _, g := range u.Groups {
+		groups = append(groups, gin.H{"value": strconv.FormatInt(g.ID, 10), "display": g.Name})
+	}
+	r["groups"] = groups
+	return r
+}
+
+// groupResource members 为 false 时省略成员（excludedAttributes=members）
+func groupResource(c *gin.Context, g *service.SCIMGroup, members bool) gin.H {
+	r := gin.H{
+		"schemas":     []string{scimGroupSchema},
+		"id":          strconv.FormatInt(g.ID, 10),
+		"displayName": g.DisplayName,
+		"meta":        scimMeta(c, "Group", "Groups", g.ID, g.Created, g.LastModified),
+	}
+	if members {
+		list := make([]gin.H, 0, len(g.Members))
+		for _, m := range g.Members {
+			list = append(list, gin.H{
+				"value":   strconv.FormatInt(m.UserID, 10),
+				"display": m.UserName,
+				"$ref":    scimLocation(c, "Users", m.UserID),
+			})
+		}
+		r["members"] = list
+	}
+	return r
+}
+
+// wantMembers excludedAttributes 是否排除 members
+func wantMembers(c *gin.Context) bool {
+	for _, a := range strings.Split(c.Query("excludedAttributes"), ",") {
+		if strings.EqualFold(strings.TrimSpace(a), "members") {
+			return false
+		}
+	}
+	return true
+}
+
+func scimList(c *gin.Context, resources []gin.H, total int, q service.SCIMQuery) {
+	start := q.StartIndex
+	if start < 1 {
+		start = 1
+	}
+	scimJSON(c, http.StatusOK, gin.H{
+		"schemas":      []string{scimListSchema},
+		"totalResults": total,
+		"startIndex":   start,
+		"itemsPerPage": len(resources),
+		"Resources":    resources,
+	})
+}
+
+// ServiceProviderConfig GET /scim/v2/ServiceProviderConfig
+func (h *SCIMHandler) ServiceProviderConfig(c *gin.Context) {
+	scimJSON(c, http.StatusOK, gin.H{
+		"schemas":        []string{scimConfigSchema},
+		"patch":          gin.H{"supported": true},
+		"bulk":           gin.H{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         gin.H{"supported": true, "maxResults": service.SCIMMaxCount},
+		"changePassword": gin.H{"supported": false},
+		"sort":           gin.H{"supported": false},
+		"etag":           gin.H{"supported": false},
+		"authenticationSchemes": []gin.H{{
+			"type": "oauthbearertoken", "name": "Bearer Token", "description": "Authorization: Bearer <SCIM_TOKEN>",
+		}},
+	})
+}
+
+// ListUsers GET /scim/v2/Users
+func (h *SCIMHandler) ListUsers(c *gin.Context) {
+	q, ok := scimQuery(c)
+	if !ok {
+		return
+	}
+	users, total, err := h.scim.ListUsers(q)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	resources := make([]gin.H, 0, len(users))
+	for i := range users {
+		resources = append(resources, userResource(c, &users[i]))
+	}
+	scimList(c, resources, total, q)
+}
+
+// GetUser GET /scim/v2/Users/:id
+func (h *SCIMHandler) GetUser(c *gin.Context) {
+	id, ok := scimID(c)
+	if !ok {
+		return
+	}
+	u, err := h.scim.GetUser(id)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	scimJSON(c, http.StatusOK, userResource(c, u))
+}
+
+// CreateUser POST /scim/v2/Users
+func (h *SCIMHandler) CreateUser(c *gin.Context) {
+	var in service.SCIMUserInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		scimBadRequest(c, "invalidSyntax", "请求参数错误")
+		return
+	}
+	u, err := h.scim.CreateUser(&in)
+	if err != nil {
+		auditFailure(h.auditRepo, c, "scim_user_create", in.UserName, err)
+		scimError(c, err)
+		return
+	}
+	auditSuccess(h.auditRepo, c, "scim_user_create", u.UserName, audit.ReasonOK, audit.Metadata{ExternalID: u.ExternalID, Enabled: audit.Bool(u.Active)})
+	c.Header("Location", scimLocation(c, "Users", u.ID))
+	scimJSON(c, http.StatusCreated, userResource(c, u))
+}
+
+// ReplaceUser PUT /scim/v2/Users/:id
+func (h *SCIMHandler) ReplaceUser(c *gin.Context) {
+	id, ok := scimID(c)
+	if !ok {
+		return
+	}
+	var in service.SCIMUserInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		scimBadRequest(c, "invalidSyntax", "请求参数错误")
+		return
+	}
+	h.updateUser(c, id, func() (*service.SCIMUser, error) { return h.scim.ReplaceUser(id, &in) })
+}
+
+// PatchUser PATCH /scim/v2/Users/:id
+func (h *SCIMHandler) PatchUser(c *gin.Context) {
+	id, ok := scimID(c)
+	if !ok {
+		return
+	}
+	var req SCIMPatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		scimBadRequest(c, "invalidSyntax", "请求参数错误")
+		return
+	}
+	h.updateUser(c, id, func() (*service.SCIMUser, error) { return h.scim.PatchUser(id, req.Operations) })
+}
+
+// updateUser 执行更新并审计；active 由 true 变为 false 时记为 scim_user_deactivate
+func (h *SCIMHandler) updateUser(c *gin.Context, id int64, update func() (*service.SCIMUser, error)) {
+	old, err := h.scim.GetUser(id)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	u, err := update()
+	if err != nil {
+		auditFailure(h.auditRepo, c, "scim_user_update", old.UserName, err)
+		scimError(c, err)
+		return
+	}
+	switch {
+	case old.Active && !u.Active:
+		auditSuccess(h.auditRepo, c, "scim_user_deactivate", u.UserName, audit.ReasonOK, audit.Metadata{})
+	case !old.Active && u.Active:
+		auditSuccess(h.auditRepo, c, "scim_user_update", u.UserName, audit.ReasonReactivated, audit.Metadata{ExternalID: u.ExternalID, Enabled: audit.Bool(true)})
+	default:
+		auditSuccess(h.auditRepo, c, "scim_user_update", u.UserName, audit.ReasonOK, audit.Metadata{ExternalID: u.ExternalID, Enabled: audit.Bool(u.Active)})
+	}
+	scimJSON(c, http.StatusOK, userResource(c, u))
+}
+
+// DeleteUser DELETE /scim/v2/Users/:id
+func (h *SCIMHandler) DeleteUser(c *gin.Context) {
+	id, ok := scimID(c)
+	if !ok {
+		return
+	}
+	u, err := h.scim.DeleteUser(id)
+	if err != nil {
+		auditFailure(h.auditRepo, c, "scim_user_delete", c.Param("id"), err)
+		scimError(c, err)
+		return
+	}
+	auditSuccess(h.auditRepo, c, "scim_user_delete", u.UserName, audit.ReasonOK, audit.Metadata{})
+	c.Status(http.StatusNoContent)
+}
+
+// ListGroups GET /scim/v2/Groups
+func (h *SCIMHandler) ListGroups(c *gin.Context) {
+	q, ok := scimQuery(c)
+	if !ok {
+		return
+	}
+	groups, total, err := h.scim.ListGroups(q)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	members := wantMembers(c)
+	resources := make([]gin.H, 0, len(groups))
+	for i := range groups {
+		resources = append(resources, groupResource(c, &groups[i], members))
+	}
+	scimList(c, resources, total, q)
+}
+
+// GetGroup GET /scim/v2/Groups/:id
+func (h *SCIMHandler) GetGroup(c *gin.Context) {
+	id, ok := scimID(c)
+	if !ok {
+		return
+	}
+	g, err := h.scim.GetGroup(id)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	scimJSON(c, http.StatusOK, groupResource(c, g, wantMembers(c)))
+}
+
+// CreateGroup POST /scim/v2/Groups
+func (h *SCIMHandler) CreateGroup(c *gin.Context) {
+	var in service.SCIMGroupInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		scimBadRequest(c, "invalidSyntax", "请求参数错误")
+		return
+	}
+	g, err := h.scim.CreateGroup(&in)
+	if err != nil {
+		auditFailure(h.auditRepo, c, "scim_group_create", in.DisplayName, err)
+		scimError(c, err)
+		return
+	}
+	auditSuccess(h.auditRepo, c, "scim_group_create", g.DisplayName, audit.ReasonOK, audit.Metadata{Count: len(g.Members)})
+	c.Header("Location", scimLocation(c, "Groups", g.ID))
+	scimJSON(c, http.StatusCreated, groupResource(c, g, true))
+}
+
+// ReplaceGroup PUT /scim/v2/Groups/:id
+func (h *SCIMHandler) ReplaceGroup(c *gin.Context) {
+	id, ok := scimID(c)
+	if !ok {
+		return
+	}
+	var in service.SCIMGroupInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		scimBadRequest(c, "invalidSyntax", "请求参数错误")
+		return
+	}
+	h.updateGroup(c, id, func() (*service.SCIMGroup, error) { return h.scim.ReplaceGroup(id, &in) })
+}
+
+// PatchGroup PATCH /scim/v2/Groups/:id
+func (h *SCIMHandler) PatchGroup(c *gin.Context) {
+	id, ok := scimID(c)
+	if !ok {
+		return
+	}
+	var req SCIMPatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		scimBadRequest(c, "invalidSyntax", "请求参数错误")
+		return
+	}
+	h.updateGroup(c, id, func() (*service.SCIMGroup, error) { return h.scim.PatchGroup(id, req.Operations) })
+}
+
+// updateGroup 执行更新并审计成员变化
+func (h *SCIMHandler) updateGroup(c *gin.Context, id int64, update func() (*service.SCIMGroup, error)) {
+	old, err := h.scim.GetGroup(id)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	g, err := update()
+	if err != nil {
+		auditFailure(h.auditRepo, c, "scim_group_update", old.DisplayName, err)
+		scimError(c, err)
+		return
+	}
+	added, removed := memberDiff(old.Members, g.Members)
+	auditSuccess(h.auditRepo, c, "scim_group_update", g.DisplayName, audit.ReasonOK, audit.Metadata{
+		OldName: old.DisplayName, Name: g.DisplayName, Added: added, Removed: removed,
+	})
+	scimJSON(c, http.StatusOK, groupResource(c, g, true))
+}
+
+// memberDiff 成员变化（用户名）
+func memberDiff(before, after []service.SCIMMember) (added, removed []string) {
+	had := map[int64]bool{}
+	for _, m := range before {
+		had[m.UserID] = true
+	}
+	has := map[int64]bool{}
+	for _, m := range after {
+		has[m.UserID] = true
+		if !had[m.UserID] {
+			added = append(added, m.UserName)
+		}
+	}
+	for _, m := range before {
+		if !has[m.UserID] {
+			removed = append(removed, m.UserName)
+		}
+	}
+	return added, removed
+}
+
+// DeleteGroup DELETE /scim/v2/Groups/:id
+func (h *SCIMHandler) DeleteGroup(c *gin.Context) {
+	id, ok := scimID(c)
+	if !ok {
+		return
+	}
+	g, err := h.scim.DeleteGroup(id)
+	if err != nil {
+		auditFailure(h.auditRepo, c, "scim_group_delete", c.Param("id"), err)
+		scimError(c, err)
+		return
+	}
+	auditSuccess(h.auditRepo, c, "scim_group_delete", g.DisplayName, audit.ReasonOK, audit.Metadata{})
+	c.Status(http.StatusNoContent)
+}
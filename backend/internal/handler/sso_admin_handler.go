@@ -2,10 +2,10 @@ package handler
 
 import (
 	"encoding/json"
-	"fmt"
 	"net/http"
 	"strconv"
 
+	"dvr-manager/internal/audit"
 	"dvr-manager/internal/repository"
 	"dvr-manager/internal/service"
 
@@ -14,14 +14,15 @@ import (
 
 // SSOAdminHandler 管理员对 SSO 提供商进行 CRUD
 type SSOAdminHandler struct {
-	repo       repository.SSORepository
-	ssoService service.SSOService
-	auditRepo  repository.AuditRepository
+	repo        repository.SSORepository
+	ssoService  service.SSOService
+	roleService service.RoleService
+	auditRepo   repository.AuditRepository
 }
 
 // NewSSOAdminHandler 创建 SSO 管理处理器
-func NewSSOAdminHandler(repo repository.SSORepository, ssoService service.SSOService, auditRepo repository.AuditRepository) *SSOAdminHandler {
-	return &SSOAdminHandler{repo: repo, ssoService: ssoService, auditRepo: auditRepo}
+func NewSSOAdminHandler(repo repository.SSORepository, ssoService service.SSOService, roleService service.RoleService, auditRepo repository.AuditRepository) *SSOAdminHandler {
+	return &SSOAdminHandler{repo: repo, ssoService: ssoService, roleService: roleService, auditRepo: auditRepo}
 }
 
 // SSOProviderRequest 新建/更新请求
@@ -32,17 +33,6 @@ type SSOProviderRequest struct {
 	Config  map[string]interface{} `json:"config" binding:"required"`
 }
 
-func (h *SSOAdminHandler) audit(c *gin.Context, action, resource, detail, status string) {
-	if h.auditRepo == nil {
-		return
-	}
-	username, _ := c.Get("username")
-	userStr, _ := username.(string)
-	role, _ := c.Get("role")
-	roleStr, _ := role.(string)
-	_ = h.auditRepo.Insert(action, userStr, roleStr, c.ClientIP(), resource, detail, status)
-}
-
 // List GET /api/admin/sso/providers
 func (h *SSOAdminHandler) List(c *gin.Context) {
 	list, err := h.repo.List()
@@ -81,11 +71,13 @@ func (h *SSOAdminHandler) Create(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "请求参数错误"})
 		return
 	}
-	if req.Type != repository.SSOTypeOIDC {
-		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "type 必须为 oidc"})
+	switch req.Type {
+	case repository.SSOTypeOIDC, repository.SSOTypeLDAP, repository.SSOTypeSAML:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "type 必须为 oidc、ldap 或 saml"})
 		return
 	}
-	if msg := validateProviderConfig(req.Type, req.Config); msg != "" {
+	if msg := validateProviderConfig(req.Type, req.Config, h.roleService); msg != "" {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": msg})
 		return
 	}
@@ -102,12 +94,12 @@ func (h *SSOAdminHandler) Create(c *gin.Context) {
 	}
 	created, err := h.repo.Create(p)
 	if err != nil {
-		h.audit(c, "sso_create", req.Name, err.Error(), "fail")
+		auditFailure(h.auditRepo, c, "sso_create", req.Name, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": err.Error()})
 		return
 	}
 	_ = h.ssoService.Reload()
-	h.audit(c, "sso_create", req.Name, fmt.Sprintf("新建 SSO 提供商（%s）", req.Type), "success")
+	auditSuccess(h.auditRepo, c, "sso_create", req.Name, audit.ReasonOK, audit.Metadata{Source: req.Type})
 	c.JSON(http.StatusOK, gin.H{"success": true, "id": created.ID})
 }
 
@@ -128,7 +120,7 @@ func (h *SSOAdminHandler) Update(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": err.Error()})
 		return
 	}
-	if msg := validateProviderConfig(exist.Type, req.Config); msg != "" {
+	if msg := validateProviderConfig(exist.Type, req.Config, h.roleService); msg != "" {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": msg})
 		return
 	}
@@ -141,12 +133,12 @@ func (h *SSOAdminHandler) Update(c *gin.Context) {
 	exist.Enabled = req.Enabled
 	exist.ConfigJSON = string(raw)
 	if err := h.repo.Update(exist); err != nil {
-		h.audit(c, "sso_update", req.Name, err.Error(), "fail")
+		auditFailure(h.auditRepo, c, "sso_update", req.Name, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": err.Error()})
 		return
 	}
 	_ = h.ssoService.Reload()
-	h.audit(c, "sso_update", req.Name, "更新 SSO 提供商", "success")
+	auditSuccess(h.auditRepo, c, "sso_update", req.Name, audit.ReasonOK, audit.Metadata{})
 	c.JSON(http.StatusOK, gin.H{"success": true})
 }
 
@@ -167,11 +159,7 @@ func (h *SSOAdminHandler) Toggle(c *gin.Context) {
 		return
 	}
 	_ = h.ssoService.Reload()
-	state := "已停用"
-	if !exist.Enabled {
-		state = "已启用"
-	}
-	h.audit(c, "sso_toggle", exist.Name, state, "success")
+	auditSuccess(h.auditRepo, c, "sso_toggle", exist.Name, audit.ReasonOK, audit.Metadata{Enabled: audit.Bool(!exist.Enabled)})
 	c.JSON(http.StatusOK, gin.H{"success": true, "enabled": !exist.Enabled})
 }
 
@@ -188,23 +176,46 @@ func (h *SSOAdminHandler) Delete(c *gin.Context) {
 		return
 	}
 	if err := h.repo.Delete(id); err != nil {
-		h.audit(c, "sso_delete", exist.Name, err.Error(), "fail")
+		auditFailure(h.auditRepo, c, "sso_delete", exist.Name, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": err.Error()})
 		return
 	}
 	_ = h.ssoService.Reload()
-	h.audit(c, "sso_delete", exist.Name, "删除 SSO 提供商", "success")
+	auditSuccess(h.auditRepo, c, "sso_delete", exist.Name, audit.ReasonOK, audit.Metadata{})
 	c.JSON(http.StatusOK, gin.H{"success": true})
 }
 
-// validateProviderConfig 简单校验关键字段
-func validateProviderConfig(t string, cfg map[string]interface{}) string {
-	if t == repository.SSOTypeOIDC {
+// validateProviderConfig 简单校验关键字段及映射的角色是否存在
+func validateProviderConfig(t string, cfg map[string]interface{}, roles service.RoleService) string {
+	switch t {
+	case repository.SSOTypeOIDC:
 		for _, k := range []string{"issuer", "client_id", "client_secret", "redirect_url"} {
 			if v, _ := cfg[k].(string); v == "" {
 				return "OIDC 缺少必填字段: " + k
 			}
 		}
+		raw, _ := json.Marshal(cfg)
+		if err := service.ValidateOIDCConfig(string(raw), roles); err != nil {
+			return "OIDC 配置无效: " + err.Error()
+		}
+	case repository.SSOTypeLDAP:
+		for _, k := range []string{"url", "base_dn"} {
+			if v, _ := cfg[k].(string); v == "" {
+				return "LDAP 缺少必填字段: " + k
+			}
+		}
+		raw, _ := json.Marshal(cfg)
+		if err := service.ValidateLDAPConfig(string(raw), roles); err != nil {
+			return "LDAP 配置无效: " + err.Error()
+		}
+	case repository.SSOTypeSAML:
+		if v, _ := cfg["root_url"].(string); v == "" {
+			return "SAML 缺少必填字段: root_url"
+		}
+		raw, _ := json.Marshal(cfg)
+		if err := service.ValidateSAMLConfig(string(raw), roles); err != nil {
+			return "SAML 配置无效: " + err.Error()
+		}
 	}
 	return ""
 }
@@ -1,13 +1,15 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"net/url"
 	"strconv"
+	"time"
 
-	"dvr-manager/internal/auth"
+	"dvr-manager/internal/audit"
 	"dvr-manager/internal/repository"
 	"dvr-manager/internal/service"
 
@@ -16,19 +18,19 @@ import (
 
 // SSOHandler SSO 公共处理器
 type SSOHandler struct {
-	ssoService  service.SSOService
-	authService service.AuthService
-	auditRepo   repository.AuditRepository
-	jwt         *auth.JWT
+	ssoService   service.SSOService
+	authService  service.AuthService
+	tokenService service.TokenService
+	auditRepo    repository.AuditRepository
 }
 
 // NewSSOHandler 创建 SSO 处理器
-func NewSSOHandler(ssoService service.SSOService, authService service.AuthService, auditRepo repository.AuditRepository, jwt *auth.JWT) *SSOHandler {
+func NewSSOHandler(ssoService service.SSOService, authService service.AuthService, tokenService service.TokenService, auditRepo repository.AuditRepository) *SSOHandler {
 	return &SSOHandler{
-		ssoService:  ssoService,
-		authService: authService,
-		auditRepo:   auditRepo,
-		jwt:         jwt,
+		ssoService:   ssoService,
+		authService:  authService,
+		tokenService: tokenService,
+		auditRepo:    auditRepo,
 	}
 }
 
@@ -52,18 +54,22 @@ func parseID(c *gin.Context) (int64, bool) {
 }
 
 // finishLogin 颁发 JWT 并通过 URL fragment 重定向（避免 token 进入服务端日志）
-func (h *SSOHandler) finishLogin(c *gin.Context, user *service.User, source string) {
-	token, err := h.jwt.Generate(user.Username, user.Role)
+func (h *SSOHandler) finishLogin(c *gin.Context, user *service.User, ident *service.SSOIdentity, source string) {
+	pair, err := h.tokenService.IssueSSO(user, c.ClientIP(), c.Request.UserAgent(),
+		service.SSOSession{Source: source, IDTokenHint: ident.IDToken})
 	if err != nil {
 		log.Printf("[SSO] 生成令牌失败: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "生成令牌失败"})
 		return
 	}
 	if h.auditRepo != nil {
-		_ = h.auditRepo.Insert("login_success", user.Username, user.Role, c.ClientIP(), source, "SSO 登录成功", "success")
+		_ = h.auditRepo.Insert(newLoginEvent(c, "login_success", user.Username, user.Role, source, audit.StatusSuccess,
+			audit.ReasonSSO, audit.Metadata{Source: source}))
 	}
 	frag := url.Values{}
-	frag.Set("token", token)
+	frag.Set("token", pair.AccessToken)
+	frag.Set("refresh_token", pair.RefreshToken)
+	frag.Set("expires_in", strconv.FormatInt(pair.ExpiresIn, 10))
 	frag.Set("username", user.Username)
 	frag.Set("role", user.Role)
 	c.Redirect(http.StatusFound, "/sso-callback#"+frag.Encode())
@@ -75,17 +81,12 @@ func (h *SSOHandler) OIDCLogin(c *gin.Context) {
 	if !ok {
 		return
 	}
-	state, err := service.GenerateState()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": err.Error()})
-		return
-	}
-	authURL, err := h.ssoService.BuildOIDCAuthURL(id, state)
+	authURL, flow, err := h.ssoService.BuildOIDCAuthURL(id)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
 		return
 	}
-	c.SetCookie(oidcStateCookieName(id), state, 600, "/", "", c.Request.TLS != nil, true)
+	c.SetCookie(oidcFlowCookieName(id), flow, 600, "/", "", c.Request.TLS != nil, true)
 	c.Redirect(http.StatusFound, authURL)
 }
 
@@ -95,12 +96,12 @@ func (h *SSOHandler) OIDCCallback(c *gin.Context) {
 	if !ok {
 		return
 	}
-	clientIP := c.ClientIP()
 
 	if errStr := c.Query("error"); errStr != "" {
 		desc := c.Query("error_description")
 		if h.auditRepo != nil {
-			_ = h.auditRepo.Insert("login_fail", "", "", clientIP, fmt.Sprintf("oidc:%d", id), errStr+": "+desc, "fail")
+			_ = h.auditRepo.Insert(newLoginEvent(c, "login_fail", "", "", fmt.Sprintf("oidc:%d", id), audit.StatusFail,
+				audit.ReasonIdPError, audit.Metadata{ErrorCode: errStr, Error: desc}))
 		}
 		c.Redirect(http.StatusFound, "/sso-callback#error="+url.QueryEscape(errStr+": "+desc))
 		return
@@ -113,37 +114,149 @@ func (h *SSOHandler) OIDCCallback(c *gin.Context) {
 		return
 	}
 
-	expectedState, _ := c.Cookie(oidcStateCookieName(id))
-	if expectedState == "" || expectedState != state {
+	// 流程 Cookie 一次性使用：无论成功与否都清除
+	flow, _ := c.Cookie(oidcFlowCookieName(id))
+	c.SetCookie(oidcFlowCookieName(id), "", -1, "/", "", c.Request.TLS != nil, true)
+
+	ident, err := h.ssoService.ExchangeOIDC(c.Request.Context(), id, code, state, flow)
+	if err != nil {
 		if h.auditRepo != nil {
-			_ = h.auditRepo.Insert("login_fail", "", "", clientIP, fmt.Sprintf("oidc:%d", id), "state 校验失败", "fail")
+			_ = h.auditRepo.Insert(newLoginEvent(c, "login_fail", "", "", fmt.Sprintf("oidc:%d", id), audit.StatusFail,
+				ssoFailureReason(err), failureMetadata(err)))
 		}
-		c.Redirect(http.StatusFound, "/sso-callback#error="+url.QueryEscape("state 校验失败"))
+		c.Redirect(http.StatusFound, "/sso-callback#error="+url.QueryEscape(err.Error()))
 		return
 	}
-	c.SetCookie(oidcStateCookieName(id), "", -1, "/", "", c.Request.TLS != nil, true)
 
-	username, err := h.ssoService.ExchangeOIDC(c.Request.Context(), id, code)
-	if err != nil {
+	h.loginSSOUser(c, ident, fmt.Sprintf("oidc:%d", id))
+}
+
+// loginSSOUser 查找或创建 SSO 用户，按 IdP 映射同步角色（审计 user_update_role）与用户组（审计 group_sync）后完成登录
+func (h *SSOHandler) loginSSOUser(c *gin.Context, ident *service.SSOIdentity, source string) {
+	clientIP := c.ClientIP()
+	user, err := h.authService.FindOrCreateSSOUser(ident, source, clientIP)
+	var linkErr *service.SSOLinkRequiredError
+	if errors.As(err, &linkErr) {
+		// 同名账号已存在：由账号本人在前端输入密码确认关联
 		if h.auditRepo != nil {
-			_ = h.auditRepo.Insert("login_fail", "", "", clientIP, fmt.Sprintf("oidc:%d", id), err.Error(), "fail")
+			_ = h.auditRepo.Insert(newLoginEvent(c, "login_fail", linkErr.Username, "", source, audit.StatusFail,
+				audit.ReasonSSOLinkRequired, audit.Metadata{Source: source}))
 		}
-		c.Redirect(http.StatusFound, "/sso-callback#error="+url.QueryEscape(err.Error()))
+		frag := url.Values{}
+		frag.Set("link_token", linkErr.LinkToken)
+		frag.Set("username", linkErr.Username)
+		c.Redirect(http.StatusFound, "/sso-callback#"+frag.Encode())
 		return
 	}
-
-	source := fmt.Sprintf("oidc:%d", id)
-	user, err := h.authService.FindOrCreateSSOUser(username, source)
 	if err != nil {
 		if h.auditRepo != nil {
-			_ = h.auditRepo.Insert("login_fail", username, "", clientIP, source, err.Error(), "fail")
+			_ = h.auditRepo.Insert(newLoginEvent(c, "login_fail", ident.Username, "", source, audit.StatusFail,
+				ssoFailureReason(err), failureMetadata(err)))
 		}
 		c.Redirect(http.StatusFound, "/sso-callback#error="+url.QueryEscape(err.Error()))
 		return
 	}
-	h.finishLogin(c, user, source)
+	oldRole := user.Role
+	changed, err := h.authService.SyncSSORole(user, ident, source)
+	if err != nil {
+		log.Printf("[SSO] sync role of %s failed: %v", user.Username, err)
+	} else if changed && h.auditRepo != nil {
+		_ = h.auditRepo.Insert(newLoginEvent(c, "user_update_role", user.Username, user.Role, source, audit.StatusSuccess,
+			audit.ReasonIdPMapping, audit.Metadata{OldRole: oldRole, Role: user.Role, Source: source}))
+	}
+	added, removed, err := h.authService.SyncSSOGroups(user, ident, source)
+	if err != nil {
+		log.Printf("[SSO] sync groups of %s failed: %v", user.Username, err)
+	} else if (len(added) > 0 || len(removed) > 0) && h.auditRepo != nil {
+		_ = h.auditRepo.Insert(newLoginEvent(c, "group_sync", user.Username, user.Role, source, audit.StatusSuccess,
+			audit.ReasonIdPMapping, audit.Metadata{Added: added, Removed: removed, Source: source}))
+	}
+	h.finishLogin(c, user, ident, source)
+}
+
+// ssoFailureReason SSO 回调失败的原因码；未归类的错误（令牌交换、签名校验等）记为 sso_failed
+func ssoFailureReason(err error) string {
+	if reason := failureReason(err); reason != audit.ReasonError {
+		return reason
+	}
+	return audit.ReasonSSOFailed
+}
+
+func oidcFlowCookieName(id int64) string {
+	return fmt.Sprintf("oidc_flow_%d", id)
 }
 
-func oidcStateCookieName(id int64) string {
-	return fmt.Sprintf("oidc_state_%d", id)
+func samlFlowCookieName(id int64) string {
+	return fmt.Sprintf("saml_flow_%d", id)
+}
+
+// setSAMLFlowCookie IdP 以跨站 POST 回到 ACS，Cookie 须为 SameSite=None（浏览器要求同时带 Secure）
+func setSAMLFlowCookie(c *gin.Context, id int64, value string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     samlFlowCookieName(id),
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteNoneMode,
+	})
+}
+
+// SAMLMetadata SP 元数据（供 IdP 导入）
+func (h *SSOHandler) SAMLMetadata(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+	data, err := h.ssoService.SAMLMetadata(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, "application/samlmetadata+xml", data)
+}
+
+// SAMLLogin 发起 SP 登录（HTTP-Redirect 跳转或 HTTP-POST 自动提交表单）
+func (h *SSOHandler) SAMLLogin(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+	req, err := h.ssoService.BuildSAMLAuthRequest(id, "")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	setSAMLFlowCookie(c, id, req.FlowCookie, int(service.SAMLRequestTTL/time.Second))
+	if req.PostForm != nil {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", req.PostForm)
+		return
+	}
+	c.Redirect(http.StatusFound, req.RedirectURL)
+}
+
+// SAMLACS 断言消费端点（IdP 以 HTTP-POST 提交 SAMLResponse）
+func (h *SSOHandler) SAMLACS(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+	source := fmt.Sprintf("saml:%d", id)
+
+	// 请求 ID Cookie 一次性使用：无论成功与否都清除
+	flow, _ := c.Cookie(samlFlowCookieName(id))
+	setSAMLFlowCookie(c, id, "", -1)
+
+	ident, err := h.ssoService.ParseSAMLResponse(id, c.Request, flow)
+	if err != nil {
+		log.Printf("[SSO] %s: %v", source, err)
+		if h.auditRepo != nil {
+			_ = h.auditRepo.Insert(newLoginEvent(c, "login_fail", "", "", source, audit.StatusFail,
+				ssoFailureReason(err), failureMetadata(err)))
+		}
+		c.Redirect(http.StatusFound, "/sso-callback#error="+url.QueryEscape("SAML 响应校验失败"))
+		return
+	}
+	h.loginSSOUser(c, ident, source)
 }
@@ -4,7 +4,10 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
+	"dvr-manager/internal/audit"
 	"dvr-manager/internal/repository"
 	"dvr-manager/internal/service"
 
@@ -13,50 +16,115 @@ import (
 
 // UserHandler 用户管理处理器（管理员）
 type UserHandler struct {
-	authService service.AuthService
-	auditRepo   repository.AuditRepository
+	authService    service.AuthService
+	roleService    service.RoleService
+	sessionService service.SessionService
+	tokenService   service.TokenService
+	throttle       service.LoginThrottleService
+	auditRepo      repository.AuditRepository
 }
 
 // NewUserHandler 创建用户管理处理器
-func NewUserHandler(authService service.AuthService, auditRepo repository.AuditRepository) *UserHandler {
-	return &UserHandler{authService: authService, auditRepo: auditRepo}
+func NewUserHandler(authService service.AuthService, roleService service.RoleService, sessionService service.SessionService, tokenService service.TokenService, throttle service.LoginThrottleService, auditRepo repository.AuditRepository) *UserHandler {
+	return &UserHandler{authService: authService, roleService: roleService, sessionService: sessionService, tokenService: tokenService, throttle: throttle, auditRepo: auditRepo}
 }
 
 // CreateUserRequest 新增用户请求
 type CreateUserRequest struct {
 	Username string `json:"username" binding:"required"`
-	Password string `json:"password" binding:"required,min=6"`
-	Role     string `json:"role" binding:"required,oneof=admin user"`
+	Password string `json:"password" binding:"required"`
+	Role     string `json:"role" binding:"required"`
 }
 
 // UpdateRoleRequest 修改角色请求
 type UpdateRoleRequest struct {
-	Role string `json:"role" binding:"required,oneof=admin user"`
+	Role string `json:"role" binding:"required"`
 }
 
 // ResetPasswordRequest 重置密码请求
 type ResetPasswordRequest struct {
-	NewPassword string `json:"new_password" binding:"required,min=6"`
+	NewPassword string `json:"new_password" binding:"required"`
 }
 
-func (h *UserHandler) audit(c *gin.Context, action, resource, detail, status string) {
-	if h.auditRepo == nil {
-		return
+// actorRoles 当前用户的有效角色（用户角色 + 所在组授予的角色）
+func actorRoles(c *gin.Context) []string {
+	if v, ok := c.Get("roles"); ok {
+		if list, ok := v.([]string); ok {
+			return list
+		}
+	}
+	return []string{c.GetString("role")}
+}
+
+// requireCovers 当前用户的有效角色须覆盖目标角色的全部权限，否则返回 403（防止拥有 users:write 的角色越权提权）
+func requireCovers(c *gin.Context, roleService service.RoleService, roles ...string) bool {
+	actor := actorRoles(c)
+	for _, r := range roles {
+		if r == "" {
+			continue
+		}
+		if !roleService.Covers(actor, r) {
+			c.JSON(http.StatusForbidden, gin.H{"success": false, "message": fmt.Sprintf("无权授予或管理角色 %s（权限超出当前角色）", r), "code": "permission_denied"})
+			return false
+		}
 	}
-	username, _ := c.Get("username")
-	userStr, _ := username.(string)
-	role, _ := c.Get("role")
-	roleStr, _ := role.(string)
-	_ = h.auditRepo.Insert(action, userStr, roleStr, c.ClientIP(), resource, detail, status)
+	return true
+}
+
+// canManage 见 requireCovers
+func (h *UserHandler) canManage(c *gin.Context, roles ...string) bool {
+	return requireCovers(c, h.roleService, roles...)
+}
+
+// UserListQuery 用户列表筛选参数
+type UserListQuery struct {
+	Q               string `form:"q"`                 // 用户名 / 邮箱 / 显示名模糊匹配
+	Role            string `form:"role"`              // 角色名
+	Source          string `form:"source"`            // local / ldap:<id> / oidc:<id> / saml:<id>
+	LastLoginAfter  string `form:"last_login_after"`  // RFC3339
+	LastLoginBefore string `form:"last_login_before"` // RFC3339，含从未登录的用户
+	NeverLoggedIn   bool   `form:"never_logged_in"`
+	Status          string `form:"status"` // enabled / disabled
 }
 
-// List 列出所有用户
+// List 列出用户（含登录失败锁定状态），支持按资料与最近登录筛选
 func (h *UserHandler) List(c *gin.Context) {
-	users, err := h.authService.ListUsers()
+	var q UserListQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "请求参数错误"})
+		return
+	}
+	f := repository.UserFilter{Query: q.Q, Role: q.Role, Source: q.Source, NeverLoggedIn: q.NeverLoggedIn, Status: q.Status}
+	if q.LastLoginAfter != "" {
+		t, err := time.Parse(time.RFC3339, q.LastLoginAfter)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "invalid last_login_after time"})
+			return
+		}
+		t = t.Local()
+		f.LastLoginAfter = &t
+	}
+	if q.LastLoginBefore != "" {
+		t, err := time.Parse(time.RFC3339, q.LastLoginBefore)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "invalid last_login_before time"})
+			return
+		}
+		t = t.Local()
+		f.LastLoginBefore = &t
+	}
+	users, err := h.authService.ListUsers(f)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": err.Error()})
 		return
 	}
+	if locked, err := h.throttle.LockedUsers(); err == nil {
+		for i := range users {
+			if until, ok := locked[strings.ToLower(users[i].Username)]; ok {
+				users[i].LockedUntil = &until
+			}
+		}
+	}
 	c.JSON(http.StatusOK, gin.H{"success": true, "list": users})
 }
 
@@ -67,13 +135,16 @@ func (h *UserHandler) Create(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "请求参数错误"})
 		return
 	}
+	if !h.canManage(c, req.Role) {
+		return
+	}
 	u, err := h.authService.CreateUser(req.Username, req.Password, req.Role)
 	if err != nil {
-		h.audit(c, "user_create", req.Username, err.Error(), "fail")
+		auditFailure(h.auditRepo, c, "user_create", req.Username, err)
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
 		return
 	}
-	h.audit(c, "user_create", req.Username, fmt.Sprintf("创建用户（角色=%s）", req.Role), "success")
+	auditSuccess(h.auditRepo, c, "user_create", req.Username, audit.ReasonOK, audit.Metadata{Role: req.Role})
 	c.JSON(http.StatusOK, gin.H{"success": true, "user": u})
 }
 
@@ -90,27 +161,54 @@ func (h *UserHandler) UpdateRole(c *gin.Context) {
 		return
 	}
 
-	// 防止管理员把自己降级（保证至少有一个 admin）
+	// 防止修改自己的角色（管理员自降级，或借 users:write 自行提权）
 	target, err := h.authService.GetUserByID(id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": err.Error()})
 		return
 	}
 	currentUser, _ := c.Get("username")
-	if currentUserStr, _ := currentUser.(string); currentUserStr == target.Username && req.Role != "admin" {
-		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "不能修改自己的管理员角色"})
+	if currentUserStr, _ := currentUser.(string); currentUserStr == target.Username && req.Role != target.Role {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "不能修改自己的角色"})
+		return
+	}
+	if !h.canManage(c, append(target.Roles(), req.Role)...) {
 		return
 	}
 
 	if err := h.authService.UpdateUserRole(id, req.Role); err != nil {
-		h.audit(c, "user_update_role", target.Username, err.Error(), "fail")
+		auditFailure(h.auditRepo, c, "user_update_role", target.Username, err)
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
 		return
 	}
-	h.audit(c, "user_update_role", target.Username, fmt.Sprintf("修改角色为 %s", req.Role), "success")
+	auditSuccess(h.auditRepo, c, "user_update_role", target.Username, audit.ReasonOK, audit.Metadata{OldRole: target.Role, Role: req.Role})
 	c.JSON(http.StatusOK, gin.H{"success": true})
 }
 
+// Unlock 解除连续登录失败导致的临时锁定
+func (h *UserHandler) Unlock(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "无效的用户 ID"})
+		return
+	}
+	target, err := h.authService.GetUserByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	if !h.canManage(c, target.Roles()...) {
+		return
+	}
+	if err := h.throttle.Unlock(target.Username); err != nil {
+		auditFailure(h.auditRepo, c, "user_unlock", target.Username, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	auditSuccess(h.auditRepo, c, "user_unlock", target.Username, audit.ReasonOK, audit.Metadata{})
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "已解锁"})
+}
+
 // ResetPassword 重置某个用户的密码
 func (h *UserHandler) ResetPassword(c *gin.Context) {
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
@@ -128,13 +226,16 @@ func (h *UserHandler) ResetPassword(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": err.Error()})
 		return
 	}
+	if !h.canManage(c, target.Roles()...) {
+		return
+	}
 	if err := h.authService.ResetPassword(id, req.NewPassword); err != nil {
-		h.audit(c, "user_reset_password", target.Username, err.Error(), "fail")
+		auditFailure(h.auditRepo, c, "user_reset_password", target.Username, err)
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
 		return
 	}
-	h.audit(c, "user_reset_password", target.Username, "重置密码", "success")
-	c.JSON(http.StatusOK, gin.H{"success": true, "message": "密码已重置"})
+	auditSuccess(h.auditRepo, c, "user_reset_password", target.Username, audit.ReasonOK, audit.Metadata{})
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "密码已重置，用户须在下次登录后修改密码"})
 }
 
 // Delete 删除用户
@@ -157,30 +258,392 @@ func (h *UserHandler) Delete(c *gin.Context) {
 		return
 	}
 
-	// 删除时确保至少保留一个管理员
-	if target.Role == "admin" {
-		users, err := h.authService.ListUsers()
+	if !h.canManage(c, target.Roles()...) {
+		return
+	}
+
+	// 删除时确保至少保留一个可用的管理员
+	if target.Role == "admin" && !target.Disabled {
+		admins, err := h.authService.ListUsers(repository.UserFilter{Role: "admin", Status: "enabled"})
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "无法验证管理员数量"})
 			return
 		}
-		admins := 0
-		for _, u := range users {
-			if u.Role == "admin" {
-				admins++
-			}
-		}
-		if admins <= 1 {
+		if len(admins) <= 1 {
 			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "至少保留一个管理员账号"})
 			return
 		}
 	}
 
 	if err := h.authService.DeleteUser(id); err != nil {
-		h.audit(c, "user_delete", target.Username, err.Error(), "fail")
+		auditFailure(h.auditRepo, c, "user_delete", target.Username, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	auditSuccess(h.auditRepo, c, "user_delete", target.Username, audit.ReasonOK, audit.Metadata{})
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// BulkStatusRequest 批量停用 / 启用请求
+type BulkStatusRequest struct {
+	UserIDs []int64 `json:"user_ids" binding:"required"`
+	Reason  string  `json:"reason"` // 停用原因（仅停用时记录）
+}
+
+// BulkStatusResult 批量操作中单个用户的结果
+type BulkStatusResult struct {
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username,omitempty"`
+	Success  bool   `json:"success"`
+	Message  string `json:"message,omitempty"`
+}
+
+// maxBulkUsers 单次批量操作的用户数上限
+const maxBulkUsers = 500
+
+// Disable POST /api/admin/users/disable 批量停用账号（吊销其会话）；逐个返回结果
+func (h *UserHandler) Disable(c *gin.Context) {
+	h.bulkSetDisabled(c, true)
+}
+
+// Enable POST /api/admin/users/enable 批量启用账号
+func (h *UserHandler) Enable(c *gin.Context) {
+	h.bulkSetDisabled(c, false)
+}
+
+func (h *UserHandler) bulkSetDisabled(c *gin.Context, disabled bool) {
+	var req BulkStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.UserIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "请求参数错误"})
+		return
+	}
+	if len(req.UserIDs) > maxBulkUsers {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": fmt.Sprintf("单次最多操作 %d 个用户", maxBulkUsers)})
+		return
+	}
+	action := "user_enable"
+	if disabled {
+		action = "user_disable"
+	}
+
+	// 停用时确保至少保留一个可用的管理员
+	enabledAdmins := 0
+	if disabled {
+		admins, err := h.authService.ListUsers(repository.UserFilter{Role: "admin", Status: "enabled"})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "无法验证管理员数量"})
+			return
+		}
+		enabledAdmins = len(admins)
+	}
+
+	actor := actorRoles(c)
+	current := c.GetString("username")
+	results := make([]BulkStatusResult, 0, len(req.UserIDs))
+	done := 0
+	seen := map[int64]bool{}
+	for _, id := range req.UserIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		r := BulkStatusResult{UserID: id}
+		target, err := h.authService.GetUserByID(id)
+		switch {
+		case err != nil:
+			r.Message = err.Error()
+		case target.Disabled == disabled:
+			r.Username, r.Success = target.Username, true
+			r.Message = "状态未变化"
+		case disabled && target.Username == current:
+			r.Username, r.Message = target.Username, "不能停用当前登录的用户"
+		case !h.coversAll(actor, target.Roles()):
+			r.Username, r.Message = target.Username, "无权管理该用户（权限超出当前角色）"
+		case disabled && target.Role == "admin" && enabledAdmins <= 1:
+			r.Username, r.Message = target.Username, "至少保留一个管理员账号"
+		default:
+			r.Username = target.Username
+			if err := h.authService.SetUserDisabled(id, disabled, req.Reason); err != nil {
+				r.Message = err.Error()
+				auditFailure(h.auditRepo, c, action, target.Username, err)
+				break
+			}
+			if disabled && target.Role == "admin" {
+				enabledAdmins--
+			}
+			r.Success = true
+			done++
+			md := audit.Metadata{}
+			if disabled {
+				md.Note = strings.TrimSpace(req.Reason)
+			}
+			auditSuccess(h.auditRepo, c, action, target.Username, audit.ReasonOK, md)
+		}
+		results = append(results, r)
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "updated": done, "results": results})
+}
+
+// coversAll 不写响应的 requireCovers，用于批量操作逐个判断
+func (h *UserHandler) coversAll(actor, roles []string) bool {
+	for _, r := range roles {
+		if r != "" && !h.roleService.Covers(actor, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// UpdateRestrictionsRequest 账号有效期与登录限制；expires_at 为空表示长期有效
+type UpdateRestrictionsRequest struct {
+	ExpiresAt    *time.Time `json:"expires_at"`
+	LoginHours   string     `json:"login_hours"`   // HH:MM-HH:MM，逗号分隔，服务器本地时间
+	AllowedCIDRs []string   `json:"allowed_cidrs"` // IP 或网段
+}
+
+// UpdateRestrictions PUT /api/admin/users/:id/restrictions
+func (h *UserHandler) UpdateRestrictions(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "无效的用户 ID"})
+		return
+	}
+	var req UpdateRestrictionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "请求参数错误"})
+		return
+	}
+	target, err := h.authService.GetUserByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	// 防止管理员误把自己锁在外面
+	if target.Username == c.GetString("username") {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "不能修改自己的登录限制"})
+		return
+	}
+	if !h.canManage(c, target.Roles()...) {
+		return
+	}
+	u, err := h.authService.UpdateUserRestrictions(id, repository.UserRestrictions{
+		ExpiresAt: req.ExpiresAt, LoginHours: req.LoginHours, AllowedCIDRs: req.AllowedCIDRs,
+	})
+	if err != nil {
+		auditFailure(h.auditRepo, c, "user_update_restrictions", target.Username, err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	md := audit.Metadata{LoginHours: u.LoginHours, CIDRs: u.AllowedCIDRs}
+	if u.ExpiresAt != nil {
+		md.ExpiresAt = u.ExpiresAt.Format("2006-01-02 15:04")
+	}
+	auditSuccess(h.auditRepo, c, "user_update_restrictions", target.Username, audit.ReasonOK, md)
+	c.JSON(http.StatusOK, gin.H{"success": true, "user": u})
+}
+
+// ListSessions 列出用户会话（默认仅活跃会话，all=true 包含已吊销 / 已过期）
+func (h *UserHandler) ListSessions(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "无效的用户 ID"})
+		return
+	}
+	if _, err := h.authService.GetUserByID(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	all, _ := strconv.ParseBool(c.Query("all"))
+	sessions, err := h.sessionService.List(id, !all)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "list": sessions})
+}
+
+// RevokeSessions 吊销用户全部会话（强制下线）
+func (h *UserHandler) RevokeSessions(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "无效的用户 ID"})
+		return
+	}
+	target, err := h.authService.GetUserByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	if !h.canManage(c, target.Roles()...) {
+		return
+	}
+	n, err := h.sessionService.RevokeUser(id, service.RevokeReasonAdmin)
+	if err != nil {
+		auditFailure(h.auditRepo, c, "session_revoke", target.Username, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": err.Error()})
 		return
 	}
-	h.audit(c, "user_delete", target.Username, "删除用户", "success")
+	auditSuccess(h.auditRepo, c, "session_revoke", target.Username, audit.ReasonAllSessions, audit.Metadata{Count: int(n)})
+	c.JSON(http.StatusOK, gin.H{"success": true, "revoked": n})
+}
+
+// RevokeSession 吊销单个会话（按会话所属用户判断操作权限）
+func (h *UserHandler) RevokeSession(c *gin.Context) {
+	sessionID := c.Param("sid")
+	sess, err := h.sessionService.Get(sessionID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	owner, err := h.authService.GetUserByID(sess.UserID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	if !h.canManage(c, owner.Roles()...) {
+		return
+	}
+	if _, err := h.sessionService.Revoke(sessionID, service.RevokeReasonAdmin); err != nil {
+		auditFailure(h.auditRepo, c, "session_revoke", sess.Username, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	auditSuccess(h.auditRepo, c, "session_revoke", sess.Username, audit.ReasonOK, audit.Metadata{Target: sess.ClientIP})
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// ImpersonateRequest 模拟登录请求
+type ImpersonateRequest struct {
+	Reason string `json:"reason" binding:"required"` // 原因（如工单号），写入审计
+}
+
+// Impersonate POST /api/admin/users/:id/impersonate 以目标用户身份登录，用于复现其权限下的问题。
+// 返回的访问令牌携带 act 声明（真实管理员），有效期短且不可刷新；
+// 模拟期间的审计记录同时记录两者，且不能修改密码、二次验证、API 令牌或任何管理设置
+func (h *UserHandler) Impersonate(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "无效的用户 ID"})
+		return
+	}
+	var req ImpersonateRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Reason) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "请填写模拟登录原因"})
+		return
+	}
+	reason := strings.TrimSpace(req.Reason)
+	target, err := h.authService.GetUserByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	actor, err := h.authService.GetUserByID(c.GetInt64("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": service.ErrSessionInvalid.Error()})
+		return
+	}
+	if actor.ID == target.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "不能模拟自己"})
+		return
+	}
+	if target.Disabled {
+		auditFailure(h.auditRepo, c, "impersonate_start", target.Username, service.ErrAccountDisabled)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "账号已停用，不能模拟登录"})
+		return
+	}
+	// 不能借模拟登录获得高于自身的权限
+	if !h.canManage(c, target.Roles()...) {
+		return
+	}
+
+	pair, err := h.tokenService.Impersonate(target, actor, c.ClientIP(), c.GetHeader("User-Agent"))
+	if err != nil {
+		auditFailure(h.auditRepo, c, "impersonate_start", target.Username, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	auditSuccess(h.auditRepo, c, "impersonate_start", target.Username, audit.ReasonOK,
+		audit.Metadata{ExpiresIn: pair.ExpiresIn, Note: reason})
+	c.JSON(http.StatusOK, gin.H{"success": true, "token": pair.AccessToken, "expires_in": pair.ExpiresIn})
+}
+
+// LinkIdentityRequest 管理员关联外部身份请求
+type LinkIdentityRequest struct {
+	Provider string `json:"provider" binding:"required"` // oidc:<id> / saml:<id>
+	Subject  string `json:"subject" binding:"required"`  // OIDC sub / SAML NameID
+}
+
+// ListIdentities 用户关联的外部身份
+func (h *UserHandler) ListIdentities(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "无效的用户 ID"})
+		return
+	}
+	list, err := h.authService.ListIdentities(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "list": list})
+}
+
+// LinkIdentity 将外部身份关联到用户（如 IdP 用户名与本地账号冲突时）
+func (h *UserHandler) LinkIdentity(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "无效的用户 ID"})
+		return
+	}
+	var req LinkIdentityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "请求参数错误"})
+		return
+	}
+	target, err := h.authService.GetUserByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	if !h.canManage(c, target.Roles()...) {
+		return
+	}
+	link, err := h.authService.LinkIdentity(id, req.Provider, req.Subject)
+	if err != nil {
+		auditFailure(h.auditRepo, c, "identity_link", target.Username, err)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	auditSuccess(h.auditRepo, c, "identity_link", target.Username, audit.ReasonOK, audit.Metadata{Provider: link.Provider, Subject: link.Subject})
+	c.JSON(http.StatusOK, gin.H{"success": true, "identity": link})
+}
+
+// UnlinkIdentity 解除外部身份关联
+func (h *UserHandler) UnlinkIdentity(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "无效的用户 ID"})
+		return
+	}
+	identityID, err := strconv.ParseInt(c.Param("iid"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "无效的身份 ID"})
+		return
+	}
+	target, err := h.authService.GetUserByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	if !h.canManage(c, target.Roles()...) {
+		return
+	}
+	link, err := h.authService.UnlinkIdentity(id, identityID)
+	if err != nil {
+		auditFailure(h.auditRepo, c, "identity_unlink", target.Username, err)
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	auditSuccess(h.auditRepo, c, "identity_unlink", target.Username, audit.ReasonOK, audit.Metadata{Provider: link.Provider, Subject: link.Subject})
 	c.JSON(http.StatusOK, gin.H{"success": true})
 }
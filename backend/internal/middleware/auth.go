@@ -1,58 +1,143 @@
 package middleware
 
 import (
+	"log"
 	"net/http"
+	"time"
 
 	"dvr-manager/internal/auth"
 	"dvr-manager/internal/config"
+	"dvr-manager/internal/service"
 
 	"github.com/gin-gonic/gin"
 )
 
-func applyClaims(c *gin.Context, claims *auth.Claims) {
-	c.Set("username", claims.Username)
-	c.Set("role", claims.Role)
+// applyUser 写入当前用户；角色取自数据库而非令牌，roles 另含所在用户组授予的角色。
+// 模拟登录会话另写入 impersonator / impersonator_id（真实管理员），且不要求修改目标用户的密码
+func applyUser(c *gin.Context, user *service.User, claims *auth.Claims) {
+	c.Set("user_id", user.ID)
+	c.Set("username", user.Username)
+	c.Set("role", user.Role)
+	c.Set("roles", user.Roles())
+	c.Set("session_id", claims.SessionID)
+	if user.Impersonator != nil {
+		c.Set("impersonator", user.Impersonator.Username)
+		c.Set("impersonator_id", user.Impersonator.ID)
+		return
+	}
+	c.Set("password_change_required", user.PasswordChangeRequired)
+}
+
+// passwordChangeAllowedPaths 须修改密码的用户仍可访问的接口
+var passwordChangeAllowedPaths = map[string]bool{
+	"/api/auth/change-password": true,
+	"/api/auth/me":              true,
+}
+
+// passwordChangeBlocked 用户须修改密码且当前接口不在白名单内
+func passwordChangeBlocked(c *gin.Context) bool {
+	required, _ := c.Get("password_change_required")
+	if b, _ := required.(bool); !b {
+		return false
+	}
+	return !passwordChangeAllowedPaths[c.FullPath()]
+}
+
+// credential 读取请求凭据：X-API-Key 优先，其次 Authorization: Bearer
+func credential(c *gin.Context) string {
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		return key
+	}
+	return auth.ExtractBearer(c.GetHeader("Authorization"))
+}
+
+// authenticate 校验 API 令牌，或校验 JWT 签名与服务端会话；失败时返回给客户端的提示
+func authenticate(c *gin.Context, jwt *auth.JWT, sessions service.SessionService, tokens service.APITokenService) (string, bool) {
+	tokenString := credential(c)
+	if tokenString == "" {
+		return "未授权，请先登录", false
+	}
+	if service.IsAPIToken(tokenString) {
+		user, token, err := tokens.Authenticate(tokenString, c.ClientIP())
+		if err != nil {
+			if err != service.ErrAPITokenInvalid {
+				log.Printf("[AUTH] API 令牌校验失败 - IP: %s, Error: %v", c.ClientIP(), err)
+			}
+			return service.ErrAPITokenInvalid.Error(), false
+		}
+		if err := service.CheckUserAccess(user, c.ClientIP(), time.Now()); err != nil {
+			return err.Error(), false
+		}
+		c.Set("user_id", user.ID)
+		c.Set("username", user.Username)
+		c.Set("role", user.Role)
+		c.Set("roles", user.Roles())
+		c.Set("api_token_id", token.ID)
+		c.Set("api_token_scopes", token.Scopes)
+		c.Set("password_change_required", user.PasswordChangeRequired)
+		return "", true
+	}
+	claims, err := jwt.Verify(tokenString)
+	if err != nil {
+		return "令牌无效或已过期", false
+	}
+	user, err := sessions.Validate(claims)
+	if err != nil {
+		if err != service.ErrSessionInvalid {
+			log.Printf("[AUTH] 会话校验失败 - IP: %s, Error: %v", c.ClientIP(), err)
+		}
+		return service.ErrSessionInvalid.Error(), false
+	}
+	// 模拟登录按真实管理员校验账号状态与登录限制（目标账号停用时其会话已被吊销）
+	checked := user
+	if user.Impersonator != nil {
+		checked = user.Impersonator
+	}
+	if err := service.CheckUserAccess(checked, c.ClientIP(), time.Now()); err != nil {
+		return err.Error(), false
+	}
+	applyUser(c, user, claims)
+	return "", true
 }
 
-// AuthMiddleware 强制认证
-func AuthMiddleware(jwt *auth.JWT) gin.HandlerFunc {
+// AuthMiddleware 强制认证（令牌有效 + 会话未吊销 + 用户存在且角色未变；或有效的 API 令牌），
+// 且账号未停用、未过期、满足登录时段与来源 IP 限制。
+// 须修改密码的用户只能访问修改密码与当前用户接口。
+func AuthMiddleware(jwt *auth.JWT, sessions service.SessionService, tokens service.APITokenService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		tokenString := auth.ExtractBearer(c.GetHeader("Authorization"))
-		if tokenString == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "未授权，请先登录"})
+		if msg, ok := authenticate(c, jwt, sessions, tokens); !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": msg})
 			c.Abort()
 			return
 		}
-		claims, err := jwt.Verify(tokenString)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "令牌无效或已过期"})
+		if passwordChangeBlocked(c) {
+			c.JSON(http.StatusForbidden, gin.H{"success": false, "message": "请先修改密码", "code": "password_change_required"})
 			c.Abort()
 			return
 		}
-		applyClaims(c, claims)
 		c.Next()
 	}
 }
 
-// OptionalAuthMiddleware 可选认证（有 Token 则解析用户信息）
-func OptionalAuthMiddleware(jwt *auth.JWT) gin.HandlerFunc {
+// OptionalAuthMiddleware 可选认证：未携带令牌时按匿名处理；携带的令牌无效、会话已吊销或账号不满足访问限制时返回 401，
+// 不降级为匿名（否则受访问策略限制的账号可借无效令牌按匿名访问）
+func OptionalAuthMiddleware(jwt *auth.JWT, sessions service.SessionService, tokens service.APITokenService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		tokenString := auth.ExtractBearer(c.GetHeader("Authorization"))
-		if tokenString == "" {
-			c.Next()
-			return
-		}
-		if claims, err := jwt.Verify(tokenString); err == nil {
-			applyClaims(c, claims)
+		if credential(c) != "" {
+			if msg, ok := authenticate(c, jwt, sessions, tokens); !ok {
+				c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": msg})
+				c.Abort()
+				return
+			}
 		}
 		c.Next()
 	}
 }
 
 // PlayAuthMiddleware 录像播放：默认可选认证；require_auth_for_play=true 时强制登录
-func PlayAuthMiddleware(jwt *auth.JWT) gin.HandlerFunc {
-	required := AuthMiddleware(jwt)
-	optional := OptionalAuthMiddleware(jwt)
+func PlayAuthMiddleware(jwt *auth.JWT, sessions service.SessionService, tokens service.APITokenService) gin.HandlerFunc {
+	required := AuthMiddleware(jwt, sessions, tokens)
+	optional := OptionalAuthMiddleware(jwt, sessions, tokens)
 	return func(c *gin.Context) {
 		if config.RequireAuthForPlayEnabled() {
 			required(c)
@@ -62,15 +147,134 @@ func PlayAuthMiddleware(jwt *auth.JWT) gin.HandlerFunc {
 	}
 }
 
-// AdminMiddleware 管理员权限
-func AdminMiddleware() gin.HandlerFunc {
+// contextRoles 当前用户的有效角色（用户角色 + 所在组授予的角色）
+func contextRoles(c *gin.Context) []string {
+	if v, ok := c.Get("roles"); ok {
+		if list, ok := v.([]string); ok {
+			return list
+		}
+	}
+	return []string{c.GetString("role")}
+}
+
+// RequirePermission 当前用户的任一有效角色须拥有任一指定权限（须在 AuthMiddleware 之后）
+func RequirePermission(roles service.RoleService, perms ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		role, exists := c.Get("role")
-		if !exists || role != "admin" {
-			c.JSON(http.StatusForbidden, gin.H{"success": false, "message": "需要管理员权限"})
+		allowed := false
+		for _, role := range contextRoles(c) {
+			if roles.HasPermission(role, perms...) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"success": false, "message": "权限不足", "code": "permission_denied"})
 			c.Abort()
 			return
 		}
 		c.Next()
 	}
 }
+
+// RequirePlayPermission 录像接口：已登录用户须拥有指定权限；未登录访问（未开启 require_auth_for_play）放行
+func RequirePlayPermission(roles service.RoleService, perm string) gin.HandlerFunc {
+	require := RequirePermission(roles, perm)
+	return func(c *gin.Context) {
+		if _, ok := c.Get("user_id"); !ok {
+			c.Next()
+			return
+		}
+		require(c)
+	}
+}
+
+// RequireDownloadPermission 以附件方式下载录像（?download=1）的已登录用户须拥有 download 权限
+func RequireDownloadPermission(roles service.RoleService) gin.HandlerFunc {
+	require := RequirePlayPermission(roles, service.PermDownload)
+	return func(c *gin.Context) {
+		if c.Query("download") != "1" {
+			c.Next()
+			return
+		}
+		require(c)
+	}
+}
+
+// RequireScope API 令牌须具备指定权限范围；交互式登录会话不受限制
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !hasScope(c, scope) {
+			c.JSON(http.StatusForbidden, gin.H{"success": false, "message": "API 令牌缺少权限范围: " + scope})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// AdminScopeMiddleware 管理接口：GET/HEAD 需 admin:read，其余方法需 admin:write
+func AdminScopeMiddleware() gin.HandlerFunc {
+	read := RequireScope(service.ScopeAdminRead)
+	write := RequireScope(service.ScopeAdminWrite)
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			read(c)
+			return
+		}
+		write(c)
+	}
+}
+
+// SessionOnlyMiddleware 仅允许交互式登录会话（如修改密码、管理自己的 API 令牌）
+func SessionOnlyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("api_token_id"); ok {
+			c.JSON(http.StatusForbidden, gin.H{"success": false, "message": "该操作不支持 API 令牌"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// impersonationForbidden 模拟登录会话被拒绝时的响应
+func impersonationForbidden(c *gin.Context) {
+	c.JSON(http.StatusForbidden, gin.H{"success": false, "message": "模拟登录会话不能执行该操作", "code": "impersonation_forbidden"})
+	c.Abort()
+}
+
+// NoImpersonationMiddleware 禁止模拟登录会话访问（修改密码、二次验证、API 令牌等凭据管理）
+func NoImpersonationMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("impersonator") != "" {
+			impersonationForbidden(c)
+			return
+		}
+		c.Next()
+	}
+}
+
+// ImpersonationReadOnlyMiddleware 模拟登录会话访问管理接口时仅允许 GET/HEAD，不能修改任何设置
+func ImpersonationReadOnlyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("impersonator") != "" && c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			impersonationForbidden(c)
+			return
+		}
+		c.Next()
+	}
+}
+
+func hasScope(c *gin.Context, scope string) bool {
+	if _, ok := c.Get("api_token_id"); !ok {
+		return true
+	}
+	scopes, _ := c.Get("api_token_scopes")
+	list, _ := scopes.([]string)
+	for _, s := range list {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SCIMAuthMiddleware SCIM 接口：Authorization: Bearer 须为 SCIM_TOKEN（常量时间比较），
+// 通过后以 scim 作为审计用户名
+func SCIMAuthMiddleware(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		got, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(strings.TrimSpace(got)), []byte(token)) != 1 {
+			c.Header("WWW-Authenticate", `Bearer realm="scim"`)
+			c.Header("Content-Type", "application/scim+json")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"schemas": []string{"urn:ietf:params:scim:api:messages:2.0:Error"},
+				"status":  "401",
+				"detail":  "SCIM 令牌无效",
+			})
+			return
+		}
+		c.Set("username", "scim")
+		c.Next()
+	}
+}
@@ -0,0 +1,294 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"dvr-manager/pkg/db"
+)
+
+// 访问策略主体类型
+const (
+	AccessSubjectUser      = "user"      // 指定用户（subject_id = users.id）
+	AccessSubjectGroup     = "group"     // 用户组成员（subject_id = groups.id）
+	AccessSubjectAnonymous = "anonymous" // 未登录访问（subject_id = 0）
+)
+
+// DVRGroup DVR 服务器分组（如按站点划分）
+type DVRGroup struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Servers     []string  `json:"servers"` // DVR 基础 URL，与 dvr_servers 中的写法一致
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// AccessPolicy 访问策略：主体可访问的 DVR 分组与录像编号模式
+type AccessPolicy struct {
+	ID             int64     `json:"id"`
+	Name           string    `json:"name"`
+	SubjectType    string    `json:"subject_type"`
+	SubjectID      int64     `json:"subject_id"`
+	SubjectName    string    `json:"subject_name"` // 用户名 / 组名（仅展示）
+	DVRGroupIDs    []int64   `json:"dvr_group_ids"`
+	RecordPatterns []string  `json:"record_patterns"`
+	Enabled        bool      `json:"enabled"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// AccessSubject 策略主体
+type AccessSubject struct {
+	Type string
+	ID   int64
+}
+
+var (
+	// ErrDVRGroupNotFound DVR 分组不存在
+	ErrDVRGroupNotFound = errors.New("DVR 分组不存在")
+	// ErrDVRGroupExists DVR 分组名称已存在
+	ErrDVRGroupExists = errors.New("DVR 分组名称已存在")
+	// ErrAccessPolicyNotFound 访问策略不存在
+	ErrAccessPolicyNotFound = errors.New("访问策略不存在")
+)
+
+// AccessRepository DVR 分组与访问策略仓库接口
+type AccessRepository interface {
+	ListGroups() ([]DVRGroup, error)
+	GetGroup(id int64) (*DVRGroup, error)
+	CreateGroup(g *DVRGroup) error
+	UpdateGroup(g *DVRGroup) error
+	DeleteGroup(id int64) error
+
+	ListPolicies() ([]AccessPolicy, error)
+	GetPolicy(id int64) (*AccessPolicy, error)
+	CreatePolicy(p *AccessPolicy) error
+	UpdatePolicy(p *AccessPolicy) error
+	DeletePolicy(id int64) error
+	// EnabledPoliciesFor 任一主体上已启用的策略
+	EnabledPoliciesFor(subjects []AccessSubject) ([]AccessPolicy, error)
+}
+
+type accessRepository struct {
+	db *sql.DB
+}
+
+// NewAccessRepository 创建访问策略仓库
+func NewAccessRepository() AccessRepository {
+	return &accessRepository{db: db.GetDB()}
+}
+
+func isUniqueErr(err error) bool {
+	return strings.Contains(strings.ToLower(err.Error()), "unique")
+}
+
+const dvrGroupColumns = `id, name, description, servers, created_at, updated_at`
+
+func scanDVRGroup(row interface {
+	Scan(dest ...interface{}) error
+}) (*DVRGroup, error) {
+	var g DVRGroup
+	var servers string
+	if err := row.Scan(&g.ID, &g.Name, &g.Description, &servers, &g.CreatedAt, &g.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(servers), &g.Servers); err != nil || g.Servers == nil {
+		g.Servers = []string{}
+	}
+	return &g, nil
+}
+
+// ListGroups 全部 DVR 分组
+func (r *accessRepository) ListGroups() ([]DVRGroup, error) {
+	rows, err := r.db.Query(`SELECT ` + dvrGroupColumns + ` FROM dvr_groups ORDER BY name ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("list dvr groups: %w", err)
+	}
+	defer rows.Close()
+
+	list := []DVRGroup{}
+	for rows.Next() {
+		g, err := scanDVRGroup(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan dvr group: %w", err)
+		}
+		list = append(list, *g)
+	}
+	return list, rows.Err()
+}
+
+// GetGroup 按 ID 查询
+func (r *accessRepository) GetGroup(id int64) (*DVRGroup, error) {
+	g, err := scanDVRGroup(r.db.QueryRow(`SELECT `+dvrGroupColumns+` FROM dvr_groups WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrDVRGroupNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get dvr group: %w", err)
+	}
+	return g, nil
+}
+
+// CreateGroup 新增分组，回填 ID
+func (r *accessRepository) CreateGroup(g *DVRGroup) error {
+	servers, _ := json.Marshal(g.Servers)
+	res, err := r.db.Exec(
+		`INSERT INTO dvr_groups (name, description, servers) VALUES (?, ?, ?)`,
+		g.Name, g.Description, string(servers),
+	)
+	if err != nil {
+		if isUniqueErr(err) {
+			return ErrDVRGroupExists
+		}
+		return fmt.Errorf("create dvr group: %w", err)
+	}
+	g.ID, _ = res.LastInsertId()
+	return nil
+}
+
+// UpdateGroup 修改分组
+func (r *accessRepository) UpdateGroup(g *DVRGroup) error {
+	servers, _ := json.Marshal(g.Servers)
+	res, err := r.db.Exec(
+		`UPDATE dvr_groups SET name = ?, description = ?, servers = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		g.Name, g.Description, string(servers), g.ID,
+	)
+	if err != nil {
+		if isUniqueErr(err) {
+			return ErrDVRGroupExists
+		}
+		return fmt.Errorf("update dvr group: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrDVRGroupNotFound
+	}
+	return nil
+}
+
+// DeleteGroup 删除分组
+func (r *accessRepository) DeleteGroup(id int64) error {
+	if _, err := r.db.Exec(`DELETE FROM dvr_groups WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("delete dvr group: %w", err)
+	}
+	return nil
+}
+
+const accessPolicyColumns = `p.id, p.name, p.subject_type, p.subject_id,
+	COALESCE(CASE p.subject_type
+		WHEN 'user' THEN (SELECT u.username FROM users u WHERE u.id = p.subject_id)
+		WHEN 'group' THEN (SELECT g.name FROM groups g WHERE g.id = p.subject_id) END, ''),
+	p.dvr_group_ids, p.record_patterns, p.enabled, p.created_at, p.updated_at`
+
+func scanAccessPolicy(row interface {
+	Scan(dest ...interface{}) error
+}) (*AccessPolicy, error) {
+	var p AccessPolicy
+	var groups, patterns string
+	if err := row.Scan(&p.ID, &p.Name, &p.SubjectType, &p.SubjectID, &p.SubjectName,
+		&groups, &patterns, &p.Enabled, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(groups), &p.DVRGroupIDs); err != nil || p.DVRGroupIDs == nil {
+		p.DVRGroupIDs = []int64{}
+	}
+	if err := json.Unmarshal([]byte(patterns), &p.RecordPatterns); err != nil || p.RecordPatterns == nil {
+		p.RecordPatterns = []string{}
+	}
+	return &p, nil
+}
+
+func (r *accessRepository) queryPolicies(where string, args ...interface{}) ([]AccessPolicy, error) {
+	rows, err := r.db.Query(`SELECT `+accessPolicyColumns+` FROM access_policies p `+where+` ORDER BY p.id ASC`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list access policies: %w", err)
+	}
+	defer rows.Close()
+
+	list := []AccessPolicy{}
+	for rows.Next() {
+		p, err := scanAccessPolicy(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan access policy: %w", err)
+		}
+		list = append(list, *p)
+	}
+	return list, rows.Err()
+}
+
+// ListPolicies 全部访问策略
+func (r *accessRepository) ListPolicies() ([]AccessPolicy, error) {
+	return r.queryPolicies("")
+}
+
+// GetPolicy 按 ID 查询
+func (r *accessRepository) GetPolicy(id int64) (*AccessPolicy, error) {
+	p, err := scanAccessPolicy(r.db.QueryRow(`SELECT `+accessPolicyColumns+` FROM access_policies p WHERE p.id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrAccessPolicyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get access policy: %w", err)
+	}
+	return p, nil
+}
+
+// CreatePolicy 新增策略，回填 ID
+func (r *accessRepository) CreatePolicy(p *AccessPolicy) error {
+	groups, _ := json.Marshal(p.DVRGroupIDs)
+	patterns, _ := json.Marshal(p.RecordPatterns)
+	res, err := r.db.Exec(
+		`INSERT INTO access_policies (name, subject_type, subject_id, dvr_group_ids, record_patterns, enabled)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		p.Name, p.SubjectType, p.SubjectID, string(groups), string(patterns), p.Enabled,
+	)
+	if err != nil {
+		return fmt.Errorf("create access policy: %w", err)
+	}
+	p.ID, _ = res.LastInsertId()
+	return nil
+}
+
+// UpdatePolicy 修改策略
+func (r *accessRepository) UpdatePolicy(p *AccessPolicy) error {
+	groups, _ := json.Marshal(p.DVRGroupIDs)
+	patterns, _ := json.Marshal(p.RecordPatterns)
+	res, err := r.db.Exec(
+		`UPDATE access_policies SET name = ?, subject_type = ?, subject_id = ?, dvr_group_ids = ?, record_patterns = ?,
+		enabled = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		p.Name, p.SubjectType, p.SubjectID, string(groups), string(patterns), p.Enabled, p.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("update access policy: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrAccessPolicyNotFound
+	}
+	return nil
+}
+
+// DeletePolicy 删除策略
+func (r *accessRepository) DeletePolicy(id int64) error {
+	if _, err := r.db.Exec(`DELETE FROM access_policies WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("delete access policy: %w", err)
+	}
+	return nil
+}
+
+// EnabledPoliciesFor 任一主体上已启用的策略
+func (r *accessRepository) EnabledPoliciesFor(subjects []AccessSubject) ([]AccessPolicy, error) {
+	if len(subjects) == 0 {
+		return []AccessPolicy{}, nil
+	}
+	conds := make([]string, 0, len(subjects))
+	args := make([]interface{}, 0, len(subjects)*2)
+	for _, s := range subjects {
+		conds = append(conds, "(p.subject_type = ? AND p.subject_id = ?)")
+		args = append(args, s.Type, s.ID)
+	}
+	return r.queryPolicies("WHERE p.enabled = 1 AND ("+strings.Join(conds, " OR ")+")", args...)
+}
@@ -0,0 +1,205 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"dvr-manager/pkg/db"
+)
+
+// APIToken 个人访问令牌 / 服务 API Key（明文令牌不落库，仅保存哈希）
+type APIToken struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"user_id"`
+	Username   string     `json:"username"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // 明文前若干位，便于用户辨认
+	TokenHash  string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Active 令牌未吊销且未过期
+func (t *APIToken) Active(now time.Time) bool {
+	return t.RevokedAt == nil && (t.ExpiresAt == nil || now.Before(*t.ExpiresAt))
+}
+
+// HasScope 是否具备指定权限范围
+func (t *APIToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrAPITokenNotFound API 令牌不存在
+var ErrAPITokenNotFound = errors.New("API 令牌不存在")
+
+// APITokenRepository API 令牌仓库接口
+type APITokenRepository interface {
+	Create(t *APIToken) error
+	Get(id int64) (*APIToken, error)
+	GetByHash(hash string) (*APIToken, error)
+	// List 列出令牌；userID 为 0 时列出全部用户的令牌
+	List(userID int64) ([]APIToken, error)
+	// Touch 记录最近使用时间与 IP
+	Touch(id int64, clientIP string, at time.Time) error
+	Revoke(id int64) (bool, error)
+	RevokeUser(userID int64) (int64, error)
+}
+
+type apiTokenRepository struct {
+	db *sql.DB
+}
+
+// NewAPITokenRepository 创建 API 令牌仓库
+func NewAPITokenRepository() APITokenRepository {
+	return &apiTokenRepository{db: db.GetDB()}
+}
+
+const apiTokenColumns = `t.id, t.user_id, COALESCE(u.username, ''), t.name, t.prefix, t.token_hash, t.scopes,
+	t.created_at, t.expires_at, t.last_used_at, t.last_used_ip, t.revoked_at`
+
+const apiTokenFrom = ` FROM api_tokens t LEFT JOIN users u ON u.id = t.user_id`
+
+func scanAPIToken(row interface {
+	Scan(dest ...interface{}) error
+}) (*APIToken, error) {
+	var t APIToken
+	var scopes string
+	var lastUsedIP sql.NullString
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+	if err := row.Scan(&t.ID, &t.UserID, &t.Username, &t.Name, &t.Prefix, &t.TokenHash, &scopes,
+		&t.CreatedAt, &expiresAt, &lastUsedAt, &lastUsedIP, &revokedAt); err != nil {
+		return nil, err
+	}
+	t.Scopes = splitScopes(scopes)
+	t.LastUsedIP = lastUsedIP.String
+	if expiresAt.Valid {
+		t.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		t.LastUsedAt = &lastUsedAt.Time
+	}
+	if revokedAt.Valid {
+		t.RevokedAt = &revokedAt.Time
+	}
+	return &t, nil
+}
+
+func splitScopes(s string) []string {
+	scopes := []string{}
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			scopes = append(scopes, p)
+		}
+	}
+	return scopes
+}
+
+// Create 新建令牌
+func (r *apiTokenRepository) Create(t *APIToken) error {
+	if t.CreatedAt.IsZero() {
+		t.CreatedAt = time.Now()
+	}
+	res, err := r.db.Exec(
+		`INSERT INTO api_tokens (user_id, name, prefix, token_hash, scopes, created_at, expires_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		t.UserID, t.Name, t.Prefix, t.TokenHash, strings.Join(t.Scopes, ","), t.CreatedAt, t.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("create api token: %w", err)
+	}
+	t.ID, _ = res.LastInsertId()
+	return nil
+}
+
+// Get 按 ID 查询
+func (r *apiTokenRepository) Get(id int64) (*APIToken, error) {
+	t, err := scanAPIToken(r.db.QueryRow(`SELECT `+apiTokenColumns+apiTokenFrom+` WHERE t.id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrAPITokenNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get api token: %w", err)
+	}
+	return t, nil
+}
+
+// GetByHash 按令牌哈希查询
+func (r *apiTokenRepository) GetByHash(hash string) (*APIToken, error) {
+	t, err := scanAPIToken(r.db.QueryRow(`SELECT `+apiTokenColumns+apiTokenFrom+` WHERE t.token_hash = ?`, hash))
+	if err == sql.ErrNoRows {
+		return nil, ErrAPITokenNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get api token: %w", err)
+	}
+	return t, nil
+}
+
+// List 按创建时间倒序列出令牌
+func (r *apiTokenRepository) List(userID int64) ([]APIToken, error) {
+	query := `SELECT ` + apiTokenColumns + apiTokenFrom
+	var args []interface{}
+	if userID > 0 {
+		query += ` WHERE t.user_id = ?`
+		args = append(args, userID)
+	}
+	query += ` ORDER BY t.created_at DESC`
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list api tokens: %w", err)
+	}
+	defer rows.Close()
+
+	list := []APIToken{}
+	for rows.Next() {
+		t, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan api token: %w", err)
+		}
+		list = append(list, *t)
+	}
+	return list, rows.Err()
+}
+
+// Touch 更新最近使用信息
+func (r *apiTokenRepository) Touch(id int64, clientIP string, at time.Time) error {
+	_, err := r.db.Exec(`UPDATE api_tokens SET last_used_at = ?, last_used_ip = ? WHERE id = ?`, at, clientIP, id)
+	if err != nil {
+		return fmt.Errorf("touch api token: %w", err)
+	}
+	return nil
+}
+
+// Revoke 吊销单个令牌；返回 false 表示不存在或已吊销
+func (r *apiTokenRepository) Revoke(id int64) (bool, error) {
+	res, err := r.db.Exec(`UPDATE api_tokens SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`, time.Now(), id)
+	if err != nil {
+		return false, fmt.Errorf("revoke api token: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// RevokeUser 吊销用户全部令牌
+func (r *apiTokenRepository) RevokeUser(userID int64) (int64, error) {
+	res, err := r.db.Exec(`UPDATE api_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`, time.Now(), userID)
+	if err != nil {
+		return 0, fmt.Errorf("revoke user api tokens: %w", err)
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,21 @@
+package repository
+
+import (
+	"dvr-manager/internal/audit"
+)
+
+// bufferedAuditRepository 写入经异步写入器排队、批量落库，查询与清理直接访问底层仓库
+type bufferedAuditRepository struct {
+	AuditRepository
+	writer *audit.Writer
+}
+
+// NewBufferedAuditRepository 包装审计仓库：Insert 仅入队，由 writer 按批次写入 repo
+func NewBufferedAuditRepository(repo AuditRepository, writer *audit.Writer) AuditRepository {
+	return &bufferedAuditRepository{AuditRepository: repo, writer: writer}
+}
+
+// Insert 事件入队；drop 策略下队列已满返回 audit.ErrQueueFull
+func (r *bufferedAuditRepository) Insert(e *audit.Event) error {
+	return r.writer.Enqueue(e)
+}
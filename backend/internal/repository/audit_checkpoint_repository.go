@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+
+	"dvr-manager/pkg/db"
+)
+
+// AuditCheckpoint 审计哈希链的签名检查点
+type AuditCheckpoint struct {
+	ID        int64  `json:"id"`
+	CreatedAt string `json:"created_at"` // RFC3339（UTC），参与签名
+	Kind      string `json:"kind"`       // periodic / retention
+	LastID    int64  `json:"last_id"`
+	LastHash  string `json:"last_hash"`
+	KeyID     string `json:"key_id"`
+	Signature string `json:"signature"`
+}
+
+// AuditCheckpointRepository 审计检查点仓库接口
+type AuditCheckpointRepository interface {
+	Create(cp *AuditCheckpoint) error
+	List() ([]AuditCheckpoint, error)
+	Latest() (*AuditCheckpoint, error)
+}
+
+type auditCheckpointRepository struct {
+	db *sql.DB
+}
+
+// NewAuditCheckpointRepository 创建审计检查点仓库
+func NewAuditCheckpointRepository() AuditCheckpointRepository {
+	return &auditCheckpointRepository{db: db.GetDB()}
+}
+
+// Create 写入检查点并回填 ID
+func (r *auditCheckpointRepository) Create(cp *AuditCheckpoint) error {
+	res, err := r.db.Exec(
+		`INSERT INTO audit_checkpoints (created_at, kind, last_id, last_hash, key_id, signature) VALUES (?, ?, ?, ?, ?, ?)`,
+		cp.CreatedAt, cp.Kind, cp.LastID, cp.LastHash, cp.KeyID, cp.Signature,
+	)
+	if err != nil {
+		return fmt.Errorf("create audit checkpoint: %w", err)
+	}
+	cp.ID, err = res.LastInsertId()
+	return err
+}
+
+// List 全部检查点（按 id 升序）
+func (r *auditCheckpointRepository) List() ([]AuditCheckpoint, error) {
+	rows, err := r.db.Query(`SELECT id, created_at, kind, last_id, last_hash, key_id, signature FROM audit_checkpoints ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("list audit checkpoints: %w", err)
+	}
+	defer rows.Close()
+	var list []AuditCheckpoint
+	for rows.Next() {
+		var cp AuditCheckpoint
+		if err := rows.Scan(&cp.ID, &cp.CreatedAt, &cp.Kind, &cp.LastID, &cp.LastHash, &cp.KeyID, &cp.Signature); err != nil {
+			return nil, err
+		}
+		list = append(list, cp)
+	}
+	return list, rows.Err()
+}
+
+// Latest 最近一个检查点；没有时返回 nil
+func (r *auditCheckpointRepository) Latest() (*AuditCheckpoint, error) {
+	var cp AuditCheckpoint
+	err := r.db.QueryRow(`SELECT id, created_at, kind, last_id, last_hash, key_id, signature FROM audit_checkpoints ORDER BY id DESC LIMIT 1`).
+		Scan(&cp.ID, &cp.CreatedAt, &cp.Kind, &cp.LastID, &cp.LastHash, &cp.KeyID, &cp.Signature)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("latest audit checkpoint: %w", err)
+	}
+	return &cp, nil
+}
@@ -2,9 +2,8 @@ package repository
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
-	"regexp"
-	"strconv"
 	"time"
 
 	"dvr-manager/internal/audit"
@@ -20,8 +19,19 @@ type AuditEntry struct {
 	Role      string    `json:"role"`
 	ClientIP  string    `json:"client_ip"`
 	Resource  string    `json:"resource"`
-	Detail    string    `json:"detail"`
-	Status    string    `json:"status"`
+	// Detail 由 Reason 与 Metadata 渲染的描述（不入库）
+	Detail string `json:"detail"`
+	Status string `json:"status"`
+	// Reason 原因码（见 audit.Reason*）
+	Reason   string          `json:"reason"`
+	Metadata *audit.Metadata `json:"metadata,omitempty"`
+	// APITokenID 经 API 令牌认证时记录令牌 ID
+	APITokenID *int64 `json:"api_token_id,omitempty"`
+	// Impersonator 模拟登录期间的操作记录真实管理员，Username 为被模拟的用户
+	Impersonator string `json:"impersonator,omitempty"`
+	// PrevHash / Hash 防篡改哈希链（见 audit.ChainHash）
+	PrevHash string `json:"prev_hash,omitempty"`
+	Hash     string `json:"hash,omitempty"`
 }
 
 // DashboardDayStat 按日统计
@@ -57,34 +67,88 @@ type DashboardStats struct {
 
 // AuditRepository 审计仓库接口
 type AuditRepository interface {
-	Insert(action, username, role, clientIP, resource, detail, status string) error
+	Insert(e *audit.Event) error
+	InsertBatch(events []*audit.Event) error
 	List(from, to *time.Time, action, username string, page, pageSize int) ([]AuditEntry, int, error)
-	DeleteOlderThan(t time.Time) (int64, error)
+	Export(from, to *time.Time, action, username string, fn func(*AuditEntry) error) (int64, error)
+	ExpiredPrefix(cutoff time.Time) (lastID int64, lastHash string, err error)
+	ListThrough(maxID int64, limit int) ([]AuditEntry, error)
+	DeleteThrough(maxID int64) (int64, error)
+	ChainHead() (id int64, hash string, err error)
+	ChainRows(afterID int64, limit int) ([]audit.ChainRecord, error)
+	BackfillChain() (int64, error)
 	Stats(from, to time.Time) (*DashboardStats, error)
+	MigrateLegacy() (int64, error)
 }
 
 type auditRepository struct {
 	db *sql.DB
 }
 
-var batchDetailRe = regexp.MustCompile(`^批量查询 (\d+) 条`)
-
 // NewAuditRepository 创建审计仓库
 func NewAuditRepository() AuditRepository {
 	return &auditRepository{db: db.GetDB()}
 }
 
-// Insert 写入单条审计记录
-func (r *auditRepository) Insert(action, username, role, clientIP, resource, detail, status string) error {
-	_, err := r.db.Exec(
-		`INSERT INTO audit_log (action, username, role, client_ip, resource, detail, status)
-		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
-		action, username, role, clientIP, resource, detail, status,
+// Insert 同步写入单条审计事件；描述不入库，读取时按原因码与 metadata 渲染
+func (r *auditRepository) Insert(e *audit.Event) error {
+	return r.InsertBatch([]*audit.Event{e})
+}
+
+// InsertBatch 在同一事务中写入一批审计事件（供异步写入器批量落库），并依次接到哈希链末尾
+func (r *auditRepository) InsertBatch(events []*audit.Event) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var prev string
+	if err := tx.QueryRow("SELECT COALESCE(hash, '') FROM audit_log ORDER BY id DESC LIMIT 1").Scan(&prev); err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("audit chain head: %w", err)
+	}
+	for _, e := range events {
+		if prev, err = insertAuditEvent(tx, e, prev); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// insertAuditEvent 写入一条记录并返回其哈希；created_at 取事件时间（UTC，与 CURRENT_TIMESTAMP 格式一致），未设置时为当前时间
+func insertAuditEvent(tx *sql.Tx, e *audit.Event, prev string) (string, error) {
+	md, err := json.Marshal(e.Metadata)
+	if err != nil {
+		return "", fmt.Errorf("marshal audit metadata: %w", err)
+	}
+	at := e.Time
+	if at.IsZero() {
+		at = time.Now()
+	}
+	rec := &audit.ChainRecord{
+		CreatedAt: at.UTC().Format("2006-01-02 15:04:05"), Action: e.Action, Username: e.Username, Role: e.Role,
+		ClientIP: e.ClientIP, Resource: e.Resource, Status: e.Status, Reason: e.Reason, Metadata: string(md),
+		APITokenID: e.APITokenID, Impersonator: e.Impersonator,
+	}
+	res, err := tx.Exec(
+		`INSERT INTO audit_log (created_at, action, username, role, client_ip, resource, detail, status, reason, metadata, api_token_id, impersonator, prev_hash)
+		 VALUES (?, ?, ?, ?, ?, ?, '', ?, ?, ?, ?, ?, ?)`,
+		rec.CreatedAt, rec.Action, rec.Username, rec.Role, rec.ClientIP, rec.Resource,
+		rec.Status, rec.Reason, rec.Metadata, rec.APITokenID, rec.Impersonator, prev,
 	)
-	return err
+	if err != nil {
+		return "", err
+	}
+	if rec.ID, err = res.LastInsertId(); err != nil {
+		return "", err
+	}
+	hash := audit.ChainHash(prev, rec)
+	if _, err := tx.Exec("UPDATE audit_log SET hash = ? WHERE id = ?", hash, rec.ID); err != nil {
+		return "", err
+	}
+	return hash, nil
 }
 
-// List 分页查询审计记录，仅返回 3 个月内数据；from/to 为可选筛选
+// List 分页查询审计记录，仅返回 3 个月内数据；from/to 为可选筛选，username 同时匹配模拟登录的管理员
 func (r *auditRepository) List(from, to *time.Time, action, username string, page, pageSize int) ([]AuditEntry, int, error) {
 	if pageSize <= 0 {
 		pageSize = 20
@@ -94,24 +158,7 @@ func (r *auditRepository) List(from, to *time.Time, action, username string, pag
 	}
 	offset := (page - 1) * pageSize
 
-	where := "created_at >= ?"
-	args := []interface{}{audit.RetentionCutoff()}
-	if from != nil {
-		where += " AND created_at >= ?"
-		args = append(args, *from)
-	}
-	if to != nil {
-		where += " AND created_at <= ?"
-		args = append(args, *to)
-	}
-	if action != "" {
-		where += " AND action = ?"
-		args = append(args, action)
-	}
-	if username != "" {
-		where += " AND username = ?"
-		args = append(args, username)
-	}
+	where, args := auditWhere(from, to, action, username)
 
 	var total int
 	countQuery := "SELECT COUNT(*) FROM audit_log WHERE " + where
@@ -121,8 +168,7 @@ func (r *auditRepository) List(from, to *time.Time, action, username string, pag
 
 	args = append(args, pageSize, offset)
 	rows, err := r.db.Query(
-		`SELECT id, created_at, action, username, role, client_ip, resource, detail, status
-		 FROM audit_log WHERE `+where+` ORDER BY created_at DESC LIMIT ? OFFSET ?`,
+		`SELECT `+auditColumns+` FROM audit_log WHERE `+where+` ORDER BY created_at DESC LIMIT ? OFFSET ?`,
 		args...,
 	)
 	if err != nil {
@@ -132,17 +178,10 @@ func (r *auditRepository) List(from, to *time.Time, action, username string, pag
 
 	var list []AuditEntry
 	for rows.Next() {
-		var e AuditEntry
-		var username, role, clientIP, resource, detail, status sql.NullString
-		if err := rows.Scan(&e.ID, &e.CreatedAt, &e.Action, &username, &role, &clientIP, &resource, &detail, &status); err != nil {
+		e, err := scanAuditEntry(rows)
+		if err != nil {
 			return nil, 0, err
 		}
-		e.Username = username.String
-		e.Role = role.String
-		e.ClientIP = clientIP.String
-		e.Resource = resource.String
-		e.Detail = detail.String
-		e.Status = status.String
 		list = append(list, e)
 	}
 	if err := rows.Err(); err != nil {
@@ -151,6 +190,104 @@ func (r *auditRepository) List(from, to *time.Time, action, username string, pag
 	return list, total, nil
 }
 
+// exportChunk 导出时每次查询的条数
+const exportChunk = 1000
+
+// Export 按与 List 相同的条件逐条导出审计记录（按 id 升序，不分页），返回导出条数；fn 返回错误时停止。
+// 数据库只有一个连接，按 id 分段查询并在写出前释放游标，避免慢速客户端长时间占用连接阻塞审计写入；
+// 只导出开始时已存在的记录，导出期间新写入的记录不包含在内。
+func (r *auditRepository) Export(from, to *time.Time, action, username string, fn func(*AuditEntry) error) (int64, error) {
+	var maxID int64
+	if err := r.db.QueryRow("SELECT COALESCE(MAX(id), 0) FROM audit_log").Scan(&maxID); err != nil {
+		return 0, fmt.Errorf("export audit: %w", err)
+	}
+	where, args := auditWhere(from, to, action, username)
+	query := `SELECT ` + auditColumns + ` FROM audit_log WHERE ` + where + ` AND id > ? AND id <= ? ORDER BY id LIMIT ?`
+
+	var n, lastID int64
+	for {
+		chunk, err := r.exportChunk(query, append(args, lastID, maxID, exportChunk))
+		if err != nil {
+			return n, err
+		}
+		for i := range chunk {
+			if err := fn(&chunk[i]); err != nil {
+				return n, err
+			}
+			n++
+		}
+		if len(chunk) < exportChunk {
+			return n, nil
+		}
+		lastID = chunk[len(chunk)-1].ID
+	}
+}
+
+func (r *auditRepository) exportChunk(query string, args []interface{}) ([]AuditEntry, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("export audit: %w", err)
+	}
+	defer rows.Close()
+	chunk := make([]AuditEntry, 0, exportChunk)
+	for rows.Next() {
+		e, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		chunk = append(chunk, e)
+	}
+	return chunk, rows.Err()
+}
+
+const auditColumns = `id, created_at, action, username, role, client_ip, resource, detail, status, reason, metadata, api_token_id, impersonator,
+	COALESCE(prev_hash, ''), COALESCE(hash, '')`
+
+// auditWhere 列表与导出共用的筛选条件，仅包含保留期内的记录
+func auditWhere(from, to *time.Time, action, username string) (string, []interface{}) {
+	where := "created_at >= ?"
+	args := []interface{}{audit.RetentionCutoff()}
+	if from != nil {
+		where += " AND created_at >= ?"
+		args = append(args, *from)
+	}
+	if to != nil {
+		where += " AND created_at <= ?"
+		args = append(args, *to)
+	}
+	if action != "" {
+		where += " AND action = ?"
+		args = append(args, action)
+	}
+	if username != "" {
+		// 含该用户以模拟登录身份执行的操作
+		where += " AND (username = ? OR impersonator = ?)"
+		args = append(args, username, username)
+	}
+	return where, args
+}
+
+// scanAuditEntry 按 auditColumns 的顺序读取一条记录并渲染描述
+func scanAuditEntry(rows *sql.Rows) (AuditEntry, error) {
+	var e AuditEntry
+	var username, role, clientIP, resource, detail, status, metadata sql.NullString
+	var tokenID sql.NullInt64
+	if err := rows.Scan(&e.ID, &e.CreatedAt, &e.Action, &username, &role, &clientIP, &resource, &detail, &status,
+		&e.Reason, &metadata, &tokenID, &e.Impersonator, &e.PrevHash, &e.Hash); err != nil {
+		return e, err
+	}
+	e.Username = username.String
+	e.Role = role.String
+	e.ClientIP = clientIP.String
+	e.Resource = resource.String
+	e.Status = status.String
+	if tokenID.Valid {
+		e.APITokenID = &tokenID.Int64
+	}
+	err := e.render(detail.String, metadata)
+	return e, err
+}
+
 // Stats 按日聚合使用统计（from/to 含当日边界，由调用方设定）
 func (r *auditRepository) Stats(from, to time.Time) (*DashboardStats, error) {
 	cutoff := audit.RetentionCutoff()
@@ -161,13 +298,13 @@ func (r *auditRepository) Stats(from, to time.Time) (*DashboardStats, error) {
 
 	rows, err := r.db.Query(`
 		SELECT date(created_at) AS d,
-			SUM(CASE WHEN action = 'play' AND detail IN ('录像已找到', '录像未找到') THEN 1 ELSE 0 END),
+			SUM(CASE WHEN action = 'play' AND reason IN ('record_found', 'record_not_found') THEN 1 ELSE 0 END),
 			SUM(CASE WHEN action = 'play_batch' THEN 1 ELSE 0 END),
-			SUM(CASE WHEN action = 'stream' OR (action = 'play' AND detail LIKE '流代理:%') THEN 1 ELSE 0 END),
-			SUM(CASE WHEN action = 'play' AND detail IN ('录像已找到', '录像未找到') AND status = 'success' THEN 1 ELSE 0 END),
-			SUM(CASE WHEN action = 'play' AND detail IN ('录像已找到', '录像未找到') AND status = 'fail' THEN 1 ELSE 0 END),
-			SUM(CASE WHEN (action = 'stream' OR (action = 'play' AND detail LIKE '流代理:%')) AND status = 'success' THEN 1 ELSE 0 END),
-			SUM(CASE WHEN (action = 'stream' OR (action = 'play' AND detail LIKE '流代理:%')) AND status = 'fail' THEN 1 ELSE 0 END)
+			SUM(CASE WHEN action = 'stream' THEN 1 ELSE 0 END),
+			SUM(CASE WHEN action = 'play' AND reason = 'record_found' THEN 1 ELSE 0 END),
+			SUM(CASE WHEN action = 'play' AND reason = 'record_not_found' THEN 1 ELSE 0 END),
+			SUM(CASE WHEN action = 'stream' AND status = 'success' THEN 1 ELSE 0 END),
+			SUM(CASE WHEN action = 'stream' AND status = 'fail' THEN 1 ELSE 0 END)
 		FROM audit_log
 		WHERE created_at >= ? AND created_at <= ?
 		GROUP BY date(created_at)
@@ -212,10 +349,8 @@ func (r *auditRepository) Stats(from, to time.Time) (*DashboardStats, error) {
 		WHERE created_at >= ? AND created_at <= ?
 		  AND username IS NOT NULL AND username != ''
 		  AND (
-		    (action = 'play' AND detail IN ('录像已找到', '录像未找到'))
-		    OR action = 'play_batch'
-		    OR action = 'stream'
-		    OR (action = 'play' AND detail LIKE '流代理:%')
+		    (action = 'play' AND reason IN ('record_found', 'record_not_found'))
+		    OR action IN ('play_batch', 'stream')
 		  )`, from, to).Scan(&summary.ActiveUsers); err != nil {
 		return nil, fmt.Errorf("stats active users: %w", err)
 	}
@@ -227,11 +362,12 @@ func (r *auditRepository) Stats(from, to time.Time) (*DashboardStats, error) {
 		return nil, fmt.Errorf("stats login: %w", err)
 	}
 
-	batchRecords, err := r.sumBatchRecords(from, to)
-	if err != nil {
-		return nil, err
+	if err := r.db.QueryRow(`
+		SELECT COALESCE(SUM(json_extract(metadata, '$.count')), 0) FROM audit_log
+		WHERE created_at >= ? AND created_at <= ? AND action = 'play_batch'`,
+		from, to).Scan(&summary.QueryBatchRecords); err != nil {
+		return nil, fmt.Errorf("stats batch records: %w", err)
 	}
-	summary.QueryBatchRecords = batchRecords
 
 	return &DashboardStats{
 		Series:    series,
@@ -240,31 +376,6 @@ func (r *auditRepository) Stats(from, to time.Time) (*DashboardStats, error) {
 	}, nil
 }
 
-func (r *auditRepository) sumBatchRecords(from, to time.Time) (int, error) {
-	rows, err := r.db.Query(
-		`SELECT detail FROM audit_log WHERE created_at >= ? AND created_at <= ? AND action = 'play_batch'`,
-		from, to,
-	)
-	if err != nil {
-		return 0, err
-	}
-	defer rows.Close()
-
-	total := 0
-	for rows.Next() {
-		var detail sql.NullString
-		if err := rows.Scan(&detail); err != nil {
-			return 0, err
-		}
-		if m := batchDetailRe.FindStringSubmatch(detail.String); len(m) == 2 {
-			if n, err := strconv.Atoi(m[1]); err == nil {
-				total += n
-			}
-		}
-	}
-	return total, rows.Err()
-}
-
 func fillDaySeries(from, to time.Time, byDate map[string]DashboardDayStat) []DashboardDayStat {
 	loc := from.Location()
 	start := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc)
@@ -297,11 +408,214 @@ func rate(success, total int) float64 {
 	return float64(success) / float64(total)
 }
 
-// DeleteOlderThan 删除早于 t 的记录，返回删除条数
-func (r *auditRepository) DeleteOlderThan(t time.Time) (int64, error) {
-	res, err := r.db.Exec("DELETE FROM audit_log WHERE created_at < ?", t)
+// ExpiredPrefix 保留期清理可删除的前缀：按 id 排在第一条未过期记录之前的全部记录（都早于 cutoff），
+// 返回其最后一条的 id 与哈希；没有可删除记录时 lastID 为 0。只删除前缀保证剩余记录仍是一条完整的链。
+func (r *auditRepository) ExpiredPrefix(cutoff time.Time) (int64, string, error) {
+	var id int64
+	var hash string
+	err := r.db.QueryRow(`SELECT id, COALESCE(hash, '') FROM audit_log
+		WHERE created_at < ? AND id < COALESCE((SELECT MIN(id) FROM audit_log WHERE created_at >= ?), 9223372036854775807)
+		ORDER BY id DESC LIMIT 1`, cutoff, cutoff).Scan(&id, &hash)
+	if err == sql.ErrNoRows {
+		return 0, "", nil
+	}
+	if err != nil {
+		return 0, "", fmt.Errorf("expired audit prefix: %w", err)
+	}
+	return id, hash, nil
+}
+
+// ListThrough id 不大于 maxID 的记录（按 id 升序，最多 limit 条），供保留期清理前归档
+func (r *auditRepository) ListThrough(maxID int64, limit int) ([]AuditEntry, error) {
+	rows, err := r.db.Query(`SELECT `+auditColumns+` FROM audit_log WHERE id <= ? ORDER BY id LIMIT ?`, maxID, limit)
 	if err != nil {
-		return 0, fmt.Errorf("delete old audit: %w", err)
+		return nil, fmt.Errorf("list expired audit: %w", err)
+	}
+	defer rows.Close()
+	var list []AuditEntry
+	for rows.Next() {
+		e, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, e)
+	}
+	return list, rows.Err()
+}
+
+// DeleteThrough 删除 id 不大于 maxID 的记录（已归档的前缀），返回删除条数
+func (r *auditRepository) DeleteThrough(maxID int64) (int64, error) {
+	res, err := r.db.Exec("DELETE FROM audit_log WHERE id <= ?", maxID)
+	if err != nil {
+		return 0, fmt.Errorf("delete archived audit: %w", err)
 	}
 	return res.RowsAffected()
 }
+
+// ChainHead 哈希链末尾记录的 id 与哈希；没有记录时 id 为 0
+func (r *auditRepository) ChainHead() (int64, string, error) {
+	var id int64
+	var hash string
+	err := r.db.QueryRow("SELECT id, COALESCE(hash, '') FROM audit_log ORDER BY id DESC LIMIT 1").Scan(&id, &hash)
+	if err == sql.ErrNoRows {
+		return 0, "", nil
+	}
+	if err != nil {
+		return 0, "", fmt.Errorf("audit chain head: %w", err)
+	}
+	return id, hash, nil
+}
+
+// ChainRows id 大于 afterID 的记录（按 id 升序，最多 limit 条），字段为参与哈希的入库文本
+func (r *auditRepository) ChainRows(afterID int64, limit int) ([]audit.ChainRecord, error) {
+	rows, err := r.db.Query(`SELECT id, CAST(created_at AS TEXT), action, COALESCE(username, ''), COALESCE(role, ''),
+		COALESCE(client_ip, ''), COALESCE(resource, ''), COALESCE(detail, ''), COALESCE(status, ''), reason,
+		COALESCE(metadata, ''), api_token_id, impersonator, COALESCE(prev_hash, ''), COALESCE(hash, '')
+		FROM audit_log WHERE id > ? ORDER BY id LIMIT ?`, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("audit chain rows: %w", err)
+	}
+	defer rows.Close()
+	var list []audit.ChainRecord
+	for rows.Next() {
+		var rec audit.ChainRecord
+		var tokenID sql.NullInt64
+		if err := rows.Scan(&rec.ID, &rec.CreatedAt, &rec.Action, &rec.Username, &rec.Role, &rec.ClientIP, &rec.Resource,
+			&rec.Detail, &rec.Status, &rec.Reason, &rec.Metadata, &tokenID, &rec.Impersonator, &rec.PrevHash, &rec.Hash); err != nil {
+			return nil, err
+		}
+		if tokenID.Valid {
+			rec.APITokenID = &tokenID.Int64
+		}
+		list = append(list, rec)
+	}
+	return list, rows.Err()
+}
+
+// chainBackfillBatch 每批补算哈希的记录数
+const chainBackfillBatch = 500
+
+// BackfillChain 升级后首次启动时为已有记录补算哈希链（须在 MigrateLegacy 之后执行），返回补算条数。
+// 只在还没有任何带哈希的记录与检查点时执行：之后出现的无哈希记录视为绕过应用写入，由校验报告，不会被“修复”。
+func (r *auditRepository) BackfillChain() (int64, error) {
+	var started bool
+	if err := r.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM audit_log WHERE hash IS NOT NULL)
+		OR EXISTS(SELECT 1 FROM audit_checkpoints)`).Scan(&started); err != nil {
+		return 0, fmt.Errorf("audit chain backfill: %w", err)
+	}
+	if started {
+		return 0, nil
+	}
+	var total, afterID int64
+	prev := ""
+	for {
+		batch, err := r.ChainRows(afterID, chainBackfillBatch)
+		if err != nil || len(batch) == 0 {
+			return total, err
+		}
+		tx, err := r.db.Begin()
+		if err != nil {
+			return total, err
+		}
+		for i := range batch {
+			hash := audit.ChainHash(prev, &batch[i])
+			if _, err := tx.Exec("UPDATE audit_log SET prev_hash = ?, hash = ? WHERE id = ?", prev, hash, batch[i].ID); err != nil {
+				tx.Rollback()
+				return total, fmt.Errorf("audit chain backfill #%d: %w", batch[i].ID, err)
+			}
+			prev = hash
+		}
+		if err := tx.Commit(); err != nil {
+			return total, err
+		}
+		total += int64(len(batch))
+		afterID = batch[len(batch)-1].ID
+	}
+}
+
+// render 按原因码与 metadata 渲染描述；metadata 为空的历史记录沿用原 detail
+func (e *AuditEntry) render(detail string, metadata sql.NullString) error {
+	if !metadata.Valid {
+		e.Detail = detail
+		return nil
+	}
+	var md audit.Metadata
+	if err := json.Unmarshal([]byte(metadata.String), &md); err != nil {
+		return fmt.Errorf("unmarshal audit metadata #%d: %w", e.ID, err)
+	}
+	e.Metadata = &md
+	ev := audit.Event{Action: e.Action, Resource: e.Resource, Status: e.Status, Reason: e.Reason, Metadata: md}
+	e.Detail = ev.Message()
+	return nil
+}
+
+// legacyMigrateBatch 每批迁移的历史记录条数
+const legacyMigrateBatch = 500
+
+// MigrateLegacy 将 metadata 为空的历史记录的自由文本 detail 解析为原因码与 metadata（旧版记为 play 的流代理改为 stream），返回迁移条数
+func (r *auditRepository) MigrateLegacy() (int64, error) {
+	var total int64
+	for {
+		n, err := r.migrateLegacyBatch()
+		if err != nil {
+			return total, err
+		}
+		total += int64(n)
+		if n < legacyMigrateBatch {
+			return total, nil
+		}
+	}
+}
+
+func (r *auditRepository) migrateLegacyBatch() (int, error) {
+	type legacyRow struct {
+		id                     int64
+		action, status, detail string
+	}
+	rows, err := r.db.Query(`SELECT id, action, COALESCE(status, ''), COALESCE(detail, '') FROM audit_log
+		WHERE metadata IS NULL ORDER BY id LIMIT ?`, legacyMigrateBatch)
+	if err != nil {
+		return 0, fmt.Errorf("select legacy audit: %w", err)
+	}
+	var batch []legacyRow
+	for rows.Next() {
+		var row legacyRow
+		if err := rows.Scan(&row.id, &row.action, &row.status, &row.detail); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		batch = append(batch, row)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(batch) == 0 {
+		return 0, nil
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare(`UPDATE audit_log SET action = ?, reason = ?, metadata = ? WHERE id = ?`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+	for _, row := range batch {
+		action, reason, md := audit.ParseLegacy(row.action, row.status, row.detail)
+		data, err := json.Marshal(md)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := stmt.Exec(action, reason, string(data), row.id); err != nil {
+			return 0, fmt.Errorf("migrate audit #%d: %w", row.id, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(batch), nil
+}
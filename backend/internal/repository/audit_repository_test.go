@@ -1,13 +1,16 @@
 package repository
 
 import (
+	"context"
+	"errors"
 	"testing"
 	"time"
 
+	"dvr-manager/internal/audit"
 	"dvr-manager/pkg/db"
 )
 
-func TestDeleteOlderThan_removesExpiredRows(t *testing.T) {
+func TestDeleteThrough_removesExpiredPrefixAndKeepsChain(t *testing.T) {
 	dir := t.TempDir()
 	if err := db.InitDB(dir); err != nil {
 		t.Fatal(err)
@@ -15,34 +18,53 @@ func TestDeleteOlderThan_removesExpiredRows(t *testing.T) {
 	t.Cleanup(func() { _ = db.Close() })
 
 	repo := NewAuditRepository()
-	if err := repo.Insert("play", "u", "user", "127.0.0.1", "r1", "old", "success"); err != nil {
-		t.Fatal(err)
+	old := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	events := []*audit.Event{
+		{Time: old, Resource: "r1"},
+		{Time: old, Resource: "r2"},
+		{Resource: "r3"},
+		// 排在未过期记录之后的旧记录不属于可删除的前缀
+		{Time: old, Resource: "r4"},
 	}
-
-	database := db.GetDB()
-	if _, err := database.Exec(`UPDATE audit_log SET created_at = ? WHERE resource = ?`,
-		"2020-01-01 00:00:00", "r1"); err != nil {
-		t.Fatal(err)
+	for _, e := range events {
+		e.Action, e.Username, e.Status, e.Reason = "play", "u", audit.StatusSuccess, audit.ReasonRecordFound
 	}
-	if err := repo.Insert("play", "u", "user", "127.0.0.1", "r2", "new", "success"); err != nil {
+	if err := repo.InsertBatch(events); err != nil {
 		t.Fatal(err)
 	}
 
 	cutoff := time.Now().AddDate(0, -3, 0)
-	n, err := repo.DeleteOlderThan(cutoff)
+	lastID, lastHash, err := repo.ExpiredPrefix(cutoff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefix, err := repo.ListThrough(lastID, 10)
+	if err != nil || len(prefix) != 2 || prefix[1].Resource != "r2" {
+		t.Fatalf("prefix=%+v err=%v", prefix, err)
+	}
+	n, err := repo.DeleteThrough(lastID)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if n != 1 {
-		t.Fatalf("deleted=%d want 1", n)
+	if n != 2 {
+		t.Fatalf("deleted=%d want 2", n)
 	}
 
-	list, total, err := repo.List(nil, nil, "", "", 1, 10)
+	// 剩余记录仍是一条完整的链，第一条接在被删除前缀的最后一条之后
+	rows, err := repo.ChainRows(0, 10)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if total != 1 || len(list) != 1 || list[0].Resource != "r2" {
-		t.Fatalf("list=%+v total=%d", list, total)
+	if len(rows) != 2 || rows[0].Resource != "r3" || rows[1].Resource != "r4" {
+		t.Fatalf("rows=%+v", rows)
+	}
+	prev := lastHash
+	for i := range rows {
+		r := &rows[i]
+		if r.PrevHash != prev || r.Hash != audit.ChainHash(prev, r) {
+			t.Fatalf("chain broken at #%d: prev=%q want %q", r.ID, r.PrevHash, prev)
+		}
+		prev = r.Hash
 	}
 }
 
@@ -59,17 +81,16 @@ func TestStats_aggregatesByDay(t *testing.T) {
 	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
 	to := time.Date(now.Year(), now.Month(), now.Day(), 23, 59, 59, 0, now.Location())
 
-	inserts := []struct {
-		action, detail, status string
-	}{
-		{"play", "录像已找到", "success"},
-		{"play", "录像未找到", "fail"},
-		{"play_batch", "批量查询 5 条，找到 3 条", "success"},
-		{"stream", "流代理: 录像已找到", "success"},
-		{"login_success", "登录成功", "success"},
+	inserts := []audit.Event{
+		{Action: "play", Status: audit.StatusSuccess, Reason: audit.ReasonRecordFound},
+		{Action: "play", Status: audit.StatusFail, Reason: audit.ReasonRecordNotFound},
+		{Action: "play_batch", Status: audit.StatusSuccess, Reason: audit.ReasonBatchCompleted, Metadata: audit.Metadata{Count: 5, Found: 3}},
+		{Action: "stream", Status: audit.StatusSuccess, Reason: audit.ReasonRecordFound},
+		{Action: "login_success", Status: audit.StatusSuccess, Reason: audit.ReasonPassword},
 	}
-	for _, row := range inserts {
-		if err := repo.Insert(row.action, "alice", "user", "127.0.0.1", "", row.detail, row.status); err != nil {
+	for i := range inserts {
+		inserts[i].Username = "alice"
+		if err := repo.Insert(&inserts[i]); err != nil {
 			t.Fatal(err)
 		}
 	}
@@ -100,3 +121,207 @@ func TestStats_aggregatesByDay(t *testing.T) {
 		t.Fatalf("series=%+v want one day %s", stats.Series, day)
 	}
 }
+
+func TestMigrateLegacy_parsesDetail(t *testing.T) {
+	dir := t.TempDir()
+	if err := db.InitDB(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	// 迁移前的记录：只有自由文本 detail，metadata 为 NULL
+	legacy := []struct {
+		action, detail, status string
+	}{
+		{"play", "录像已找到", "success"},
+		{"play", "流代理: 录像未找到", "fail"},
+		{"play_batch", "批量查询 7 条，找到 2 条", "success"},
+		{"login_fail", "登录受限，30 秒后可重试", "fail"},
+		{"login_fail", "账号已停用，请联系管理员", "fail"},
+		{"user_create", "创建用户（角色=user）", "success"},
+	}
+	database := db.GetDB()
+	for _, row := range legacy {
+		if _, err := database.Exec(`INSERT INTO audit_log (action, username, detail, status) VALUES (?, 'bob', ?, ?)`,
+			row.action, row.detail, row.status); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	repo := NewAuditRepository()
+	n, err := repo.MigrateLegacy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(legacy)) {
+		t.Fatalf("migrated=%d want %d", n, len(legacy))
+	}
+	if n, _ := repo.MigrateLegacy(); n != 0 {
+		t.Fatalf("second migration=%d want 0", n)
+	}
+
+	list, _, err := repo.List(nil, nil, "", "", 1, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]AuditEntry{}
+	for _, e := range list {
+		got[e.Action+"/"+e.Reason] = e
+	}
+	for key, detail := range map[string]string{
+		"play/record_found":           "录像已找到",
+		"stream/record_not_found":     "流代理: 录像未找到",
+		"play_batch/batch_completed":  "批量查询 7 条，找到 2 条",
+		"login_fail/throttled":        "登录受限，30 秒后可重试",
+		"login_fail/account_disabled": "账号已停用，请联系管理员",
+		"user_create/legacy":          "创建用户（角色=user）",
+	} {
+		e, ok := got[key]
+		if !ok {
+			t.Fatalf("missing %s in %+v", key, got)
+		}
+		if e.Detail != detail {
+			t.Fatalf("%s detail=%q want %q", key, e.Detail, detail)
+		}
+	}
+	if md := got["play_batch/batch_completed"].Metadata; md == nil || md.Count != 7 || md.Found != 2 {
+		t.Fatalf("batch metadata=%+v", md)
+	}
+
+	now := time.Now()
+	stats, err := repo.Stats(now.AddDate(0, 0, -1), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Summary.QuerySingle != 1 || stats.Summary.Stream != 1 || stats.Summary.QueryBatchRecords != 7 {
+		t.Fatalf("summary=%+v", stats.Summary)
+	}
+
+	// 迁移后为已有记录补算哈希链，新记录接在链尾
+	if n, err := repo.BackfillChain(); err != nil || n != int64(len(legacy)) {
+		t.Fatalf("backfill=%d err=%v", n, err)
+	}
+	if err := repo.Insert(&audit.Event{Action: "logout", Username: "bob", Status: audit.StatusSuccess, Reason: audit.ReasonOK}); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := repo.BackfillChain(); n != 0 {
+		t.Fatalf("second backfill=%d want 0", n)
+	}
+	rows, err := repo.ChainRows(0, 100)
+	if err != nil || len(rows) != len(legacy)+1 {
+		t.Fatalf("rows=%d err=%v", len(rows), err)
+	}
+	prev := ""
+	for _, r := range rows {
+		if r.PrevHash != prev || r.Hash != audit.ChainHash(prev, &r) {
+			t.Fatalf("broken link at #%d", r.ID)
+		}
+		prev = r.Hash
+	}
+}
+
+// blockingSink 在 release 关闭前阻塞写入，用于填满队列
+type blockingSink struct {
+	release chan struct{}
+}
+
+func (s *blockingSink) InsertBatch(events []*audit.Event) error {
+	<-s.release
+	return nil
+}
+
+func TestBufferedAudit_drainsOnCloseAndCountsDrops(t *testing.T) {
+	dir := t.TempDir()
+	if err := db.InitDB(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	repo := NewAuditRepository()
+	writer := audit.NewWriter(repo, audit.WriterConfig{QueueSize: 100, BatchSize: 10, FlushInterval: time.Hour})
+	buffered := NewBufferedAuditRepository(repo, writer)
+	for i := 0; i < 25; i++ {
+		if err := buffered.Insert(&audit.Event{Action: "play", Username: "u", Status: audit.StatusSuccess, Reason: audit.ReasonRecordFound}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, total, err := repo.List(nil, nil, "", "", 1, 10); err != nil || total != 25 {
+		t.Fatalf("total=%d err=%v want 25", total, err)
+	}
+	if st := writer.Stats(); st.Written != 25 || st.QueueDepth != 0 {
+		t.Fatalf("stats=%+v", st)
+	}
+	if err := buffered.Insert(&audit.Event{Action: "play"}); !errors.Is(err, audit.ErrWriterClosed) {
+		t.Fatalf("insert after close err=%v", err)
+	}
+
+	// drop 策略：写入阻塞时队列满即丢弃并计数
+	sink := &blockingSink{release: make(chan struct{})}
+	dropping := audit.NewWriter(sink, audit.WriterConfig{QueueSize: 2, BatchSize: 1, FlushInterval: time.Hour, Overflow: audit.OverflowDrop})
+	dropped := 0
+	for i := 0; i < 10; i++ {
+		if err := dropping.Enqueue(&audit.Event{Action: "play"}); errors.Is(err, audit.ErrQueueFull) {
+			dropped++
+		}
+	}
+	close(sink.release)
+	if err := dropping.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	st := dropping.Stats()
+	if dropped == 0 || st.Dropped != int64(dropped) || st.Written+st.Dropped != 10 {
+		t.Fatalf("dropped=%d stats=%+v", dropped, st)
+	}
+}
+
+func TestExport_streamsAllMatchingRowsInOrder(t *testing.T) {
+	dir := t.TempDir()
+	if err := db.InitDB(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	repo := NewAuditRepository()
+	var events []*audit.Event
+	for i := 0; i < exportChunk+205; i++ {
+		user := "alice"
+		if i%2 == 1 {
+			user = "bob"
+		}
+		events = append(events, &audit.Event{Action: "play", Username: user, Status: audit.StatusSuccess, Reason: audit.ReasonRecordFound})
+	}
+	if err := repo.InsertBatch(events); err != nil {
+		t.Fatal(err)
+	}
+
+	var lastID int64
+	n, err := repo.Export(nil, nil, "", "", func(e *AuditEntry) error {
+		if e.ID <= lastID {
+			t.Fatalf("id %d after %d", e.ID, lastID)
+		}
+		lastID = e.ID
+		return nil
+	})
+	if err != nil || n != int64(len(events)) {
+		t.Fatalf("n=%d err=%v want %d", n, err, len(events))
+	}
+
+	n, err = repo.Export(nil, nil, "play", "bob", func(e *AuditEntry) error {
+		if e.Username != "bob" || e.Detail == "" {
+			t.Fatalf("entry=%+v", e)
+		}
+		return nil
+	})
+	if err != nil || n != int64(len(events)/2) {
+		t.Fatalf("n=%d err=%v want %d", n, err, len(events)/2)
+	}
+
+	stop := errors.New("stop")
+	n, err = repo.Export(nil, nil, "", "", func(e *AuditEntry) error { return stop })
+	if !errors.Is(err, stop) || n != 0 {
+		t.Fatalf("n=%d err=%v", n, err)
+	}
+}
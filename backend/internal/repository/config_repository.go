@@ -49,6 +49,7 @@ func (r *configRepository) GetDefaultConfig() *config.Config {
 			AllowMethods: "POST, GET, OPTIONS",
 			AllowHeaders: "Content-Type",
 		},
+		PasswordPolicy: config.DefaultPasswordPolicy(),
 	}
 }
 
@@ -90,6 +91,11 @@ func (r *configRepository) GetConfig() (*config.Config, error) {
 		cfg.CORS.AllowMethods = "POST, GET, OPTIONS"
 		cfg.CORS.AllowHeaders = "Content-Type"
 	}
+	// 旧配置无密码策略时使用默认策略
+	if cfg.PasswordPolicy.MinLength == 0 {
+		cfg.PasswordPolicy = config.DefaultPasswordPolicy()
+	}
+	cfg.PasswordPolicy.Normalize()
 
 	return &cfg, nil
 }
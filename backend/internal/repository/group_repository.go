@@ -0,0 +1,312 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"dvr-manager/pkg/db"
+)
+
+// GroupMemberManual 管理员手动添加的组成员（SSO 同步不会移除）；亦为管理员创建的用户组的来源
+const GroupMemberManual = "manual"
+
+// Group 用户组
+type Group struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Role 组成员额外获得的角色，为空表示不授予
+	Role string `json:"role"`
+	// ExternalName SSO / 目录登录时匹配的 IdP 组名（与组 Claim 值或组 DN 的 CN 比较，不区分大小写），为空表示不同步
+	ExternalName string `json:"external_name"`
+	// Source manual（管理员创建）或 scim（由 IdP 通过 SCIM 创建）
+	Source      string    `json:"source"`
+	MemberCount int       `json:"member_count"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// GroupMember 组成员
+type GroupMember struct {
+	UserID    int64     `json:"user_id"`
+	Username  string    `json:"username"`
+	Source    string    `json:"source"` // manual / SSO 来源 / scim
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UserGroup 用户所属的组（随用户一并查询）
+type UserGroup struct {
+	ID     int64  `json:"id"`
+	Name   string `json:"name"`
+	Role   string `json:"role"`
+	Source string `json:"source"`
+}
+
+var (
+	// ErrGroupNotFound 用户组不存在
+	ErrGroupNotFound = errors.New("用户组不存在")
+	// ErrGroupExists 用户组名称已存在
+	ErrGroupExists = errors.New("用户组名称已存在")
+)
+
+// GroupRepository 用户组仓库接口
+type GroupRepository interface {
+	List() ([]Group, error)
+	Get(id int64) (*Group, error)
+	Create(g *Group) error
+	Update(g *Group) error
+	// Delete 删除组及其成员关系、访问策略
+	Delete(id int64) error
+
+	ListMembers(groupID int64) ([]GroupMember, error)
+	// AddMember 添加成员；已是成员时改为手动添加
+	AddMember(groupID, userID int64, source string) error
+	RemoveMember(groupID, userID int64) error
+	// AddSourceMember 以 source 来源添加成员；已是成员时保持原来源
+	AddSourceMember(groupID, userID int64, source string) error
+	// RemoveSourceMember 仅移除 source 来源的成员关系，返回是否移除
+	RemoveSourceMember(groupID, userID int64, source string) (bool, error)
+	// SyncMembers 使用户在 source 来源下的组恰为 groupIDs（不影响其他来源的成员关系），返回是否有变化
+	SyncMembers(userID int64, source string, groupIDs []int64) (bool, error)
+}
+
+type groupRepository struct {
+	db *sql.DB
+}
+
+// NewGroupRepository 创建用户组仓库
+func NewGroupRepository() GroupRepository {
+	return &groupRepository{db: db.GetDB()}
+}
+
+const groupColumns = `g.id, g.name, g.description, g.role, g.external_name, g.source, g.created_at, g.updated_at,
+	(SELECT COUNT(*) FROM group_members m WHERE m.group_id = g.id)`
+
+func scanGroup(row interface {
+	Scan(dest ...interface{}) error
+}) (*Group, error) {
+	var g Group
+	if err := row.Scan(&g.ID, &g.Name, &g.Description, &g.Role, &g.ExternalName, &g.Source, &g.CreatedAt, &g.UpdatedAt, &g.MemberCount); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// List 全部用户组
+func (r *groupRepository) List() ([]Group, error) {
+	rows, err := r.db.Query(`SELECT ` + groupColumns + ` FROM groups g ORDER BY g.name ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("list groups: %w", err)
+	}
+	defer rows.Close()
+
+	list := []Group{}
+	for rows.Next() {
+		g, err := scanGroup(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan group: %w", err)
+		}
+		list = append(list, *g)
+	}
+	return list, rows.Err()
+}
+
+// Get 按 ID 查询
+func (r *groupRepository) Get(id int64) (*Group, error) {
+	g, err := scanGroup(r.db.QueryRow(`SELECT `+groupColumns+` FROM groups g WHERE g.id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrGroupNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get group: %w", err)
+	}
+	return g, nil
+}
+
+// Create 新增用户组，回填 ID；Source 为空时为 manual
+func (r *groupRepository) Create(g *Group) error {
+	if g.Source == "" {
+		g.Source = GroupMemberManual
+	}
+	res, err := r.db.Exec(
+		`INSERT INTO groups (name, description, role, external_name, source) VALUES (?, ?, ?, ?, ?)`,
+		g.Name, g.Description, g.Role, g.ExternalName, g.Source,
+	)
+	if err != nil {
+		if isUniqueErr(err) {
+			return ErrGroupExists
+		}
+		return fmt.Errorf("create group: %w", err)
+	}
+	g.ID, _ = res.LastInsertId()
+	return nil
+}
+
+// Update 修改用户组
+func (r *groupRepository) Update(g *Group) error {
+	res, err := r.db.Exec(
+		`UPDATE groups SET name = ?, description = ?, role = ?, external_name = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		g.Name, g.Description, g.Role, g.ExternalName, g.ID,
+	)
+	if err != nil {
+		if isUniqueErr(err) {
+			return ErrGroupExists
+		}
+		return fmt.Errorf("update group: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrGroupNotFound
+	}
+	return nil
+}
+
+// Delete 删除用户组（成员关系与以该组为主体的访问策略一并删除）
+func (r *groupRepository) Delete(id int64) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM group_members WHERE group_id = ?`, id); err != nil {
+		return fmt.Errorf("delete group members: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM access_policies WHERE subject_type = ? AND subject_id = ?`, AccessSubjectGroup, id); err != nil {
+		return fmt.Errorf("delete group policies: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM groups WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("delete group: %w", err)
+	}
+	return tx.Commit()
+}
+
+// ListMembers 组成员（按用户名排序）
+func (r *groupRepository) ListMembers(groupID int64) ([]GroupMember, error) {
+	rows, err := r.db.Query(
+		`SELECT m.user_id, u.username, m.source, m.created_at
+		FROM group_members m JOIN users u ON u.id = m.user_id
+		WHERE m.group_id = ? ORDER BY u.username ASC`,
+		groupID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list group members: %w", err)
+	}
+	defer rows.Close()
+
+	list := []GroupMember{}
+	for rows.Next() {
+		var m GroupMember
+		if err := rows.Scan(&m.UserID, &m.Username, &m.Source, &m.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan group member: %w", err)
+		}
+		list = append(list, m)
+	}
+	return list, rows.Err()
+}
+
+// AddMember 添加成员；已存在时改为指定来源
+func (r *groupRepository) AddMember(groupID, userID int64, source string) error {
+	_, err := r.db.Exec(
+		`INSERT INTO group_members (group_id, user_id, source) VALUES (?, ?, ?)
+		ON CONFLICT(group_id, user_id) DO UPDATE SET source = excluded.source`,
+		groupID, userID, source,
+	)
+	if err != nil {
+		return fmt.Errorf("add group member: %w", err)
+	}
+	return nil
+}
+
+// RemoveMember 移除成员
+func (r *groupRepository) RemoveMember(groupID, userID int64) error {
+	if _, err := r.db.Exec(`DELETE FROM group_members WHERE group_id = ? AND user_id = ?`, groupID, userID); err != nil {
+		return fmt.Errorf("remove group member: %w", err)
+	}
+	return nil
+}
+
+// AddSourceMember 以指定来源添加成员（已是成员时不改动）
+func (r *groupRepository) AddSourceMember(groupID, userID int64, source string) error {
+	_, err := r.db.Exec(
+		`INSERT INTO group_members (group_id, user_id, source) VALUES (?, ?, ?) ON CONFLICT(group_id, user_id) DO NOTHING`,
+		groupID, userID, source,
+	)
+	if err != nil {
+		return fmt.Errorf("add group member: %w", err)
+	}
+	return nil
+}
+
+// RemoveSourceMember 移除指定来源的成员关系
+func (r *groupRepository) RemoveSourceMember(groupID, userID int64, source string) (bool, error) {
+	res, err := r.db.Exec(`DELETE FROM group_members WHERE group_id = ? AND user_id = ? AND source = ?`, groupID, userID, source)
+	if err != nil {
+		return false, fmt.Errorf("remove group member: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// SyncMembers 同步某来源的成员关系；手动添加的成员关系保持不变
+func (r *groupRepository) SyncMembers(userID int64, source string, groupIDs []int64) (bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	want := make(map[int64]bool, len(groupIDs))
+	for _, id := range groupIDs {
+		want[id] = true
+	}
+	rows, err := tx.Query(`SELECT group_id, source FROM group_members WHERE user_id = ?`, userID)
+	if err != nil {
+		return false, fmt.Errorf("list user groups: %w", err)
+	}
+	current := map[int64]string{}
+	for rows.Next() {
+		var id int64
+		var src string
+		if err := rows.Scan(&id, &src); err != nil {
+			rows.Close()
+			return false, fmt.Errorf("scan user group: %w", err)
+		}
+		current[id] = src
+	}
+	rows.Close()
+
+	changed := false
+	for id, src := range current {
+		if src == source && !want[id] {
+			if _, err := tx.Exec(`DELETE FROM group_members WHERE group_id = ? AND user_id = ?`, id, userID); err != nil {
+				return false, fmt.Errorf("remove group member: %w", err)
+			}
+			changed = true
+		}
+	}
+	for id := range want {
+		if _, ok := current[id]; ok {
+			continue
+		}
+		if _, err := tx.Exec(`INSERT INTO group_members (group_id, user_id, source) VALUES (?, ?, ?)`, id, userID, source); err != nil {
+			return false, fmt.Errorf("add group member: %w", err)
+		}
+		changed = true
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return changed, nil
+}
+
+// userGroupsColumn 用户所属组（JSON 数组），供 users 查询附带
+const userGroupsColumn = `COALESCE((SELECT json_group_array(json_object('id', g.id, 'name', g.name, 'role', g.role, 'source', m.source))
+		FROM group_members m JOIN groups g ON g.id = m.group_id WHERE m.user_id = users.id), '[]')`
+
+// sortUserGroups 按组名排序
+func sortUserGroups(groups []UserGroup) {
+	sort.Slice(groups, func(i, j int) bool { return strings.ToLower(groups[i].Name) < strings.ToLower(groups[j].Name) })
+}
@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"dvr-manager/pkg/db"
+)
+
+// UserIdentity 外部身份（IdP 中的 subject）与本地用户的关联
+type UserIdentity struct {
+	ID          int64      `json:"id"`
+	UserID      int64      `json:"user_id"`
+	Provider    string     `json:"provider"` // oidc:<id> / saml:<id>
+	Subject     string     `json:"subject"`  // OIDC sub / SAML NameID
+	Username    string     `json:"username"` // 关联时 IdP 提供的用户名（仅展示）
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+// ErrIdentityNotFound 外部身份不存在
+var ErrIdentityNotFound = errors.New("外部身份不存在")
+
+// ErrIdentityExists 外部身份已关联到某个用户
+var ErrIdentityExists = errors.New("该外部身份已关联到其他用户")
+
+// IdentityRepository 外部身份仓库接口
+type IdentityRepository interface {
+	// Get 按 (provider, subject) 查询
+	Get(provider, subject string) (*UserIdentity, error)
+	GetByID(id int64) (*UserIdentity, error)
+	ListByUser(userID int64) ([]UserIdentity, error)
+	Create(userID int64, provider, subject, username string) (*UserIdentity, error)
+	// Touch 记录通过该身份登录的时间
+	Touch(id int64) error
+	Delete(id int64) error
+}
+
+type identityRepository struct {
+	db *sql.DB
+}
+
+// NewIdentityRepository 创建外部身份仓库
+func NewIdentityRepository() IdentityRepository {
+	return &identityRepository{db: db.GetDB()}
+}
+
+const identityColumns = `id, user_id, provider, subject, username, created_at, last_login_at`
+
+func scanIdentity(row interface {
+	Scan(dest ...interface{}) error
+}) (*UserIdentity, error) {
+	var i UserIdentity
+	var lastLogin sql.NullTime
+	if err := row.Scan(&i.ID, &i.UserID, &i.Provider, &i.Subject, &i.Username, &i.CreatedAt, &lastLogin); err != nil {
+		return nil, err
+	}
+	if lastLogin.Valid {
+		i.LastLoginAt = &lastLogin.Time
+	}
+	return &i, nil
+}
+
+// Get 按 (provider, subject) 查询
+func (r *identityRepository) Get(provider, subject string) (*UserIdentity, error) {
+	i, err := scanIdentity(r.db.QueryRow(
+		`SELECT `+identityColumns+` FROM user_identities WHERE provider = ? AND subject = ?`,
+		provider, subject,
+	))
+	if err == sql.ErrNoRows {
+		return nil, ErrIdentityNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get identity: %w", err)
+	}
+	return i, nil
+}
+
+// GetByID 按 ID 查询
+func (r *identityRepository) GetByID(id int64) (*UserIdentity, error) {
+	i, err := scanIdentity(r.db.QueryRow(`SELECT `+identityColumns+` FROM user_identities WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrIdentityNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get identity: %w", err)
+	}
+	return i, nil
+}
+
+// ListByUser 用户关联的全部外部身份
+func (r *identityRepository) ListByUser(userID int64) ([]UserIdentity, error) {
+	rows, err := r.db.Query(
+		`SELECT `+identityColumns+` FROM user_identities WHERE user_id = ? ORDER BY id ASC`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list identities: %w", err)
+	}
+	defer rows.Close()
+
+	list := []UserIdentity{}
+	for rows.Next() {
+		i, err := scanIdentity(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan identity: %w", err)
+		}
+		list = append(list, *i)
+	}
+	return list, rows.Err()
+}
+
+// Create 建立关联
+func (r *identityRepository) Create(userID int64, provider, subject, username string) (*UserIdentity, error) {
+	res, err := r.db.Exec(
+		`INSERT INTO user_identities (user_id, provider, subject, username) VALUES (?, ?, ?, ?)`,
+		userID, provider, subject, username,
+	)
+	if err != nil {
+		if strings.Contains(strings.ToLower(err.Error()), "unique") {
+			return nil, ErrIdentityExists
+		}
+		return nil, fmt.Errorf("create identity: %w", err)
+	}
+	id, _ := res.LastInsertId()
+	return r.GetByID(id)
+}
+
+// Touch 更新最近登录时间
+func (r *identityRepository) Touch(id int64) error {
+	if _, err := r.db.Exec(`UPDATE user_identities SET last_login_at = ? WHERE id = ?`, time.Now(), id); err != nil {
+		return fmt.Errorf("touch identity: %w", err)
+	}
+	return nil
+}
+
+// Delete 解除关联
+func (r *identityRepository) Delete(id int64) error {
+	if _, err := r.db.Exec(`DELETE FROM user_identities WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("delete identity: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"dvr-manager/pkg/db"
+)
+
+// JWTKey JWT 签名密钥记录（私钥为 PKCS#8 PEM）
+type JWTKey struct {
+	KID        string
+	Alg        string
+	PrivateKey string
+	CreatedAt  time.Time
+	RetiredAt  *time.Time
+	ExpiresAt  *time.Time
+}
+
+// JWTKeyRepository JWT 签名密钥仓库接口
+type JWTKeyRepository interface {
+	Create(k *JWTKey) error
+	// ListUsable 返回未过期的密钥（当前密钥 + 宽限期内的旧密钥），按创建时间倒序
+	ListUsable(alg string, now time.Time) ([]*JWTKey, error)
+	// Retire 将除 keepKID 外仍在用的密钥标记为已轮换，expiresAt 后不再用于验签
+	Retire(alg, keepKID string, expiresAt time.Time) (int64, error)
+	DeleteExpired(before time.Time) (int64, error)
+}
+
+type jwtKeyRepository struct {
+	db *sql.DB
+}
+
+// NewJWTKeyRepository 创建 JWT 签名密钥仓库
+func NewJWTKeyRepository() JWTKeyRepository {
+	return &jwtKeyRepository{db: db.GetDB()}
+}
+
+// Create 写入新密钥
+func (r *jwtKeyRepository) Create(k *JWTKey) error {
+	if k.CreatedAt.IsZero() {
+		k.CreatedAt = time.Now()
+	}
+	_, err := r.db.Exec(
+		`INSERT INTO jwt_keys (kid, alg, private_key, created_at) VALUES (?, ?, ?, ?)`,
+		k.KID, k.Alg, k.PrivateKey, k.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("create jwt key: %w", err)
+	}
+	return nil
+}
+
+// ListUsable 查询指定算法下可用于验签的密钥
+func (r *jwtKeyRepository) ListUsable(alg string, now time.Time) ([]*JWTKey, error) {
+	rows, err := r.db.Query(
+		`SELECT kid, alg, private_key, created_at, retired_at, expires_at FROM jwt_keys
+		 WHERE alg = ? AND (expires_at IS NULL OR expires_at > ?)
+		 ORDER BY created_at DESC`, alg, now,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list jwt keys: %w", err)
+	}
+	defer rows.Close()
+
+	var list []*JWTKey
+	for rows.Next() {
+		var k JWTKey
+		var retiredAt, expiresAt sql.NullTime
+		if err := rows.Scan(&k.KID, &k.Alg, &k.PrivateKey, &k.CreatedAt, &retiredAt, &expiresAt); err != nil {
+			return nil, fmt.Errorf("scan jwt key: %w", err)
+		}
+		if retiredAt.Valid {
+			k.RetiredAt = &retiredAt.Time
+		}
+		if expiresAt.Valid {
+			k.ExpiresAt = &expiresAt.Time
+		}
+		list = append(list, &k)
+	}
+	return list, rows.Err()
+}
+
+// Retire 轮换：旧密钥进入宽限期
+func (r *jwtKeyRepository) Retire(alg, keepKID string, expiresAt time.Time) (int64, error) {
+	res, err := r.db.Exec(
+		`UPDATE jwt_keys SET retired_at = ?, expires_at = ? WHERE alg = ? AND kid <> ? AND retired_at IS NULL`,
+		time.Now(), expiresAt, alg, keepKID,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("retire jwt keys: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// DeleteExpired 删除宽限期已过的旧密钥
+func (r *jwtKeyRepository) DeleteExpired(before time.Time) (int64, error) {
+	res, err := r.db.Exec(`DELETE FROM jwt_keys WHERE expires_at IS NOT NULL AND expires_at < ?`, before)
+	if err != nil {
+		return 0, fmt.Errorf("delete expired jwt keys: %w", err)
+	}
+	return res.RowsAffected()
+}
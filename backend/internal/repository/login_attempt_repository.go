@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"dvr-manager/pkg/db"
+)
+
+// 登录失败计数维度
+const (
+	LoginScopeUser = "user"
+	LoginScopeIP   = "ip"
+)
+
+// LoginAttempt 某个用户名或客户端 IP 的连续登录失败记录
+type LoginAttempt struct {
+	Scope         string     `json:"scope"`
+	Subject       string     `json:"subject"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty"`
+}
+
+// LoginAttemptRepository 登录失败计数仓库接口
+type LoginAttemptRepository interface {
+	// Get 不存在时返回 nil, nil
+	Get(scope, subject string) (*LoginAttempt, error)
+	Save(a *LoginAttempt) error
+	Reset(scope, subject string) error
+	// ListLocked 列出锁定尚未到期的记录
+	ListLocked(scope string, now time.Time) ([]LoginAttempt, error)
+	// DeleteStale 删除最近一次失败早于 before 且未处于锁定期的记录
+	DeleteStale(before time.Time) (int64, error)
+}
+
+type loginAttemptRepository struct {
+	db *sql.DB
+}
+
+// NewLoginAttemptRepository 创建登录失败计数仓库
+func NewLoginAttemptRepository() LoginAttemptRepository {
+	return &loginAttemptRepository{db: db.GetDB()}
+}
+
+func scanLoginAttempt(row interface {
+	Scan(dest ...interface{}) error
+}) (*LoginAttempt, error) {
+	var a LoginAttempt
+	var lockedUntil sql.NullTime
+	if err := row.Scan(&a.Scope, &a.Subject, &a.Failures, &a.LastFailureAt, &lockedUntil); err != nil {
+		return nil, err
+	}
+	if lockedUntil.Valid {
+		a.LockedUntil = &lockedUntil.Time
+	}
+	return &a, nil
+}
+
+// Get 查询失败记录
+func (r *loginAttemptRepository) Get(scope, subject string) (*LoginAttempt, error) {
+	row := r.db.QueryRow(
+		`SELECT scope, subject, failures, last_failure_at, locked_until FROM login_attempts WHERE scope = ? AND subject = ?`,
+		scope, subject,
+	)
+	a, err := scanLoginAttempt(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get login attempt: %w", err)
+	}
+	return a, nil
+}
+
+// Save 写入失败记录（存在则覆盖）
+func (r *loginAttemptRepository) Save(a *LoginAttempt) error {
+	var lockedUntil interface{}
+	if a.LockedUntil != nil {
+		lockedUntil = *a.LockedUntil
+	}
+	_, err := r.db.Exec(
+		`INSERT INTO login_attempts (scope, subject, failures, last_failure_at, locked_until) VALUES (?, ?, ?, ?, ?)
+		 ON CONFLICT(scope, subject) DO UPDATE SET failures = excluded.failures,
+		   last_failure_at = excluded.last_failure_at, locked_until = excluded.locked_until`,
+		a.Scope, a.Subject, a.Failures, a.LastFailureAt, lockedUntil,
+	)
+	if err != nil {
+		return fmt.Errorf("save login attempt: %w", err)
+	}
+	return nil
+}
+
+// Reset 清除失败记录（登录成功或管理员解锁）
+func (r *loginAttemptRepository) Reset(scope, subject string) error {
+	if _, err := r.db.Exec(`DELETE FROM login_attempts WHERE scope = ? AND subject = ?`, scope, subject); err != nil {
+		return fmt.Errorf("reset login attempt: %w", err)
+	}
+	return nil
+}
+
+// ListLocked 列出锁定中的记录
+func (r *loginAttemptRepository) ListLocked(scope string, now time.Time) ([]LoginAttempt, error) {
+	rows, err := r.db.Query(
+		`SELECT scope, subject, failures, last_failure_at, locked_until FROM login_attempts
+		 WHERE scope = ? AND locked_until IS NOT NULL AND locked_until > ? ORDER BY locked_until DESC`,
+		scope, now,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list locked login attempts: %w", err)
+	}
+	defer rows.Close()
+
+	var list []LoginAttempt
+	for rows.Next() {
+		a, err := scanLoginAttempt(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan login attempt: %w", err)
+		}
+		list = append(list, *a)
+	}
+	return list, rows.Err()
+}
+
+// DeleteStale 清理过期的失败记录
+func (r *loginAttemptRepository) DeleteStale(before time.Time) (int64, error) {
+	res, err := r.db.Exec(
+		`DELETE FROM login_attempts WHERE last_failure_at < ? AND (locked_until IS NULL OR locked_until < ?)`,
+		before, before,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("delete stale login attempts: %w", err)
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"dvr-manager/pkg/db"
+)
+
+// MFAState 用户二次验证状态
+type MFAState struct {
+	UserID   int64
+	Secret   string // 为空表示未生成密钥
+	Enabled  bool
+	LastStep int64 // 最近一次成功使用的 TOTP 时间步
+}
+
+// MFARepository 二次验证仓库接口（密钥存于 users 表，恢复码独立存储）
+type MFARepository interface {
+	Get(userID int64) (*MFAState, error)
+	// SetPendingSecret 写入待确认密钥（未启用状态）
+	SetPendingSecret(userID int64, secret string) error
+	Enable(userID int64) error
+	// Disable 关闭二次验证并清除密钥与全部恢复码
+	Disable(userID int64) error
+	// ConsumeStep 仅当 step 大于上次使用的时间步时记录并返回 true（拒绝验证码重放）
+	ConsumeStep(userID, step int64) (bool, error)
+	// ReplaceRecoveryCodes 用新的恢复码哈希替换全部旧恢复码
+	ReplaceRecoveryCodes(userID int64, hashes []string) error
+	// UseRecoveryCode 消费一个未使用的恢复码；返回 false 表示不存在或已使用
+	UseRecoveryCode(userID int64, hash string) (bool, error)
+	CountRecoveryCodes(userID int64) (int, error)
+}
+
+type mfaRepository struct {
+	db *sql.DB
+}
+
+// NewMFARepository 创建二次验证仓库
+func NewMFARepository() MFARepository {
+	return &mfaRepository{db: db.GetDB()}
+}
+
+// Get 查询状态
+func (r *mfaRepository) Get(userID int64) (*MFAState, error) {
+	st := MFAState{UserID: userID}
+	var secret sql.NullString
+	err := r.db.QueryRow(
+		`SELECT mfa_secret, mfa_enabled, mfa_last_step FROM users WHERE id = ?`, userID,
+	).Scan(&secret, &st.Enabled, &st.LastStep)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get mfa state: %w", err)
+	}
+	st.Secret = secret.String
+	return &st, nil
+}
+
+// SetPendingSecret 写入待确认密钥
+func (r *mfaRepository) SetPendingSecret(userID int64, secret string) error {
+	_, err := r.db.Exec(
+		`UPDATE users SET mfa_secret = ?, mfa_enabled = 0, mfa_last_step = 0, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		secret, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("set mfa secret: %w", err)
+	}
+	return nil
+}
+
+// Enable 启用二次验证
+func (r *mfaRepository) Enable(userID int64) error {
+	_, err := r.db.Exec(
+		`UPDATE users SET mfa_enabled = 1, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND mfa_secret IS NOT NULL`,
+		userID,
+	)
+	if err != nil {
+		return fmt.Errorf("enable mfa: %w", err)
+	}
+	return nil
+}
+
+// Disable 关闭二次验证
+func (r *mfaRepository) Disable(userID int64) error {
+	if _, err := r.db.Exec(
+		`UPDATE users SET mfa_secret = NULL, mfa_enabled = 0, mfa_last_step = 0, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		userID,
+	); err != nil {
+		return fmt.Errorf("disable mfa: %w", err)
+	}
+	if _, err := r.db.Exec(`DELETE FROM mfa_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("delete recovery codes: %w", err)
+	}
+	return nil
+}
+
+// ConsumeStep 记录已使用的时间步
+func (r *mfaRepository) ConsumeStep(userID, step int64) (bool, error) {
+	res, err := r.db.Exec(
+		`UPDATE users SET mfa_last_step = ? WHERE id = ? AND mfa_last_step < ?`,
+		step, userID, step,
+	)
+	if err != nil {
+		return false, fmt.Errorf("consume totp step: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// ReplaceRecoveryCodes 替换恢复码
+func (r *mfaRepository) ReplaceRecoveryCodes(userID int64, hashes []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM mfa_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("delete recovery codes: %w", err)
+	}
+	now := time.Now()
+	for _, h := range hashes {
+		if _, err := tx.Exec(
+			`INSERT INTO mfa_recovery_codes (user_id, code_hash, created_at) VALUES (?, ?, ?)`,
+			userID, h, now,
+		); err != nil {
+			return fmt.Errorf("insert recovery code: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// UseRecoveryCode 消费恢复码
+func (r *mfaRepository) UseRecoveryCode(userID int64, hash string) (bool, error) {
+	res, err := r.db.Exec(
+		`UPDATE mfa_recovery_codes SET used_at = ? WHERE id = (
+			SELECT id FROM mfa_recovery_codes WHERE user_id = ? AND code_hash = ? AND used_at IS NULL LIMIT 1
+		)`,
+		time.Now(), userID, hash,
+	)
+	if err != nil {
+		return false, fmt.Errorf("use recovery code: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// CountRecoveryCodes 剩余可用恢复码数量
+func (r *mfaRepository) CountRecoveryCodes(userID int64) (int, error) {
+	var n int
+	if err := r.db.QueryRow(
+		`SELECT COUNT(*) FROM mfa_recovery_codes WHERE user_id = ? AND used_at IS NULL`, userID,
+	).Scan(&n); err != nil {
+		return 0, fmt.Errorf("count recovery codes: %w", err)
+	}
+	return n, nil
+}
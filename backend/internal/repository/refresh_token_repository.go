@@ -0,0 +1,158 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"dvr-manager/pkg/db"
+)
+
+// RefreshToken 刷新令牌记录（明文令牌不落库，仅保存哈希）
+type RefreshToken struct {
+	ID        int64
+	FamilyID  string
+	UserID    int64
+	TokenHash string
+	ClientIP  string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	RotatedAt *time.Time
+	RevokedAt *time.Time
+}
+
+// ErrRefreshTokenNotFound 刷新令牌不存在
+var ErrRefreshTokenNotFound = errors.New("刷新令牌不存在")
+
+// RefreshTokenRepository 刷新令牌仓库接口
+type RefreshTokenRepository interface {
+	Create(t *RefreshToken) error
+	GetByHash(hash string) (*RefreshToken, error)
+	// Rotate 在同一事务中将令牌 id 标记为已轮换并写入下一个令牌 next；
+	// 返回 false 表示令牌已被使用或吊销（并发重放），此时不写入 next
+	Rotate(id int64, next *RefreshToken) (bool, error)
+	RevokeFamily(familyID string) (int64, error)
+	RevokeUser(userID int64) (int64, error)
+	DeleteExpired(before time.Time) (int64, error)
+}
+
+type refreshTokenRepository struct {
+	db *sql.DB
+}
+
+// NewRefreshTokenRepository 创建刷新令牌仓库
+func NewRefreshTokenRepository() RefreshTokenRepository {
+	return &refreshTokenRepository{db: db.GetDB()}
+}
+
+// Create 写入新的刷新令牌
+func (r *refreshTokenRepository) Create(t *RefreshToken) error {
+	if t.CreatedAt.IsZero() {
+		t.CreatedAt = time.Now()
+	}
+	res, err := r.db.Exec(
+		`INSERT INTO refresh_tokens (family_id, user_id, token_hash, client_ip, created_at, expires_at)
+		 VALUES (?, ?, ?, ?, ?, ?)`,
+		t.FamilyID, t.UserID, t.TokenHash, t.ClientIP, t.CreatedAt, t.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("create refresh token: %w", err)
+	}
+	t.ID, _ = res.LastInsertId()
+	return nil
+}
+
+// GetByHash 根据令牌哈希查询
+func (r *refreshTokenRepository) GetByHash(hash string) (*RefreshToken, error) {
+	var t RefreshToken
+	var clientIP sql.NullString
+	var rotatedAt, revokedAt sql.NullTime
+	err := r.db.QueryRow(
+		`SELECT id, family_id, user_id, token_hash, client_ip, created_at, expires_at, rotated_at, revoked_at
+		 FROM refresh_tokens WHERE token_hash = ?`, hash,
+	).Scan(&t.ID, &t.FamilyID, &t.UserID, &t.TokenHash, &clientIP, &t.CreatedAt, &t.ExpiresAt, &rotatedAt, &revokedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrRefreshTokenNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get refresh token: %w", err)
+	}
+	t.ClientIP = clientIP.String
+	if rotatedAt.Valid {
+		t.RotatedAt = &rotatedAt.Time
+	}
+	if revokedAt.Valid {
+		t.RevokedAt = &revokedAt.Time
+	}
+	return &t, nil
+}
+
+// Rotate 仅当令牌仍有效时标记为已轮换并写入新令牌；任一步失败整体回滚，旧令牌仍可使用
+func (r *refreshTokenRepository) Rotate(id int64, next *RefreshToken) (bool, error) {
+	if next.CreatedAt.IsZero() {
+		next.CreatedAt = time.Now()
+	}
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("rotate refresh token: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		`UPDATE refresh_tokens SET rotated_at = ? WHERE id = ? AND rotated_at IS NULL AND revoked_at IS NULL`,
+		next.CreatedAt, id,
+	)
+	if err != nil {
+		return false, fmt.Errorf("rotate refresh token: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n != 1 {
+		return false, err
+	}
+	res, err = tx.Exec(
+		`INSERT INTO refresh_tokens (family_id, user_id, token_hash, client_ip, created_at, expires_at)
+		 VALUES (?, ?, ?, ?, ?, ?)`,
+		next.FamilyID, next.UserID, next.TokenHash, next.ClientIP, next.CreatedAt, next.ExpiresAt,
+	)
+	if err != nil {
+		return false, fmt.Errorf("rotate refresh token: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("rotate refresh token: %w", err)
+	}
+	next.ID, _ = res.LastInsertId()
+	return true, nil
+}
+
+// RevokeFamily 吊销同一轮换链上的全部令牌
+func (r *refreshTokenRepository) RevokeFamily(familyID string) (int64, error) {
+	res, err := r.db.Exec(
+		`UPDATE refresh_tokens SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL`,
+		time.Now(), familyID,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("revoke refresh token family: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// RevokeUser 吊销某用户的全部刷新令牌
+func (r *refreshTokenRepository) RevokeUser(userID int64) (int64, error) {
+	res, err := r.db.Exec(
+		`UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`,
+		time.Now(), userID,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("revoke user refresh tokens: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// DeleteExpired 硬删除 expires_at 早于 before 的记录
+func (r *refreshTokenRepository) DeleteExpired(before time.Time) (int64, error) {
+	res, err := r.db.Exec(`DELETE FROM refresh_tokens WHERE expires_at < ?`, before)
+	if err != nil {
+		return 0, fmt.Errorf("delete expired refresh tokens: %w", err)
+	}
+	return res.RowsAffected()
+}
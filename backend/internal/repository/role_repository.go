@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"dvr-manager/pkg/db"
+)
+
+// Role 角色及其权限集合
+type Role struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Permissions []string  `json:"permissions"`
+	BuiltIn     bool      `json:"builtin"` // 内置角色不可删除
+	UserCount   int       `json:"user_count"`
+	GroupCount  int       `json:"group_count"` // 授予该角色的用户组数量
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// ErrRoleNotFound 角色不存在
+var ErrRoleNotFound = errors.New("角色不存在")
+
+// ErrRoleExists 角色已存在
+var ErrRoleExists = errors.New("角色已存在")
+
+// RoleRepository 角色仓库接口
+type RoleRepository interface {
+	List() ([]Role, error)
+	Get(name string) (*Role, error)
+	Create(r *Role) error
+	// Ensure 角色不存在时创建（内置角色初始化），已存在则不改动
+	Ensure(r *Role) error
+	Update(name, description string, permissions []string) error
+	Delete(name string) error
+}
+
+type roleRepository struct {
+	db *sql.DB
+}
+
+// NewRoleRepository 创建角色仓库
+func NewRoleRepository() RoleRepository {
+	return &roleRepository{db: db.GetDB()}
+}
+
+const roleColumns = `r.name, r.description, r.permissions, r.builtin, r.created_at, r.updated_at,
+	(SELECT COUNT(*) FROM users u WHERE u.role = r.name), (SELECT COUNT(*) FROM groups g WHERE g.role = r.name)`
+
+func scanRole(row interface {
+	Scan(dest ...interface{}) error
+}) (*Role, error) {
+	var r Role
+	var perms string
+	if err := row.Scan(&r.Name, &r.Description, &perms, &r.BuiltIn, &r.CreatedAt, &r.UpdatedAt, &r.UserCount, &r.GroupCount); err != nil {
+		return nil, err
+	}
+	r.Permissions = splitScopes(perms)
+	return &r, nil
+}
+
+// List 全部角色（内置在前）
+func (r *roleRepository) List() ([]Role, error) {
+	rows, err := r.db.Query(`SELECT ` + roleColumns + ` FROM roles r ORDER BY r.builtin DESC, r.name ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("list roles: %w", err)
+	}
+	defer rows.Close()
+
+	list := []Role{}
+	for rows.Next() {
+		role, err := scanRole(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan role: %w", err)
+		}
+		list = append(list, *role)
+	}
+	return list, rows.Err()
+}
+
+// Get 按名称查询
+func (r *roleRepository) Get(name string) (*Role, error) {
+	role, err := scanRole(r.db.QueryRow(`SELECT `+roleColumns+` FROM roles r WHERE r.name = ?`, name))
+	if err == sql.ErrNoRows {
+		return nil, ErrRoleNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get role: %w", err)
+	}
+	return role, nil
+}
+
+// Create 新增角色
+func (r *roleRepository) Create(role *Role) error {
+	_, err := r.db.Exec(
+		`INSERT INTO roles (name, description, permissions, builtin) VALUES (?, ?, ?, ?)`,
+		role.Name, role.Description, strings.Join(role.Permissions, ","), role.BuiltIn,
+	)
+	if err != nil {
+		if strings.Contains(strings.ToLower(err.Error()), "unique") || strings.Contains(strings.ToLower(err.Error()), "primary key") {
+			return ErrRoleExists
+		}
+		return fmt.Errorf("create role: %w", err)
+	}
+	return nil
+}
+
+// Ensure 不存在时创建
+func (r *roleRepository) Ensure(role *Role) error {
+	_, err := r.db.Exec(
+		`INSERT OR IGNORE INTO roles (name, description, permissions, builtin) VALUES (?, ?, ?, ?)`,
+		role.Name, role.Description, strings.Join(role.Permissions, ","), role.BuiltIn,
+	)
+	if err != nil {
+		return fmt.Errorf("ensure role: %w", err)
+	}
+	return nil
+}
+
+// Update 修改描述与权限
+func (r *roleRepository) Update(name, description string, permissions []string) error {
+	res, err := r.db.Exec(
+		`UPDATE roles SET description = ?, permissions = ?, updated_at = CURRENT_TIMESTAMP WHERE name = ?`,
+		description, strings.Join(permissions, ","), name,
+	)
+	if err != nil {
+		return fmt.Errorf("update role: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrRoleNotFound
+	}
+	return nil
+}
+
+// Delete 删除角色
+func (r *roleRepository) Delete(name string) error {
+	if _, err := r.db.Exec(`DELETE FROM roles WHERE name = ?`, name); err != nil {
+		return fmt.Errorf("delete role: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"dvr-manager/pkg/db"
+)
+
+// Session 登录会话
+type Session struct {
+	ID           string     `json:"id"`
+	UserID       int64      `json:"user_id"`
+	Username     string     `json:"username"`
+	Role         string     `json:"role"`
+	ClientIP     string     `json:"client_ip"`
+	UserAgent    string     `json:"user_agent"`
+	CreatedAt    time.Time  `json:"created_at"`
+	LastSeenAt   time.Time  `json:"last_seen_at"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+	RevokeReason string     `json:"revoke_reason,omitempty"`
+	SSOSource    string     `json:"sso_source,omitempty"` // oidc:<id> 等，本地登录为空
+	IDTokenHint  string     `json:"-"`                    // OIDC 登出用的 id_token_hint
+	// ImpersonatorID / Impersonator 模拟登录会话的发起管理员，普通会话为 0 / 空
+	ImpersonatorID int64  `json:"impersonator_id,omitempty"`
+	Impersonator   string `json:"impersonator,omitempty"`
+}
+
+// Active 会话未吊销且未过期
+func (s *Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// ErrSessionNotFound 会话不存在
+var ErrSessionNotFound = errors.New("会话不存在")
+
+// SessionRepository 会话仓库接口
+type SessionRepository interface {
+	Create(s *Session) error
+	Get(id string) (*Session, error)
+	// Touch 刷新令牌轮换时顺延会话有效期
+	Touch(id, clientIP string, expiresAt time.Time) error
+	ListByUser(userID int64, activeOnly bool) ([]Session, error)
+	Revoke(id, reason string) (bool, error)
+	// RevokeUser 吊销用户全部会话（含其发起的模拟登录会话），返回被吊销的会话 ID
+	RevokeUser(userID int64, reason string) ([]string, error)
+	DeleteExpired(before time.Time) (int64, error)
+}
+
+type sessionRepository struct {
+	db *sql.DB
+}
+
+// NewSessionRepository 创建会话仓库
+func NewSessionRepository() SessionRepository {
+	return &sessionRepository{db: db.GetDB()}
+}
+
+const sessionColumns = `id, user_id, username, role, client_ip, user_agent, created_at, last_seen_at, expires_at, revoked_at, revoke_reason, sso_source, id_token_hint, impersonator_id, impersonator`
+
+func scanSession(row interface {
+	Scan(dest ...interface{}) error
+}) (*Session, error) {
+	var s Session
+	var clientIP, userAgent, reason, ssoSource, idTokenHint sql.NullString
+	var revokedAt sql.NullTime
+	if err := row.Scan(&s.ID, &s.UserID, &s.Username, &s.Role, &clientIP, &userAgent,
+		&s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt, &revokedAt, &reason, &ssoSource, &idTokenHint,
+		&s.ImpersonatorID, &s.Impersonator); err != nil {
+		return nil, err
+	}
+	s.ClientIP = clientIP.String
+	s.UserAgent = userAgent.String
+	s.RevokeReason = reason.String
+	s.SSOSource = ssoSource.String
+	s.IDTokenHint = idTokenHint.String
+	if revokedAt.Valid {
+		s.RevokedAt = &revokedAt.Time
+	}
+	return &s, nil
+}
+
+// Create 新建会话
+func (r *sessionRepository) Create(s *Session) error {
+	now := time.Now()
+	if s.CreatedAt.IsZero() {
+		s.CreatedAt = now
+	}
+	if s.LastSeenAt.IsZero() {
+		s.LastSeenAt = now
+	}
+	_, err := r.db.Exec(
+		`INSERT INTO sessions (id, user_id, username, role, client_ip, user_agent, created_at, last_seen_at, expires_at, sso_source, id_token_hint,
+		 impersonator_id, impersonator)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		s.ID, s.UserID, s.Username, s.Role, s.ClientIP, s.UserAgent, s.CreatedAt, s.LastSeenAt, s.ExpiresAt,
+		s.SSOSource, s.IDTokenHint, s.ImpersonatorID, s.Impersonator,
+	)
+	if err != nil {
+		return fmt.Errorf("create session: %w", err)
+	}
+	return nil
+}
+
+// Get 根据 ID 查询
+func (r *sessionRepository) Get(id string) (*Session, error) {
+	row := r.db.QueryRow(`SELECT `+sessionColumns+` FROM sessions WHERE id = ?`, id)
+	s, err := scanSession(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get session: %w", err)
+	}
+	return s, nil
+}
+
+// Touch 更新最近活跃时间与过期时间
+func (r *sessionRepository) Touch(id, clientIP string, expiresAt time.Time) error {
+	_, err := r.db.Exec(
+		`UPDATE sessions SET last_seen_at = ?, client_ip = ?, expires_at = ? WHERE id = ?`,
+		time.Now(), clientIP, expiresAt, id,
+	)
+	if err != nil {
+		return fmt.Errorf("touch session: %w", err)
+	}
+	return nil
+}
+
+// ListByUser 列出用户会话（按创建时间倒序）
+func (r *sessionRepository) ListByUser(userID int64, activeOnly bool) ([]Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE user_id = ?`
+	args := []interface{}{userID}
+	if activeOnly {
+		query += ` AND revoked_at IS NULL AND expires_at > ?`
+		args = append(args, time.Now())
+	}
+	rows, err := r.db.Query(query+` ORDER BY created_at DESC`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	list := make([]Session, 0)
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *s)
+	}
+	return list, rows.Err()
+}
+
+// Revoke 吊销单个会话；返回 false 表示会话不存在或已吊销
+func (r *sessionRepository) Revoke(id, reason string) (bool, error) {
+	res, err := r.db.Exec(
+		`UPDATE sessions SET revoked_at = ?, revoke_reason = ? WHERE id = ? AND revoked_at IS NULL`,
+		time.Now(), reason, id,
+	)
+	if err != nil {
+		return false, fmt.Errorf("revoke session: %w", err)
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// RevokeUser 吊销用户全部未吊销会话，以及该用户作为管理员发起的模拟登录会话
+func (r *sessionRepository) RevokeUser(userID int64, reason string) ([]string, error) {
+	rows, err := r.db.Query(`SELECT id FROM sessions WHERE (user_id = ? OR impersonator_id = ?) AND revoked_at IS NULL`, userID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list user sessions: %w", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, err := r.db.Exec(
+		`UPDATE sessions SET revoked_at = ?, revoke_reason = ? WHERE (user_id = ? OR impersonator_id = ?) AND revoked_at IS NULL`,
+		time.Now(), reason, userID, userID,
+	); err != nil {
+		return nil, fmt.Errorf("revoke user sessions: %w", err)
+	}
+	return ids, nil
+}
+
+// DeleteExpired 硬删除 expires_at 早于 before 的会话
+func (r *sessionRepository) DeleteExpired(before time.Time) (int64, error) {
+	res, err := r.db.Exec(`DELETE FROM sessions WHERE expires_at < ?`, before)
+	if err != nil {
+		return 0, fmt.Errorf("delete expired sessions: %w", err)
+	}
+	return res.RowsAffected()
+}
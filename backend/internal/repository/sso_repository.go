@@ -1,7 +1,9 @@
 package repository
 
 import (
+	"crypto/rand"
 	"database/sql"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"time"
@@ -12,6 +14,8 @@ import (
 // SSO 提供商类型常量
 const (
 	SSOTypeOIDC = "oidc"
+	SSOTypeLDAP = "ldap" // 用户名密码登录时回落到目录认证，不出现在登录页按钮中
+	SSOTypeSAML = "saml"
 )
 
 // ErrSSOProviderNotFound 提供商不存在
@@ -20,7 +24,7 @@ var ErrSSOProviderNotFound = errors.New("sso 提供商不存在")
 // SSOProvider SSO 提供商记录
 type SSOProvider struct {
 	ID         int64     `json:"id"`
-	Type       string    `json:"type"`        // oidc
+	Type       string    `json:"type"`        // oidc / ldap / saml
 	Name       string    `json:"name"`        // 展示名
 	Enabled    bool      `json:"enabled"`     // 是否启用
 	ConfigJSON string    `json:"config_json"` // 协议相关配置 JSON
@@ -37,8 +41,15 @@ type SSORepository interface {
 	Update(p *SSOProvider) error
 	SetEnabled(id int64, enabled bool) error
 	Delete(id int64) error
+	// FlowKey 返回 SSO 登录流程 Cookie 的加密密钥；首次调用时随机生成并写入 config 表，重启与多实例间保持一致
+	FlowKey() ([]byte, error)
+	// ConsumeSAMLAssertion 记录已使用的断言 ID（保留到 expiresAt）；同一 ID 再次出现时返回 false
+	ConsumeSAMLAssertion(assertionID string, expiresAt, now time.Time) (bool, error)
 }
 
+// ssoFlowKeyName config 表中保存流程 Cookie 密钥的键
+const ssoFlowKeyName = "sso_flow_key"
+
 type ssoRepository struct {
 	db *sql.DB
 }
@@ -170,3 +181,42 @@ func (r *ssoRepository) Delete(id int64) error {
 	_, err := r.db.Exec(`DELETE FROM sso_providers WHERE id = ?`, id)
 	return err
 }
+
+// FlowKey 读取流程 Cookie 密钥，不存在时生成；INSERT OR IGNORE 保证并发初始化时各实例读到同一把密钥
+func (r *ssoRepository) FlowKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("generate sso flow key: %w", err)
+	}
+	if _, err := r.db.Exec(
+		`INSERT OR IGNORE INTO config (key, value) VALUES (?, ?)`,
+		ssoFlowKeyName, base64.StdEncoding.EncodeToString(key),
+	); err != nil {
+		return nil, fmt.Errorf("save sso flow key: %w", err)
+	}
+	var stored string
+	if err := r.db.QueryRow(`SELECT value FROM config WHERE key = ?`, ssoFlowKeyName).Scan(&stored); err != nil {
+		return nil, fmt.Errorf("get sso flow key: %w", err)
+	}
+	key, err := base64.StdEncoding.DecodeString(stored)
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("invalid sso flow key in config")
+	}
+	return key, nil
+}
+
+// ConsumeSAMLAssertion 清理过期记录后写入断言 ID；主键冲突即为重放
+func (r *ssoRepository) ConsumeSAMLAssertion(assertionID string, expiresAt, now time.Time) (bool, error) {
+	if _, err := r.db.Exec(`DELETE FROM saml_assertions WHERE expires_at <= ?`, now); err != nil {
+		return false, fmt.Errorf("purge saml assertions: %w", err)
+	}
+	res, err := r.db.Exec(
+		`INSERT OR IGNORE INTO saml_assertions (assertion_id, expires_at) VALUES (?, ?)`,
+		assertionID, expiresAt,
+	)
+	if err != nil {
+		return false, fmt.Errorf("record saml assertion: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n == 1, nil
+}
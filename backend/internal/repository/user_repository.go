@@ -2,11 +2,13 @@ package repository
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
 	"time"
 
+	"dvr-manager/internal/config"
 	"dvr-manager/pkg/db"
 )
 
@@ -17,8 +19,67 @@ type User struct {
 	PasswordHash string    `json:"-"`
 	Role         string    `json:"role"`
 	Source       string    `json:"source"`
+	MFAEnabled   bool      `json:"mfa_enabled"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
+	// PasswordChangedAt 最近一次设置密码的时间（旧数据为空时取 CreatedAt）
+	PasswordChangedAt time.Time `json:"password_changed_at"`
+	// MustChangePassword 须修改密码后才能使用（种子账号、管理员重置）
+	MustChangePassword bool `json:"must_change_password"`
+	// 用户资料（SSO 登录时由 IdP 同步）
+	Email       string `json:"email"`
+	DisplayName string `json:"display_name"`
+	AvatarURL   string `json:"avatar_url"`
+	// LastLoginAt / LastLoginIP 最近一次登录（任意登录方式），从未登录为空
+	LastLoginAt *time.Time `json:"last_login_at"`
+	LastLoginIP string     `json:"last_login_ip"`
+	// Groups 所属用户组（按组名排序）
+	Groups []UserGroup `json:"groups"`
+	// Disabled 账号已停用（管理员停用或到期自动停用），停用时间与原因见 DisabledAt / DisabledReason
+	Disabled       bool       `json:"disabled"`
+	DisabledAt     *time.Time `json:"disabled_at"`
+	DisabledReason string     `json:"disabled_reason"`
+	UserRestrictions
+	// ExternalID SCIM 预配时 IdP 提供的 externalId
+	ExternalID string `json:"external_id"`
+}
+
+// SourceSCIM 由 IdP 通过 SCIM 预配的账号来源
+const SourceSCIM = "scim"
+
+// 停用原因
+const (
+	DisabledReasonExpired = "expired"
+	// DisabledReasonSCIM IdP 通过 SCIM 将账号置为 active=false
+	DisabledReasonSCIM = "scim"
+)
+
+// UserRestrictions 账号有效期与登录限制，零值表示不限制
+type UserRestrictions struct {
+	// ExpiresAt 到期后不能登录，并由定时任务自动停用
+	ExpiresAt *time.Time `json:"expires_at"`
+	// LoginHours 允许登录与访问的时段（服务器本地时间），逗号分隔，如 08:00-18:00,20:00-22:00
+	LoginHours string `json:"login_hours"`
+	// AllowedCIDRs 允许的来源网段
+	AllowedCIDRs []string `json:"allowed_cidrs"`
+}
+
+// UserProfile IdP 提供的用户资料；空字段不覆盖已有值
+type UserProfile struct {
+	Email       string
+	DisplayName string
+	AvatarURL   string
+}
+
+// UserFilter 用户列表筛选条件，零值表示不筛选
+type UserFilter struct {
+	Query           string // 用户名 / 邮箱 / 显示名模糊匹配
+	Role            string
+	Source          string // local / ldap:<id> / oidc:<id> / saml:<id> / scim
+	LastLoginAfter  *time.Time
+	LastLoginBefore *time.Time // 含从未登录
+	NeverLoggedIn   bool
+	Status          string // enabled / disabled
 }
 
 // ErrUserNotFound 用户不存在
@@ -31,11 +92,29 @@ var ErrUserExists = errors.New("用户已存在")
 type UserRepository interface {
 	GetByUsername(username string) (*User, error)
 	GetByID(id int64) (*User, error)
-	List() ([]User, error)
+	List(f UserFilter) ([]User, error)
 	Create(username, passwordHash, role string) (*User, error)
 	CreateSSO(username, role, source string) (*User, error)
-	UpdatePassword(id int64, passwordHash string) error
+	// UpdatePassword 更新密码哈希，原哈希写入历史（保留最近 config.MaxPasswordHistory 条）；
+	// mustChange 为 true 表示该密码须由用户本人修改后才能继续使用
+	UpdatePassword(id int64, passwordHash string, mustChange bool) error
+	// SetMustChangePassword 设置 / 清除须修改密码标记
+	SetMustChangePassword(id int64, mustChange bool) error
+	// PasswordHistory 最近 limit 条历史密码哈希（新的在前）
+	PasswordHistory(userID int64, limit int) ([]string, error)
 	UpdateRole(id int64, role string) error
+	// UpdateProfile 更新资料中非空的字段
+	UpdateProfile(id int64, p UserProfile) error
+	// RecordLogin 记录最近登录时间与 IP
+	RecordLogin(id int64, clientIP string) error
+	// SetDisabled 停用 / 启用账号；启用时清除停用原因
+	SetDisabled(id int64, disabled bool, reason string) error
+	// UpdateRestrictions 设置有效期与登录限制
+	UpdateRestrictions(id int64, r UserRestrictions) error
+	// ListExpired 已到期但尚未停用的账号
+	ListExpired(now time.Time) ([]User, error)
+	// SetExternalID 设置 SCIM externalId
+	SetExternalID(id int64, externalID string) error
 	Delete(id int64) error
 	Count() (int, error)
 }
@@ -49,20 +128,48 @@ func NewUserRepository() UserRepository {
 	return &userRepository{db: db.GetDB()}
 }
 
+const userColumns = `id, username, password_hash, role, source, mfa_enabled, created_at, updated_at, password_changed_at, must_change_password,
+	email, display_name, avatar_url, last_login_at, last_login_ip, disabled, disabled_at, disabled_reason, expires_at, login_hours, allowed_cidrs,
+	external_id, ` + userGroupsColumn
+
 func (r *userRepository) scan(row interface {
 	Scan(dest ...interface{}) error
 }) (*User, error) {
 	var u User
-	if err := row.Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Role, &u.Source, &u.CreatedAt, &u.UpdatedAt); err != nil {
+	var changedAt, lastLogin, disabledAt, expiresAt sql.NullTime
+	var cidrs, groups string
+	if err := row.Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Role, &u.Source, &u.MFAEnabled, &u.CreatedAt, &u.UpdatedAt, &changedAt, &u.MustChangePassword,
+		&u.Email, &u.DisplayName, &u.AvatarURL, &lastLogin, &u.LastLoginIP, &u.Disabled, &disabledAt, &u.DisabledReason, &expiresAt, &u.LoginHours, &cidrs,
+		&u.ExternalID, &groups); err != nil {
 		return nil, err
 	}
+	if disabledAt.Valid {
+		u.DisabledAt = &disabledAt.Time
+	}
+	if expiresAt.Valid {
+		u.ExpiresAt = &expiresAt.Time
+	}
+	if err := json.Unmarshal([]byte(cidrs), &u.AllowedCIDRs); err != nil || u.AllowedCIDRs == nil {
+		u.AllowedCIDRs = []string{}
+	}
+	if err := json.Unmarshal([]byte(groups), &u.Groups); err != nil || u.Groups == nil {
+		u.Groups = []UserGroup{}
+	}
+	sortUserGroups(u.Groups)
+	if lastLogin.Valid {
+		u.LastLoginAt = &lastLogin.Time
+	}
+	u.PasswordChangedAt = u.CreatedAt
+	if changedAt.Valid {
+		u.PasswordChangedAt = changedAt.Time
+	}
 	return &u, nil
 }
 
 // GetByUsername 根据用户名查询
 func (r *userRepository) GetByUsername(username string) (*User, error) {
 	row := r.db.QueryRow(
-		`SELECT id, username, password_hash, role, source, created_at, updated_at FROM users WHERE username = ?`,
+		`SELECT `+userColumns+` FROM users WHERE username = ?`,
 		username,
 	)
 	u, err := r.scan(row)
@@ -78,7 +185,7 @@ func (r *userRepository) GetByUsername(username string) (*User, error) {
 // GetByID 根据 ID 查询
 func (r *userRepository) GetByID(id int64) (*User, error) {
 	row := r.db.QueryRow(
-		`SELECT id, username, password_hash, role, source, created_at, updated_at FROM users WHERE id = ?`,
+		`SELECT `+userColumns+` FROM users WHERE id = ?`,
 		id,
 	)
 	u, err := r.scan(row)
@@ -91,11 +198,45 @@ func (r *userRepository) GetByID(id int64) (*User, error) {
 	return u, nil
 }
 
-// List 列出全部用户
-func (r *userRepository) List() ([]User, error) {
-	rows, err := r.db.Query(
-		`SELECT id, username, password_hash, role, source, created_at, updated_at FROM users ORDER BY id ASC`,
-	)
+// List 按条件列出用户
+func (r *userRepository) List(f UserFilter) ([]User, error) {
+	where := "1 = 1"
+	var args []interface{}
+	if q := strings.TrimSpace(f.Query); q != "" {
+		like := "%" + q + "%"
+		where += " AND (username LIKE ? OR email LIKE ? OR display_name LIKE ?)"
+		args = append(args, like, like, like)
+	}
+	if f.Role != "" {
+		where += " AND role = ?"
+		args = append(args, f.Role)
+	}
+	if f.Source != "" {
+		where += " AND source = ?"
+		args = append(args, f.Source)
+	}
+	if f.LastLoginAfter != nil {
+		where += " AND last_login_at >= ?"
+		args = append(args, *f.LastLoginAfter)
+	}
+	if f.LastLoginBefore != nil {
+		where += " AND (last_login_at IS NULL OR last_login_at <= ?)"
+		args = append(args, *f.LastLoginBefore)
+	}
+	if f.NeverLoggedIn {
+		where += " AND last_login_at IS NULL"
+	}
+	switch f.Status {
+	case "enabled":
+		where += " AND disabled = 0"
+	case "disabled":
+		where += " AND disabled = 1"
+	}
+	return r.query(`SELECT `+userColumns+` FROM users WHERE `+where+` ORDER BY id ASC`, args...)
+}
+
+func (r *userRepository) query(q string, args ...interface{}) ([]User, error) {
+	rows, err := r.db.Query(q, args...)
 	if err != nil {
 		return nil, fmt.Errorf("list users: %w", err)
 	}
@@ -103,11 +244,11 @@ func (r *userRepository) List() ([]User, error) {
 
 	var users []User
 	for rows.Next() {
-		var u User
-		if err := rows.Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Role, &u.Source, &u.CreatedAt, &u.UpdatedAt); err != nil {
+		u, err := r.scan(rows)
+		if err != nil {
 			return nil, err
 		}
-		users = append(users, u)
+		users = append(users, *u)
 	}
 	return users, rows.Err()
 }
@@ -115,7 +256,7 @@ func (r *userRepository) List() ([]User, error) {
 // Create 新增本地用户
 func (r *userRepository) Create(username, passwordHash, role string) (*User, error) {
 	res, err := r.db.Exec(
-		`INSERT INTO users (username, password_hash, role, source) VALUES (?, ?, ?, 'local')`,
+		`INSERT INTO users (username, password_hash, role, source, password_changed_at) VALUES (?, ?, ?, 'local', CURRENT_TIMESTAMP)`,
 		username, passwordHash, role,
 	)
 	if err != nil {
@@ -145,17 +286,69 @@ func (r *userRepository) CreateSSO(username, role, source string) (*User, error)
 }
 
 // UpdatePassword 更新密码哈希
-func (r *userRepository) UpdatePassword(id int64, passwordHash string) error {
+func (r *userRepository) UpdatePassword(id int64, passwordHash string, mustChange bool) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("update password: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		`INSERT INTO password_history (user_id, password_hash) SELECT id, password_hash FROM users WHERE id = ? AND source = 'local'`,
+		id,
+	); err != nil {
+		return fmt.Errorf("update password: %w", err)
+	}
+	if _, err := tx.Exec(
+		`DELETE FROM password_history WHERE user_id = ? AND id NOT IN (
+			SELECT id FROM password_history WHERE user_id = ? ORDER BY id DESC LIMIT ?)`,
+		id, id, config.MaxPasswordHistory,
+	); err != nil {
+		return fmt.Errorf("update password: %w", err)
+	}
+	if _, err := tx.Exec(
+		`UPDATE users SET password_hash = ?, must_change_password = ?, password_changed_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		passwordHash, mustChange, id,
+	); err != nil {
+		return fmt.Errorf("update password: %w", err)
+	}
+	return tx.Commit()
+}
+
+// SetMustChangePassword 设置须修改密码标记
+func (r *userRepository) SetMustChangePassword(id int64, mustChange bool) error {
 	_, err := r.db.Exec(
-		`UPDATE users SET password_hash = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
-		passwordHash, id,
+		`UPDATE users SET must_change_password = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		mustChange, id,
 	)
 	if err != nil {
-		return fmt.Errorf("update password: %w", err)
+		return fmt.Errorf("set must change password: %w", err)
 	}
 	return nil
 }
 
+// PasswordHistory 历史密码哈希
+func (r *userRepository) PasswordHistory(userID int64, limit int) ([]string, error) {
+	rows, err := r.db.Query(
+		`SELECT password_hash FROM password_history WHERE user_id = ? ORDER BY id DESC LIMIT ?`,
+		userID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("password history: %w", err)
+	}
+	defer rows.Close()
+
+	var hashes []string
+	for rows.Next() {
+		var h string
+		if err := rows.Scan(&h); err != nil {
+			return nil, fmt.Errorf("scan password history: %w", err)
+		}
+		hashes = append(hashes, h)
+	}
+	return hashes, rows.Err()
+}
+
 // UpdateRole 更新角色
 func (r *userRepository) UpdateRole(id int64, role string) error {
 	_, err := r.db.Exec(
@@ -168,12 +361,99 @@ func (r *userRepository) UpdateRole(id int64, role string) error {
 	return nil
 }
 
+// UpdateProfile 更新资料（空字段保持原值）
+func (r *userRepository) UpdateProfile(id int64, p UserProfile) error {
+	_, err := r.db.Exec(
+		`UPDATE users SET
+			email = CASE WHEN ? = '' THEN email ELSE ? END,
+			display_name = CASE WHEN ? = '' THEN display_name ELSE ? END,
+			avatar_url = CASE WHEN ? = '' THEN avatar_url ELSE ? END,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?`,
+		p.Email, p.Email, p.DisplayName, p.DisplayName, p.AvatarURL, p.AvatarURL, id,
+	)
+	if err != nil {
+		return fmt.Errorf("update profile: %w", err)
+	}
+	return nil
+}
+
+// RecordLogin 记录最近登录
+func (r *userRepository) RecordLogin(id int64, clientIP string) error {
+	_, err := r.db.Exec(
+		`UPDATE users SET last_login_at = ?, last_login_ip = ? WHERE id = ?`,
+		time.Now(), clientIP, id,
+	)
+	if err != nil {
+		return fmt.Errorf("record login: %w", err)
+	}
+	return nil
+}
+
+// SetDisabled 停用 / 启用账号
+func (r *userRepository) SetDisabled(id int64, disabled bool, reason string) error {
+	var err error
+	if disabled {
+		_, err = r.db.Exec(
+			`UPDATE users SET disabled = 1, disabled_at = ?, disabled_reason = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+			time.Now(), reason, id,
+		)
+	} else {
+		_, err = r.db.Exec(
+			`UPDATE users SET disabled = 0, disabled_at = NULL, disabled_reason = '', updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+			id,
+		)
+	}
+	if err != nil {
+		return fmt.Errorf("set disabled: %w", err)
+	}
+	return nil
+}
+
+// UpdateRestrictions 设置有效期与登录限制
+func (r *userRepository) UpdateRestrictions(id int64, u UserRestrictions) error {
+	cidrs := u.AllowedCIDRs
+	if cidrs == nil {
+		cidrs = []string{}
+	}
+	raw, _ := json.Marshal(cidrs)
+	_, err := r.db.Exec(
+		`UPDATE users SET expires_at = ?, login_hours = ?, allowed_cidrs = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		u.ExpiresAt, u.LoginHours, string(raw), id,
+	)
+	if err != nil {
+		return fmt.Errorf("update restrictions: %w", err)
+	}
+	return nil
+}
+
+// ListExpired 已到期且未停用的账号
+func (r *userRepository) ListExpired(now time.Time) ([]User, error) {
+	return r.query(`SELECT `+userColumns+` FROM users WHERE disabled = 0 AND expires_at IS NOT NULL AND expires_at <= ? ORDER BY id ASC`, now)
+}
+
+// SetExternalID 设置 SCIM externalId
+func (r *userRepository) SetExternalID(id int64, externalID string) error {
+	_, err := r.db.Exec(
+		`UPDATE users SET external_id = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		externalID, id,
+	)
+	if err != nil {
+		return fmt.Errorf("set external id: %w", err)
+	}
+	return nil
+}
+
 // Delete 删除用户
 func (r *userRepository) Delete(id int64) error {
 	_, err := r.db.Exec(`DELETE FROM users WHERE id = ?`, id)
 	if err != nil {
 		return fmt.Errorf("delete user: %w", err)
 	}
+	_, _ = r.db.Exec(`DELETE FROM password_history WHERE user_id = ?`, id)
+	_, _ = r.db.Exec(`DELETE FROM user_identities WHERE user_id = ?`, id)
+	_, _ = r.db.Exec(`DELETE FROM access_policies WHERE subject_type = 'user' AND subject_id = ?`, id)
+	_, _ = r.db.Exec(`DELETE FROM group_members WHERE user_id = ?`, id)
 	return nil
 }
 
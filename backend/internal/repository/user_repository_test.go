@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"dvr-manager/pkg/db"
+)
+
+func TestUserRepository_profileAndLastLogin(t *testing.T) {
+	if err := db.InitDB(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	repo := NewUserRepository()
+	alice, err := repo.CreateSSO("alice", "user", "oidc:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Create("bob", "hash", "admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.UpdateProfile(alice.ID, UserProfile{Email: "alice@example.com", DisplayName: "Alice"}); err != nil {
+		t.Fatal(err)
+	}
+	// 空字段不覆盖
+	if err := repo.UpdateProfile(alice.ID, UserProfile{AvatarURL: "https://img.test/a.png"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.RecordLogin(alice.ID, "10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := repo.GetByID(alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Email != "alice@example.com" || got.DisplayName != "Alice" || got.AvatarURL != "https://img.test/a.png" {
+		t.Fatalf("unexpected profile %+v", got)
+	}
+	if got.LastLoginAt == nil || got.LastLoginIP != "10.0.0.1" {
+		t.Fatalf("last login not recorded: %+v", got)
+	}
+
+	cases := []struct {
+		name string
+		f    UserFilter
+		want []string
+	}{
+		{"all", UserFilter{}, []string{"alice", "bob"}},
+		{"query email", UserFilter{Query: "example.com"}, []string{"alice"}},
+		{"source", UserFilter{Source: "local"}, []string{"bob"}},
+		{"role", UserFilter{Role: "admin"}, []string{"bob"}},
+		{"never logged in", UserFilter{NeverLoggedIn: true}, []string{"bob"}},
+		{"logged in since", UserFilter{LastLoginAfter: ptrTime(time.Now().Add(-time.Hour))}, []string{"alice"}},
+		{"inactive before", UserFilter{LastLoginBefore: ptrTime(time.Now().Add(-time.Hour))}, []string{"bob"}},
+	}
+	for _, tc := range cases {
+		list, err := repo.List(tc.f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, u := range list {
+			names = append(names, u.Username)
+		}
+		if len(names) != len(tc.want) {
+			t.Fatalf("%s: got %v, want %v", tc.name, names, tc.want)
+		}
+		for i := range names {
+			if names[i] != tc.want[i] {
+				t.Fatalf("%s: got %v, want %v", tc.name, names, tc.want)
+			}
+		}
+	}
+}
+
+func ptrTime(t time.Time) *time.Time { return &t }
@@ -1,6 +1,7 @@
 package router
 
 import (
+	"dvr-manager/internal/audit"
 	"dvr-manager/internal/auth"
 	"dvr-manager/internal/config"
 	"dvr-manager/internal/handler"
@@ -13,8 +14,10 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// NewRouter 创建路由
-func NewRouter(cfg *config.Config, cacheTTLDays int, jwt *auth.JWT) *gin.Engine {
+// NewRouter 创建路由；auditRepo 为经 auditWriter 异步批量写入的审计仓库，auditArchives 负责保留期清理前的归档，
+// auditChain 负责审计哈希链的检查点与校验
+func NewRouter(cfg *config.Config, cacheTTLDays int, jwt *auth.JWT, auditRepo repository.AuditRepository, auditWriter *audit.Writer,
+	auditArchives service.AuditArchiveService, auditChain service.AuditChainService) (*gin.Engine, error) {
 	gin.SetMode(gin.ReleaseMode)
 
 	r := gin.New()
@@ -24,90 +27,196 @@ func NewRouter(cfg *config.Config, cacheTTLDays int, jwt *auth.JWT) *gin.Engine
 
 	configRepo := repository.NewConfigRepository()
 	dvrRepo := repository.NewDVRRepository()
-	auditRepo := repository.NewAuditRepository()
 	userRepo := repository.NewUserRepository()
 	ssoRepo := repository.NewSSORepository()
+	identityRepo := repository.NewIdentityRepository()
 	recordingCacheRepo := repository.NewRecordingCacheRepository()
+	refreshTokenRepo := repository.NewRefreshTokenRepository()
+	sessionRepo := repository.NewSessionRepository()
+	apiTokenRepo := repository.NewAPITokenRepository()
+	roleRepo := repository.NewRoleRepository()
+	accessRepo := repository.NewAccessRepository()
+	groupRepo := repository.NewGroupRepository()
 
 	cacheInstance := cache.NewSQLiteCache(recordingCacheRepo, cacheTTLDays)
 	dvrService := service.NewDVRService(cfg, dvrRepo)
 	proxyService := service.NewProxyService(cfg)
 	configService := service.NewConfigService(configRepo, dvrRepo)
-	authService := service.NewAuthService(userRepo)
-	ssoService := service.NewSSOService(ssoRepo)
-
-	authHandler := handler.NewAuthHandler(authService, jwt, auditRepo)
-	playHandler := handler.NewPlayHandler(dvrService, cacheInstance, auditRepo)
-	proxyHandler := handler.NewProxyHandler(proxyService, dvrService, cacheInstance, auditRepo)
+	sessionService := service.NewSessionService(sessionRepo, refreshTokenRepo, userRepo)
+	roleService := service.NewRoleService(roleRepo)
+	ssoService, err := service.NewSSOService(ssoRepo, roleService)
+	if err != nil {
+		return nil, err
+	}
+	accessService := service.NewAccessService(accessRepo, userRepo, groupRepo)
+	groupService := service.NewGroupService(groupRepo, userRepo, roleService)
+	authService := service.NewAuthService(userRepo, identityRepo, roleService, groupService, sessionService, ssoService)
+	tokenService := service.NewTokenService(jwt, refreshTokenRepo, sessionRepo, userRepo)
+	apiTokenService := service.NewAPITokenService(apiTokenRepo, userRepo, roleService)
+	mfaService := service.NewMFAService(repository.NewMFARepository(), userRepo, jwt)
+	throttleService := service.NewLoginThrottleService(repository.NewLoginAttemptRepository(), service.LoginPolicyFromEnv())
+
+	authHandler := handler.NewAuthHandler(authService, tokenService, sessionService, mfaService, throttleService, ssoService, roleService, jwt, auditRepo)
+	playHandler := handler.NewPlayHandler(dvrService, accessService, cacheInstance, auditRepo)
+	proxyHandler := handler.NewProxyHandler(proxyService, dvrService, accessService, cacheInstance, auditRepo)
 	configHandler := handler.NewConfigHandler()
 	healthHandler := handler.NewHealthHandler()
 	adminHandler := handler.NewAdminHandler(configService, auditRepo)
-	auditHandler := handler.NewAuditHandler(auditRepo)
+	auditHandler := handler.NewAuditHandler(auditRepo, auditWriter, auditArchives, auditChain)
 	dashboardHandler := handler.NewDashboardHandler(auditRepo)
-	userHandler := handler.NewUserHandler(authService, auditRepo)
-	ssoHandler := handler.NewSSOHandler(ssoService, authService, auditRepo, jwt)
-	ssoAdminHandler := handler.NewSSOAdminHandler(ssoRepo, ssoService, auditRepo)
+	userHandler := handler.NewUserHandler(authService, roleService, sessionService, tokenService, throttleService, auditRepo)
+	ssoHandler := handler.NewSSOHandler(ssoService, authService, tokenService, auditRepo)
+	ssoAdminHandler := handler.NewSSOAdminHandler(ssoRepo, ssoService, roleService, auditRepo)
+	jwksHandler := handler.NewJWKSHandler(jwt)
+	apiTokenHandler := handler.NewAPITokenHandler(authService, apiTokenService, auditRepo)
+	mfaHandler := handler.NewMFAHandler(authService, mfaService, auditRepo)
+	roleHandler := handler.NewRoleHandler(roleService, auditRepo)
+	accessHandler := handler.NewAccessHandler(accessService, auditRepo)
+	groupHandler := handler.NewGroupHandler(groupService, authService, roleService, auditRepo)
+	scimHandler := handler.NewSCIMHandler(service.NewSCIMService(userRepo, groupRepo, authService, roleService), auditRepo)
 
 	auth := r.Group("/api/auth")
 	{
 		auth.POST("/login", authHandler.Login)
+		auth.POST("/login/mfa", authHandler.LoginMFA)
+		auth.POST("/login/mfa/setup", authHandler.LoginMFASetup)
+		auth.POST("/login/mfa/activate", authHandler.LoginMFAActivate)
+		auth.POST("/refresh", authHandler.Refresh)
 		auth.GET("/me", authHandler.Me)
 		auth.POST("/logout", authHandler.Logout)
 		auth.GET("/sso/providers", ssoHandler.ListProviders)
 		auth.GET("/sso/oidc/:id/login", ssoHandler.OIDCLogin)
 		auth.GET("/sso/oidc/:id/callback", ssoHandler.OIDCCallback)
+		auth.GET("/sso/saml/:id/metadata", ssoHandler.SAMLMetadata)
+		auth.GET("/sso/saml/:id/login", ssoHandler.SAMLLogin)
+		auth.POST("/sso/saml/:id/acs", ssoHandler.SAMLACS)
+		auth.POST("/sso/link", authHandler.ConfirmSSOLink)
 	}
 
 	authProtected := r.Group("/api/auth")
-	authProtected.Use(middleware.AuthMiddleware(jwt))
+	authProtected.Use(middleware.AuthMiddleware(jwt, sessionService, apiTokenService))
+	authProtected.Use(middleware.SessionOnlyMiddleware())
+	authProtected.Use(middleware.NoImpersonationMiddleware())
 	{
 		authProtected.POST("/change-password", authHandler.ChangePassword)
+		authProtected.GET("/tokens", apiTokenHandler.ListMine)
+		authProtected.POST("/tokens", apiTokenHandler.Create)
+		authProtected.DELETE("/tokens/:id", apiTokenHandler.RevokeMine)
+		authProtected.GET("/mfa", mfaHandler.Status)
+		authProtected.POST("/mfa/setup", mfaHandler.Setup)
+		authProtected.POST("/mfa/activate", mfaHandler.Activate)
+		authProtected.POST("/mfa/disable", mfaHandler.Disable)
+		authProtected.POST("/mfa/recovery-codes", mfaHandler.RegenerateRecoveryCodes)
 	}
 
-	playAuth := middleware.PlayAuthMiddleware(jwt)
+	playAuth := middleware.PlayAuthMiddleware(jwt, sessionService, apiTokenService)
 
 	api := r.Group("/api")
-	api.Use(playAuth)
+	api.Use(playAuth, middleware.RequireScope(service.ScopePlay), middleware.RequirePlayPermission(roleService, service.PermPlay))
 	{
 		api.POST("/play", playHandler.Handle)
 		api.GET("/play", playHandler.Handle)
 	}
 	r.GET("/api/config", configHandler.Handle)
 
+	// 管理接口：按角色权限逐路由校验，API 令牌另需 admin:read / admin:write 范围
+	perm := func(perms ...string) gin.HandlerFunc { return middleware.RequirePermission(roleService, perms...) }
 	admin := r.Group("/api/admin")
-	admin.Use(middleware.AuthMiddleware(jwt))
-	admin.Use(middleware.AdminMiddleware())
+	admin.Use(middleware.AuthMiddleware(jwt, sessionService, apiTokenService))
+	admin.Use(middleware.AdminScopeMiddleware())
+	admin.Use(middleware.ImpersonationReadOnlyMiddleware())
 	{
-		admin.GET("/config", adminHandler.GetConfig)
-		admin.POST("/config", adminHandler.UpdateConfig)
-		admin.GET("/dvr-servers", adminHandler.GetDVRServers)
-		admin.POST("/dvr-servers", adminHandler.UpdateDVRServers)
-		admin.POST("/reload", adminHandler.ReloadConfig)
-		admin.GET("/audit", auditHandler.GetAudit)
-		admin.GET("/dashboard/stats", dashboardHandler.GetStats)
-		admin.POST("/audit/cleanup", auditHandler.Cleanup)
-		admin.GET("/users", userHandler.List)
-		admin.POST("/users", userHandler.Create)
-		admin.PUT("/users/:id/role", userHandler.UpdateRole)
-		admin.POST("/users/:id/reset-password", userHandler.ResetPassword)
-		admin.DELETE("/users/:id", userHandler.Delete)
-		admin.GET("/sso/providers", ssoAdminHandler.List)
-		admin.POST("/sso/providers", ssoAdminHandler.Create)
-		admin.PUT("/sso/providers/:id", ssoAdminHandler.Update)
-		admin.POST("/sso/providers/:id/toggle", ssoAdminHandler.Toggle)
-		admin.DELETE("/sso/providers/:id", ssoAdminHandler.Delete)
+		admin.GET("/config", perm(service.PermConfigRead), adminHandler.GetConfig)
+		admin.POST("/config", perm(service.PermConfigWrite), adminHandler.UpdateConfig)
+		admin.GET("/dvr-servers", perm(service.PermConfigRead), adminHandler.GetDVRServers)
+		admin.POST("/dvr-servers", perm(service.PermConfigWrite), adminHandler.UpdateDVRServers)
+		admin.POST("/reload", perm(service.PermConfigWrite), adminHandler.ReloadConfig)
+		admin.GET("/audit", perm(service.PermAuditRead), auditHandler.GetAudit)
+		admin.GET("/dashboard/stats", perm(service.PermDashboardRead), dashboardHandler.GetStats)
+		admin.POST("/audit/cleanup", perm(service.PermAuditManage), auditHandler.Cleanup)
+		admin.GET("/audit/export", perm(service.PermAuditRead), auditHandler.Export)
+		admin.GET("/audit/metrics", perm(service.PermAuditRead), auditHandler.Metrics)
+		admin.GET("/audit/verify", perm(service.PermAuditRead), auditHandler.Verify)
+		admin.GET("/audit/archives", perm(service.PermAuditRead), auditHandler.ListArchives)
+		admin.GET("/audit/archives/:name", perm(service.PermAuditRead), auditHandler.QueryArchive)
+		admin.GET("/users", perm(service.PermUsersRead), userHandler.List)
+		admin.POST("/users", perm(service.PermUsersWrite), userHandler.Create)
+		admin.POST("/users/disable", perm(service.PermUsersWrite), userHandler.Disable)
+		admin.POST("/users/enable", perm(service.PermUsersWrite), userHandler.Enable)
+		admin.PUT("/users/:id/restrictions", perm(service.PermUsersWrite), userHandler.UpdateRestrictions)
+		admin.PUT("/users/:id/role", perm(service.PermUsersWrite), userHandler.UpdateRole)
+		admin.POST("/users/:id/reset-password", perm(service.PermUsersWrite), userHandler.ResetPassword)
+		admin.DELETE("/users/:id", perm(service.PermUsersWrite), userHandler.Delete)
+		admin.DELETE("/users/:id/mfa", perm(service.PermUsersWrite), mfaHandler.Reset)
+		admin.POST("/users/:id/unlock", perm(service.PermUsersWrite), userHandler.Unlock)
+		admin.POST("/users/:id/impersonate", perm(service.PermImpersonate), middleware.SessionOnlyMiddleware(), userHandler.Impersonate)
+		admin.GET("/users/:id/sessions", perm(service.PermUsersRead), userHandler.ListSessions)
+		admin.DELETE("/users/:id/sessions", perm(service.PermUsersWrite), userHandler.RevokeSessions)
+		admin.DELETE("/sessions/:sid", perm(service.PermUsersWrite), userHandler.RevokeSession)
+		admin.GET("/users/:id/identities", perm(service.PermUsersRead), userHandler.ListIdentities)
+		admin.POST("/users/:id/identities", perm(service.PermUsersWrite), userHandler.LinkIdentity)
+		admin.DELETE("/users/:id/identities/:iid", perm(service.PermUsersWrite), userHandler.UnlinkIdentity)
+		admin.GET("/api-tokens", perm(service.PermUsersRead), apiTokenHandler.ListAll)
+		admin.DELETE("/api-tokens/:id", perm(service.PermUsersWrite), apiTokenHandler.Revoke)
+		admin.GET("/sso/providers", perm(service.PermSSOManage), ssoAdminHandler.List)
+		admin.POST("/sso/providers", perm(service.PermSSOManage), ssoAdminHandler.Create)
+		admin.PUT("/sso/providers/:id", perm(service.PermSSOManage), ssoAdminHandler.Update)
+		admin.POST("/sso/providers/:id/toggle", perm(service.PermSSOManage), ssoAdminHandler.Toggle)
+		admin.DELETE("/sso/providers/:id", perm(service.PermSSOManage), ssoAdminHandler.Delete)
+		admin.GET("/roles", perm(service.PermRolesManage, service.PermUsersRead), roleHandler.List)
+		admin.POST("/roles", perm(service.PermRolesManage), roleHandler.Create)
+		admin.PUT("/roles/:name", perm(service.PermRolesManage), roleHandler.Update)
+		admin.DELETE("/roles/:name", perm(service.PermRolesManage), roleHandler.Delete)
+		admin.GET("/groups", perm(service.PermUsersRead), groupHandler.List)
+		admin.POST("/groups", perm(service.PermUsersWrite), groupHandler.Create)
+		admin.PUT("/groups/:id", perm(service.PermUsersWrite), groupHandler.Update)
+		admin.DELETE("/groups/:id", perm(service.PermUsersWrite), groupHandler.Delete)
+		admin.GET("/groups/:id/members", perm(service.PermUsersRead), groupHandler.ListMembers)
+		admin.POST("/groups/:id/members", perm(service.PermUsersWrite), groupHandler.AddMember)
+		admin.DELETE("/groups/:id/members/:uid", perm(service.PermUsersWrite), groupHandler.RemoveMember)
+		admin.GET("/dvr-groups", perm(service.PermAccessManage), accessHandler.ListGroups)
+		admin.POST("/dvr-groups", perm(service.PermAccessManage), accessHandler.CreateGroup)
+		admin.PUT("/dvr-groups/:id", perm(service.PermAccessManage), accessHandler.UpdateGroup)
+		admin.DELETE("/dvr-groups/:id", perm(service.PermAccessManage), accessHandler.DeleteGroup)
+		admin.GET("/access-policies", perm(service.PermAccessManage), accessHandler.ListPolicies)
+		admin.POST("/access-policies", perm(service.PermAccessManage), accessHandler.CreatePolicy)
+		admin.PUT("/access-policies/:id", perm(service.PermAccessManage), accessHandler.UpdatePolicy)
+		admin.DELETE("/access-policies/:id", perm(service.PermAccessManage), accessHandler.DeletePolicy)
 	}
 
 	stream := r.Group("/stream")
-	stream.Use(playAuth)
+	stream.Use(playAuth, middleware.RequireScope(service.ScopeStream),
+		middleware.RequirePlayPermission(roleService, service.PermPlay), middleware.RequireDownloadPermission(roleService))
 	{
 		stream.GET("/:filename", proxyHandler.Handle)
 	}
 
+	// SCIM 2.0 预配：仅在设置 SCIM_TOKEN 时启用
+	if token := service.SCIMTokenFromEnv(); token != "" {
+		scim := r.Group("/scim/v2")
+		scim.Use(middleware.SCIMAuthMiddleware(token))
+		{
+			scim.GET("/ServiceProviderConfig", scimHandler.ServiceProviderConfig)
+			scim.GET("/Users", scimHandler.ListUsers)
+			scim.POST("/Users", scimHandler.CreateUser)
+			scim.GET("/Users/:id", scimHandler.GetUser)
+			scim.PUT("/Users/:id", scimHandler.ReplaceUser)
+			scim.PATCH("/Users/:id", scimHandler.PatchUser)
+			scim.DELETE("/Users/:id", scimHandler.DeleteUser)
+			scim.GET("/Groups", scimHandler.ListGroups)
+			scim.POST("/Groups", scimHandler.CreateGroup)
+			scim.GET("/Groups/:id", scimHandler.GetGroup)
+			scim.PUT("/Groups/:id", scimHandler.ReplaceGroup)
+			scim.PATCH("/Groups/:id", scimHandler.PatchGroup)
+			scim.DELETE("/Groups/:id", scimHandler.DeleteGroup)
+		}
+	}
+
 	r.GET("/health", healthHandler.Handle)
 	r.HEAD("/health", healthHandler.Handle)
+	r.GET("/.well-known/jwks.json", jwksHandler.Handle)
 
 	web.Register(r)
 
-	return r
+	return r, nil
 }
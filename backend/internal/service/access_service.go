@@ -0,0 +1,371 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"dvr-manager/internal/repository"
+)
+
+// ErrAccessDenied 访问策略不允许访问该录像
+var ErrAccessDenied = errors.New("无权访问该录像")
+
+// accessRule 单条策略编译结果：servers 为 nil 表示不限服务器，patterns 为空表示不限录像编号
+type accessRule struct {
+	servers  map[string]bool
+	patterns []string
+}
+
+func (r accessRule) matchRecord(recordID string) bool {
+	if len(r.patterns) == 0 {
+		return true
+	}
+	for _, p := range r.patterns {
+		if ok, _ := path.Match(p, recordID); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// AccessScope 调用方的访问范围；nil 表示不受限，没有任何规则的范围拒绝全部录像。
+// 多条策略取并集：录像编号匹配某条策略时，可访问该策略的 DVR 分组
+type AccessScope struct {
+	rules []accessRule
+}
+
+// normalizeServer DVR 基础 URL 统一去掉首尾空白与末尾 /
+func normalizeServer(s string) string {
+	return strings.TrimRight(strings.TrimSpace(s), "/")
+}
+
+// AllowsRecord 是否允许访问该录像编号（不考虑服务器）
+func (s *AccessScope) AllowsRecord(recordID string) bool {
+	if s == nil {
+		return true
+	}
+	for _, r := range s.rules {
+		if r.matchRecord(recordID) {
+			return true
+		}
+	}
+	return false
+}
+
+// Servers 从 all 中筛选可用于查询该录像的服务器（保持原顺序）
+func (s *AccessScope) Servers(recordID string, all []string) []string {
+	if s == nil {
+		return all
+	}
+	out := make([]string, 0, len(all))
+	for _, server := range all {
+		key := normalizeServer(server)
+		for _, r := range s.rules {
+			if r.matchRecord(recordID) && (r.servers == nil || r.servers[key]) {
+				out = append(out, server)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// AllowsURL 录像真实地址（如缓存命中的 URL）是否位于允许的服务器上
+func (s *AccessScope) AllowsURL(recordID, rawURL string) bool {
+	if s == nil {
+		return true
+	}
+	for _, r := range s.rules {
+		if !r.matchRecord(recordID) {
+			continue
+		}
+		if r.servers == nil {
+			return true
+		}
+		for server := range r.servers {
+			if strings.HasPrefix(rawURL, server+"/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AccessService DVR 分组与访问策略
+type AccessService interface {
+	// ScopeFor 用户（含所在用户组）的访问范围；userID 为 0 表示未登录访问。
+	// 登录用户没有适用的已启用策略时返回 nil（不受限）；匿名访问在存在任一已启用策略时默认拒绝，除非配置了匿名策略
+	ScopeFor(userID int64) (*AccessScope, error)
+
+	ListGroups() ([]repository.DVRGroup, error)
+	CreateGroup(name, description string, servers []string) (*repository.DVRGroup, error)
+	UpdateGroup(id int64, name, description string, servers []string) (*repository.DVRGroup, error)
+	DeleteGroup(id int64) (*repository.DVRGroup, error)
+
+	ListPolicies() ([]repository.AccessPolicy, error)
+	CreatePolicy(p *repository.AccessPolicy) (*repository.AccessPolicy, error)
+	UpdatePolicy(p *repository.AccessPolicy) (*repository.AccessPolicy, error)
+	DeletePolicy(id int64) (*repository.AccessPolicy, error)
+}
+
+type accessService struct {
+	repo      repository.AccessRepository
+	userRepo  repository.UserRepository
+	groupRepo repository.GroupRepository
+}
+
+// NewAccessService 创建访问策略服务
+func NewAccessService(repo repository.AccessRepository, userRepo repository.UserRepository, groupRepo repository.GroupRepository) AccessService {
+	return &accessService{repo: repo, userRepo: userRepo, groupRepo: groupRepo}
+}
+
+// subjectsFor 用户适用的策略主体：用户本身及其所在的用户组
+func (s *accessService) subjectsFor(userID int64) ([]repository.AccessSubject, error) {
+	if userID == 0 {
+		return []repository.AccessSubject{{Type: repository.AccessSubjectAnonymous}}, nil
+	}
+	u, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	subjects := []repository.AccessSubject{{Type: repository.AccessSubjectUser, ID: userID}}
+	for _, g := range u.Groups {
+		subjects = append(subjects, repository.AccessSubject{Type: repository.AccessSubjectGroup, ID: g.ID})
+	}
+	return subjects, nil
+}
+
+// ScopeFor 编译用户（含所在用户组）适用的已启用策略
+func (s *accessService) ScopeFor(userID int64) (*AccessScope, error) {
+	subjects, err := s.subjectsFor(userID)
+	if err != nil {
+		return nil, err
+	}
+	policies, err := s.repo.EnabledPoliciesFor(subjects)
+	if err != nil {
+		return nil, err
+	}
+	if len(policies) == 0 {
+		if userID != 0 {
+			return nil, nil
+		}
+		return s.anonymousDefault()
+	}
+	groups, err := s.repo.ListGroups()
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int64]repository.DVRGroup, len(groups))
+	for _, g := range groups {
+		byID[g.ID] = g
+	}
+
+	scope := &AccessScope{}
+	for _, p := range policies {
+		rule := accessRule{patterns: p.RecordPatterns}
+		if len(p.DVRGroupIDs) > 0 {
+			rule.servers = map[string]bool{}
+			for _, id := range p.DVRGroupIDs {
+				for _, server := range byID[id].Servers {
+					rule.servers[normalizeServer(server)] = true
+				}
+			}
+		}
+		scope.rules = append(scope.rules, rule)
+	}
+	return scope, nil
+}
+
+// anonymousDefault 没有匿名策略时的匿名访问范围：已启用任一策略即拒绝全部录像，
+// 否则受限用户不带令牌访问即可绕过自己的策略
+func (s *accessService) anonymousDefault() (*AccessScope, error) {
+	all, err := s.repo.ListPolicies()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range all {
+		if p.Enabled {
+			return &AccessScope{}, nil
+		}
+	}
+	return nil, nil
+}
+
+// ListGroups 全部 DVR 分组
+func (s *accessService) ListGroups() ([]repository.DVRGroup, error) {
+	return s.repo.ListGroups()
+}
+
+// normalizeGroupServers 去重并校验 DVR 地址
+func normalizeGroupServers(servers []string) ([]string, error) {
+	seen := map[string]bool{}
+	out := make([]string, 0, len(servers))
+	for _, raw := range servers {
+		server := normalizeServer(raw)
+		if server == "" || seen[server] {
+			continue
+		}
+		u, err := url.Parse(server)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("无效的 DVR 地址: %s", raw)
+		}
+		seen[server] = true
+		out = append(out, server)
+	}
+	if len(out) == 0 {
+		return nil, errors.New("DVR 分组至少包含一个服务器")
+	}
+	return out, nil
+}
+
+// CreateGroup 新增 DVR 分组
+func (s *accessService) CreateGroup(name, description string, servers []string) (*repository.DVRGroup, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("分组名称不能为空")
+	}
+	list, err := normalizeGroupServers(servers)
+	if err != nil {
+		return nil, err
+	}
+	g := &repository.DVRGroup{Name: name, Description: strings.TrimSpace(description), Servers: list}
+	if err := s.repo.CreateGroup(g); err != nil {
+		return nil, err
+	}
+	return s.repo.GetGroup(g.ID)
+}
+
+// UpdateGroup 修改 DVR 分组（引用该分组的策略随之生效）
+func (s *accessService) UpdateGroup(id int64, name, description string, servers []string) (*repository.DVRGroup, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("分组名称不能为空")
+	}
+	list, err := normalizeGroupServers(servers)
+	if err != nil {
+		return nil, err
+	}
+	g := &repository.DVRGroup{ID: id, Name: name, Description: strings.TrimSpace(description), Servers: list}
+	if err := s.repo.UpdateGroup(g); err != nil {
+		return nil, err
+	}
+	return s.repo.GetGroup(id)
+}
+
+// DeleteGroup 删除 DVR 分组；仍被策略引用时拒绝（否则引用方的访问范围会意外变化）
+func (s *accessService) DeleteGroup(id int64) (*repository.DVRGroup, error) {
+	g, err := s.repo.GetGroup(id)
+	if err != nil {
+		return nil, err
+	}
+	policies, err := s.repo.ListPolicies()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range policies {
+		for _, gid := range p.DVRGroupIDs {
+			if gid == id {
+				return nil, fmt.Errorf("分组仍被访问策略「%s」使用", p.Name)
+			}
+		}
+	}
+	if err := s.repo.DeleteGroup(id); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// ListPolicies 全部访问策略
+func (s *accessService) ListPolicies() ([]repository.AccessPolicy, error) {
+	return s.repo.ListPolicies()
+}
+
+// validatePolicy 校验并规范化策略字段
+func (s *accessService) validatePolicy(p *repository.AccessPolicy) error {
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" {
+		return errors.New("策略名称不能为空")
+	}
+	switch p.SubjectType {
+	case repository.AccessSubjectAnonymous:
+		p.SubjectID = 0
+	case repository.AccessSubjectUser:
+		if _, err := s.userRepo.GetByID(p.SubjectID); err != nil {
+			return err
+		}
+	case repository.AccessSubjectGroup:
+		if _, err := s.groupRepo.Get(p.SubjectID); err != nil {
+			return err
+		}
+	default:
+		return errors.New("subject_type 须为 user、group 或 anonymous")
+	}
+
+	groupIDs := make([]int64, 0, len(p.DVRGroupIDs))
+	seen := map[int64]bool{}
+	for _, id := range p.DVRGroupIDs {
+		if seen[id] {
+			continue
+		}
+		if _, err := s.repo.GetGroup(id); err != nil {
+			return err
+		}
+		seen[id] = true
+		groupIDs = append(groupIDs, id)
+	}
+	p.DVRGroupIDs = groupIDs
+
+	patterns := make([]string, 0, len(p.RecordPatterns))
+	for _, raw := range p.RecordPatterns {
+		pattern := strings.TrimSpace(raw)
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("无效的录像编号模式: %s", raw)
+		}
+		patterns = append(patterns, pattern)
+	}
+	p.RecordPatterns = patterns
+	return nil
+}
+
+// CreatePolicy 新增访问策略
+func (s *accessService) CreatePolicy(p *repository.AccessPolicy) (*repository.AccessPolicy, error) {
+	if err := s.validatePolicy(p); err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreatePolicy(p); err != nil {
+		return nil, err
+	}
+	return s.repo.GetPolicy(p.ID)
+}
+
+// UpdatePolicy 修改访问策略
+func (s *accessService) UpdatePolicy(p *repository.AccessPolicy) (*repository.AccessPolicy, error) {
+	if _, err := s.repo.GetPolicy(p.ID); err != nil {
+		return nil, err
+	}
+	if err := s.validatePolicy(p); err != nil {
+		return nil, err
+	}
+	if err := s.repo.UpdatePolicy(p); err != nil {
+		return nil, err
+	}
+	return s.repo.GetPolicy(p.ID)
+}
+
+// DeletePolicy 删除访问策略
+func (s *accessService) DeletePolicy(id int64) (*repository.AccessPolicy, error) {
+	p, err := s.repo.GetPolicy(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.DeletePolicy(id); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
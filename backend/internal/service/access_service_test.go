@@ -0,0 +1,79 @@
+package service
+
+import (
+	"testing"
+
+	"dvr-manager/internal/repository"
+	"dvr-manager/pkg/db"
+)
+
+func TestAccessService_scopeFor(t *testing.T) {
+	if err := db.InitDB(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	users := repository.NewUserRepository()
+	contractor, err := users.Create("contractor", "x", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := NewAccessService(repository.NewAccessRepository(), users, repository.NewGroupRepository())
+
+	// 无策略：不受限
+	if scope, err := svc.ScopeFor(contractor.ID); err != nil || scope != nil {
+		t.Fatalf("expected unrestricted scope, got %+v err=%v", scope, err)
+	}
+
+	siteA, err := svc.CreateGroup("site-a", "", []string{"http://dvr-a:8080/record/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.CreatePolicy(&repository.AccessPolicy{
+		Name: "site A only", SubjectType: repository.AccessSubjectUser, SubjectID: contractor.ID,
+		DVRGroupIDs: []int64{siteA.ID}, RecordPatterns: []string{"A-*"}, Enabled: true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.CreatePolicy(&repository.AccessPolicy{
+		Name: "bad", SubjectType: repository.AccessSubjectUser, SubjectID: contractor.ID, RecordPatterns: []string{"["},
+	}); err == nil {
+		t.Fatal("expected malformed pattern to be rejected")
+	}
+
+	scope, err := svc.ScopeFor(contractor.ID)
+	if err != nil || scope == nil {
+		t.Fatalf("scope=%v err=%v", scope, err)
+	}
+	all := []string{"http://dvr-a:8080/record", "http://dvr-b:8080/record"}
+	if got := scope.Servers("A-001", all); len(got) != 1 || got[0] != all[0] {
+		t.Fatalf("servers for A-001 = %v", got)
+	}
+	if got := scope.Servers("B-001", all); len(got) != 0 || scope.AllowsRecord("B-001") {
+		t.Fatalf("B-001 must be denied, servers=%v", got)
+	}
+	if !scope.AllowsURL("A-001", "http://dvr-a:8080/record/A-001.mp4") ||
+		scope.AllowsURL("A-001", "http://dvr-b:8080/record/A-001.mp4") ||
+		scope.AllowsURL("A-001", "http://dvr-a:8080/recordings/A-001.mp4") {
+		t.Fatal("unexpected AllowsURL result")
+	}
+
+	// 已配置策略而没有匿名策略时，匿名访问拒绝全部录像（受限用户不能通过不带令牌绕过策略）
+	if scope, err := svc.ScopeFor(0); err != nil || scope == nil || scope.AllowsRecord("B-001") || len(scope.Servers("B-001", all)) != 0 {
+		t.Fatalf("anonymous scope must deny all records, got %+v err=%v", scope, err)
+	}
+	// 明确的匿名策略放开对应范围
+	if _, err := svc.CreatePolicy(&repository.AccessPolicy{
+		Name: "public", SubjectType: repository.AccessSubjectAnonymous, RecordPatterns: []string{"P-*"}, Enabled: true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if scope, err := svc.ScopeFor(0); err != nil || scope == nil || !scope.AllowsRecord("P-001") || scope.AllowsRecord("B-001") {
+		t.Fatalf("anonymous scope = %+v err=%v", scope, err)
+	}
+
+	// 分组被引用时不可删除
+	if _, err := svc.DeleteGroup(siteA.ID); err == nil {
+		t.Fatal("expected referenced group delete to fail")
+	}
+}
@@ -0,0 +1,196 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"dvr-manager/internal/repository"
+)
+
+// 账号状态与登录限制导致的拒绝（密码或 IdP 身份已验证通过）
+var (
+	ErrAccountDisabled     = errors.New("账号已停用，请联系管理员")
+	ErrAccountExpired      = errors.New("账号已过期，请联系管理员")
+	ErrLoginHoursForbidden = errors.New("当前时段不允许登录")
+	ErrLoginIPForbidden    = errors.New("当前网络不允许登录")
+)
+
+// IsAccountRestricted 错误是否为账号停用 / 过期 / 登录时段 / 来源 IP 限制
+func IsAccountRestricted(err error) bool {
+	return errors.Is(err, ErrAccountDisabled) || errors.Is(err, ErrAccountExpired) ||
+		errors.Is(err, ErrLoginHoursForbidden) || errors.Is(err, ErrLoginIPForbidden)
+}
+
+// CheckUserAccess 校验账号未停用、未过期，且当前时间与来源 IP 满足该账号的登录限制
+func CheckUserAccess(u *User, clientIP string, now time.Time) error {
+	if u.Disabled {
+		return ErrAccountDisabled
+	}
+	if u.ExpiresAt != nil && !now.Before(*u.ExpiresAt) {
+		return ErrAccountExpired
+	}
+	if u.LoginHours != "" {
+		windows, err := parseLoginHours(u.LoginHours)
+		// 解析失败时按不满足处理（保存时已校验）
+		if err != nil || !inLoginHours(windows, now) {
+			return ErrLoginHoursForbidden
+		}
+	}
+	if len(u.AllowedCIDRs) > 0 && !ipAllowed(u.AllowedCIDRs, clientIP) {
+		return ErrLoginIPForbidden
+	}
+	return nil
+}
+
+// loginWindow 一天内允许的时段（分钟）；end 小于 start 表示跨零点
+type loginWindow struct {
+	start, end int
+}
+
+// parseLoginHours 解析 "08:00-18:00,22:00-06:00"
+func parseLoginHours(s string) ([]loginWindow, error) {
+	var windows []loginWindow
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		from, to, ok := strings.Cut(part, "-")
+		if !ok {
+			return nil, fmt.Errorf("登录时段格式错误: %s（应为 HH:MM-HH:MM）", part)
+		}
+		start, err := parseClock(from)
+		if err != nil {
+			return nil, fmt.Errorf("登录时段格式错误: %s（应为 HH:MM-HH:MM）", part)
+		}
+		end, err := parseClock(to)
+		if err != nil || end == start {
+			return nil, fmt.Errorf("登录时段格式错误: %s（应为 HH:MM-HH:MM）", part)
+		}
+		windows = append(windows, loginWindow{start: start, end: end})
+	}
+	return windows, nil
+}
+
+// parseClock HH:MM → 当天分钟数；24:00 表示一天结束
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		if strings.TrimSpace(s) == "24:00" {
+			return 24 * 60, nil
+		}
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func inLoginHours(windows []loginWindow, now time.Time) bool {
+	if len(windows) == 0 {
+		return true
+	}
+	m := now.Hour()*60 + now.Minute()
+	for _, w := range windows {
+		if w.start < w.end && m >= w.start && m < w.end {
+			return true
+		}
+		if w.start > w.end && (m >= w.start || m < w.end) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeCIDRs 校验网段；单个 IP 视为 /32（IPv6 为 /128），去重
+func normalizeCIDRs(list []string) ([]string, error) {
+	out := []string{}
+	seen := map[string]bool{}
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("无效的 IP 或网段: %s", s)
+			}
+			if ip.To4() != nil {
+				s = ip.String() + "/32"
+			} else {
+				s = ip.String() + "/128"
+			}
+		}
+		_, ipnet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("无效的 IP 或网段: %s", s)
+		}
+		if key := ipnet.String(); !seen[key] {
+			seen[key] = true
+			out = append(out, key)
+		}
+	}
+	return out, nil
+}
+
+func ipAllowed(cidrs []string, clientIP string) bool {
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return false
+	}
+	for _, c := range cidrs {
+		if _, ipnet, err := net.ParseCIDR(c); err == nil && ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeRestrictions 校验并规范化登录限制
+func normalizeRestrictions(r repository.UserRestrictions) (repository.UserRestrictions, error) {
+	windows, err := parseLoginHours(r.LoginHours)
+	if err != nil {
+		return r, err
+	}
+	parts := make([]string, 0, len(windows))
+	for _, w := range windows {
+		parts = append(parts, fmt.Sprintf("%02d:%02d-%02d:%02d", w.start/60, w.start%60, w.end/60, w.end%60))
+	}
+	r.LoginHours = strings.Join(parts, ",")
+	if r.ExpiresAt != nil {
+		// 统一为本地时区，与到期检查的比较口径一致
+		t := r.ExpiresAt.Local()
+		r.ExpiresAt = &t
+	}
+	if r.AllowedCIDRs, err = normalizeCIDRs(r.AllowedCIDRs); err != nil {
+		return r, err
+	}
+	return r, nil
+}
+
+// DisableExpiredUsers 停用已到期的账号并吊销其会话（sessions 可为 nil），返回被停用的账号
+func DisableExpiredUsers(repo repository.UserRepository, sessions SessionService, now time.Time) ([]User, error) {
+	expired, err := repo.ListExpired(now)
+	if err != nil {
+		return nil, err
+	}
+	var out []User
+	for i := range expired {
+		u := &expired[i]
+		if err := repo.SetDisabled(u.ID, true, repository.DisabledReasonExpired); err != nil {
+			return out, err
+		}
+		if sessions != nil {
+			if _, err := sessions.RevokeUser(u.ID, RevokeReasonUserDisabled); err != nil {
+				log.Printf("[AUTH] revoke sessions of expired user %s failed: %v", u.Username, err)
+			}
+		}
+		u.Disabled = true
+		u.DisabledReason = repository.DisabledReasonExpired
+		out = append(out, *toUser(u))
+	}
+	return out, nil
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"dvr-manager/internal/repository"
+	"dvr-manager/pkg/db"
+)
+
+func TestCheckUserAccess_restrictions(t *testing.T) {
+	at := func(hour, min int) time.Time { return time.Date(2026, 3, 2, hour, min, 0, 0, time.Local) }
+	u := &User{LoginHours: "22:00-06:00", AllowedCIDRs: []string{"10.0.0.0/8"}}
+
+	if err := CheckUserAccess(u, "10.1.2.3", at(23, 30)); err != nil {
+		t.Fatalf("overnight window: %v", err)
+	}
+	if err := CheckUserAccess(u, "10.1.2.3", at(12, 0)); !errors.Is(err, ErrLoginHoursForbidden) {
+		t.Fatalf("expected hours rejection, got %v", err)
+	}
+	if err := CheckUserAccess(u, "192.168.1.1", at(5, 59)); !errors.Is(err, ErrLoginIPForbidden) {
+		t.Fatalf("expected ip rejection, got %v", err)
+	}
+	expires := at(0, 0)
+	u.ExpiresAt = &expires
+	if err := CheckUserAccess(u, "10.1.2.3", at(1, 0)); !errors.Is(err, ErrAccountExpired) {
+		t.Fatalf("expected expiry rejection, got %v", err)
+	}
+
+	if _, err := parseLoginHours("08:00~18:00"); err == nil {
+		t.Fatal("expected malformed window to be rejected")
+	}
+	if got, err := normalizeCIDRs([]string{"10.0.0.5", " 10.0.0.5/32 ", "2001:db8::/32"}); err != nil || len(got) != 2 {
+		t.Fatalf("cidrs=%v err=%v", got, err)
+	}
+}
+
+func TestAuthService_disabledAndExpired(t *testing.T) {
+	if err := db.InitDB(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	repo := repository.NewUserRepository()
+	svc := NewAuthService(repo, repository.NewIdentityRepository(), nil, nil, nil, nil)
+	dave, err := svc.CreateUser("dave", "Orange-Kite-1", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := svc.SetUserDisabled(dave.ID, true, "离职"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Authenticate("dave", "Orange-Kite-1", "127.0.0.1"); !errors.Is(err, ErrAccountDisabled) {
+		t.Fatalf("expected disabled, got %v", err)
+	}
+	// 密码错误时不暴露账号状态
+	if _, err := svc.Authenticate("dave", "wrong", "127.0.0.1"); IsAccountRestricted(err) {
+		t.Fatalf("wrong password leaked account state: %v", err)
+	}
+	if err := svc.SetUserDisabled(dave.ID, false, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	past := time.Now().Add(-time.Minute)
+	if _, err := svc.UpdateUserRestrictions(dave.ID, repository.UserRestrictions{ExpiresAt: &past}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Authenticate("dave", "Orange-Kite-1", "127.0.0.1"); !errors.Is(err, ErrAccountExpired) {
+		t.Fatalf("expected expired, got %v", err)
+	}
+	disabled, err := DisableExpiredUsers(repo, nil, time.Now())
+	if err != nil || len(disabled) != 1 || disabled[0].Username != "dave" {
+		t.Fatalf("disabled=%v err=%v", disabled, err)
+	}
+	u, _ := svc.GetUserByID(dave.ID)
+	if !u.Disabled || u.DisabledReason != repository.DisabledReasonExpired {
+		t.Fatalf("user after expiry job = %+v", u)
+	}
+	// 已过期的账号须先调整有效期才能启用
+	if err := svc.SetUserDisabled(dave.ID, false, ""); err == nil {
+		t.Fatal("expected enabling an expired account to fail")
+	}
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"dvr-manager/internal/repository"
+)
+
+// API 令牌权限范围
+const (
+	ScopePlay       = "play"        // /api/play 录像查询
+	ScopeStream     = "stream"      // /stream 播放与下载
+	ScopeAdminRead  = "admin:read"  // 管理接口只读（GET），需令牌所属用户的角色拥有管理权限
+	ScopeAdminWrite = "admin:write" // 管理接口写操作，需令牌所属用户的角色拥有管理权限
+)
+
+// APITokenPrefix API 令牌明文前缀，用于与 JWT 区分及泄露扫描
+const APITokenPrefix = "dvr_pat_"
+
+// apiTokenTouchInterval 同一 IP 连续使用时最近使用时间的最小更新间隔
+const apiTokenTouchInterval = time.Minute
+
+var (
+	// ErrAPITokenInvalid API 令牌无效、过期或已吊销
+	ErrAPITokenInvalid = errors.New("API 令牌无效或已过期")
+	// ErrAPITokenScope 权限范围非法或超出用户角色
+	ErrAPITokenScope = errors.New("API 令牌权限范围无效")
+)
+
+// AllScopes 全部可选权限范围
+func AllScopes() []string {
+	return []string{ScopePlay, ScopeStream, ScopeAdminRead, ScopeAdminWrite}
+}
+
+// IsAPIToken 判断凭据是否为 API 令牌（而非 JWT）
+func IsAPIToken(raw string) bool {
+	return strings.HasPrefix(raw, APITokenPrefix)
+}
+
+// APITokenService 个人访问令牌 / 服务 API Key
+type APITokenService interface {
+	// Create 为用户创建令牌，返回记录与仅此一次可见的明文令牌；expiresAt 为 nil 表示永不过期
+	Create(user *User, name string, scopes []string, expiresAt *time.Time) (*repository.APIToken, string, error)
+	// List 列出令牌；userID 为 0 时列出全部
+	List(userID int64) ([]repository.APIToken, error)
+	Get(id int64) (*repository.APIToken, error)
+	Revoke(id int64) (bool, error)
+	// Authenticate 校验明文令牌并记录使用信息，返回令牌所属用户
+	Authenticate(raw, clientIP string) (*User, *repository.APIToken, error)
+}
+
+type apiTokenService struct {
+	repo     repository.APITokenRepository
+	userRepo repository.UserRepository
+	roles    RoleService
+}
+
+// NewAPITokenService 创建 API 令牌服务；roles 为 nil 时仅 admin 角色可授予管理范围
+func NewAPITokenService(repo repository.APITokenRepository, userRepo repository.UserRepository, roles RoleService) APITokenService {
+	return &apiTokenService{repo: repo, userRepo: userRepo, roles: roles}
+}
+
+// adminCapable 用户的有效角色（含用户组授予的角色）是否可授予管理范围（实际访问仍按接口权限校验）
+func (s *apiTokenService) adminCapable(user *User) bool {
+	for _, role := range user.Roles() {
+		if s.roles == nil && role == RoleAdmin {
+			return true
+		}
+		if s.roles != nil && s.roles.IsAdminCapable(role) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeScopes 去重、校验权限范围；管理范围仅拥有管理权限的角色可授予
+func normalizeScopes(scopes []string, adminCapable bool) ([]string, error) {
+	valid := map[string]bool{}
+	for _, s := range AllScopes() {
+		valid[s] = true
+	}
+	seen := map[string]bool{}
+	out := make([]string, 0, len(scopes))
+	for _, s := range scopes {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if s == "" || seen[s] {
+			continue
+		}
+		if !valid[s] {
+			return nil, ErrAPITokenScope
+		}
+		if strings.HasPrefix(s, "admin:") && !adminCapable {
+			return nil, ErrAPITokenScope
+		}
+		seen[s] = true
+		out = append(out, s)
+	}
+	if len(out) == 0 {
+		return nil, ErrAPITokenScope
+	}
+	return out, nil
+}
+
+// Create 创建令牌
+func (s *apiTokenService) Create(user *User, name string, scopes []string, expiresAt *time.Time) (*repository.APIToken, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", errors.New("令牌名称不能为空")
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, "", errors.New("过期时间必须晚于当前时间")
+	}
+	scopes, err := normalizeScopes(scopes, s.adminCapable(user))
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	raw := APITokenPrefix + secret
+	t := &repository.APIToken{
+		UserID:    user.ID,
+		Username:  user.Username,
+		Name:      name,
+		Prefix:    raw[:len(APITokenPrefix)+6],
+		TokenHash: hashToken(raw),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}
+	if err := s.repo.Create(t); err != nil {
+		return nil, "", err
+	}
+	return t, raw, nil
+}
+
+// List 列出令牌
+func (s *apiTokenService) List(userID int64) ([]repository.APIToken, error) {
+	return s.repo.List(userID)
+}
+
+// Get 查询令牌
+func (s *apiTokenService) Get(id int64) (*repository.APIToken, error) {
+	return s.repo.Get(id)
+}
+
+// Revoke 吊销令牌
+func (s *apiTokenService) Revoke(id int64) (bool, error) {
+	return s.repo.Revoke(id)
+}
+
+// Authenticate 校验令牌；角色始终取自数据库
+func (s *apiTokenService) Authenticate(raw, clientIP string) (*User, *repository.APIToken, error) {
+	if !IsAPIToken(raw) {
+		return nil, nil, ErrAPITokenInvalid
+	}
+	t, err := s.repo.GetByHash(hashToken(raw))
+	if err != nil {
+		if errors.Is(err, repository.ErrAPITokenNotFound) {
+			return nil, nil, ErrAPITokenInvalid
+		}
+		return nil, nil, err
+	}
+	now := time.Now()
+	if !t.Active(now) {
+		return nil, nil, ErrAPITokenInvalid
+	}
+	u, err := s.userRepo.GetByID(t.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, nil, ErrAPITokenInvalid
+		}
+		return nil, nil, err
+	}
+	if t.LastUsedAt == nil || t.LastUsedIP != clientIP || now.Sub(*t.LastUsedAt) >= apiTokenTouchInterval {
+		if err := s.repo.Touch(t.ID, clientIP, now); err != nil {
+			log.Printf("[AUTH] touch api token %d failed: %v", t.ID, err)
+		}
+	}
+	return toUser(u), t, nil
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"dvr-manager/internal/repository"
+	"dvr-manager/pkg/db"
+)
+
+func TestAPITokenService_scopesAndRevocation(t *testing.T) {
+	dir := t.TempDir()
+	if err := db.InitDB(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	userRepo := repository.NewUserRepository()
+	u, err := userRepo.Create("ticketing", "x", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := NewAPITokenService(repository.NewAPITokenRepository(), userRepo, nil)
+
+	// 普通用户不能申请管理范围
+	if _, _, err := svc.Create(toUser(u), "bad", []string{ScopeAdminRead}, nil); !errors.Is(err, ErrAPITokenScope) {
+		t.Fatalf("admin scope for user err=%v want ErrAPITokenScope", err)
+	}
+	expires := time.Now().Add(time.Hour)
+	tok, raw, err := svc.Create(toUser(u), "工单系统", []string{"play", "PLAY", "stream"}, &expires)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsAPIToken(raw) || len(tok.Scopes) != 2 {
+		t.Fatalf("token=%q scopes=%v", raw, tok.Scopes)
+	}
+
+	user, got, err := svc.Authenticate(raw, "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != "ticketing" || !got.HasScope(ScopePlay) || got.HasScope(ScopeAdminRead) {
+		t.Fatalf("authenticate user=%+v token=%+v", user, got)
+	}
+	stored, err := svc.Get(tok.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.LastUsedAt == nil || stored.LastUsedIP != "10.0.0.1" {
+		t.Fatalf("last used not recorded: %+v", stored)
+	}
+
+	if _, err := svc.Revoke(tok.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := svc.Authenticate(raw, "10.0.0.1"); !errors.Is(err, ErrAPITokenInvalid) {
+		t.Fatalf("revoked token err=%v want ErrAPITokenInvalid", err)
+	}
+}
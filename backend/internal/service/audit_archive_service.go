@@ -0,0 +1,355 @@
+package service
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"dvr-manager/internal/repository"
+)
+
+// AuditArchiveDirName 审计归档目录（位于 DATA_DIR 下）
+const AuditArchiveDirName = "audit-archive"
+
+const (
+	auditArchiveManifest = "manifest.json"
+	auditArchiveChunk    = 1000 // 每批归档并删除的记录数
+)
+
+var (
+	// ErrAuditArchiveNotFound 清单中没有该归档文件
+	ErrAuditArchiveNotFound = errors.New("归档文件不存在")
+	// ErrAuditArchiveCorrupt 归档文件的 SHA-256 与清单不一致
+	ErrAuditArchiveCorrupt = errors.New("归档文件校验失败，文件可能已被修改或损坏")
+)
+
+// AuditArchiveFile 清单中的一个月度归档文件
+type AuditArchiveFile struct {
+	Name      string    `json:"name"`  // audit-2026-07.jsonl.gz
+	Month     string    `json:"month"` // 记录所属月份（UTC）
+	Records   int64     `json:"records"`
+	FirstID   int64     `json:"first_id"`
+	LastID    int64     `json:"last_id"`
+	From      time.Time `json:"from"` // 最早一条记录的时间
+	To        time.Time `json:"to"`   // 最晚一条记录的时间
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type auditArchiveManifestFile struct {
+	Files []AuditArchiveFile `json:"files"`
+}
+
+// AuditArchiveService 保留期清理前将到期审计记录写入按月轮转的 gzip JSONL 归档（附 SHA-256 清单），并支持按需查询归档
+type AuditArchiveService interface {
+	// ArchiveExpired 归档并删除早于 cutoff 的记录，返回归档与删除条数
+	ArchiveExpired(cutoff time.Time) (archived, deleted int64, err error)
+	// List 清单中的全部归档文件（按月份升序）
+	List() ([]AuditArchiveFile, error)
+	// Query 校验并按条件查询一个归档文件（按 id 升序分页），筛选语义同审计列表
+	Query(name string, from, to *time.Time, action, username string, page, pageSize int) ([]repository.AuditEntry, int, error)
+}
+
+type auditArchiveService struct {
+	repo  repository.AuditRepository
+	chain AuditChainService
+	dir   string
+	mu    sync.Mutex // 串行化每日清理与手动清理
+}
+
+// NewAuditArchiveService 创建审计归档服务；dir 不存在时在首次归档时创建
+func NewAuditArchiveService(repo repository.AuditRepository, chain AuditChainService, dir string) AuditArchiveService {
+	return &auditArchiveService{repo: repo, chain: chain, dir: dir}
+}
+
+// ArchiveExpired 只清理按 id 连续的过期前缀，删除前先为前缀末尾写入保留期检查点，使剩余的哈希链仍可校验；
+// 之后按批执行：追加写入月度归档并落盘 → 原子更新清单 → 删除该批记录。
+// 中途中断时，未写入清单的归档尾部在下次追加前截断，已写入清单但未删除的记录按 LastID 跳过，不会重复归档。
+func (s *auditArchiveService) ArchiveExpired(cutoff time.Time) (int64, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var archived, deleted int64
+	m, err := s.loadManifest()
+	if err != nil {
+		return 0, 0, err
+	}
+	lastID, lastHash, err := s.repo.ExpiredPrefix(cutoff)
+	if err != nil || lastID == 0 {
+		return 0, 0, err
+	}
+	if err := s.chain.CheckpointPrefix(lastID, lastHash); err != nil {
+		return 0, 0, err
+	}
+	for {
+		rows, err := s.repo.ListThrough(lastID, auditArchiveChunk)
+		if err != nil {
+			return archived, deleted, err
+		}
+		if len(rows) == 0 {
+			return archived, deleted, nil
+		}
+		if err := os.MkdirAll(s.dir, 0750); err != nil {
+			return archived, deleted, fmt.Errorf("create audit archive dir: %w", err)
+		}
+
+		byMonth := map[string][]*repository.AuditEntry{}
+		for i := range rows {
+			month := rows[i].CreatedAt.UTC().Format("2006-01")
+			byMonth[month] = append(byMonth[month], &rows[i])
+		}
+		for month, list := range byMonth {
+			f := m.file(month)
+			n, err := s.appendMonth(f, list)
+			if err != nil {
+				return archived, deleted, err
+			}
+			archived += n
+		}
+		if err := s.saveManifest(m); err != nil {
+			return archived, deleted, err
+		}
+
+		n, err := s.repo.DeleteThrough(rows[len(rows)-1].ID)
+		if err != nil {
+			return archived, deleted, err
+		}
+		deleted += n
+		if len(rows) < auditArchiveChunk {
+			return archived, deleted, nil
+		}
+	}
+}
+
+// appendMonth 以新的 gzip 成员追加写入（多成员 gzip 可整体顺序解压），返回新写入条数
+func (s *auditArchiveService) appendMonth(f *AuditArchiveFile, rows []*repository.AuditEntry) (int64, error) {
+	var fresh []*repository.AuditEntry
+	for _, e := range rows {
+		if e.ID > f.LastID {
+			fresh = append(fresh, e)
+		}
+	}
+	if len(fresh) == 0 {
+		return 0, nil
+	}
+
+	file, err := os.OpenFile(filepath.Join(s.dir, f.Name), os.O_RDWR|os.O_CREATE, 0640)
+	if err != nil {
+		return 0, fmt.Errorf("open audit archive: %w", err)
+	}
+	defer file.Close()
+	// 丢弃上次写入后未记入清单的尾部
+	if err := file.Truncate(f.Size); err != nil {
+		return 0, fmt.Errorf("truncate audit archive: %w", err)
+	}
+	if _, err := file.Seek(f.Size, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	bw := bufio.NewWriter(file)
+	zw := gzip.NewWriter(bw)
+	enc := json.NewEncoder(zw)
+	enc.SetEscapeHTML(false)
+	for _, e := range fresh {
+		if err := enc.Encode(e); err != nil {
+			return 0, fmt.Errorf("write audit archive: %w", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return 0, fmt.Errorf("write audit archive: %w", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return 0, fmt.Errorf("write audit archive: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return 0, fmt.Errorf("sync audit archive: %w", err)
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	h := sha256.New()
+	size, err := io.Copy(h, file)
+	if err != nil {
+		return 0, fmt.Errorf("hash audit archive: %w", err)
+	}
+
+	if f.Records == 0 {
+		f.FirstID = fresh[0].ID
+		f.From = fresh[0].CreatedAt
+	}
+	for _, e := range fresh {
+		if e.CreatedAt.Before(f.From) {
+			f.From = e.CreatedAt
+		}
+		if e.CreatedAt.After(f.To) {
+			f.To = e.CreatedAt
+		}
+	}
+	f.Records += int64(len(fresh))
+	f.LastID = fresh[len(fresh)-1].ID
+	f.Size = size
+	f.SHA256 = hex.EncodeToString(h.Sum(nil))
+	f.UpdatedAt = time.Now().UTC()
+	return int64(len(fresh)), nil
+}
+
+// List 清单中的归档文件
+func (s *auditArchiveService) List() ([]AuditArchiveFile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, err := s.loadManifest()
+	if err != nil {
+		return nil, err
+	}
+	return m.Files, nil
+}
+
+// Query 解压时同时计算 SHA-256，读完后与清单比对；不一致时返回 ErrAuditArchiveCorrupt
+func (s *auditArchiveService) Query(name string, from, to *time.Time, action, username string, page, pageSize int) ([]repository.AuditEntry, int, error) {
+	if pageSize <= 0 {
+		pageSize = 20
+	}
+	if page < 1 {
+		page = 1
+	}
+	offset := (page - 1) * pageSize
+
+	f, err := s.lookup(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	file, err := os.Open(filepath.Join(s.dir, f.Name))
+	if err != nil {
+		return nil, 0, fmt.Errorf("open audit archive: %w", err)
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	tee := io.TeeReader(io.LimitReader(file, f.Size), h)
+	zr, err := gzip.NewReader(bufio.NewReader(tee))
+	if err != nil {
+		return nil, 0, ErrAuditArchiveCorrupt
+	}
+	list := []repository.AuditEntry{}
+	total := 0
+	dec := json.NewDecoder(zr)
+	for {
+		var e repository.AuditEntry
+		if err := dec.Decode(&e); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, 0, ErrAuditArchiveCorrupt
+		}
+		if !archiveEntryMatches(&e, from, to, action, username) {
+			continue
+		}
+		if total >= offset && len(list) < pageSize {
+			list = append(list, e)
+		}
+		total++
+	}
+	if _, err := io.Copy(io.Discard, tee); err != nil {
+		return nil, 0, err
+	}
+	if hex.EncodeToString(h.Sum(nil)) != f.SHA256 {
+		return nil, 0, ErrAuditArchiveCorrupt
+	}
+	return list, total, nil
+}
+
+func archiveEntryMatches(e *repository.AuditEntry, from, to *time.Time, action, username string) bool {
+	if from != nil && e.CreatedAt.Before(*from) {
+		return false
+	}
+	if to != nil && e.CreatedAt.After(*to) {
+		return false
+	}
+	if action != "" && e.Action != action {
+		return false
+	}
+	return username == "" || e.Username == username || e.Impersonator == username
+}
+
+// lookup 只允许访问清单中登记的文件名
+func (s *auditArchiveService) lookup(name string) (AuditArchiveFile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, err := s.loadManifest()
+	if err != nil {
+		return AuditArchiveFile{}, err
+	}
+	for _, f := range m.Files {
+		if f.Name == name {
+			return f, nil
+		}
+	}
+	return AuditArchiveFile{}, ErrAuditArchiveNotFound
+}
+
+func (s *auditArchiveService) loadManifest() (*auditArchiveManifestFile, error) {
+	m := &auditArchiveManifestFile{Files: []AuditArchiveFile{}}
+	data, err := os.ReadFile(filepath.Join(s.dir, auditArchiveManifest))
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read audit archive manifest: %w", err)
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("parse audit archive manifest: %w", err)
+	}
+	return m, nil
+}
+
+// saveManifest 先写临时文件再重命名，保证清单完整
+func (s *auditArchiveService) saveManifest(m *auditArchiveManifestFile) error {
+	sort.Slice(m.Files, func(i, j int) bool { return m.Files[i].Month < m.Files[j].Month })
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(s.dir, auditArchiveManifest)
+	tmp, err := os.CreateTemp(s.dir, auditArchiveManifest+".*")
+	if err != nil {
+		return fmt.Errorf("write audit archive manifest: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write audit archive manifest: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write audit archive manifest: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write audit archive manifest: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("write audit archive manifest: %w", err)
+	}
+	return nil
+}
+
+// file 返回月份对应的清单项，不存在时新建
+func (m *auditArchiveManifestFile) file(month string) *AuditArchiveFile {
+	for i := range m.Files {
+		if m.Files[i].Month == month {
+			return &m.Files[i]
+		}
+	}
+	m.Files = append(m.Files, AuditArchiveFile{Name: "audit-" + month + ".jsonl.gz", Month: month})
+	return &m.Files[len(m.Files)-1]
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"dvr-manager/internal/audit"
+	"dvr-manager/internal/repository"
+	"dvr-manager/pkg/db"
+)
+
+func TestAuditArchive_archivesBeforeDeleteAndQueries(t *testing.T) {
+	if err := db.InitDB(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	repo := repository.NewAuditRepository()
+	old := time.Date(2025, 1, 20, 8, 0, 0, 0, time.UTC)
+	var events []*audit.Event
+	for i := 0; i < auditArchiveChunk+10; i++ {
+		user := "alice"
+		if i%3 == 0 {
+			user = "bob"
+		}
+		at := old
+		if i%2 == 0 {
+			at = old.AddDate(0, 1, 0) // 2025-02
+		}
+		events = append(events, &audit.Event{Time: at, Action: "play", Username: user, Status: audit.StatusSuccess, Reason: audit.ReasonRecordFound})
+	}
+	events = append(events, &audit.Event{Action: "play", Username: "carol", Status: audit.StatusSuccess, Reason: audit.ReasonRecordFound})
+	if err := repo.InsertBatch(events); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(t.TempDir(), AuditArchiveDirName)
+	chain := newTestAuditChain(t, repo)
+	svc := NewAuditArchiveService(repo, chain, dir)
+	cutoff := time.Now().AddDate(0, -3, 0)
+	archived, deleted, err := svc.ArchiveExpired(cutoff)
+	if err != nil || archived != int64(len(events)-1) || deleted != archived {
+		t.Fatalf("archived=%d deleted=%d err=%v", archived, deleted, err)
+	}
+	if rest, err := repo.ListThrough(1<<62, 10); err != nil || len(rest) != 1 || rest[0].Username != "carol" {
+		t.Fatalf("remaining=%+v err=%v", rest, err)
+	}
+	if report, err := chain.Verify(); err != nil || !report.OK || report.Rows != 1 {
+		t.Fatalf("report=%+v err=%v", report, err)
+	}
+
+	files, err := svc.List()
+	if err != nil || len(files) != 2 || files[0].Month != "2025-01" || files[1].Month != "2025-02" {
+		t.Fatalf("files=%+v err=%v", files, err)
+	}
+	if files[0].Records+files[1].Records != archived || files[0].SHA256 == "" {
+		t.Fatalf("files=%+v", files)
+	}
+
+	list, total, err := svc.Query(files[1].Name, nil, nil, "play", "bob", 1, 5)
+	if err != nil || total == 0 || len(list) != 5 || list[0].Username != "bob" || list[0].Detail == "" {
+		t.Fatalf("total=%d list=%+v err=%v", total, list, err)
+	}
+	if _, _, err := svc.Query("../manifest.json", nil, nil, "", "", 1, 5); !errors.Is(err, ErrAuditArchiveNotFound) {
+		t.Fatalf("err=%v", err)
+	}
+
+	// 写入归档后、更新清单前中断留下的尾部在下次追加前被截断
+	path := filepath.Join(dir, files[0].Name)
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("partial")
+	f.Close()
+	if _, err := db.GetDB().Exec("DELETE FROM audit_log"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Insert(&audit.Event{Time: old, Action: "logout", Username: "alice", Status: audit.StatusSuccess, Reason: audit.ReasonOK}); err != nil {
+		t.Fatal(err)
+	}
+	if archived, _, err := svc.ArchiveExpired(cutoff); err != nil || archived != 1 {
+		t.Fatalf("archived=%d err=%v", archived, err)
+	}
+	if _, total, err := svc.Query(files[0].Name, nil, nil, "logout", "", 1, 5); err != nil || total != 1 {
+		t.Fatalf("total=%d err=%v", total, err)
+	}
+
+	// 篡改后查询报告校验失败
+	data, _ := os.ReadFile(path)
+	data[len(data)-1] ^= 0xff
+	if err := os.WriteFile(path, data, 0640); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := svc.Query(files[0].Name, nil, nil, "", "", 1, 5); !errors.Is(err, ErrAuditArchiveCorrupt) {
+		t.Fatalf("err=%v", err)
+	}
+}
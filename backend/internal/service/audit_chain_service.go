@@ -0,0 +1,185 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"dvr-manager/internal/audit"
+	"dvr-manager/internal/repository"
+)
+
+// auditChainBatch 校验时每次读取的记录数
+const auditChainBatch = 1000
+
+// AuditChainBreak 校验发现的第一个断点
+type AuditChainBreak struct {
+	ID         int64  `json:"id"`                   // 断点所在（或缺失）的审计记录 id
+	Checkpoint int64  `json:"checkpoint,omitempty"` // 相关检查点 id
+	Reason     string `json:"reason"`               // 见 audit.Break*
+	Message    string `json:"message"`
+}
+
+// AuditChainReport 哈希链校验结果
+type AuditChainReport struct {
+	OK               bool             `json:"ok"`
+	Rows             int64            `json:"rows"`
+	FirstID          int64            `json:"first_id"`
+	LastID           int64            `json:"last_id"`
+	Checkpoints      int              `json:"checkpoints"`
+	TruncatedThrough int64            `json:"truncated_through"` // 经保留期检查点确认删除的前缀（id 不大于该值）
+	KeyID            string           `json:"key_id"`
+	PublicKey        string           `json:"public_key"`
+	VerifiedAt       time.Time        `json:"verified_at"`
+	Broken           *AuditChainBreak `json:"broken,omitempty"`
+}
+
+// AuditChainService 审计哈希链：签名检查点与完整性校验
+type AuditChainService interface {
+	// Checkpoint 对当前链头签名；自上个检查点以来没有新记录时返回 nil
+	Checkpoint() (*repository.AuditCheckpoint, error)
+	// CheckpointPrefix 保留期清理删除 id 不大于 lastID 的前缀之前调用，对该前缀末尾签名
+	CheckpointPrefix(lastID int64, lastHash string) error
+	// Verify 从头遍历哈希链与检查点，报告第一个断点
+	Verify() (*AuditChainReport, error)
+}
+
+type auditChainService struct {
+	repo        repository.AuditRepository
+	checkpoints repository.AuditCheckpointRepository
+	signer      *audit.Signer
+}
+
+// NewAuditChainService 创建审计哈希链服务
+func NewAuditChainService(repo repository.AuditRepository, checkpoints repository.AuditCheckpointRepository, signer *audit.Signer) AuditChainService {
+	return &auditChainService{repo: repo, checkpoints: checkpoints, signer: signer}
+}
+
+// Checkpoint 对链头签名
+func (s *auditChainService) Checkpoint() (*repository.AuditCheckpoint, error) {
+	id, hash, err := s.repo.ChainHead()
+	if err != nil || id == 0 {
+		return nil, err
+	}
+	latest, err := s.checkpoints.Latest()
+	if err != nil {
+		return nil, err
+	}
+	if latest != nil && latest.LastID == id && latest.LastHash == hash {
+		return nil, nil
+	}
+	return s.sign(audit.CheckpointPeriodic, id, hash)
+}
+
+// CheckpointPrefix 对将被删除的前缀签名
+func (s *auditChainService) CheckpointPrefix(lastID int64, lastHash string) error {
+	_, err := s.sign(audit.CheckpointRetention, lastID, lastHash)
+	return err
+}
+
+func (s *auditChainService) sign(kind string, lastID int64, lastHash string) (*repository.AuditCheckpoint, error) {
+	cp := &repository.AuditCheckpoint{
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		Kind:      kind,
+		LastID:    lastID,
+		LastHash:  lastHash,
+		KeyID:     s.signer.KeyID(),
+	}
+	cp.Signature = s.signer.Sign(audit.CheckpointPayload(cp.Kind, cp.CreatedAt, cp.LastID, cp.LastHash, cp.KeyID))
+	if err := s.checkpoints.Create(cp); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// Verify 依次检查：检查点签名 → 第一条记录的前驱（链首或经保留期检查点确认删除的前缀）→
+// 每条记录的 prev_hash 与前一条 hash 相连、hash 与内容一致 → 检查点处的 hash 与签名时一致 → 检查点指向的记录仍存在
+func (s *auditChainService) Verify() (*AuditChainReport, error) {
+	report := &AuditChainReport{KeyID: s.signer.KeyID(), PublicKey: s.signer.PublicKey(), VerifiedAt: time.Now().UTC()}
+	cps, err := s.checkpoints.List()
+	if err != nil {
+		return nil, err
+	}
+	report.Checkpoints = len(cps)
+
+	byLastID := map[int64][]repository.AuditCheckpoint{}
+	prefixHashes := map[string]bool{}
+	for _, cp := range cps {
+		if !s.signer.Verify(cp.KeyID, audit.CheckpointPayload(cp.Kind, cp.CreatedAt, cp.LastID, cp.LastHash, cp.KeyID), cp.Signature) {
+			return report.fail(cp.LastID, cp.ID, audit.BreakCheckpointSignature,
+				fmt.Sprintf("检查点 #%d 签名无效或签名密钥 %s 不受信任", cp.ID, cp.KeyID)), nil
+		}
+		if cp.Kind == audit.CheckpointRetention {
+			prefixHashes[cp.LastHash] = true
+			if cp.LastID > report.TruncatedThrough {
+				report.TruncatedThrough = cp.LastID
+			}
+		}
+		byLastID[cp.LastID] = append(byLastID[cp.LastID], cp)
+	}
+
+	var prev *audit.ChainRecord
+	var afterID int64
+	for {
+		rows, err := s.repo.ChainRows(afterID, auditChainBatch)
+		if err != nil {
+			return nil, err
+		}
+		for i := range rows {
+			r := &rows[i]
+			if r.Hash == "" {
+				return report.fail(r.ID, 0, audit.BreakMissingHash, fmt.Sprintf("记录 #%d 没有哈希", r.ID)), nil
+			}
+			if prev == nil {
+				// 清理中断时剩余记录可能仍在已签名的前缀内，此时前驱已被合法删除
+				if r.PrevHash != "" && !prefixHashes[r.PrevHash] && r.ID > report.TruncatedThrough {
+					return report.fail(r.ID, 0, audit.BreakPrefixDeleted,
+						fmt.Sprintf("记录 #%d 之前的记录已被删除，且没有对应的保留期检查点", r.ID)), nil
+				}
+				report.FirstID = r.ID
+			} else if r.PrevHash != prev.Hash {
+				return report.fail(r.ID, 0, audit.BreakPrevMismatch,
+					fmt.Sprintf("记录 #%d 与前一条记录 #%d 不相连（其间记录被删除或插入）", r.ID, prev.ID)), nil
+			}
+			if audit.ChainHash(r.PrevHash, r) != r.Hash {
+				return report.fail(r.ID, 0, audit.BreakHashMismatch, fmt.Sprintf("记录 #%d 的内容与哈希不一致", r.ID)), nil
+			}
+			for _, cp := range byLastID[r.ID] {
+				if cp.LastHash != r.Hash {
+					return report.fail(r.ID, cp.ID, audit.BreakCheckpointMismatch,
+						fmt.Sprintf("记录 #%d 的哈希与检查点 #%d 签名时不一致（哈希链被重算）", r.ID, cp.ID)), nil
+				}
+			}
+			delete(byLastID, r.ID)
+			prev = r
+			report.Rows++
+			report.LastID = r.ID
+		}
+		if len(rows) < auditChainBatch {
+			break
+		}
+		afterID = rows[len(rows)-1].ID
+	}
+
+	// 剩余的检查点指向已不存在的记录：在已签名的前缀内属于正常清理，否则记录被删除
+	var missing *repository.AuditCheckpoint
+	for id, list := range byLastID {
+		if id <= report.TruncatedThrough {
+			continue
+		}
+		if missing == nil || id < missing.LastID {
+			cp := list[0]
+			missing = &cp
+		}
+	}
+	if missing != nil {
+		return report.fail(missing.LastID, missing.ID, audit.BreakRowDeleted,
+			fmt.Sprintf("检查点 #%d 指向的记录 #%d 已不存在", missing.ID, missing.LastID)), nil
+	}
+	report.OK = true
+	return report, nil
+}
+
+func (r *AuditChainReport) fail(id, checkpoint int64, reason, message string) *AuditChainReport {
+	r.Broken = &AuditChainBreak{ID: id, Checkpoint: checkpoint, Reason: reason, Message: message}
+	return r
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"testing"
+
+	"dvr-manager/internal/audit"
+	"dvr-manager/internal/repository"
+	"dvr-manager/pkg/db"
+)
+
+func newTestAuditChain(t *testing.T, repo repository.AuditRepository) AuditChainService {
+	t.Helper()
+	t.Setenv("AUDIT_SIGNING_KEY", "")
+	signer, err := audit.LoadSigner(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewAuditChainService(repo, repository.NewAuditCheckpointRepository(), signer)
+}
+
+func TestAuditChain_reportsFirstBrokenLink(t *testing.T) {
+	if err := db.InitDB(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	repo := repository.NewAuditRepository()
+	chain := newTestAuditChain(t, repo)
+	insert := func(n int) {
+		var events []*audit.Event
+		for i := 0; i < n; i++ {
+			events = append(events, &audit.Event{Action: "play", Username: "alice", Status: audit.StatusSuccess, Reason: audit.ReasonRecordFound})
+		}
+		if err := repo.InsertBatch(events); err != nil {
+			t.Fatal(err)
+		}
+	}
+	verify := func() *AuditChainReport {
+		t.Helper()
+		report, err := chain.Verify()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return report
+	}
+
+	insert(5)
+	if err := repo.Insert(&audit.Event{Action: "logout", Username: "bob", Status: audit.StatusSuccess, Reason: audit.ReasonOK}); err != nil {
+		t.Fatal(err)
+	}
+	if r := verify(); !r.OK || r.Rows != 6 {
+		t.Fatalf("report=%+v", r)
+	}
+	cp, err := chain.Checkpoint()
+	if err != nil || cp == nil || cp.LastID != 6 {
+		t.Fatalf("cp=%+v err=%v", cp, err)
+	}
+	if again, err := chain.Checkpoint(); err != nil || again != nil {
+		t.Fatalf("unchanged head should not checkpoint: %+v %v", again, err)
+	}
+	insert(4)
+
+	conn := db.GetDB()
+	// 修改内容
+	if _, err := conn.Exec("UPDATE audit_log SET username = 'mallory' WHERE id = 3"); err != nil {
+		t.Fatal(err)
+	}
+	if r := verify(); r.OK || r.Broken.ID != 3 || r.Broken.Reason != audit.BreakHashMismatch {
+		t.Fatalf("report=%+v broken=%+v", r, r.Broken)
+	}
+	if _, err := conn.Exec("UPDATE audit_log SET username = 'alice' WHERE id = 3"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 修改内容并重算之后的整条链：由已签名的检查点发现
+	rows, err := repo.ChainRows(0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := ""
+	for i := range rows {
+		if rows[i].ID == 2 {
+			rows[i].Username = "mallory"
+		}
+		hash := audit.ChainHash(prev, &rows[i])
+		if _, err := conn.Exec("UPDATE audit_log SET username = ?, prev_hash = ?, hash = ? WHERE id = ?", rows[i].Username, prev, hash, rows[i].ID); err != nil {
+			t.Fatal(err)
+		}
+		prev = hash
+	}
+	if r := verify(); r.OK || r.Broken.ID != 6 || r.Broken.Reason != audit.BreakCheckpointMismatch {
+		t.Fatalf("report=%+v broken=%+v", r, r.Broken)
+	}
+
+	// 删除中间记录
+	if _, err := conn.Exec("DELETE FROM audit_checkpoints"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Exec("DELETE FROM audit_log WHERE id = 8"); err != nil {
+		t.Fatal(err)
+	}
+	if r := verify(); r.OK || r.Broken.ID != 9 || r.Broken.Reason != audit.BreakPrevMismatch {
+		t.Fatalf("report=%+v broken=%+v", r, r.Broken)
+	}
+
+	// 删除开头而没有保留期检查点
+	if _, err := conn.Exec("DELETE FROM audit_log WHERE id <= 8"); err != nil {
+		t.Fatal(err)
+	}
+	if r := verify(); r.OK || r.Broken.ID != 9 || r.Broken.Reason != audit.BreakPrefixDeleted {
+		t.Fatalf("report=%+v broken=%+v", r, r.Broken)
+	}
+
+	// 伪造的检查点签名
+	if err := repository.NewAuditCheckpointRepository().Create(&repository.AuditCheckpoint{
+		CreatedAt: "2026-01-01T00:00:00Z", Kind: audit.CheckpointRetention, LastID: 8, LastHash: rows[7].Hash, KeyID: "forged", Signature: "AAAA",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if r := verify(); r.OK || r.Broken.Reason != audit.BreakCheckpointSignature {
+		t.Fatalf("report=%+v broken=%+v", r, r.Broken)
+	}
+}
@@ -2,10 +2,15 @@ package service
 
 import (
 	"errors"
+	"fmt"
 	"log"
 	"os"
 	"strings"
+	"sync"
+	"time"
 
+	"dvr-manager/internal/auth"
+	"dvr-manager/internal/config"
 	"dvr-manager/internal/repository"
 
 	"golang.org/x/crypto/bcrypt"
@@ -13,59 +18,136 @@ import (
 
 // User 用户模型（对外返回，不包含密码）
 type User struct {
-	ID       int64  `json:"id"`
-	Username string `json:"username"`
-	Role     string `json:"role"`
-	Source   string `json:"source"`
+	ID         int64  `json:"id"`
+	Username   string `json:"username"`
+	Role       string `json:"role"`
+	Source     string `json:"source"`
+	MFAEnabled bool   `json:"mfa_enabled"` // 是否已启用 TOTP 二次验证
+	// MustChangePassword 种子账号或管理员重置密码后，须由本人修改密码
+	MustChangePassword bool `json:"must_change_password"`
+	// PasswordChangeRequired 须修改密码后才能继续使用（MustChangePassword 或密码超过最长有效期）
+	PasswordChangeRequired bool `json:"password_change_required"`
+	// LockedUntil 连续登录失败导致的临时锁定截止时间（仅用户列表填充）
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
+	Email       string     `json:"email,omitempty"`
+	DisplayName string     `json:"display_name,omitempty"`
+	AvatarURL   string     `json:"avatar_url,omitempty"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+	LastLoginIP string     `json:"last_login_ip,omitempty"`
+	// Groups 所属用户组（手动添加或 SSO 同步）
+	Groups []repository.UserGroup `json:"groups"`
+	// Disabled 已停用（停用原因 expired 表示到期自动停用）
+	Disabled       bool       `json:"disabled"`
+	DisabledAt     *time.Time `json:"disabled_at,omitempty"`
+	DisabledReason string     `json:"disabled_reason,omitempty"`
+	// ExpiresAt / LoginHours / AllowedCIDRs 账号有效期与登录限制，见 CheckUserAccess
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	LoginHours   string     `json:"login_hours,omitempty"`
+	AllowedCIDRs []string   `json:"allowed_cidrs,omitempty"`
+	// ExternalID SCIM 预配时 IdP 提供的 externalId
+	ExternalID string `json:"external_id,omitempty"`
+	// Impersonator 模拟登录会话中实际操作的管理员（仅会话校验时填充）
+	Impersonator *User `json:"-"`
+}
+
+// Roles 有效角色：用户角色在前，其后为所在组授予的角色（去重）
+func (u *User) Roles() []string {
+	roles := []string{u.Role}
+	seen := map[string]bool{u.Role: true}
+	for _, g := range u.Groups {
+		if g.Role != "" && !seen[g.Role] {
+			seen[g.Role] = true
+			roles = append(roles, g.Role)
+		}
+	}
+	return roles
+}
+
+// GroupNames 所属用户组名称
+func (u *User) GroupNames() []string {
+	names := make([]string, 0, len(u.Groups))
+	for _, g := range u.Groups {
+		names = append(names, g.Name)
+	}
+	return names
 }
 
 // AuthService 认证服务接口
 type AuthService interface {
-	Authenticate(username, password string) (*User, error)
+	// Authenticate 校验密码后检查账号状态与登录限制（见 CheckUserAccess）
+	Authenticate(username, password, clientIP string) (*User, error)
 	GetUser(username string) (*User, error)
 	ChangePassword(username, oldPassword, newPassword string) error
 
-	// SSO 登录使用：根据 (username, source) 查找用户，不存在则自动创建 (role=user)
-	FindOrCreateSSOUser(username, source string) (*User, error)
+	// SSO 登录使用：按 (source, ident.Subject) 查找已关联用户，未关联且用户名空闲时以 ident.Role（为空时 user）
+	// 自动创建；用户名被其他账号占用时返回 *SSOLinkRequiredError。由该来源创建的账号同步 IdP 资料；
+	// 账号已停用、已过期或不满足登录限制时拒绝
+	FindOrCreateSSOUser(ident *SSOIdentity, source, clientIP string) (*User, error)
+	// ConfirmSSOLink 用冲突账号的密码确认关联（令牌来自 SSOLinkRequiredError）
+	ConfirmSSOLink(linkToken, password, clientIP string) (*User, *repository.UserIdentity, error)
+	// PendingSSOLinkUser 关联令牌对应的账号用户名，令牌无效时为空
+	PendingSSOLinkUser(linkToken string) string
+	// SyncSSORole 按 IdP 映射结果同步由该来源创建的账号角色，返回是否变化（u.Role 同步更新）
+	SyncSSORole(u *User, ident *SSOIdentity, source string) (bool, error)
+	// SyncSSOGroups 按 IdP 提供的组同步由该来源创建的账号的组成员关系，返回新加入与被移出的组名（u.Groups 同步更新）
+	SyncSSOGroups(u *User, ident *SSOIdentity, source string) (added, removed []string, err error)
 
 	// 管理员接口
-	ListUsers() ([]User, error)
+	ListUsers(f repository.UserFilter) ([]User, error)
 	CreateUser(username, password, role string) (*User, error)
 	ResetPassword(id int64, newPassword string) error
 	UpdateUserRole(id int64, role string) error
 	DeleteUser(id int64) error
+	// SetUserDisabled 停用（吊销全部会话）或启用账号；已过期的账号须先调整有效期才能启用
+	SetUserDisabled(id int64, disabled bool, reason string) error
+	// UpdateUserRestrictions 设置账号有效期、登录时段与允许的来源网段
+	UpdateUserRestrictions(id int64, r repository.UserRestrictions) (*User, error)
 	GetUserByID(id int64) (*User, error)
+	ListIdentities(userID int64) ([]repository.UserIdentity, error)
+	LinkIdentity(userID int64, provider, subject string) (*repository.UserIdentity, error)
+	UnlinkIdentity(userID, identityID int64) (*repository.UserIdentity, error)
 }
 
 type authService struct {
-	repo repository.UserRepository
+	repo       repository.UserRepository
+	identities repository.IdentityRepository
+	roles      RoleService
+	groups     GroupService
+	sessions   SessionService
+	ldap       LDAPAuthenticator
+
+	linkMu       sync.Mutex
+	pendingLinks map[string]pendingLink // 关联令牌 → 待确认的关联
 }
 
-// NewAuthService 创建认证服务（数据库存储 + bcrypt）
-func NewAuthService(repo repository.UserRepository) AuthService {
-	s := &authService{repo: repo}
+// NewAuthService 创建认证服务（数据库存储 + bcrypt）；角色变更、删除用户时通过 sessions 吊销其会话。
+// roles 用于校验角色是否存在（为 nil 时仅允许 admin / user）；groups 非空时 SSO / 目录登录按 IdP 组同步用户组；
+// ldap 非空时，本地不存在的用户及 source=ldap:<id> 的用户通过目录认证
+func NewAuthService(repo repository.UserRepository, identities repository.IdentityRepository, roles RoleService, groups GroupService, sessions SessionService, ldap LDAPAuthenticator) AuthService {
+	s := &authService{repo: repo, identities: identities, roles: roles, groups: groups, sessions: sessions, ldap: ldap, pendingLinks: make(map[string]pendingLink)}
 	s.seedDefaultUsers()
 	return s
 }
 
-// seedDefaultUsers 在用户表为空时，使用环境变量创建默认账号
-func (s *authService) seedDefaultUsers() {
-	count, err := s.repo.Count()
-	if err != nil {
-		log.Printf("[AUTH] count users error: %v", err)
-		return
-	}
-	if count > 0 {
-		return
-	}
+// 内置默认账号密码（未设置 ADMIN_PASSWORD / USER_PASSWORD 时使用）
+const (
+	defaultAdminPassword = "admin123"
+	defaultUserPassword  = "user123"
+)
+
+type seedAccount struct {
+	username, password, role string
+}
 
+// seedAccounts 由环境变量决定的种子账号（同名时只保留管理员）
+func seedAccounts() []seedAccount {
 	adminUsername := strings.TrimSpace(os.Getenv("ADMIN_USERNAME"))
 	if adminUsername == "" {
 		adminUsername = "admin"
 	}
 	adminPassword := os.Getenv("ADMIN_PASSWORD")
 	if adminPassword == "" {
-		adminPassword = "admin123"
+		adminPassword = defaultAdminPassword
 	}
 
 	userUsername := strings.TrimSpace(os.Getenv("USER_USERNAME"))
@@ -74,21 +156,58 @@ func (s *authService) seedDefaultUsers() {
 	}
 	userPassword := os.Getenv("USER_PASSWORD")
 	if userPassword == "" {
-		userPassword = "user123"
+		userPassword = defaultUserPassword
 	}
 
-	if _, err := s.CreateUser(adminUsername, adminPassword, "admin"); err != nil {
-		log.Printf("[AUTH] seed admin failed: %v", err)
-	} else {
-		log.Printf("[AUTH] seeded default admin user: %s", adminUsername)
-	}
+	accounts := []seedAccount{{adminUsername, adminPassword, "admin"}}
 	if userUsername != adminUsername {
-		if _, err := s.CreateUser(userUsername, userPassword, "user"); err != nil {
-			log.Printf("[AUTH] seed user failed: %v", err)
-		} else {
-			log.Printf("[AUTH] seeded default normal user: %s", userUsername)
+		accounts = append(accounts, seedAccount{userUsername, userPassword, "user"})
+	}
+	return accounts
+}
+
+// seedDefaultUsers 在用户表为空时，使用环境变量创建默认账号；种子账号首次登录须修改密码
+func (s *authService) seedDefaultUsers() {
+	count, err := s.repo.Count()
+	if err != nil {
+		log.Printf("[AUTH] count users error: %v", err)
+		return
+	}
+	if count > 0 {
+		return
+	}
+
+	for _, a := range seedAccounts() {
+		// 种子账号可能使用内置默认密码，不校验密码策略
+		u, err := s.createUser(a.username, a.password, a.role, false)
+		if err != nil {
+			log.Printf("[AUTH] seed %s failed: %v", a.role, err)
+			continue
+		}
+		if err := s.repo.SetMustChangePassword(u.ID, true); err != nil {
+			log.Printf("[AUTH] flag seeded user %s failed: %v", a.username, err)
+		}
+		log.Printf("[AUTH] seeded default %s user: %s", a.role, a.username)
+	}
+}
+
+// DefaultCredentialsInUse 仍可使用内置默认密码登录的种子账号
+func DefaultCredentialsInUse(repo repository.UserRepository) []string {
+	defaults := map[string]string{"admin": defaultAdminPassword, "user": defaultUserPassword}
+	var names []string
+	for _, a := range seedAccounts() {
+		if a.password != defaults[a.role] {
+			continue
+		}
+		u, err := repo.GetByUsername(a.username)
+		if err != nil || u.Disabled || (u.Source != "" && u.Source != "local") {
+			continue
+		}
+		if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(a.password)) == nil {
+			names = append(names, a.username)
 		}
 	}
+	return names
 }
 
 func hashPassword(p string) (string, error) {
@@ -103,18 +222,83 @@ func toUser(u *repository.User) *User {
 	if u == nil {
 		return nil
 	}
-	return &User{ID: u.ID, Username: u.Username, Role: u.Role, Source: u.Source}
+	return &User{
+		ID: u.ID, Username: u.Username, Role: u.Role, Source: u.Source, MFAEnabled: u.MFAEnabled,
+		MustChangePassword:     u.MustChangePassword,
+		PasswordChangeRequired: u.MustChangePassword || passwordExpired(u, config.CurrentPasswordPolicy(), time.Now()),
+		Email:                  u.Email, DisplayName: u.DisplayName, AvatarURL: u.AvatarURL,
+		LastLoginAt: u.LastLoginAt, LastLoginIP: u.LastLoginIP,
+		Groups:   u.Groups,
+		Disabled: u.Disabled, DisabledAt: u.DisabledAt, DisabledReason: u.DisabledReason,
+		ExpiresAt: u.ExpiresAt, LoginHours: u.LoginHours, AllowedCIDRs: u.AllowedCIDRs,
+		ExternalID: u.ExternalID,
+	}
+}
+
+// passwordExpired 本地账号密码是否超过最长有效期
+func passwordExpired(u *repository.User, policy config.PasswordPolicy, now time.Time) bool {
+	if policy.MaxAgeDays <= 0 || (u.Source != "" && u.Source != "local") {
+		return false
+	}
+	return now.Sub(u.PasswordChangedAt) > time.Duration(policy.MaxAgeDays)*24*time.Hour
+}
+
+// checkPassword 按当前密码策略校验新密码；u 非空时检查历史密码（含当前密码）
+func (s *authService) checkPassword(username, password string, u *repository.User) error {
+	policy := config.CurrentPasswordPolicy()
+	if err := auth.ValidatePassword(policy, username, password); err != nil {
+		return err
+	}
+	if u == nil || policy.HistorySize <= 0 {
+		return nil
+	}
+	hashes := []string{u.PasswordHash}
+	if policy.HistorySize > 1 {
+		history, err := s.repo.PasswordHistory(u.ID, policy.HistorySize-1)
+		if err != nil {
+			return err
+		}
+		hashes = append(hashes, history...)
+	}
+	for _, h := range hashes {
+		if bcrypt.CompareHashAndPassword([]byte(h), []byte(password)) == nil {
+			return fmt.Errorf("不能使用最近 %d 次用过的密码", policy.HistorySize)
+		}
+	}
+	return nil
+}
+
+// Authenticate 验证用户名密码，通过后检查账号状态与登录限制
+func (s *authService) Authenticate(username, password, clientIP string) (*User, error) {
+	u, err := s.authenticate(username, password)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckUserAccess(u, clientIP, time.Now()); err != nil {
+		return nil, err
+	}
+	return u, nil
 }
 
-// Authenticate 验证用户名密码（仅本地用户）
-func (s *authService) Authenticate(username, password string) (*User, error) {
+// authenticate 本地用户校验 bcrypt；目录用户及本地不存在的用户交给 LDAP
+func (s *authService) authenticate(username, password string) (*User, error) {
 	u, err := s.repo.GetByUsername(username)
 	if err != nil {
 		if errors.Is(err, repository.ErrUserNotFound) {
-			return nil, errors.New("用户名或密码错误")
+			return s.authenticateDirectory(username, password)
 		}
 		return nil, err
 	}
+	if id, ok := ParseLDAPSource(u.Source); ok {
+		if s.ldap == nil {
+			return nil, errors.New("用户名或密码错误")
+		}
+		ident, err := s.ldap.AuthenticateLDAP(id, username, password)
+		if err != nil {
+			return nil, ldapLoginError(id, err)
+		}
+		return s.syncLDAPUser(u, ident)
+	}
 	// SSO 用户禁止本地密码登录
 	if u.Source != "" && u.Source != "local" {
 		return nil, errors.New("该账号通过 SSO 登录，无法使用密码登录")
@@ -125,27 +309,144 @@ func (s *authService) Authenticate(username, password string) (*User, error) {
 	return toUser(u), nil
 }
 
-// FindOrCreateSSOUser SSO 登录入口：按用户名查找；不存在则以默认角色 user 创建
-func (s *authService) FindOrCreateSSOUser(username, source string) (*User, error) {
-	username = strings.TrimSpace(username)
+// authenticateDirectory 本地不存在的用户：依次尝试已启用的 LDAP 提供商，首次登录成功时创建账号
+func (s *authService) authenticateDirectory(username, password string) (*User, error) {
+	if s.ldap == nil {
+		return nil, errors.New("用户名或密码错误")
+	}
+	for _, id := range s.ldap.LDAPProviderIDs() {
+		ident, err := s.ldap.AuthenticateLDAP(id, username, password)
+		if errors.Is(err, ErrLDAPUserNotFound) {
+			continue
+		}
+		if err != nil {
+			// 目录不可达时继续尝试下一个；用户存在但密码错误等情况直接返回
+			if !errors.Is(err, ErrLDAPInvalidCredentials) && !errors.Is(err, ErrLDAPNoRole) {
+				log.Printf("[AUTH] ldap provider %d: %v", id, err)
+				continue
+			}
+			return nil, ldapLoginError(id, err)
+		}
+		source := LDAPSource(id)
+		// 目录中的规范用户名可能与输入不同（大小写等），以目录为准
+		if u, err := s.repo.GetByUsername(ident.Username); err == nil {
+			if u.Source != source {
+				return nil, errors.New("同名账号已存在，无法通过目录登录")
+			}
+			return s.syncLDAPUser(u, ident)
+		}
+		created, err := s.repo.CreateSSO(ident.Username, ident.Role, source)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("[AUTH] created ldap user %s (%s, role=%s)", created.Username, source, created.Role)
+		return s.syncLDAPGroups(created, source, ident.Groups)
+	}
+	return nil, errors.New("用户名或密码错误")
+}
+
+// syncLDAPUser 目录中的组变化后同步角色；角色变化时吊销旧会话
+func (s *authService) syncLDAPUser(u *repository.User, ident *LDAPIdentity) (*User, error) {
+	if u.Role != ident.Role {
+		if err := s.repo.UpdateRole(u.ID, ident.Role); err != nil {
+			return nil, err
+		}
+		s.revokeSessions(u.ID, RevokeReasonRoleChange)
+		log.Printf("[AUTH] ldap user %s role synced: %s -> %s", u.Username, u.Role, ident.Role)
+		u.Role = ident.Role
+	}
+	return s.syncLDAPGroups(u, LDAPSource(ident.ProviderID), ident.Groups)
+}
+
+// syncLDAPGroups 按目录中的组（memberOf 等）同步用户组成员关系
+func (s *authService) syncLDAPGroups(u *repository.User, source string, groups []string) (*User, error) {
+	if s.groups == nil {
+		return toUser(u), nil
+	}
+	added, removed, err := s.groups.SyncExternal(u.ID, source, groups)
+	if err != nil {
+		return nil, err
+	}
+	if len(added) == 0 && len(removed) == 0 {
+		return toUser(u), nil
+	}
+	log.Printf("[AUTH] ldap user %s groups synced: +%v -%v", u.Username, added, removed)
+	refreshed, err := s.repo.GetByID(u.ID)
+	if err != nil {
+		return nil, err
+	}
+	return toUser(refreshed), nil
+}
+
+// ldapLoginError 对外统一的目录登录错误（连接类错误不暴露细节）
+func ldapLoginError(id int64, err error) error {
+	switch {
+	case errors.Is(err, ErrLDAPNoRole):
+		return err
+	case errors.Is(err, ErrLDAPInvalidCredentials), errors.Is(err, ErrLDAPUserNotFound):
+		return errors.New("用户名或密码错误")
+	default:
+		log.Printf("[AUTH] ldap provider %d: %v", id, err)
+		return errors.New("目录服务暂不可用，请稍后重试")
+	}
+}
+
+// FindOrCreateSSOUser SSO 登录入口：按 IdP subject 映射用户，见 resolveSSOUser
+func (s *authService) FindOrCreateSSOUser(ident *SSOIdentity, source, clientIP string) (*User, error) {
+	username := strings.TrimSpace(ident.Username)
 	if username == "" {
 		return nil, errors.New("SSO 用户名为空")
 	}
 	if source == "" {
 		source = "sso"
 	}
-	u, err := s.repo.GetByUsername(username)
-	if err == nil {
-		return toUser(u), nil
-	}
-	if !errors.Is(err, repository.ErrUserNotFound) {
+	u, err := s.resolveSSOUser(ident, username, source)
+	if err != nil {
 		return nil, err
 	}
-	created, err := s.repo.CreateSSO(username, "user", source)
-	if err != nil {
+	if u.Source == source && ident.hasProfile() {
+		if err := s.repo.UpdateProfile(u.ID, ident.Profile()); err != nil {
+			log.Printf("[AUTH] update profile of %s: %v", username, err)
+		} else if refreshed, err := s.repo.GetByID(u.ID); err == nil {
+			u = refreshed
+		}
+	}
+	user := toUser(u)
+	if err := CheckUserAccess(user, clientIP, time.Now()); err != nil {
 		return nil, err
 	}
-	return toUser(created), nil
+	return user, nil
+}
+
+// SyncSSOGroups 按 IdP 组同步用户组；与角色同步一样仅处理 source 相同的账号，提供商未配置组来源时不改动
+func (s *authService) SyncSSOGroups(u *User, ident *SSOIdentity, source string) ([]string, []string, error) {
+	if s.groups == nil || !ident.SyncGroups || u.Source != source {
+		return nil, nil, nil
+	}
+	added, removed, err := s.groups.SyncExternal(u.ID, source, ident.Groups)
+	if err != nil || (len(added) == 0 && len(removed) == 0) {
+		return nil, nil, err
+	}
+	if refreshed, err := s.repo.GetByID(u.ID); err == nil {
+		u.Groups = refreshed.Groups
+	}
+	return added, removed, nil
+}
+
+// SyncSSORole 按 IdP 映射结果同步角色；仅处理 source 相同的账号，避免同名本地账号被 IdP 改动
+func (s *authService) SyncSSORole(u *User, ident *SSOIdentity, source string) (bool, error) {
+	if u.Source != source {
+		return false, nil
+	}
+	target := ssoTargetRole(s.roles, u.Role, ident)
+	if target == u.Role {
+		return false, nil
+	}
+	if err := s.UpdateUserRole(u.ID, target); err != nil {
+		return false, err
+	}
+	u.Role = target
+	return true, nil
 }
 
 // GetUser 获取用户
@@ -168,9 +469,6 @@ func (s *authService) GetUserByID(id int64) (*User, error) {
 
 // ChangePassword 修改自己的密码（需校验旧密码）
 func (s *authService) ChangePassword(username, oldPassword, newPassword string) error {
-	if len(newPassword) < 6 {
-		return errors.New("新密码长度至少 6 位")
-	}
 	u, err := s.repo.GetByUsername(username)
 	if err != nil {
 		if errors.Is(err, repository.ErrUserNotFound) {
@@ -178,22 +476,28 @@ func (s *authService) ChangePassword(username, oldPassword, newPassword string)
 		}
 		return err
 	}
+	if u.Source != "" && u.Source != "local" {
+		return errors.New("该账号由外部身份源管理，请在身份源处修改密码")
+	}
 	if err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(oldPassword)); err != nil {
 		return errors.New("原密码错误")
 	}
 	if oldPassword == newPassword {
 		return errors.New("新密码与原密码相同")
 	}
+	if err := s.checkPassword(u.Username, newPassword, u); err != nil {
+		return err
+	}
 	hash, err := hashPassword(newPassword)
 	if err != nil {
 		return err
 	}
-	return s.repo.UpdatePassword(u.ID, hash)
+	return s.repo.UpdatePassword(u.ID, hash, false)
 }
 
 // ListUsers 用户列表
-func (s *authService) ListUsers() ([]User, error) {
-	list, err := s.repo.List()
+func (s *authService) ListUsers(f repository.UserFilter) ([]User, error) {
+	list, err := s.repo.List(f)
 	if err != nil {
 		return nil, err
 	}
@@ -204,17 +508,25 @@ func (s *authService) ListUsers() ([]User, error) {
 	return out, nil
 }
 
-// CreateUser 新增用户
+// CreateUser 新增用户（校验密码策略）
 func (s *authService) CreateUser(username, password, role string) (*User, error) {
+	return s.createUser(username, password, role, true)
+}
+
+func (s *authService) createUser(username, password, role string, enforcePolicy bool) (*User, error) {
 	username = strings.TrimSpace(username)
 	if username == "" {
 		return nil, errors.New("用户名不能为空")
 	}
-	if len(password) < 6 {
-		return nil, errors.New("密码长度至少 6 位")
+	if enforcePolicy {
+		if err := s.checkPassword(username, password, nil); err != nil {
+			return nil, err
+		}
+	} else if password == "" {
+		return nil, errors.New("密码不能为空")
 	}
-	if role != "admin" && role != "user" {
-		return nil, errors.New("角色必须为 admin 或 user")
+	if !s.validRole(role) {
+		return nil, ErrRoleInvalid
 	}
 	hash, err := hashPassword(password)
 	if err != nil {
@@ -227,36 +539,97 @@ func (s *authService) CreateUser(username, password, role string) (*User, error)
 	return toUser(u), nil
 }
 
-// ResetPassword 管理员重置某个用户的密码
+// validRole 角色是否存在
+func (s *authService) validRole(role string) bool {
+	if s.roles == nil {
+		return role == RoleAdmin || role == RoleUser
+	}
+	return s.roles.Exists(role)
+}
+
+// ResetPassword 管理员重置某个用户的密码；该用户须修改密码后才能继续使用
 func (s *authService) ResetPassword(id int64, newPassword string) error {
-	if len(newPassword) < 6 {
-		return errors.New("新密码长度至少 6 位")
+	u, err := s.repo.GetByID(id)
+	if err != nil {
+		return err
 	}
-	if _, err := s.repo.GetByID(id); err != nil {
+	if err := s.checkPassword(u.Username, newPassword, u); err != nil {
 		return err
 	}
 	hash, err := hashPassword(newPassword)
 	if err != nil {
 		return err
 	}
-	return s.repo.UpdatePassword(id, hash)
+	return s.repo.UpdatePassword(id, hash, true)
 }
 
-// UpdateUserRole 修改用户角色
+// UpdateUserRole 修改用户角色；角色变化时吊销该用户全部会话
 func (s *authService) UpdateUserRole(id int64, role string) error {
-	if role != "admin" && role != "user" {
-		return errors.New("角色必须为 admin 或 user")
+	if !s.validRole(role) {
+		return ErrRoleInvalid
 	}
-	if _, err := s.repo.GetByID(id); err != nil {
+	u, err := s.repo.GetByID(id)
+	if err != nil {
 		return err
 	}
-	return s.repo.UpdateRole(id, role)
+	if err := s.repo.UpdateRole(id, role); err != nil {
+		return err
+	}
+	if u.Role != role {
+		s.revokeSessions(id, RevokeReasonRoleChange)
+	}
+	return nil
 }
 
-// DeleteUser 删除用户
+// DeleteUser 删除用户并吊销其全部会话
 func (s *authService) DeleteUser(id int64) error {
 	if _, err := s.repo.GetByID(id); err != nil {
 		return err
 	}
+	s.revokeSessions(id, RevokeReasonUserDeleted)
 	return s.repo.Delete(id)
 }
+
+// SetUserDisabled 停用 / 启用账号
+func (s *authService) SetUserDisabled(id int64, disabled bool, reason string) error {
+	u, err := s.repo.GetByID(id)
+	if err != nil {
+		return err
+	}
+	if !disabled && u.ExpiresAt != nil && !time.Now().Before(*u.ExpiresAt) {
+		return errors.New("账号已过期，请先调整有效期再启用")
+	}
+	if err := s.repo.SetDisabled(id, disabled, strings.TrimSpace(reason)); err != nil {
+		return err
+	}
+	if disabled {
+		s.revokeSessions(id, RevokeReasonUserDisabled)
+	}
+	return nil
+}
+
+// UpdateUserRestrictions 设置有效期与登录限制（对已登录会话的后续请求立即生效）
+func (s *authService) UpdateUserRestrictions(id int64, r repository.UserRestrictions) (*User, error) {
+	if _, err := s.repo.GetByID(id); err != nil {
+		return nil, err
+	}
+	r, err := normalizeRestrictions(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.UpdateRestrictions(id, r); err != nil {
+		return nil, err
+	}
+	return s.GetUserByID(id)
+}
+
+func (s *authService) revokeSessions(userID int64, reason string) {
+	if s.sessions == nil {
+		return
+	}
+	if n, err := s.sessions.RevokeUser(userID, reason); err != nil {
+		log.Printf("[AUTH] revoke sessions of user %d failed: %v", userID, err)
+	} else if n > 0 {
+		log.Printf("[AUTH] revoked %d sessions of user %d (%s)", n, userID, reason)
+	}
+}
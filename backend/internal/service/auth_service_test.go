@@ -0,0 +1,77 @@
+package service
+
+import (
+	"testing"
+
+	"dvr-manager/internal/repository"
+	"dvr-manager/pkg/db"
+)
+
+func TestAuthService_passwordHistory(t *testing.T) {
+	dir := t.TempDir()
+	if err := db.InitDB(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	svc := NewAuthService(repository.NewUserRepository(), repository.NewIdentityRepository(), nil, nil, nil, nil)
+	if _, err := svc.CreateUser("dave", "Orange-Kite-1", "user"); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.ChangePassword("dave", "Orange-Kite-1", "Orange-Kite-2"); err != nil {
+		t.Fatal(err)
+	}
+	// 默认策略禁止重复使用最近 5 次的密码
+	if err := svc.ChangePassword("dave", "Orange-Kite-2", "Orange-Kite-1"); err == nil {
+		t.Fatal("expected reuse of previous password to be rejected")
+	}
+	if err := svc.ChangePassword("dave", "Orange-Kite-2", "Orange-Kite-3"); err != nil {
+		t.Fatal(err)
+	}
+	u, err := svc.GetUser("dave")
+	if err != nil || u.PasswordChangeRequired {
+		t.Fatalf("user=%+v err=%v", u, err)
+	}
+}
+
+func TestAuthService_seededAccountsMustChangePassword(t *testing.T) {
+	dir := t.TempDir()
+	if err := db.InitDB(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	t.Setenv("ADMIN_USERNAME", "")
+	t.Setenv("ADMIN_PASSWORD", "")
+	t.Setenv("USER_USERNAME", "")
+	t.Setenv("USER_PASSWORD", "")
+
+	repo := repository.NewUserRepository()
+	svc := NewAuthService(repo, repository.NewIdentityRepository(), nil, nil, nil, nil)
+	if got := DefaultCredentialsInUse(repo); len(got) != 2 {
+		t.Fatalf("default credentials in use=%v", got)
+	}
+	admin, err := svc.GetUser("admin")
+	if err != nil || !admin.MustChangePassword || !admin.PasswordChangeRequired {
+		t.Fatalf("admin=%+v err=%v", admin, err)
+	}
+
+	if err := svc.ChangePassword("admin", "admin123", "Violet-Harbor-9"); err != nil {
+		t.Fatal(err)
+	}
+	admin, _ = svc.GetUser("admin")
+	if admin.PasswordChangeRequired {
+		t.Fatal("flag should be cleared after changing password")
+	}
+	if got := DefaultCredentialsInUse(repo); len(got) != 1 || got[0] != "user" {
+		t.Fatalf("default credentials in use=%v", got)
+	}
+
+	// 管理员重置密码后须再次修改
+	if err := svc.ResetPassword(admin.ID, "Amber-Meadow-4"); err != nil {
+		t.Fatal(err)
+	}
+	admin, _ = svc.GetUser("admin")
+	if !admin.MustChangePassword {
+		t.Fatal("reset password should set must_change_password")
+	}
+}
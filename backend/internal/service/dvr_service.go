@@ -16,7 +16,8 @@ import (
 
 // DVRService DVR 服务接口
 type DVRService interface {
-	FindRecording(ctx context.Context, recordID string) (string, error)
+	// FindRecording 查询录像真实地址；scope 非 nil 时仅查询其允许的服务器，无可用服务器时返回 ErrAccessDenied
+	FindRecording(ctx context.Context, recordID string, scope *AccessScope) (string, error)
 }
 
 type dvrService struct {
@@ -54,8 +55,8 @@ type DVRQueryResult struct {
 	Error     error
 }
 
-// FindRecording 并发查询多个 DVR 服务器
-func (s *dvrService) FindRecording(ctx context.Context, recordID string) (string, error) {
+// FindRecording 并发查询多个 DVR 服务器（限于访问范围内的服务器）
+func (s *dvrService) FindRecording(ctx context.Context, recordID string, scope *AccessScope) (string, error) {
 	cfg := config.GetConfig()
 	if cfg == nil {
 		return "", fmt.Errorf("config not loaded")
@@ -73,6 +74,11 @@ func (s *dvrService) FindRecording(ctx context.Context, recordID string) (string
 	if len(dvrServers) == 0 {
 		return "", fmt.Errorf("no dvr servers configured")
 	}
+	if scope != nil {
+		if dvrServers = scope.Servers(recordID, dvrServers); len(dvrServers) == 0 {
+			return "", ErrAccessDenied
+		}
+	}
 
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"dvr-manager/internal/repository"
+)
+
+// GroupService 用户组：组成员额外获得组的角色，并可作为访问策略主体
+type GroupService interface {
+	List() ([]repository.Group, error)
+	Get(id int64) (*repository.Group, error)
+	Create(name, description, role, externalName string) (*repository.Group, error)
+	Update(id int64, name, description, role, externalName string) (*repository.Group, error)
+	// Delete 删除组，成员关系与以该组为主体的访问策略一并删除
+	Delete(id int64) (*repository.Group, error)
+
+	Members(id int64) ([]repository.GroupMember, error)
+	// AddMember 手动添加成员（已由 SSO 同步加入的改为手动，不再随 IdP 移除）
+	AddMember(groupID, userID int64) error
+	RemoveMember(groupID, userID int64) error
+	// SyncExternal 按 IdP 提供的组名同步用户在 source 来源下的组成员关系，返回新加入与被移出的组名
+	SyncExternal(userID int64, source string, idpGroups []string) (added, removed []string, err error)
+}
+
+type groupService struct {
+	repo     repository.GroupRepository
+	userRepo repository.UserRepository
+	roles    RoleService
+}
+
+// NewGroupService 创建用户组服务；roles 为 nil 时组角色仅允许 admin / user
+func NewGroupService(repo repository.GroupRepository, userRepo repository.UserRepository, roles RoleService) GroupService {
+	return &groupService{repo: repo, userRepo: userRepo, roles: roles}
+}
+
+// List 全部用户组
+func (s *groupService) List() ([]repository.Group, error) {
+	return s.repo.List()
+}
+
+// Get 按 ID 查询
+func (s *groupService) Get(id int64) (*repository.Group, error) {
+	return s.repo.Get(id)
+}
+
+// normalizeGroup 校验并规范化组字段
+func (s *groupService) normalizeGroup(g *repository.Group) error {
+	g.Name = strings.TrimSpace(g.Name)
+	if g.Name == "" {
+		return errors.New("用户组名称不能为空")
+	}
+	if utf8.RuneCountInString(g.Name) > 64 {
+		return errors.New("用户组名称不能超过 64 个字符")
+	}
+	g.Description = strings.TrimSpace(g.Description)
+	g.Role = strings.TrimSpace(g.Role)
+	if g.Role != "" {
+		if s.roles == nil && g.Role != RoleAdmin && g.Role != RoleUser {
+			return ErrRoleInvalid
+		}
+		if s.roles != nil && !s.roles.Exists(g.Role) {
+			return ErrRoleInvalid
+		}
+	}
+	g.ExternalName = strings.TrimSpace(g.ExternalName)
+	return nil
+}
+
+// Create 新增用户组
+func (s *groupService) Create(name, description, role, externalName string) (*repository.Group, error) {
+	g := &repository.Group{Name: name, Description: description, Role: role, ExternalName: externalName}
+	if err := s.normalizeGroup(g); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(g); err != nil {
+		return nil, err
+	}
+	return s.repo.Get(g.ID)
+}
+
+// Update 修改用户组（角色变化对成员立即生效）
+func (s *groupService) Update(id int64, name, description, role, externalName string) (*repository.Group, error) {
+	g := &repository.Group{ID: id, Name: name, Description: description, Role: role, ExternalName: externalName}
+	if err := s.normalizeGroup(g); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Update(g); err != nil {
+		return nil, err
+	}
+	return s.repo.Get(id)
+}
+
+// Delete 删除用户组
+func (s *groupService) Delete(id int64) (*repository.Group, error) {
+	g, err := s.repo.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Delete(id); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// Members 组成员
+func (s *groupService) Members(id int64) ([]repository.GroupMember, error) {
+	if _, err := s.repo.Get(id); err != nil {
+		return nil, err
+	}
+	return s.repo.ListMembers(id)
+}
+
+// AddMember 手动添加成员
+func (s *groupService) AddMember(groupID, userID int64) error {
+	if _, err := s.repo.Get(groupID); err != nil {
+		return err
+	}
+	if _, err := s.userRepo.GetByID(userID); err != nil {
+		return err
+	}
+	return s.repo.AddMember(groupID, userID, repository.GroupMemberManual)
+}
+
+// RemoveMember 移除成员（SSO 同步的成员在下次登录时若仍属于 IdP 组会重新加入）
+func (s *groupService) RemoveMember(groupID, userID int64) error {
+	if _, err := s.repo.Get(groupID); err != nil {
+		return err
+	}
+	return s.repo.RemoveMember(groupID, userID)
+}
+
+// SyncExternal IdP 组名与 external_name 比较（不区分大小写，DN 亦按其 CN 匹配）
+func (s *groupService) SyncExternal(userID int64, source string, idpGroups []string) ([]string, []string, error) {
+	groups, err := s.repo.List()
+	if err != nil {
+		return nil, nil, err
+	}
+	names := map[string]bool{}
+	for _, g := range idpGroups {
+		g = strings.TrimSpace(g)
+		if g == "" {
+			continue
+		}
+		names[strings.ToLower(g)] = true
+		names[strings.ToLower(groupCN(g))] = true
+	}
+	var ids []int64
+	want := map[int64]bool{}
+	for _, g := range groups {
+		if g.ExternalName != "" && names[strings.ToLower(g.ExternalName)] {
+			ids = append(ids, g.ID)
+			want[g.ID] = true
+		}
+	}
+
+	u, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	changed, err := s.repo.SyncMembers(userID, source, ids)
+	if err != nil || !changed {
+		return nil, nil, err
+	}
+	var added, removed []string
+	had := map[int64]bool{}
+	for _, g := range u.Groups {
+		had[g.ID] = true
+		if g.Source == source && !want[g.ID] {
+			removed = append(removed, g.Name)
+		}
+	}
+	for _, g := range groups {
+		if want[g.ID] && !had[g.ID] {
+			added = append(added, g.Name)
+		}
+	}
+	return added, removed, nil
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"testing"
+
+	"dvr-manager/internal/repository"
+	"dvr-manager/pkg/db"
+)
+
+func TestGroupService_syncExternal(t *testing.T) {
+	if err := db.InitDB(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	users := repository.NewUserRepository()
+	alice, err := users.CreateSSO("alice", "viewer", "oidc:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	groupRepo := repository.NewGroupRepository()
+	svc := NewGroupService(groupRepo, users, NewRoleService(repository.NewRoleRepository()))
+
+	auditors, err := svc.Create("auditors", "", RoleAuditor, "DVR-Auditors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	siteA, err := svc.Create("site-a", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Create("bad", "", "no-such-role", ""); err == nil {
+		t.Fatal("expected unknown role to be rejected")
+	}
+	if err := svc.AddMember(siteA.ID, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// 目录返回的组 DN 按其 CN 匹配（不区分大小写）
+	added, _, err := svc.SyncExternal(alice.ID, "oidc:1", []string{"cn=dvr-auditors,ou=groups,dc=example,dc=com"})
+	if err != nil || len(added) != 1 || added[0] != "auditors" {
+		t.Fatalf("added=%v err=%v", added, err)
+	}
+	u, _ := users.GetByID(alice.ID)
+	if roles := toUser(u).Roles(); len(roles) != 2 || roles[1] != RoleAuditor {
+		t.Fatalf("effective roles = %v", roles)
+	}
+
+	// IdP 不再提供该组：移出同步加入的组，手动添加的组保留
+	_, removed, err := svc.SyncExternal(alice.ID, "oidc:1", nil)
+	if err != nil || len(removed) != 1 || removed[0] != auditors.Name {
+		t.Fatalf("removed=%v err=%v", removed, err)
+	}
+	u, _ = users.GetByID(alice.ID)
+	if len(u.Groups) != 1 || u.Groups[0].ID != siteA.ID {
+		t.Fatalf("groups after sync = %+v", u.Groups)
+	}
+
+	// 用户组可作为访问策略主体
+	access := NewAccessService(repository.NewAccessRepository(), users, groupRepo)
+	if _, err := access.CreatePolicy(&repository.AccessPolicy{
+		Name: "site A", SubjectType: repository.AccessSubjectGroup, SubjectID: siteA.ID,
+		RecordPatterns: []string{"A-*"}, Enabled: true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	scope, err := access.ScopeFor(alice.ID)
+	if err != nil || scope == nil || scope.AllowsRecord("B-001") || !scope.AllowsRecord("A-001") {
+		t.Fatalf("group policy not applied: scope=%v err=%v", scope, err)
+	}
+}
@@ -0,0 +1,207 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"dvr-manager/internal/repository"
+)
+
+// ssoLinkTTL SSO 登录遇到同名账号后，用户确认关联的最长时间
+const ssoLinkTTL = 10 * time.Minute
+
+// ErrSSOLinkInvalid 关联令牌无效、已使用或已过期
+var ErrSSOLinkInvalid = errors.New("关联请求无效或已过期，请重新通过 SSO 登录")
+
+// SSOLinkRequiredError IdP 身份未关联且用户名与已有账号冲突：
+// 须由该账号本人输入密码确认关联（LinkToken），或由管理员关联
+type SSOLinkRequiredError struct {
+	Username  string
+	LinkToken string
+}
+
+func (e *SSOLinkRequiredError) Error() string {
+	return fmt.Sprintf("用户名 %s 已被其他账号使用，需确认关联后才能登录", e.Username)
+}
+
+// pendingLink 待确认的关联
+type pendingLink struct {
+	userID   int64
+	provider string
+	subject  string
+	username string
+	expires  time.Time
+}
+
+// resolveSSOUser 按 (provider, subject) 查找已关联的用户；未关联时：
+// 用户名不存在则创建并关联；同名账号由该来源创建且尚无该来源身份（升级前的旧账号），
+// 或为 SCIM 预配的账号且尚无该来源身份（见 scimSSOLinkAllowed）则直接关联；其余情况返回 SSOLinkRequiredError
+func (s *authService) resolveSSOUser(ident *SSOIdentity, username, source string) (*repository.User, error) {
+	subject := strings.TrimSpace(ident.Subject)
+	if subject == "" {
+		return nil, errors.New("SSO 身份缺少 subject")
+	}
+	if link, err := s.identities.Get(source, subject); err == nil {
+		u, err := s.repo.GetByID(link.UserID)
+		if err != nil {
+			return nil, err
+		}
+		_ = s.identities.Touch(link.ID)
+		return u, nil
+	} else if !errors.Is(err, repository.ErrIdentityNotFound) {
+		return nil, err
+	}
+
+	u, err := s.repo.GetByUsername(username)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		role := ident.Role
+		if role == "" {
+			role = "user"
+		}
+		if u, err = s.repo.CreateSSO(username, role, source); err != nil {
+			return nil, err
+		}
+		if _, err := s.identities.Create(u.ID, source, subject, username); err != nil {
+			return nil, err
+		}
+		return u, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Source == source || (u.Source == repository.SourceSCIM && scimSSOLinkAllowed(source)) {
+		linked, err := s.hasIdentity(u.ID, source)
+		if err != nil {
+			return nil, err
+		}
+		if !linked {
+			if _, err := s.identities.Create(u.ID, source, subject, username); err != nil {
+				return nil, err
+			}
+			return u, nil
+		}
+	}
+
+	token, err := randomToken(24)
+	if err != nil {
+		return nil, err
+	}
+	s.linkMu.Lock()
+	now := time.Now()
+	for k, p := range s.pendingLinks {
+		if now.After(p.expires) {
+			delete(s.pendingLinks, k)
+		}
+	}
+	s.pendingLinks[token] = pendingLink{userID: u.ID, provider: source, subject: subject, username: username, expires: now.Add(ssoLinkTTL)}
+	s.linkMu.Unlock()
+	return nil, &SSOLinkRequiredError{Username: u.Username, LinkToken: token}
+}
+
+func (s *authService) hasIdentity(userID int64, provider string) (bool, error) {
+	list, err := s.identities.ListByUser(userID)
+	if err != nil {
+		return false, err
+	}
+	for _, i := range list {
+		if i.Provider == provider {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ConfirmSSOLink 用户输入冲突账号的密码确认关联；关联成功后令牌失效（密码错误可重试，由登录限流约束）
+func (s *authService) ConfirmSSOLink(linkToken, password, clientIP string) (*User, *repository.UserIdentity, error) {
+	s.linkMu.Lock()
+	p, ok := s.pendingLinks[linkToken]
+	s.linkMu.Unlock()
+	if !ok || time.Now().After(p.expires) {
+		return nil, nil, ErrSSOLinkInvalid
+	}
+	target, err := s.repo.GetByID(p.userID)
+	if err != nil {
+		return nil, nil, ErrSSOLinkInvalid
+	}
+	u, err := s.Authenticate(target.Username, password, clientIP)
+	if err != nil {
+		return nil, nil, err
+	}
+	if u.ID != target.ID {
+		return nil, nil, ErrSSOLinkInvalid
+	}
+	s.linkMu.Lock()
+	delete(s.pendingLinks, linkToken)
+	s.linkMu.Unlock()
+	link, err := s.identities.Create(u.ID, p.provider, p.subject, p.username)
+	if err != nil {
+		return nil, nil, err
+	}
+	return u, link, nil
+}
+
+// PendingSSOLinkUser 关联令牌对应的账号用户名（用于限流与审计）；令牌无效时为空
+func (s *authService) PendingSSOLinkUser(linkToken string) string {
+	s.linkMu.Lock()
+	p, ok := s.pendingLinks[linkToken]
+	s.linkMu.Unlock()
+	if !ok {
+		return ""
+	}
+	u, err := s.repo.GetByID(p.userID)
+	if err != nil {
+		return ""
+	}
+	return u.Username
+}
+
+// ListIdentities 用户关联的外部身份
+func (s *authService) ListIdentities(userID int64) ([]repository.UserIdentity, error) {
+	if _, err := s.repo.GetByID(userID); err != nil {
+		return nil, err
+	}
+	return s.identities.ListByUser(userID)
+}
+
+// LinkIdentity 管理员关联外部身份
+func (s *authService) LinkIdentity(userID int64, provider, subject string) (*repository.UserIdentity, error) {
+	provider, subject = strings.TrimSpace(provider), strings.TrimSpace(subject)
+	if !validIdentityProvider(provider) {
+		return nil, errors.New("provider 须为 oidc:<id> 或 saml:<id>")
+	}
+	if subject == "" {
+		return nil, errors.New("subject 不能为空")
+	}
+	u, err := s.repo.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.identities.Create(u.ID, provider, subject, "")
+}
+
+// UnlinkIdentity 解除关联；identityID 须属于该用户
+func (s *authService) UnlinkIdentity(userID, identityID int64) (*repository.UserIdentity, error) {
+	link, err := s.identities.GetByID(identityID)
+	if err != nil {
+		return nil, err
+	}
+	if link.UserID != userID {
+		return nil, repository.ErrIdentityNotFound
+	}
+	if err := s.identities.Delete(link.ID); err != nil {
+		return nil, err
+	}
+	return link, nil
+}
+
+func validIdentityProvider(p string) bool {
+	for _, prefix := range []string{repository.SSOTypeOIDC + ":", repository.SSOTypeSAML + ":"} {
+		if id, ok := strings.CutPrefix(p, prefix); ok && id != "" && strings.Trim(id, "0123456789") == "" {
+			return true
+		}
+	}
+	return false
+}
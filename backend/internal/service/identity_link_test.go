@@ -0,0 +1,58 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"dvr-manager/internal/repository"
+	"dvr-manager/pkg/db"
+)
+
+func TestAuthService_ssoIdentityLinking(t *testing.T) {
+	if err := db.InitDB(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	t.Setenv("ADMIN_PASSWORD", "Tr0ub4dor&3")
+
+	svc := NewAuthService(repository.NewUserRepository(), repository.NewIdentityRepository(), nil, nil, nil, nil)
+
+	// 新用户：创建并按 subject 关联，之后改名仍映射到同一账号
+	carol, err := svc.FindOrCreateSSOUser(&SSOIdentity{Subject: "sub-carol", Username: "carol"}, "oidc:1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := svc.FindOrCreateSSOUser(&SSOIdentity{Subject: "sub-carol", Username: "carol.new"}, "oidc:1", "")
+	if err != nil || again.ID != carol.ID {
+		t.Fatalf("renamed IdP user mapped to %+v err=%v", again, err)
+	}
+
+	// 与本地管理员同名：不能直接登录为 admin，须确认关联
+	_, err = svc.FindOrCreateSSOUser(&SSOIdentity{Subject: "sub-evil", Username: "admin", Role: "admin"}, "oidc:1", "")
+	var linkErr *SSOLinkRequiredError
+	if !errors.As(err, &linkErr) || linkErr.Username != "admin" {
+		t.Fatalf("expected link required, got %v", err)
+	}
+	if _, _, err := svc.ConfirmSSOLink(linkErr.LinkToken, "wrong", ""); err == nil {
+		t.Fatal("expected wrong password to be rejected")
+	}
+	u, link, err := svc.ConfirmSSOLink(linkErr.LinkToken, "Tr0ub4dor&3", "")
+	if err != nil || u.Username != "admin" || link.Subject != "sub-evil" {
+		t.Fatalf("confirm link: user=%+v link=%+v err=%v", u, link, err)
+	}
+	if _, _, err := svc.ConfirmSSOLink(linkErr.LinkToken, "Tr0ub4dor&3", ""); !errors.Is(err, ErrSSOLinkInvalid) {
+		t.Fatalf("expected token to be single use, got %v", err)
+	}
+	linked, err := svc.FindOrCreateSSOUser(&SSOIdentity{Subject: "sub-evil", Username: "admin"}, "oidc:1", "")
+	if err != nil || linked.ID != u.ID {
+		t.Fatalf("linked identity mapped to %+v err=%v", linked, err)
+	}
+
+	// 解除关联后需重新确认
+	if _, err := svc.UnlinkIdentity(u.ID, link.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.FindOrCreateSSOUser(&SSOIdentity{Subject: "sub-evil", Username: "admin"}, "oidc:1", ""); !errors.As(err, &linkErr) {
+		t.Fatalf("expected link required after unlink, got %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"dvr-manager/internal/auth"
+	"dvr-manager/internal/repository"
+)
+
+// KeyService 非对称 JWT 签名密钥：首次启动生成、按周期轮换、宽限期后清理
+type KeyService interface {
+	// Load 从数据库加载密钥集并注入 JWT；没有可用的当前密钥时生成一把
+	Load() error
+	// RotateIfDue 当前密钥超过轮换周期时生成新密钥，旧密钥进入宽限期；返回是否发生轮换
+	RotateIfDue(now time.Time) (bool, error)
+}
+
+type keyService struct {
+	jwt      *auth.JWT
+	repo     repository.JWTKeyRepository
+	alg      string
+	rotation time.Duration
+	grace    time.Duration
+
+	mu     sync.Mutex
+	active *auth.SigningKey
+}
+
+// NewKeyService 创建签名密钥服务；rotation 为 0 表示不自动轮换
+func NewKeyService(jwt *auth.JWT, repo repository.JWTKeyRepository, alg string, rotation, grace time.Duration) KeyService {
+	return &keyService{jwt: jwt, repo: repo, alg: alg, rotation: rotation, grace: grace}
+}
+
+// Load 加载密钥
+func (s *keyService) Load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load()
+}
+
+func (s *keyService) load() error {
+	rows, err := s.repo.ListUsable(s.alg, time.Now())
+	if err != nil {
+		return err
+	}
+	var active *auth.SigningKey
+	keys := make([]*auth.SigningKey, 0, len(rows))
+	for _, row := range rows {
+		k, err := auth.ParseSigningKey(row.KID, row.Alg, row.PrivateKey, row.CreatedAt)
+		if err != nil {
+			log.Printf("[AUTH] skip invalid jwt key %s: %v", row.KID, err)
+			continue
+		}
+		keys = append(keys, k)
+		if row.RetiredAt == nil && active == nil {
+			active = k
+		}
+	}
+	if active == nil {
+		if active, err = s.create(); err != nil {
+			return err
+		}
+		keys = append(keys, active)
+		log.Printf("[AUTH] 已生成 JWT 签名密钥 - alg: %s, kid: %s", active.Alg, active.KID)
+	}
+	auth.SortKeysNewestFirst(keys)
+	s.active = active
+	s.jwt.SetKeys(active, keys)
+	return nil
+}
+
+func (s *keyService) create() (*auth.SigningKey, error) {
+	k, err := auth.GenerateSigningKey(s.alg)
+	if err != nil {
+		return nil, err
+	}
+	pemStr, err := auth.MarshalPrivateKeyPEM(k)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(&repository.JWTKey{KID: k.KID, Alg: k.Alg, PrivateKey: pemStr, CreatedAt: k.CreatedAt}); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// RotateIfDue 到期轮换并清理宽限期已过的旧密钥
+func (s *keyService) RotateIfDue(now time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if n, err := s.repo.DeleteExpired(now); err != nil {
+		log.Printf("[AUTH] delete expired jwt keys failed: %v", err)
+	} else if n > 0 {
+		log.Printf("[AUTH] 已清理过期 JWT 签名密钥: %d", n)
+	}
+
+	if s.rotation <= 0 || s.active == nil || now.Before(s.active.CreatedAt.Add(s.rotation)) {
+		// 仍需重新加载，使已过宽限期的旧密钥退出验签集合
+		return false, s.load()
+	}
+	next, err := s.create()
+	if err != nil {
+		return false, fmt.Errorf("rotate jwt key: %w", err)
+	}
+	if _, err := s.repo.Retire(s.alg, next.KID, now.Add(s.grace)); err != nil {
+		return false, err
+	}
+	log.Printf("[AUTH] JWT 签名密钥已轮换 - old: %s, new: %s, grace: %s", s.active.KID, next.KID, s.grace)
+	return true, s.load()
+}
@@ -0,0 +1,279 @@
+package service
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"dvr-manager/internal/repository"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// LDAP 默认值
+const (
+	DefaultLDAPUserFilter        = "(&(objectClass=person)(|(uid={username})(sAMAccountName={username})))"
+	DefaultLDAPUsernameAttribute = "uid"
+	DefaultLDAPGroupAttribute    = "memberOf"
+	ldapTimeout                  = 10 * time.Second
+)
+
+// LDAP 认证错误
+var (
+	ErrLDAPUserNotFound       = errors.New("目录中不存在该用户")
+	ErrLDAPInvalidCredentials = errors.New("用户名或密码错误")
+	ErrLDAPNoRole             = errors.New("该账号不属于任何已授权的目录组")
+)
+
+// LDAPConfig LDAP / Active Directory 提供商配置
+type LDAPConfig struct {
+	URL           string `json:"url"`             // ldap://host:389 或 ldaps://host:636
+	StartTLS      bool   `json:"start_tls"`       // ldap:// 连接后升级 TLS
+	SkipTLSVerify bool   `json:"skip_tls_verify"` // 跳过证书校验（自签名证书）
+	BindDN        string `json:"bind_dn"`         // 查询用的服务账号，空则匿名查询
+	BindPassword  string `json:"bind_password"`
+	BaseDN        string `json:"base_dn"`
+	// UserFilter 用户查询过滤器，{username} 替换为转义后的登录名
+	UserFilter        string `json:"user_filter"`
+	UsernameAttribute string `json:"username_attribute"` // 本系统用户名取自该属性，AD 通常为 sAMAccountName
+	GroupAttribute    string `json:"group_attribute"`    // 用户所属组属性，默认 memberOf
+	// GroupRoles 组（完整 DN 或 CN，不区分大小写）→ 角色；命中多个时取权限最多的角色
+	GroupRoles map[string]string `json:"group_roles"`
+	// DefaultRole 未命中任何组时的角色；为空表示拒绝登录
+	DefaultRole string `json:"default_role"`
+}
+
+// LDAPIdentity 目录认证通过的用户
+type LDAPIdentity struct {
+	ProviderID int64
+	Username   string
+	DN         string
+	Groups     []string
+	Role       string
+}
+
+// LDAPConn 目录连接（*ldap.Conn 满足该接口；测试使用进程内替身）
+type LDAPConn interface {
+	Bind(username, password string) error
+	Search(req *ldap.SearchRequest) (*ldap.SearchResult, error)
+	Close() error
+}
+
+// LDAPDialer 建立目录连接（含 TLS / StartTLS）
+type LDAPDialer func(cfg LDAPConfig) (LDAPConn, error)
+
+// LDAPAuthenticator 目录认证（SSOService 实现，供 AuthService 在密码登录时调用）
+type LDAPAuthenticator interface {
+	// LDAPProviderIDs 已启用的 LDAP 提供商，按 ID 升序
+	LDAPProviderIDs() []int64
+	AuthenticateLDAP(id int64, username, password string) (*LDAPIdentity, error)
+}
+
+// LDAPSource 用户 source 字段取值
+func LDAPSource(id int64) string {
+	return fmt.Sprintf("%s:%d", repository.SSOTypeLDAP, id)
+}
+
+// ParseLDAPSource 从 source 解析 LDAP 提供商 ID
+func ParseLDAPSource(source string) (int64, bool) {
+	var id int64
+	if _, err := fmt.Sscanf(source, repository.SSOTypeLDAP+":%d", &id); err != nil {
+		return 0, false
+	}
+	return id, true
+}
+
+// ValidateLDAPConfig 校验 LDAP 提供商配置 JSON 及映射的角色（管理接口保存前调用）
+func ValidateLDAPConfig(raw string, roles RoleService) error {
+	cfg, err := parseLDAPConfig(raw)
+	if err != nil {
+		return err
+	}
+	mapped := make(map[string]string, len(cfg.GroupRoles)+1)
+	for group, role := range cfg.GroupRoles {
+		mapped["组 "+group] = role
+	}
+	if cfg.DefaultRole != "" {
+		mapped["default_role"] = cfg.DefaultRole
+	}
+	return checkRoles(roles, mapped)
+}
+
+func parseLDAPConfig(raw string) (LDAPConfig, error) {
+	var cfg LDAPConfig
+	if err := json.Unmarshal([]byte(raw), &cfg); err != nil {
+		return cfg, fmt.Errorf("invalid ldap config: %w", err)
+	}
+	if cfg.URL == "" || cfg.BaseDN == "" {
+		return cfg, errors.New("url / base_dn 不能为空")
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") {
+		return cfg, errors.New("url 须为 ldap:// 或 ldaps://")
+	}
+	if cfg.StartTLS && u.Scheme == "ldaps" {
+		return cfg, errors.New("ldaps:// 不能同时启用 start_tls")
+	}
+	if cfg.UserFilter == "" {
+		cfg.UserFilter = DefaultLDAPUserFilter
+	}
+	if !strings.Contains(cfg.UserFilter, "{username}") {
+		return cfg, errors.New("user_filter 须包含 {username}")
+	}
+	if cfg.UsernameAttribute == "" {
+		cfg.UsernameAttribute = DefaultLDAPUsernameAttribute
+	}
+	if cfg.GroupAttribute == "" {
+		cfg.GroupAttribute = DefaultLDAPGroupAttribute
+	}
+	for group, role := range cfg.GroupRoles {
+		if strings.TrimSpace(role) == "" {
+			return cfg, fmt.Errorf("组 %s 的角色不能为空", group)
+		}
+	}
+	return cfg, nil
+}
+
+// dialLDAP 默认连接实现
+func dialLDAP(cfg LDAPConfig) (LDAPConn, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	tlsCfg := &tls.Config{ServerName: u.Hostname(), InsecureSkipVerify: cfg.SkipTLSVerify}
+	conn, err := ldap.DialURL(cfg.URL, ldap.DialWithTLSConfig(tlsCfg))
+	if err != nil {
+		return nil, fmt.Errorf("connect ldap: %w", err)
+	}
+	conn.SetTimeout(ldapTimeout)
+	if cfg.StartTLS {
+		if err := conn.StartTLS(tlsCfg); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("starttls: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// authenticateLDAP 服务账号查找用户 → 以用户 DN 和密码绑定 → 按组映射角色
+func authenticateLDAP(dial LDAPDialer, roles RoleService, id int64, cfg LDAPConfig, username, password string) (*LDAPIdentity, error) {
+	// 空密码会被目录视为匿名绑定而“成功”，必须拒绝
+	if strings.TrimSpace(username) == "" || password == "" {
+		return nil, ErrLDAPInvalidCredentials
+	}
+	conn, err := dial(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if cfg.BindDN != "" {
+		if err := conn.Bind(cfg.BindDN, cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("service account bind: %w", err)
+		}
+	}
+	filter := strings.ReplaceAll(cfg.UserFilter, "{username}", ldap.EscapeFilter(username))
+	res, err := conn.Search(ldap.NewSearchRequest(
+		cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(ldapTimeout.Seconds()), false,
+		filter, []string{cfg.UsernameAttribute, cfg.GroupAttribute}, nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("search user: %w", err)
+	}
+	if len(res.Entries) == 0 {
+		return nil, ErrLDAPUserNotFound
+	}
+	if len(res.Entries) > 1 {
+		return nil, fmt.Errorf("用户 %s 在目录中匹配到多条记录", username)
+	}
+	entry := res.Entries[0]
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrLDAPInvalidCredentials
+		}
+		return nil, fmt.Errorf("user bind: %w", err)
+	}
+
+	ident := &LDAPIdentity{
+		ProviderID: id,
+		Username:   entry.GetAttributeValue(cfg.UsernameAttribute),
+		DN:         entry.DN,
+		Groups:     entry.GetAttributeValues(cfg.GroupAttribute),
+	}
+	if ident.Username == "" {
+		ident.Username = username
+	}
+	ident.Role = mapLDAPRole(roles, cfg, ident.Groups)
+	if ident.Role == "" {
+		return nil, ErrLDAPNoRole
+	}
+	return ident, nil
+}
+
+// mapLDAPRole 组 → 角色（完整 DN 或 CN 匹配，命中多个时取权限最多的角色）；未命中时使用 DefaultRole。
+// 已被删除的角色视为未命中
+func mapLDAPRole(roles RoleService, cfg LDAPConfig, groups []string) string {
+	mapping := make(map[string]string, len(cfg.GroupRoles))
+	for g, r := range cfg.GroupRoles {
+		mapping[strings.ToLower(strings.TrimSpace(g))] = r
+	}
+	var matched []string
+	for _, g := range groups {
+		for _, key := range []string{strings.ToLower(g), strings.ToLower(groupCN(g))} {
+			if r, ok := mapping[key]; ok {
+				matched = append(matched, r)
+			}
+		}
+	}
+	if role := preferRole(roles, matched); role != "" {
+		return role
+	}
+	if cfg.DefaultRole != "" && roles.Exists(cfg.DefaultRole) {
+		return cfg.DefaultRole
+	}
+	return ""
+}
+
+// groupCN 提取组 DN 的 CN；非 DN 原样返回
+func groupCN(group string) string {
+	dn, err := ldap.ParseDN(group)
+	if err != nil || len(dn.RDNs) == 0 {
+		return group
+	}
+	for _, attr := range dn.RDNs[0].Attributes {
+		if strings.EqualFold(attr.Type, "cn") {
+			return attr.Value
+		}
+	}
+	return group
+}
+
+// ---------------- SSOService 中的 LDAP 部分 ----------------
+
+// LDAPProviderIDs 已启用的 LDAP 提供商 ID
+func (s *ssoService) LDAPProviderIDs() []int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ids := make([]int64, 0, len(s.ldapSet))
+	for id := range s.ldapSet {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// AuthenticateLDAP 使用指定 LDAP 提供商认证
+func (s *ssoService) AuthenticateLDAP(id int64, username, password string) (*LDAPIdentity, error) {
+	s.mu.RLock()
+	cfg, ok := s.ldapSet[id]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, errors.New("LDAP 提供商不存在或未启用")
+	}
+	return authenticateLDAP(s.dialLDAP, s.roles, id, cfg, username, password)
+}
@@ -0,0 +1,256 @@
+package service
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"dvr-manager/internal/auth"
+	"dvr-manager/internal/repository"
+	"dvr-manager/pkg/db"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// fakeDirectory 进程内 LDAP 替身：仅支持 (uid=<value>) 形式的过滤器
+type fakeDirectory struct {
+	bindDN, bindPassword string
+	users                map[string]fakeDirUser // uid → 用户
+}
+
+type fakeDirUser struct {
+	password string
+	groups   []string
+}
+
+type fakeConn struct {
+	dir   *fakeDirectory
+	bound string
+}
+
+var uidFilter = regexp.MustCompile(`\(uid=([^)]*)\)`)
+
+func (d *fakeDirectory) dial(LDAPConfig) (LDAPConn, error) { return &fakeConn{dir: d}, nil }
+
+func (c *fakeConn) Bind(dn, password string) error {
+	if dn == c.dir.bindDN && password == c.dir.bindPassword {
+		c.bound = dn
+		return nil
+	}
+	for uid, u := range c.dir.users {
+		if dn == "uid="+uid+",ou=people,dc=example,dc=org" && password == u.password {
+			c.bound = dn
+			return nil
+		}
+	}
+	return ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+}
+
+func (c *fakeConn) Search(req *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	if c.bound != c.dir.bindDN {
+		return nil, ldap.NewError(ldap.LDAPResultInsufficientAccessRights, errors.New("not bound"))
+	}
+	res := &ldap.SearchResult{}
+	m := uidFilter.FindStringSubmatch(req.Filter)
+	if m == nil {
+		return res, nil
+	}
+	if u, ok := c.dir.users[m[1]]; ok {
+		res.Entries = append(res.Entries, ldap.NewEntry("uid="+m[1]+",ou=people,dc=example,dc=org", map[string][]string{
+			"uid":      {m[1]},
+			"memberOf": u.groups,
+		}))
+	}
+	return res, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func TestMapLDAPRole(t *testing.T) {
+	if err := db.InitDB(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	roles := NewRoleService(repository.NewRoleRepository())
+
+	cfg := LDAPConfig{GroupRoles: map[string]string{
+		"cn=DVR-Admins,ou=groups,dc=example,dc=org": "admin",
+		"dvr-users":   "user",
+		"dvr-ops":     RoleOperator,
+		"dvr-viewers": RoleViewer,
+		"dvr-legacy":  "retired",
+	}}
+	cases := []struct {
+		groups []string
+		want   string
+	}{
+		{[]string{"cn=dvr-users,ou=groups,dc=example,dc=org"}, "user"},
+		{[]string{"cn=dvr-users,ou=groups,dc=example,dc=org", "CN=dvr-admins,OU=groups,DC=example,DC=org"}, "admin"},
+		// 与角色名无关：取权限最多的角色
+		{[]string{"cn=dvr-viewers,dc=example,dc=org", "cn=dvr-ops,dc=example,dc=org"}, RoleOperator},
+		// 已不存在的角色视为未命中
+		{[]string{"cn=dvr-legacy,dc=example,dc=org", "cn=dvr-viewers,dc=example,dc=org"}, RoleViewer},
+		{[]string{"cn=other,dc=example,dc=org"}, ""},
+	}
+	for _, tc := range cases {
+		if got := mapLDAPRole(roles, cfg, tc.groups); got != tc.want {
+			t.Errorf("mapLDAPRole(%v) = %q, want %q", tc.groups, got, tc.want)
+		}
+	}
+	cfg.DefaultRole = "user"
+	if got := mapLDAPRole(roles, cfg, nil); got != "user" {
+		t.Errorf("default role = %q", got)
+	}
+
+	raw := `{"url":"ldap://dir.example.org","base_dn":"dc=example,dc=org","group_roles":{"dvr-ops":"operator"},"default_role":"viewer"}`
+	if err := ValidateLDAPConfig(raw, roles); err != nil {
+		t.Fatal(err)
+	}
+	raw = `{"url":"ldap://dir.example.org","base_dn":"dc=example,dc=org","group_roles":{"dvr-ops":"night-shift"}}`
+	if err := ValidateLDAPConfig(raw, roles); err == nil || !strings.Contains(err.Error(), "night-shift") {
+		t.Fatalf("expected unknown role to be rejected, got %v", err)
+	}
+}
+
+func TestAuthService_ldapLogin(t *testing.T) {
+	if err := db.InitDB(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	dir := &fakeDirectory{
+		bindDN: "cn=svc,dc=example,dc=org", bindPassword: "svc-pass",
+		users: map[string]fakeDirUser{
+			"carol":   {password: "carol-pass", groups: []string{"cn=dvr-users,ou=groups,dc=example,dc=org"}},
+			"mallory": {password: "m-pass", groups: []string{"cn=contractors,ou=groups,dc=example,dc=org"}},
+		},
+	}
+	ssoRepo := repository.NewSSORepository()
+	p, err := ssoRepo.Create(&repository.SSOProvider{
+		Type: repository.SSOTypeLDAP, Name: "corp", Enabled: true,
+		ConfigJSON: `{"url":"ldap://dir.example.org","base_dn":"dc=example,dc=org","bind_dn":"cn=svc,dc=example,dc=org","bind_password":"svc-pass",` +
+			`"user_filter":"(uid={username})","group_roles":{"dvr-users":"user","dvr-admins":"admin"}}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sso := newTestSSOService(t, ssoRepo)
+	sso.dialLDAP = dir.dial
+	users := repository.NewUserRepository()
+	svc := NewAuthService(users, repository.NewIdentityRepository(), nil, nil, nil, sso)
+
+	// 首次登录：自动创建目录用户
+	u, err := svc.Authenticate("carol", "carol-pass", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Role != "user" || u.Source != LDAPSource(p.ID) {
+		t.Fatalf("unexpected user %+v", u)
+	}
+	if _, err := svc.Authenticate("carol", "wrong", ""); err == nil {
+		t.Fatal("expected wrong password to be rejected")
+	}
+	if _, err := svc.Authenticate("carol", "", ""); err == nil {
+		t.Fatal("expected empty password to be rejected")
+	}
+	// 过滤器注入不应匹配到其他用户
+	if _, err := svc.Authenticate("*)(uid=carol", "carol-pass", ""); err == nil {
+		t.Fatal("expected filter injection to fail")
+	}
+	// 不属于任何映射组且未配置默认角色
+	if _, err := svc.Authenticate("mallory", "m-pass", ""); !errors.Is(err, ErrLDAPNoRole) {
+		t.Fatalf("expected ErrLDAPNoRole, got %v", err)
+	}
+
+	// 组变化后再次登录同步角色
+	dir.users["carol"] = fakeDirUser{password: "carol-pass", groups: []string{"cn=dvr-admins,ou=groups,dc=example,dc=org"}}
+	if u, err = svc.Authenticate("carol", "carol-pass", ""); err != nil || u.Role != "admin" {
+		t.Fatalf("role not synced: %+v %v", u, err)
+	}
+	if err := svc.ChangePassword("carol", "carol-pass", "Another-Pass-9"); err == nil || !strings.Contains(err.Error(), "身份源") {
+		t.Fatalf("expected directory user password change to be refused, got %v", err)
+	}
+
+	// 本地用户不受影响
+	if _, err := svc.CreateUser("dave", "Orange-Kite-1", "user"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Authenticate("dave", "Orange-Kite-1", ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// LDAP 账号的密码由本系统校验，强制二次验证的角色须能完成绑定，否则无法登录
+func TestAuthService_ldapLoginMFARequired(t *testing.T) {
+	if err := db.InitDB(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	t.Setenv("MFA_REQUIRED_ROLES", "admin")
+
+	dir := &fakeDirectory{
+		bindDN: "cn=svc,dc=example,dc=org", bindPassword: "svc-pass",
+		users: map[string]fakeDirUser{
+			"erin": {password: "erin-pass", groups: []string{"cn=dvr-admins,ou=groups,dc=example,dc=org"}},
+		},
+	}
+	ssoRepo := repository.NewSSORepository()
+	if _, err := ssoRepo.Create(&repository.SSOProvider{
+		Type: repository.SSOTypeLDAP, Name: "corp", Enabled: true,
+		ConfigJSON: `{"url":"ldap://dir.example.org","base_dn":"dc=example,dc=org","bind_dn":"cn=svc,dc=example,dc=org","bind_password":"svc-pass",` +
+			`"user_filter":"(uid={username})","group_roles":{"dvr-admins":"admin"}}`,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	sso := newTestSSOService(t, ssoRepo)
+	sso.dialLDAP = dir.dial
+	users := repository.NewUserRepository()
+	svc := NewAuthService(users, repository.NewIdentityRepository(), nil, nil, nil, sso)
+	mfa := NewMFAService(repository.NewMFARepository(), users, newTestJWT(t))
+
+	u, err := svc.Authenticate("erin", "erin-pass", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.MFAEnabled || !mfa.Required(u) {
+		t.Fatalf("expected enrolment to be required: %+v", u)
+	}
+	// 登录时的绑定流程：挑战令牌 → 生成密钥 → 验证码确认
+	token, err := mfa.Challenge(u, auth.PurposeMFAEnroll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err = mfa.ParseChallenge(token, auth.PurposeMFAEnroll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setup, err := mfa.Setup(u)
+	if err != nil {
+		t.Fatalf("ldap admin must be able to enrol: %v", err)
+	}
+	code, _ := auth.TOTPCode(setup.Secret, auth.TOTPStep(time.Now()))
+	if _, err := mfa.Activate(u, code); err != nil {
+		t.Fatal(err)
+	}
+
+	// 再次登录进入两步验证
+	if u, err = svc.Authenticate("erin", "erin-pass", ""); err != nil || !u.MFAEnabled {
+		t.Fatalf("expected mfa enabled after enrolment: %+v %v", u, err)
+	}
+
+	// OIDC / SAML 账号仍由身份提供商负责
+	if _, err := mfa.Setup(&User{ID: u.ID, Username: "sso", Source: "oidc:1"}); !errors.Is(err, ErrMFALocalOnly) {
+		t.Fatalf("expected ErrMFALocalOnly for oidc account, got %v", err)
+	}
+}
+
+func newTestSSOService(t *testing.T, repo repository.SSORepository) *ssoService {
+	t.Helper()
+	svc, err := NewSSOService(repo, NewRoleService(repository.NewRoleRepository()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return svc.(*ssoService)
+}
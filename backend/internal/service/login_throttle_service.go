@@ -0,0 +1,219 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"dvr-manager/internal/repository"
+)
+
+// 登录限流默认值
+const (
+	DefaultLoginMaxFailures   = 5
+	DefaultLoginIPMaxFailures = 20
+	DefaultLoginLockout       = 15 * time.Minute
+	DefaultLoginFailureWindow = time.Hour
+	loginBackoffBase          = time.Second
+)
+
+// ErrLoginThrottled 登录尝试过于频繁或账号已临时锁定
+var ErrLoginThrottled = errors.New("登录失败次数过多，请稍后再试")
+
+// LoginPolicy 登录限流策略。
+// 连续失败 n 次后须等待 base·2^(n-2)（第 1 次失败不等待），达到上限后锁定 Lockout；
+// 距最近一次失败超过 Window 的计数清零。
+type LoginPolicy struct {
+	MaxFailures   int           // 单个用户名失败上限（LOGIN_MAX_FAILURES）
+	IPMaxFailures int           // 单个 IP 失败上限（LOGIN_IP_MAX_FAILURES）
+	Lockout       time.Duration // 锁定时长（LOGIN_LOCKOUT）
+	Window        time.Duration // 失败计数窗口（LOGIN_FAILURE_WINDOW）
+}
+
+// LoginPolicyFromEnv 读取登录限流配置，非法值使用默认值
+func LoginPolicyFromEnv() LoginPolicy {
+	return LoginPolicy{
+		MaxFailures:   intEnv("LOGIN_MAX_FAILURES", DefaultLoginMaxFailures),
+		IPMaxFailures: intEnv("LOGIN_IP_MAX_FAILURES", DefaultLoginIPMaxFailures),
+		Lockout:       durationEnv("LOGIN_LOCKOUT", DefaultLoginLockout),
+		Window:        durationEnv("LOGIN_FAILURE_WINDOW", DefaultLoginFailureWindow),
+	}
+}
+
+func intEnv(key string, def int) int {
+	s := strings.TrimSpace(os.Getenv(key))
+	if s == "" {
+		return def
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		log.Printf("[AUTH] invalid %s=%q, using default %d", key, s, def)
+		return def
+	}
+	return n
+}
+
+func durationEnv(key string, def time.Duration) time.Duration {
+	s := strings.TrimSpace(os.Getenv(key))
+	if s == "" {
+		return def
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		log.Printf("[AUTH] invalid %s=%q, using default %s", key, s, def)
+		return def
+	}
+	return d
+}
+
+// delay 连续失败 failures 次后的等待时长
+func (p LoginPolicy) delay(failures, max int) time.Duration {
+	if failures >= max {
+		return p.Lockout
+	}
+	if failures < 2 {
+		return 0
+	}
+	d := loginBackoffBase << uint(failures-2)
+	if d > p.Lockout {
+		d = p.Lockout
+	}
+	return d
+}
+
+// LoginThrottleService 登录限流：按用户名与客户端 IP 分别计数
+type LoginThrottleService interface {
+	// Check 登录前检查，受限时返回 ErrLoginThrottled 与剩余等待时长
+	Check(username, ip string) (time.Duration, error)
+	// Fail 记录一次失败；locked 表示本次失败使该用户名进入锁定
+	Fail(username, ip string) (locked bool, err error)
+	// Succeed 登录成功，清除该用户名的失败计数
+	Succeed(username string) error
+	// Unlock 管理员解锁用户名
+	Unlock(username string) error
+	// LockedUsers 锁定中的用户名（小写）及锁定截止时间
+	LockedUsers() (map[string]time.Time, error)
+}
+
+type loginThrottleService struct {
+	repo   repository.LoginAttemptRepository
+	policy LoginPolicy
+	now    func() time.Time
+	mu     sync.Mutex
+}
+
+// NewLoginThrottleService 创建登录限流服务
+func NewLoginThrottleService(repo repository.LoginAttemptRepository, policy LoginPolicy) LoginThrottleService {
+	return &loginThrottleService{repo: repo, policy: policy, now: time.Now}
+}
+
+func normalizeLoginSubject(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// blockedFor 记录对应的剩余等待时长
+func (s *loginThrottleService) blockedFor(a *repository.LoginAttempt, max int, now time.Time) time.Duration {
+	if a == nil {
+		return 0
+	}
+	if a.LockedUntil != nil && a.LockedUntil.After(now) {
+		return a.LockedUntil.Sub(now)
+	}
+	if now.Sub(a.LastFailureAt) > s.policy.Window {
+		return 0
+	}
+	if d := a.LastFailureAt.Add(s.policy.delay(a.Failures, max)).Sub(now); d > 0 {
+		return d
+	}
+	return 0
+}
+
+func (s *loginThrottleService) Check(username, ip string) (time.Duration, error) {
+	now := s.now()
+	var wait time.Duration
+	checks := []struct {
+		scope, subject string
+		max            int
+	}{
+		{repository.LoginScopeUser, normalizeLoginSubject(username), s.policy.MaxFailures},
+		{repository.LoginScopeIP, ip, s.policy.IPMaxFailures},
+	}
+	for _, c := range checks {
+		if c.subject == "" {
+			continue
+		}
+		a, err := s.repo.Get(c.scope, c.subject)
+		if err != nil {
+			return 0, err
+		}
+		if d := s.blockedFor(a, c.max, now); d > wait {
+			wait = d
+		}
+	}
+	if wait > 0 {
+		return wait, ErrLoginThrottled
+	}
+	return 0, nil
+}
+
+func (s *loginThrottleService) Fail(username, ip string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	locked, err := s.record(repository.LoginScopeUser, normalizeLoginSubject(username), s.policy.MaxFailures, now)
+	if err != nil {
+		return false, err
+	}
+	if _, err := s.record(repository.LoginScopeIP, ip, s.policy.IPMaxFailures, now); err != nil {
+		return locked, err
+	}
+	return locked, nil
+}
+
+// record 失败计数 +1，达到上限时写入锁定截止时间；返回是否刚进入锁定
+func (s *loginThrottleService) record(scope, subject string, max int, now time.Time) (bool, error) {
+	if subject == "" {
+		return false, nil
+	}
+	a, err := s.repo.Get(scope, subject)
+	if err != nil {
+		return false, err
+	}
+	wasLocked := a != nil && a.LockedUntil != nil && a.LockedUntil.After(now)
+	if a == nil || (!wasLocked && now.Sub(a.LastFailureAt) > s.policy.Window) {
+		a = &repository.LoginAttempt{Scope: scope, Subject: subject}
+	}
+	a.Failures++
+	a.LastFailureAt = now
+	locked := false
+	if a.Failures >= max {
+		until := now.Add(s.policy.Lockout)
+		a.LockedUntil = &until
+		locked = !wasLocked
+	}
+	return locked, s.repo.Save(a)
+}
+
+func (s *loginThrottleService) Succeed(username string) error {
+	return s.repo.Reset(repository.LoginScopeUser, normalizeLoginSubject(username))
+}
+
+func (s *loginThrottleService) Unlock(username string) error {
+	return s.repo.Reset(repository.LoginScopeUser, normalizeLoginSubject(username))
+}
+
+func (s *loginThrottleService) LockedUsers() (map[string]time.Time, error) {
+	list, err := s.repo.ListLocked(repository.LoginScopeUser, s.now())
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]time.Time, len(list))
+	for _, a := range list {
+		out[a.Subject] = *a.LockedUntil
+	}
+	return out, nil
+}
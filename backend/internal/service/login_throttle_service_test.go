@@ -0,0 +1,60 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"dvr-manager/internal/repository"
+	"dvr-manager/pkg/db"
+)
+
+func TestLoginThrottle_backoffLockoutAndUnlock(t *testing.T) {
+	dir := t.TempDir()
+	if err := db.InitDB(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	policy := LoginPolicy{MaxFailures: 3, IPMaxFailures: 100, Lockout: 10 * time.Minute, Window: time.Hour}
+	svc := NewLoginThrottleService(repository.NewLoginAttemptRepository(), policy).(*loginThrottleService)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return now }
+
+	// 第 1 次失败不等待
+	if locked, err := svc.Fail("Admin", "10.0.0.1"); err != nil || locked {
+		t.Fatalf("fail 1: locked=%v err=%v", locked, err)
+	}
+	if _, err := svc.Check("admin", "10.0.0.1"); err != nil {
+		t.Fatalf("check after 1 failure: %v", err)
+	}
+
+	// 第 2 次失败后须等待 1s
+	if _, err := svc.Fail("admin", "10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if wait, err := svc.Check("admin", "10.0.0.2"); !errors.Is(err, ErrLoginThrottled) || wait != time.Second {
+		t.Fatalf("backoff: wait=%s err=%v", wait, err)
+	}
+	now = now.Add(2 * time.Second)
+
+	// 第 3 次失败锁定
+	if locked, err := svc.Fail("admin", "10.0.0.1"); err != nil || !locked {
+		t.Fatalf("fail 3: locked=%v err=%v", locked, err)
+	}
+	now = now.Add(time.Minute)
+	if wait, err := svc.Check("admin", "10.0.0.3"); !errors.Is(err, ErrLoginThrottled) || wait != 9*time.Minute {
+		t.Fatalf("lockout: wait=%s err=%v", wait, err)
+	}
+	locked, err := svc.LockedUsers()
+	if err != nil || len(locked) != 1 {
+		t.Fatalf("locked users=%v err=%v", locked, err)
+	}
+
+	if err := svc.Unlock("ADMIN"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Check("admin", "10.0.0.3"); err != nil {
+		t.Fatalf("check after unlock: %v", err)
+	}
+}
@@ -0,0 +1,319 @@
+package service
+
+import (
+	"crypto/rand"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"dvr-manager/internal/auth"
+	"dvr-manager/internal/repository"
+)
+
+const (
+	// mfaChallengeTTL 密码验证通过后完成二次验证的时限
+	mfaChallengeTTL = 5 * time.Minute
+	// recoveryCodeCount 每次生成的恢复码数量
+	recoveryCodeCount = 10
+	defaultMFAIssuer  = "DVR Manager"
+)
+
+var (
+	// ErrMFACodeInvalid 验证码或恢复码错误
+	ErrMFACodeInvalid = errors.New("验证码错误")
+	// ErrMFAChallengeInvalid 二次验证挑战令牌无效或已过期
+	ErrMFAChallengeInvalid = errors.New("二次验证已过期，请重新登录")
+	// ErrMFAAlreadyEnabled 已启用二次验证
+	ErrMFAAlreadyEnabled = errors.New("已启用二次验证")
+	// ErrMFANotEnabled 未启用二次验证
+	ErrMFANotEnabled = errors.New("未启用二次验证")
+	// ErrMFANotSetup 尚未生成密钥
+	ErrMFANotSetup = errors.New("请先生成二次验证密钥")
+	// ErrMFARequired 当前角色强制二次验证，不能关闭
+	ErrMFARequired = errors.New("当前角色必须启用二次验证")
+	// ErrMFALocalOnly 仅本地与 LDAP 账号支持二次验证（OIDC / SAML 账号由身份提供商负责）
+	ErrMFALocalOnly = errors.New("仅本地与 LDAP 账号支持二次验证")
+)
+
+// MFASetup 绑定信息：secret 供手动输入，otpauth_uri 供生成二维码
+type MFASetup struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+// MFAStatus 当前用户二次验证状态
+type MFAStatus struct {
+	Enabled                bool `json:"enabled"`
+	Required               bool `json:"required"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+}
+
+// MFAService TOTP 二次验证（本地与 LDAP 账号，密码均由本系统校验）
+type MFAService interface {
+	// Required 用户的任一有效角色（自身角色与所在组授予的角色）是否强制二次验证（MFA_REQUIRED_ROLES）
+	Required(user *User) bool
+	Status(user *User) (*MFAStatus, error)
+	// Setup 生成待确认密钥；已启用时返回 ErrMFAAlreadyEnabled
+	Setup(user *User) (*MFASetup, error)
+	// Activate 用验证码确认密钥并启用，返回仅此一次可见的恢复码
+	Activate(user *User, code string) ([]string, error)
+	// Verify 校验 TOTP 验证码或恢复码；usedRecovery 表示消耗了恢复码
+	Verify(user *User, code string) (usedRecovery bool, err error)
+	// Disable 用户自行关闭（需验证码）；强制角色不可关闭
+	Disable(user *User, code string) error
+	// RegenerateRecoveryCodes 重新生成恢复码（需验证码），旧恢复码全部作废
+	RegenerateRecoveryCodes(user *User, code string) ([]string, error)
+	// Reset 管理员重置：清除密钥与恢复码
+	Reset(userID int64) error
+
+	// Challenge 签发二次验证挑战令牌（purpose 为 auth.PurposeMFA / auth.PurposeMFAEnroll）
+	Challenge(user *User, purpose string) (string, error)
+	// ParseChallenge 校验挑战令牌并返回当前用户
+	ParseChallenge(token, purpose string) (*User, error)
+}
+
+type mfaService struct {
+	repo     repository.MFARepository
+	userRepo repository.UserRepository
+	jwt      *auth.JWT
+}
+
+// NewMFAService 创建二次验证服务
+func NewMFAService(repo repository.MFARepository, userRepo repository.UserRepository, jwt *auth.JWT) MFAService {
+	return &mfaService{repo: repo, userRepo: userRepo, jwt: jwt}
+}
+
+// MFARequiredRoles 强制二次验证的角色（MFA_REQUIRED_ROLES，逗号分隔，如 admin）
+func MFARequiredRoles() []string {
+	var roles []string
+	for _, r := range strings.Split(os.Getenv("MFA_REQUIRED_ROLES"), ",") {
+		if r = strings.ToLower(strings.TrimSpace(r)); r != "" {
+			roles = append(roles, r)
+		}
+	}
+	return roles
+}
+
+func mfaIssuer() string {
+	if v := strings.TrimSpace(os.Getenv("MFA_ISSUER")); v != "" {
+		return v
+	}
+	return defaultMFAIssuer
+}
+
+// Required 任一有效角色在 MFA_REQUIRED_ROLES 中即强制
+func (s *mfaService) Required(user *User) bool {
+	required := MFARequiredRoles()
+	for _, role := range user.Roles() {
+		role = strings.ToLower(role)
+		for _, r := range required {
+			if r == role {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Status 查询状态
+func (s *mfaService) Status(user *User) (*MFAStatus, error) {
+	st, err := s.repo.Get(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	out := &MFAStatus{Enabled: st.Enabled, Required: s.Required(user)}
+	if st.Enabled {
+		if out.RecoveryCodesRemaining, err = s.repo.CountRecoveryCodes(user.ID); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// mfaSupported 本地与 LDAP 账号由本系统校验密码，可绑定 TOTP；OIDC / SAML 账号在身份提供商处完成多因素认证
+func mfaSupported(user *User) bool {
+	if user.Source == "" || user.Source == "local" {
+		return true
+	}
+	_, ok := ParseLDAPSource(user.Source)
+	return ok
+}
+
+// Setup 生成密钥
+func (s *mfaService) Setup(user *User) (*MFASetup, error) {
+	if !mfaSupported(user) {
+		return nil, ErrMFALocalOnly
+	}
+	st, err := s.repo.Get(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if st.Enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.SetPendingSecret(user.ID, secret); err != nil {
+		return nil, err
+	}
+	return &MFASetup{Secret: secret, OTPAuthURI: auth.TOTPURI(mfaIssuer(), user.Username, secret)}, nil
+}
+
+// Activate 确认并启用
+func (s *mfaService) Activate(user *User, code string) ([]string, error) {
+	st, err := s.repo.Get(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if st.Enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if st.Secret == "" {
+		return nil, ErrMFANotSetup
+	}
+	if err := s.checkTOTP(st, code); err != nil {
+		return nil, err
+	}
+	codes, err := s.newRecoveryCodes(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Enable(user.ID); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Verify 校验验证码或恢复码
+func (s *mfaService) Verify(user *User, code string) (bool, error) {
+	st, err := s.repo.Get(user.ID)
+	if err != nil {
+		return false, err
+	}
+	if !st.Enabled {
+		return false, ErrMFANotEnabled
+	}
+	code = strings.TrimSpace(code)
+	if len(code) == auth.TOTPDigits {
+		return false, s.checkTOTP(st, code)
+	}
+	ok, err := s.repo.UseRecoveryCode(user.ID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		return false, ErrMFACodeInvalid
+	}
+	return true, nil
+}
+
+// Disable 自行关闭
+func (s *mfaService) Disable(user *User, code string) error {
+	if s.Required(user) {
+		return ErrMFARequired
+	}
+	if _, err := s.Verify(user, code); err != nil {
+		return err
+	}
+	return s.repo.Disable(user.ID)
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码
+func (s *mfaService) RegenerateRecoveryCodes(user *User, code string) ([]string, error) {
+	if _, err := s.Verify(user, code); err != nil {
+		return nil, err
+	}
+	return s.newRecoveryCodes(user.ID)
+}
+
+// Reset 管理员重置
+func (s *mfaService) Reset(userID int64) error {
+	if _, err := s.repo.Get(userID); err != nil {
+		return err
+	}
+	return s.repo.Disable(userID)
+}
+
+// checkTOTP 校验验证码并记录时间步，同一验证码不能使用两次
+func (s *mfaService) checkTOTP(st *repository.MFAState, code string) error {
+	step, ok := auth.ValidateTOTP(st.Secret, code, time.Now())
+	if !ok || step <= st.LastStep {
+		return ErrMFACodeInvalid
+	}
+	consumed, err := s.repo.ConsumeStep(st.UserID, step)
+	if err != nil {
+		return err
+	}
+	if !consumed {
+		return ErrMFACodeInvalid
+	}
+	return nil
+}
+
+// recoveryAlphabet Crockford base32 小写字母表（不含 i/l/o/u，32 个字符，取模无偏差）
+const recoveryAlphabet = "0123456789abcdefghjkmnpqrstvwxyz"
+
+func (s *mfaService) newRecoveryCodes(userID int64) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	buf := make([]byte, 10)
+	for i := 0; i < recoveryCodeCount; i++ {
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		var b strings.Builder
+		for j, c := range buf {
+			if j == 5 {
+				b.WriteByte('-')
+			}
+			b.WriteByte(recoveryAlphabet[c&31])
+		}
+		code := b.String()
+		codes = append(codes, code)
+		hashes = append(hashes, hashToken(normalizeRecoveryCode(code)))
+	}
+	if err := s.repo.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
+
+// Challenge 签发挑战令牌（不含 sid，不能作为访问令牌）
+func (s *mfaService) Challenge(user *User, purpose string) (string, error) {
+	claims := auth.Claims{Username: user.Username, Role: user.Role, Purpose: purpose}
+	claims.Subject = strconv.FormatInt(user.ID, 10)
+	return s.jwt.Generate(claims, mfaChallengeTTL)
+}
+
+// ParseChallenge 校验挑战令牌
+func (s *mfaService) ParseChallenge(token, purpose string) (*User, error) {
+	claims, err := s.jwt.Verify(token)
+	if err != nil || claims.Purpose != purpose {
+		return nil, ErrMFAChallengeInvalid
+	}
+	id, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		return nil, ErrMFAChallengeInvalid
+	}
+	u, err := s.userRepo.GetByID(id)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, ErrMFAChallengeInvalid
+		}
+		return nil, err
+	}
+	if u.Username != claims.Username {
+		return nil, ErrMFAChallengeInvalid
+	}
+	return toUser(u), nil
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"dvr-manager/internal/auth"
+	"dvr-manager/internal/repository"
+	"dvr-manager/pkg/db"
+)
+
+func TestMFAService_enrollVerifyAndRecovery(t *testing.T) {
+	dir := t.TempDir()
+	if err := db.InitDB(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	jwt := newTestJWT(t)
+	userRepo := repository.NewUserRepository()
+	u, err := userRepo.Create("carol", "x", "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := toUser(u)
+	svc := NewMFAService(repository.NewMFARepository(), userRepo, jwt)
+
+	setup, err := svc.Setup(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := auth.TOTPCode(setup.Secret, auth.TOTPStep(time.Now()))
+	recovery, err := svc.Activate(user, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recovery) != recoveryCodeCount {
+		t.Fatalf("recovery codes=%d", len(recovery))
+	}
+
+	// 同一时间步的验证码不能重放
+	if _, err := svc.Verify(user, code); !errors.Is(err, ErrMFACodeInvalid) {
+		t.Fatalf("replayed code err=%v want ErrMFACodeInvalid", err)
+	}
+	// 恢复码一次性使用（大小写、分隔符不敏感）
+	if used, err := svc.Verify(user, "  "+recovery[0]+" "); err != nil || !used {
+		t.Fatalf("recovery code used=%v err=%v", used, err)
+	}
+	if _, err := svc.Verify(user, recovery[0]); !errors.Is(err, ErrMFACodeInvalid) {
+		t.Fatalf("reused recovery code err=%v", err)
+	}
+
+	// 挑战令牌只能用于对应用途，且不能作为访问令牌
+	token, err := svc.Challenge(user, auth.PurposeMFA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := svc.ParseChallenge(token, auth.PurposeMFA); err != nil || got.ID != user.ID {
+		t.Fatalf("parse challenge user=%+v err=%v", got, err)
+	}
+	if _, err := svc.ParseChallenge(token, auth.PurposeMFAEnroll); !errors.Is(err, ErrMFAChallengeInvalid) {
+		t.Fatalf("wrong purpose err=%v", err)
+	}
+	claims, _ := jwt.Verify(token)
+	sessions := NewSessionService(repository.NewSessionRepository(), repository.NewRefreshTokenRepository(), userRepo)
+	if _, err := sessions.Validate(claims); !errors.Is(err, ErrSessionInvalid) {
+		t.Fatalf("challenge accepted as access token: %v", err)
+	}
+
+	if err := svc.Reset(user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if st, _ := svc.Status(user); st.Enabled {
+		t.Fatal("mfa still enabled after reset")
+	}
+}
+
+// 强制二次验证按全部有效角色判断：用户组授予的角色同样生效
+func TestMFAService_requiredByGroupRole(t *testing.T) {
+	if err := db.InitDB(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	t.Setenv("MFA_REQUIRED_ROLES", "admin")
+
+	userRepo := repository.NewUserRepository()
+	u, err := userRepo.Create("frank", "x", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := toUser(u)
+	svc := NewMFAService(repository.NewMFARepository(), userRepo, newTestJWT(t))
+	if svc.Required(user) {
+		t.Fatal("plain user must not be required")
+	}
+
+	user.Groups = []repository.UserGroup{{Name: "ops-admins", Role: "admin"}}
+	if !svc.Required(user) {
+		t.Fatal("admin role granted by group must require mfa")
+	}
+	if st, err := svc.Status(user); err != nil || !st.Required {
+		t.Fatalf("status=%+v err=%v", st, err)
+	}
+	if err := svc.Disable(user, "000000"); !errors.Is(err, ErrMFARequired) {
+		t.Fatalf("disable err=%v want ErrMFARequired", err)
+	}
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// oidcFlowTTL 登录跳转到回调的最长时间（与 Cookie 有效期一致）
+const oidcFlowTTL = 10 * time.Minute
+
+// ErrOIDCFlowInvalid 登录流程 Cookie 缺失、过期、被篡改或 state 不匹配
+var ErrOIDCFlowInvalid = errors.New("登录状态无效或已过期，请重新登录")
+
+// oidcFlow 一次 OIDC 授权码流程的浏览器侧状态（加密后存于 Cookie）
+type oidcFlow struct {
+	ProviderID int64  `json:"p"`
+	State      string `json:"s"`
+	Verifier   string `json:"v"` // PKCE code_verifier
+	Nonce      string `json:"n"`
+	Expires    int64  `json:"e"`
+}
+
+// sealFlow 加密流程状态（见 sealCookie）
+func sealFlow(key []byte, f *oidcFlow) (string, error) {
+	return sealCookie(key, f.ProviderID, f)
+}
+
+// openFlow 解密并校验提供商、有效期
+func openFlow(key []byte, providerID int64, value string, now time.Time) (*oidcFlow, error) {
+	var f oidcFlow
+	if !openCookie(key, providerID, value, &f) || f.ProviderID != providerID {
+		return nil, ErrOIDCFlowInvalid
+	}
+	if now.Unix() > f.Expires {
+		return nil, ErrOIDCFlowInvalid
+	}
+	return &f, nil
+}
+
+// checkFlowState 回调中的 state 须与 Cookie 中的一致
+func checkFlowState(f *oidcFlow, state string) error {
+	if state == "" || subtle.ConstantTimeCompare([]byte(f.State), []byte(state)) != 1 {
+		return ErrOIDCFlowInvalid
+	}
+	return nil
+}
+
+// postLogoutRedirect 默认登出后回到 redirect_url 同源的登录页
+func postLogoutRedirect(cfg OIDCConfig) string {
+	if cfg.PostLogoutRedirectURL != "" {
+		return cfg.PostLogoutRedirectURL
+	}
+	u, err := url.Parse(cfg.RedirectURL)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s://%s/login", u.Scheme, u.Host)
+}
+
+// buildEndSessionURL RP-Initiated Logout 1.0 的登出地址
+func buildEndSessionURL(endpoint, clientID, idTokenHint, redirect string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("client_id", clientID)
+	if idTokenHint != "" {
+		q.Set("id_token_hint", idTokenHint)
+	}
+	if redirect != "" {
+		q.Set("post_logout_redirect_uri", redirect)
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"dvr-manager/internal/repository"
+	"dvr-manager/pkg/db"
+)
+
+func TestOIDCFlow_sealOpen(t *testing.T) {
+	key := make([]byte, 32)
+	now := time.Now()
+	f := &oidcFlow{ProviderID: 7, State: "st", Verifier: "ver", Nonce: "nn", Expires: now.Add(oidcFlowTTL).Unix()}
+	sealed, err := sealFlow(key, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := openFlow(key, 7, sealed, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != *f {
+		t.Fatalf("round trip mismatch: %+v", got)
+	}
+	if err := checkFlowState(got, "st"); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkFlowState(got, "other"); err != ErrOIDCFlowInvalid {
+		t.Fatalf("state mismatch: got %v", err)
+	}
+
+	// 挪用到其他提供商、过期、篡改均失败
+	if _, err := openFlow(key, 8, sealed, now); err != ErrOIDCFlowInvalid {
+		t.Fatalf("other provider: got %v", err)
+	}
+	if _, err := openFlow(key, 7, sealed, now.Add(oidcFlowTTL+time.Second)); err != ErrOIDCFlowInvalid {
+		t.Fatalf("expired: got %v", err)
+	}
+	tampered := []byte(sealed)
+	if tampered[0] == 'A' {
+		tampered[0] = 'B'
+	} else {
+		tampered[0] = 'A'
+	}
+	if _, err := openFlow(key, 7, string(tampered), now); err != ErrOIDCFlowInvalid {
+		t.Fatalf("tampered: got %v", err)
+	}
+}
+
+func TestBuildEndSessionURL(t *testing.T) {
+	cfg := OIDCConfig{ClientID: "dvr", RedirectURL: "https://dvr.test/api/sso/oidc/1/callback"}
+	raw, err := buildEndSessionURL("https://idp.test/logout?x=1", cfg.ClientID, "tok", postLogoutRedirect(cfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(raw)
+	q := u.Query()
+	if q.Get("x") != "1" || q.Get("client_id") != "dvr" || q.Get("id_token_hint") != "tok" ||
+		q.Get("post_logout_redirect_uri") != "https://dvr.test/login" {
+		t.Fatalf("unexpected logout url %s", raw)
+	}
+}
+
+func TestSSOService_flowKeyPersisted(t *testing.T) {
+	if err := db.InitDB(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	repo := repository.NewSSORepository()
+	first := newTestSSOService(t, repo)
+	f := &oidcFlow{ProviderID: 3, State: "st", Expires: time.Now().Add(oidcFlowTTL).Unix()}
+	sealed, err := sealFlow(first.flowKey, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 重启或另一实例读取同一把密钥，仍能打开之前下发的 Cookie
+	second := newTestSSOService(t, repo)
+	if _, err := openFlow(second.flowKey, 3, sealed, time.Now()); err != nil {
+		t.Fatalf("flow cookie from previous instance: %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"dvr-manager/internal/repository"
+)
+
+// OIDC 角色规则运算符
+const (
+	RoleRuleEquals   = "equals"   // Claim 值（或数组中任一元素）等于 Value
+	RoleRuleContains = "contains" // 数组包含 Value；字符串包含子串 Value
+	RoleRuleMatches  = "matches"  // Claim 值（或数组中任一元素）匹配正则 Value
+)
+
+// SSO 角色同步模式
+const (
+	RoleSyncPromote = "promote" // 仅提升（默认）：映射结果的权限不覆盖现有角色时保留现有角色
+	RoleSyncFull    = "full"    // 完全同步：按规则结果升降级
+)
+
+// ErrSSONoRoleMatch 开启 deny_if_no_match 且无规则命中
+var ErrSSONoRoleMatch = errors.New("账号不满足任何角色规则，拒绝登录")
+
+// OIDCRoleRule 基于 ID Token Claim 的角色规则，如 groups contains dvr-admins → admin；命中多条时取权限最多的角色
+type OIDCRoleRule struct {
+	Claim string `json:"claim"` // 支持点路径，如 realm_access.roles
+	Op    string `json:"op"`    // equals / contains / matches
+	Value string `json:"value"`
+	Role  string `json:"role"` // 已存在的角色名
+}
+
+// SSOIdentity IdP 认证通过的用户
+type SSOIdentity struct {
+	// Subject IdP 内稳定的用户标识（OIDC sub / SAML NameID），用于关联本地用户
+	Subject  string
+	Username string
+	// Role 映射得到的角色；为空表示未配置映射，不改动已有账号角色
+	Role string
+	// Demote 是否允许把已有账号改为权限不覆盖现有角色的角色（降级）
+	Demote bool
+	// IDToken OIDC 原始 ID Token，登出时作为 id_token_hint
+	IDToken string
+	// 资料：ID Token / UserInfo 中的 email、name、picture，为空不覆盖
+	Email       string
+	DisplayName string
+	AvatarURL   string
+	// Groups IdP 提供的组名；SyncGroups 为 true（提供商配置了组来源）时登录后按其同步用户组成员关系
+	Groups     []string
+	SyncGroups bool
+}
+
+func (i *SSOIdentity) hasProfile() bool {
+	return i.Email != "" || i.DisplayName != "" || i.AvatarURL != ""
+}
+
+// Profile 转为用户资料
+func (i *SSOIdentity) Profile() repository.UserProfile {
+	return repository.UserProfile{Email: i.Email, DisplayName: i.DisplayName, AvatarURL: i.AvatarURL}
+}
+
+// validateRoleRules 校验规则与同步模式
+func validateRoleRules(rules []OIDCRoleRule, sync string) error {
+	for i, r := range rules {
+		if r.Claim == "" || r.Value == "" {
+			return fmt.Errorf("第 %d 条角色规则缺少 claim 或 value", i+1)
+		}
+		if strings.TrimSpace(r.Role) == "" {
+			return fmt.Errorf("第 %d 条角色规则缺少 role", i+1)
+		}
+		switch r.Op {
+		case RoleRuleEquals, RoleRuleContains:
+		case RoleRuleMatches:
+			if _, err := regexp.Compile(r.Value); err != nil {
+				return fmt.Errorf("第 %d 条角色规则正则无效: %v", i+1, err)
+			}
+		default:
+			return fmt.Errorf("第 %d 条角色规则的 op 须为 equals、contains 或 matches", i+1)
+		}
+	}
+	if sync != "" && sync != RoleSyncPromote && sync != RoleSyncFull {
+		return errors.New("role_sync 须为 promote 或 full")
+	}
+	return nil
+}
+
+// checkRuleRoles 校验规则映射的角色均已存在
+func checkRuleRoles(roles RoleService, rules []OIDCRoleRule) error {
+	for i, r := range rules {
+		if err := checkRoles(roles, map[string]string{fmt.Sprintf("第 %d 条角色规则", i+1): r.Role}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyRoleRules 按规则计算角色：命中多条时取权限最多的角色（相同时取靠前的规则）；无规则命中或角色已不存在时返回空
+func applyRoleRules(roles RoleService, rules []OIDCRoleRule, claims map[string]interface{}) string {
+	var matched []string
+	for _, r := range rules {
+		if ruleMatches(r, lookupClaim(claims, r.Claim)) {
+			matched = append(matched, r.Role)
+		}
+	}
+	return preferRole(roles, matched)
+}
+
+// lookupClaim 按点路径取 Claim；顶层存在同名（含点）Claim 时优先
+func lookupClaim(claims map[string]interface{}, path string) interface{} {
+	if v, ok := claims[path]; ok {
+		return v
+	}
+	var cur interface{} = claims
+	for _, part := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		cur = m[part]
+	}
+	return cur
+}
+
+func ruleMatches(r OIDCRoleRule, v interface{}) bool {
+	switch val := v.(type) {
+	case []interface{}:
+		for _, item := range val {
+			s := fmt.Sprint(item)
+			if (r.Op == RoleRuleContains || r.Op == RoleRuleEquals) && s == r.Value {
+				return true
+			}
+			if r.Op == RoleRuleMatches && regexMatch(r.Value, s) {
+				return true
+			}
+		}
+		return false
+	case nil:
+		return false
+	default:
+		s := fmt.Sprint(val)
+		switch r.Op {
+		case RoleRuleEquals:
+			return s == r.Value
+		case RoleRuleContains:
+			return strings.Contains(s, r.Value)
+		case RoleRuleMatches:
+			return regexMatch(r.Value, s)
+		}
+		return false
+	}
+}
+
+// claimStrings Claim 值转为字符串列表（数组逐项，单值为一项）
+func claimStrings(v interface{}) []string {
+	switch val := v.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		out := make([]string, 0, len(val))
+		for _, item := range val {
+			if s := strings.TrimSpace(fmt.Sprint(item)); s != "" {
+				out = append(out, s)
+			}
+		}
+		return out
+	default:
+		if s := strings.TrimSpace(fmt.Sprint(val)); s != "" {
+			return []string{s}
+		}
+		return nil
+	}
+}
+
+func regexMatch(pattern, s string) bool {
+	re, err := regexp.Compile(pattern)
+	return err == nil && re.MatchString(s)
+}
+
+// ssoTargetRole 已有账号在本次登录后应有的角色：promote 模式只在映射角色的权限覆盖现有角色时变更
+func ssoTargetRole(roles RoleService, current string, ident *SSOIdentity) string {
+	if ident.Role == "" || ident.Role == current {
+		return current
+	}
+	if !ident.Demote && !roles.Covers([]string{ident.Role}, current) {
+		return current
+	}
+	return ident.Role
+}
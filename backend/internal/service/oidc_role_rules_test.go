@@ -0,0 +1,83 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"dvr-manager/internal/repository"
+	"dvr-manager/pkg/db"
+)
+
+func newTestRoleService(t *testing.T) RoleService {
+	t.Helper()
+	if err := db.InitDB(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return NewRoleService(repository.NewRoleRepository())
+}
+
+func TestApplyRoleRules(t *testing.T) {
+	roles := newTestRoleService(t)
+	rules := []OIDCRoleRule{
+		{Claim: "groups", Op: RoleRuleContains, Value: "dvr-admins", Role: "admin"},
+		{Claim: "realm_access.roles", Op: RoleRuleEquals, Value: "viewer", Role: "user"},
+		{Claim: "email", Op: RoleRuleMatches, Value: `@ops\.example\.com$`, Role: "admin"},
+		{Claim: "dept", Op: RoleRuleEquals, Value: "noc", Role: RoleViewer},
+		{Claim: "dept", Op: RoleRuleContains, Value: "no", Role: RoleOperator},
+		{Claim: "dept", Op: RoleRuleEquals, Value: "sec", Role: "retired"},
+	}
+	cases := []struct {
+		name   string
+		claims map[string]interface{}
+		want   string
+	}{
+		{"group", map[string]interface{}{"groups": []interface{}{"staff", "dvr-admins"}}, "admin"},
+		{"nested", map[string]interface{}{"realm_access": map[string]interface{}{"roles": []interface{}{"viewer"}}}, "user"},
+		{"admin wins", map[string]interface{}{
+			"realm_access": map[string]interface{}{"roles": []interface{}{"viewer"}},
+			"email":        "bob@ops.example.com",
+		}, "admin"},
+		{"most permissions wins", map[string]interface{}{"dept": "noc"}, RoleOperator},
+		{"deleted role ignored", map[string]interface{}{"dept": "sec"}, ""},
+		{"no match", map[string]interface{}{"groups": []interface{}{"staff"}}, ""},
+	}
+	for _, tc := range cases {
+		if got := applyRoleRules(roles, rules, tc.claims); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestOIDCIdentity_denyAndSync(t *testing.T) {
+	roles := newTestRoleService(t)
+	cfg := OIDCConfig{
+		RoleRules:     []OIDCRoleRule{{Claim: "groups", Op: RoleRuleContains, Value: "dvr-admins", Role: "admin"}},
+		DenyIfNoMatch: true,
+	}
+	if _, err := oidcIdentity(roles, cfg, "eve", map[string]interface{}{"groups": []interface{}{"staff"}}); !errors.Is(err, ErrSSONoRoleMatch) {
+		t.Fatalf("expected ErrSSONoRoleMatch, got %v", err)
+	}
+
+	cfg.DenyIfNoMatch = false
+	ident, err := oidcIdentity(roles, cfg, "eve", map[string]interface{}{"groups": []interface{}{"staff"}})
+	if err != nil || ident.Role != "user" {
+		t.Fatalf("ident=%+v err=%v", ident, err)
+	}
+	// promote（默认）模式不降级；full 模式降级
+	if got := ssoTargetRole(roles, "admin", ident); got != "admin" {
+		t.Errorf("promote mode demoted admin to %q", got)
+	}
+	// promote 模式：映射角色的权限不覆盖现有角色时（平级或更低）保留现有角色
+	if got := ssoTargetRole(roles, RoleAuditor, &SSOIdentity{Role: RoleOperator}); got != RoleAuditor {
+		t.Errorf("promote mode changed auditor to %q", got)
+	}
+	if got := ssoTargetRole(roles, RoleViewer, &SSOIdentity{Role: RoleOperator}); got != RoleOperator {
+		t.Errorf("promote mode kept %q, want operator", got)
+	}
+	cfg.RoleSync = RoleSyncFull
+	ident, _ = oidcIdentity(roles, cfg, "eve", map[string]interface{}{})
+	if got := ssoTargetRole(roles, "admin", ident); got != "user" {
+		t.Errorf("full mode kept %q", got)
+	}
+}
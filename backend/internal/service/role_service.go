@@ -0,0 +1,357 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"dvr-manager/internal/repository"
+)
+
+// 权限
+const (
+	PermPlay          = "play"              // 录像查询与在线播放（/api/play、/stream）
+	PermDownload      = "download"          // 下载录像（/stream?download=1）
+	PermDashboardRead = "dashboard:read"    // 仪表盘统计
+	PermAuditRead     = "audit:read"        // 查看审计日志
+	PermAuditManage   = "audit:manage"      // 清理审计日志
+	PermConfigRead    = "config:read"       // 查看系统配置与 DVR 列表
+	PermConfigWrite   = "config:write"      // 修改系统配置、DVR 列表，重载配置
+	PermUsersRead     = "users:read"        // 查看用户、会话、外部身份、API 令牌
+	PermUsersWrite    = "users:write"       // 管理用户（创建、改角色、重置密码、下线等）
+	PermImpersonate   = "users:impersonate" // 以其他用户身份登录（模拟登录，排查权限问题）
+	PermSSOManage     = "sso:manage"        // 管理 SSO 提供商
+	PermRolesManage   = "roles:manage"      // 管理角色与权限
+	PermAccessManage  = "access:manage"     // 管理 DVR 分组与访问策略
+)
+
+// 内置角色
+const (
+	RoleAdmin    = "admin"    // 全部权限，不可修改
+	RoleUser     = "user"     // 播放与下载
+	RoleAuditor  = "auditor"  // 审计与仪表盘只读
+	RoleOperator = "operator" // DVR 配置，不含用户管理
+	RoleViewer   = "viewer"   // 仅播放，不可下载
+)
+
+// PermissionInfo 权限说明（供管理界面展示）
+type PermissionInfo struct {
+	Key         string `json:"key"`
+	Description string `json:"description"`
+}
+
+// AllPermissions 全部权限
+func AllPermissions() []PermissionInfo {
+	return []PermissionInfo{
+		{PermPlay, "录像查询与在线播放"},
+		{PermDownload, "下载录像"},
+		{PermDashboardRead, "查看仪表盘"},
+		{PermAuditRead, "查看审计日志"},
+		{PermAuditManage, "清理审计日志"},
+		{PermConfigRead, "查看系统配置与 DVR 列表"},
+		{PermConfigWrite, "修改系统配置与 DVR 列表"},
+		{PermUsersRead, "查看用户、会话与 API 令牌"},
+		{PermUsersWrite, "管理用户、会话与 API 令牌"},
+		{PermImpersonate, "以其他用户身份登录（模拟登录）"},
+		{PermSSOManage, "管理 SSO 提供商"},
+		{PermRolesManage, "管理角色与权限"},
+		{PermAccessManage, "管理 DVR 分组与访问策略"},
+	}
+}
+
+// builtinRoles 内置角色的初始权限；启动时补齐缺失的内置角色，已存在的不覆盖（admin 除外）
+func builtinRoles() []repository.Role {
+	all := make([]string, 0, len(AllPermissions()))
+	for _, p := range AllPermissions() {
+		all = append(all, p.Key)
+	}
+	return []repository.Role{
+		{Name: RoleAdmin, Description: "管理员（全部权限）", Permissions: all},
+		{Name: RoleUser, Description: "普通用户", Permissions: []string{PermPlay, PermDownload}},
+		{Name: RoleAuditor, Description: "审计员（审计与仪表盘只读）", Permissions: []string{PermAuditRead, PermDashboardRead}},
+		{Name: RoleOperator, Description: "运维（DVR 配置，不含用户管理）", Permissions: []string{PermPlay, PermDownload, PermDashboardRead, PermConfigRead, PermConfigWrite}},
+		{Name: RoleViewer, Description: "只读观看（仅播放，不可下载）", Permissions: []string{PermPlay}},
+	}
+}
+
+// adminPermissions 管理接口相关权限（持有任意一项即可授予 API 令牌 admin:* 范围）
+var adminPermissions = []string{
+	PermDashboardRead, PermAuditRead, PermAuditManage, PermConfigRead, PermConfigWrite,
+	PermUsersRead, PermUsersWrite, PermImpersonate, PermSSOManage, PermRolesManage, PermAccessManage,
+}
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,31}$`)
+
+var (
+	// ErrRoleBuiltIn 内置角色不可删除
+	ErrRoleBuiltIn = errors.New("内置角色不可删除")
+	// ErrRoleInvalid 角色不存在
+	ErrRoleInvalid = errors.New("角色不存在，请先在角色管理中创建")
+)
+
+// RoleService 角色与权限服务；权限判断使用内存缓存，角色变更后刷新
+type RoleService interface {
+	List() ([]repository.Role, error)
+	Create(name, description string, permissions []string) (*repository.Role, error)
+	Update(name, description string, permissions []string) (*repository.Role, error)
+	Delete(name string) error
+	// Exists 角色是否存在
+	Exists(role string) bool
+	// Permissions 角色拥有的权限（多个角色取并集）
+	Permissions(roles ...string) []string
+	// HasPermission 角色是否拥有任一指定权限
+	HasPermission(role string, perms ...string) bool
+	// IsAdminCapable 角色是否拥有任一管理接口权限
+	IsAdminCapable(role string) bool
+	// Covers actors（用户角色与所在组的角色）的权限并集是否包含 role 的全部权限（防止授予或操作高于自身的角色）
+	Covers(actors []string, role string) bool
+	// CoversPermissions actors 的权限并集是否包含 perms 中的全部权限（防止新建或修改角色时授予自身没有的权限）
+	CoversPermissions(actors []string, perms []string) bool
+}
+
+type roleService struct {
+	repo repository.RoleRepository
+
+	mu    sync.RWMutex
+	perms map[string]map[string]bool // 角色 → 权限集合
+}
+
+// NewRoleService 创建角色服务，补齐内置角色（旧库的 admin / user 即迁移为内置角色）
+func NewRoleService(repo repository.RoleRepository) RoleService {
+	s := &roleService{repo: repo}
+	for _, r := range builtinRoles() {
+		r.BuiltIn = true
+		if err := repo.Ensure(&r); err != nil {
+			log.Printf("[ROLE] ensure builtin role %s: %v", r.Name, err)
+		}
+		// 新增权限后 admin 自动拥有
+		if r.Name == RoleAdmin {
+			if err := repo.Update(r.Name, r.Description, r.Permissions); err != nil {
+				log.Printf("[ROLE] sync admin permissions: %v", err)
+			}
+		}
+	}
+	s.reload()
+	return s
+}
+
+func (s *roleService) reload() {
+	list, err := s.repo.List()
+	if err != nil {
+		log.Printf("[ROLE] load roles: %v", err)
+		return
+	}
+	perms := make(map[string]map[string]bool, len(list))
+	for _, r := range list {
+		set := make(map[string]bool, len(r.Permissions))
+		for _, p := range r.Permissions {
+			set[p] = true
+		}
+		perms[r.Name] = set
+	}
+	s.mu.Lock()
+	s.perms = perms
+	s.mu.Unlock()
+}
+
+// List 全部角色
+func (s *roleService) List() ([]repository.Role, error) {
+	return s.repo.List()
+}
+
+// normalizePermissions 去重并校验权限
+func normalizePermissions(perms []string) ([]string, error) {
+	valid := map[string]bool{}
+	for _, p := range AllPermissions() {
+		valid[p.Key] = true
+	}
+	seen := map[string]bool{}
+	out := make([]string, 0, len(perms))
+	for _, p := range perms {
+		p = strings.TrimSpace(p)
+		if p == "" || seen[p] {
+			continue
+		}
+		if !valid[p] {
+			return nil, fmt.Errorf("未知权限: %s", p)
+		}
+		seen[p] = true
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// Create 新增自定义角色
+func (s *roleService) Create(name, description string, permissions []string) (*repository.Role, error) {
+	name = strings.TrimSpace(name)
+	if !roleNamePattern.MatchString(name) {
+		return nil, errors.New("角色名须为 2~32 位小写字母、数字、- 或 _，且以字母开头")
+	}
+	perms, err := normalizePermissions(permissions)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(&repository.Role{Name: name, Description: strings.TrimSpace(description), Permissions: perms}); err != nil {
+		return nil, err
+	}
+	s.reload()
+	return s.repo.Get(name)
+}
+
+// Update 修改角色描述与权限；admin 的权限固定为全部
+func (s *roleService) Update(name, description string, permissions []string) (*repository.Role, error) {
+	if name == RoleAdmin {
+		return nil, errors.New("admin 角色拥有全部权限，不可修改")
+	}
+	perms, err := normalizePermissions(permissions)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Update(name, strings.TrimSpace(description), perms); err != nil {
+		return nil, err
+	}
+	s.reload()
+	return s.repo.Get(name)
+}
+
+// Delete 删除自定义角色；仍有用户或用户组使用时拒绝
+func (s *roleService) Delete(name string) error {
+	r, err := s.repo.Get(name)
+	if err != nil {
+		return err
+	}
+	if r.BuiltIn {
+		return ErrRoleBuiltIn
+	}
+	if r.UserCount > 0 {
+		return fmt.Errorf("仍有 %d 个用户使用该角色，请先调整其角色", r.UserCount)
+	}
+	if r.GroupCount > 0 {
+		return fmt.Errorf("仍有 %d 个用户组授予该角色，请先调整用户组", r.GroupCount)
+	}
+	if err := s.repo.Delete(name); err != nil {
+		return err
+	}
+	s.reload()
+	return nil
+}
+
+// Exists 角色是否存在
+func (s *roleService) Exists(role string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.perms[role]
+	return ok
+}
+
+// Permissions 角色权限并集（按 AllPermissions 顺序）
+func (s *roleService) Permissions(roles ...string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := []string{}
+	for _, p := range AllPermissions() {
+		for _, role := range roles {
+			if s.perms[role][p.Key] {
+				out = append(out, p.Key)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// HasPermission 任一权限满足即可
+func (s *roleService) HasPermission(role string, perms ...string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	set := s.perms[role]
+	for _, p := range perms {
+		if set[p] {
+			return true
+		}
+	}
+	return false
+}
+
+// preferRole 外部身份源映射命中多个角色时取权限最多者（与角色名无关），权限数相同时取先命中的；不存在的角色忽略
+func preferRole(roles RoleService, candidates []string) string {
+	best, most := "", -1
+	for _, r := range candidates {
+		if r == "" || !roles.Exists(r) {
+			continue
+		}
+		if n := len(roles.Permissions(r)); n > most {
+			best, most = r, n
+		}
+	}
+	return best
+}
+
+// checkRoles 校验外部身份源配置中映射的角色均已存在；what 描述角色所在的配置项
+func checkRoles(roles RoleService, mapped map[string]string) error {
+	keys := make([]string, 0, len(mapped))
+	for what := range mapped {
+		keys = append(keys, what)
+	}
+	sort.Strings(keys)
+	for _, what := range keys {
+		if r := mapped[what]; !roles.Exists(r) {
+			return fmt.Errorf("%s：角色 %s 不存在，请先在角色管理中创建", what, r)
+		}
+	}
+	return nil
+}
+
+// IsAdminCapable 是否拥有任一管理权限
+func (s *roleService) IsAdminCapable(role string) bool {
+	return s.HasPermission(role, adminPermissions...)
+}
+
+// Covers actors 的权限并集是否包含 role 的全部权限；admin 覆盖一切
+func (s *roleService) Covers(actors []string, role string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	perms := make([]string, 0, len(s.perms[role]))
+	for p := range s.perms[role] {
+		perms = append(perms, p)
+	}
+	return s.coversLocked(actors, perms)
+}
+
+// CoversPermissions actors 的权限并集是否包含 perms 中的全部权限；admin 覆盖一切
+func (s *roleService) CoversPermissions(actors []string, perms []string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.coversLocked(actors, perms)
+}
+
+func (s *roleService) coversLocked(actors []string, perms []string) bool {
+	mine := map[string]bool{}
+	known := false
+	for _, actor := range actors {
+		if actor == RoleAdmin {
+			return true
+		}
+		set, ok := s.perms[actor]
+		if !ok {
+			continue
+		}
+		known = true
+		for p := range set {
+			mine[p] = true
+		}
+	}
+	if !known {
+		return false
+	}
+	for _, p := range perms {
+		if !mine[p] {
+			return false
+		}
+	}
+	return true
+}
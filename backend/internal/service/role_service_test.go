@@ -0,0 +1,58 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"dvr-manager/internal/repository"
+	"dvr-manager/pkg/db"
+)
+
+func TestRoleService_builtinAndCustomRoles(t *testing.T) {
+	if err := db.InitDB(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	svc := NewRoleService(repository.NewRoleRepository())
+
+	if !svc.HasPermission(RoleAdmin, PermRolesManage) || !svc.HasPermission(RoleUser, PermDownload) {
+		t.Fatal("builtin admin / user permissions missing")
+	}
+	if svc.HasPermission(RoleViewer, PermDownload) || svc.HasPermission(RoleOperator, PermUsersWrite) {
+		t.Fatal("viewer must not download, operator must not manage users")
+	}
+	if !svc.Covers([]string{RoleOperator}, RoleViewer) || svc.Covers([]string{RoleOperator}, RoleAdmin) {
+		t.Fatal("unexpected Covers result")
+	}
+	// 用户组授予的角色与用户角色取并集
+	if !svc.Covers([]string{RoleViewer, RoleAuditor}, RoleAuditor) || len(svc.Permissions(RoleViewer, RoleAuditor)) != 3 {
+		t.Fatal("roles from groups must be combined")
+	}
+
+	if _, err := svc.Create("night-shift", "夜班", []string{PermPlay, "bogus"}); err == nil {
+		t.Fatal("expected unknown permission to be rejected")
+	}
+	if _, err := svc.Create("night-shift", "夜班", []string{PermPlay, PermAuditRead, PermPlay}); err != nil {
+		t.Fatal(err)
+	}
+	if got := svc.Permissions("night-shift"); len(got) != 2 {
+		t.Fatalf("permissions = %v", got)
+	}
+	if _, err := svc.Update("night-shift", "夜班", []string{PermDownload}); err != nil {
+		t.Fatal(err)
+	}
+	if svc.HasPermission("night-shift", PermPlay) || !svc.HasPermission("night-shift", PermDownload) {
+		t.Fatal("permission cache not refreshed after update")
+	}
+
+	if _, err := svc.Update(RoleAdmin, "", nil); err == nil {
+		t.Fatal("admin role must not be editable")
+	}
+	if err := svc.Delete(RoleViewer); !errors.Is(err, ErrRoleBuiltIn) {
+		t.Fatalf("expected builtin delete to fail, got %v", err)
+	}
+	if err := svc.Delete("night-shift"); err != nil || svc.Exists("night-shift") {
+		t.Fatalf("delete custom role: %v", err)
+	}
+}
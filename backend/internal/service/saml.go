@@ -0,0 +1,460 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"dvr-manager/internal/repository"
+
+	"github.com/crewjam/saml"
+	xrv "github.com/mattermost/xml-roundtrip-validator"
+)
+
+// SAML 默认值
+const (
+	SAMLBindingRedirect = "redirect"
+	SAMLBindingPost     = "post"
+	// SAMLRequestTTL 已发出的 AuthnRequest 等待 IdP 响应的最长时间（与请求 ID Cookie 有效期一致）
+	SAMLRequestTTL = 10 * time.Minute
+)
+
+// SAMLConfig SAML 2.0 SP 配置
+type SAMLConfig struct {
+	RootURL  string `json:"root_url"`  // 本系统对外地址，如 https://dvr.example.com（用于生成 ACS / 元数据地址）
+	EntityID string `json:"entity_id"` // SP Entity ID，默认等于元数据地址
+	// IdP 元数据：二选一，XML 优先
+	IDPMetadataURL string `json:"idp_metadata_url"`
+	IDPMetadataXML string `json:"idp_metadata_xml"`
+	// SP 证书与私钥（PEM）：签名 AuthnRequest、解密加密断言；可留空
+	SPCertificate string `json:"sp_certificate"`
+	SPPrivateKey  string `json:"sp_private_key"`
+	SignRequests  bool   `json:"sign_requests"`
+	Binding       string `json:"binding"`        // AuthnRequest 绑定：redirect（默认）/ post
+	NameIDFormat  string `json:"name_id_format"` // unspecified（默认）/ email / persistent / transient / 完整 URN
+	// UsernameAttribute 用户名取自该属性（Name 或 FriendlyName），为空使用 NameID
+	UsernameAttribute string `json:"username_attribute"`
+	// RoleAttribute + RoleMapping 属性值 → 角色；配置后每次登录同步，命中多个时取权限最多的角色，未命中为 user
+	RoleAttribute string            `json:"role_attribute"`
+	RoleMapping   map[string]string `json:"role_mapping"`
+	// GroupsAttribute 组属性（Name 或 FriendlyName），配置后每次登录按其同步用户组；为空不同步
+	GroupsAttribute   string `json:"groups_attribute"`
+	AllowIDPInitiated bool   `json:"allow_idp_initiated"` // 允许 IdP 发起的登录（无 InResponseTo）
+	SkipTLSVerify     bool   `json:"skip_tls_verify"`     // 拉取 IdP 元数据时跳过证书校验
+}
+
+// SAMLAuthRequest SP 发起登录：Redirect 绑定返回跳转地址，POST 绑定返回自动提交的 HTML 表单；
+// FlowCookie 为加密后的请求 ID，须写入浏览器 Cookie，ACS 仅接受响应该请求的断言
+type SAMLAuthRequest struct {
+	RedirectURL string
+	PostForm    []byte
+	FlowCookie  string
+}
+
+// samlRuntime 已初始化的 SAML SP
+type samlRuntime struct {
+	id   int64
+	name string
+	cfg  SAMLConfig
+	sp   *saml.ServiceProvider
+}
+
+// samlFlow 已发出的 AuthnRequest（加密后存于发起登录的浏览器 Cookie）
+type samlFlow struct {
+	ProviderID int64  `json:"p"`
+	RequestID  string `json:"r"`
+	Expires    int64  `json:"e"`
+}
+
+// ErrSAMLAssertionReplayed 断言 ID 已被使用过
+var ErrSAMLAssertionReplayed = errors.New("SAML 断言已被使用")
+
+// ValidateSAMLConfig 校验 SAML 提供商配置 JSON 及映射的角色（不拉取远程元数据）
+func ValidateSAMLConfig(raw string, roles RoleService) error {
+	cfg, err := parseSAMLConfig(raw)
+	if err != nil {
+		return err
+	}
+	if cfg.IDPMetadataXML != "" {
+		if _, err := ParseSAMLMetadata([]byte(cfg.IDPMetadataXML)); err != nil {
+			return fmt.Errorf("idp_metadata_xml: %w", err)
+		}
+	}
+	if _, _, err = parseSPKeyPair(cfg); err != nil {
+		return err
+	}
+	mapped := make(map[string]string, len(cfg.RoleMapping))
+	for v, role := range cfg.RoleMapping {
+		mapped["属性值 "+v] = role
+	}
+	return checkRoles(roles, mapped)
+}
+
+func parseSAMLConfig(raw string) (SAMLConfig, error) {
+	var cfg SAMLConfig
+	if err := json.Unmarshal([]byte(raw), &cfg); err != nil {
+		return cfg, fmt.Errorf("invalid saml config: %w", err)
+	}
+	cfg.RootURL = strings.TrimRight(cfg.RootURL, "/")
+	u, err := url.Parse(cfg.RootURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return cfg, errors.New("root_url 须为 http(s):// 开头的完整地址")
+	}
+	if cfg.IDPMetadataURL == "" && cfg.IDPMetadataXML == "" {
+		return cfg, errors.New("idp_metadata_url / idp_metadata_xml 至少填写一项")
+	}
+	switch cfg.Binding {
+	case "":
+		cfg.Binding = SAMLBindingRedirect
+	case SAMLBindingRedirect, SAMLBindingPost:
+	default:
+		return cfg, errors.New("binding 须为 redirect 或 post")
+	}
+	for v, role := range cfg.RoleMapping {
+		if strings.TrimSpace(role) == "" {
+			return cfg, fmt.Errorf("属性值 %s 的角色不能为空", v)
+		}
+	}
+	if cfg.SignRequests && (cfg.SPCertificate == "" || cfg.SPPrivateKey == "") {
+		return cfg, errors.New("签名请求需要配置 sp_certificate 与 sp_private_key")
+	}
+	return cfg, nil
+}
+
+// ParseSAMLMetadata 解析 IdP 元数据（EntityDescriptor 或包含 IdP 的 EntitiesDescriptor）
+func ParseSAMLMetadata(data []byte) (*saml.EntityDescriptor, error) {
+	if err := xrv.Validate(bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	var root struct{ XMLName xml.Name }
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	if root.XMLName.Local == "EntitiesDescriptor" {
+		var entities saml.EntitiesDescriptor
+		if err := xml.Unmarshal(data, &entities); err != nil {
+			return nil, err
+		}
+		for i, e := range entities.EntityDescriptors {
+			if len(e.IDPSSODescriptors) > 0 {
+				return &entities.EntityDescriptors[i], nil
+			}
+		}
+		return nil, errors.New("元数据中没有 IdP")
+	}
+	var entity saml.EntityDescriptor
+	if err := xml.Unmarshal(data, &entity); err != nil {
+		return nil, err
+	}
+	if len(entity.IDPSSODescriptors) == 0 {
+		return nil, errors.New("元数据中没有 IDPSSODescriptor")
+	}
+	return &entity, nil
+}
+
+// fetchSAMLMetadata 拉取远程 IdP 元数据
+func fetchSAMLMetadata(rawURL string, skipTLSVerify bool) (*saml.EntityDescriptor, error) {
+	httpClient := &http.Client{Timeout: 15 * time.Second}
+	if skipTLSVerify {
+		httpClient.Transport = &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("fetch metadata: status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return nil, err
+	}
+	return ParseSAMLMetadata(data)
+}
+
+// parseSPKeyPair 解析 SP 证书与私钥；两者都为空时返回 nil
+func parseSPKeyPair(cfg SAMLConfig) (*x509.Certificate, crypto.Signer, error) {
+	if cfg.SPCertificate == "" && cfg.SPPrivateKey == "" {
+		return nil, nil, nil
+	}
+	if cfg.SPCertificate == "" || cfg.SPPrivateKey == "" {
+		return nil, nil, errors.New("sp_certificate 与 sp_private_key 须同时配置")
+	}
+	pair, err := tls.X509KeyPair([]byte(cfg.SPCertificate), []byte(cfg.SPPrivateKey))
+	if err != nil {
+		return nil, nil, fmt.Errorf("sp 证书/私钥无效: %w", err)
+	}
+	block, _ := pem.Decode([]byte(cfg.SPCertificate))
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	signer, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, nil, errors.New("不支持的私钥类型")
+	}
+	return cert, signer, nil
+}
+
+func samlNameIDFormat(v string) saml.NameIDFormat {
+	switch v {
+	case "", "unspecified":
+		return saml.UnspecifiedNameIDFormat
+	case "email":
+		return saml.EmailAddressNameIDFormat
+	case "persistent":
+		return saml.PersistentNameIDFormat
+	case "transient":
+		return saml.TransientNameIDFormat
+	default:
+		return saml.NameIDFormat(v)
+	}
+}
+
+// SAMLEndpoint SP 端点地址（metadata / acs）
+func SAMLEndpoint(rootURL string, id int64, endpoint string) string {
+	return fmt.Sprintf("%s/api/auth/sso/saml/%d/%s", strings.TrimRight(rootURL, "/"), id, endpoint)
+}
+
+func buildSAMLRuntime(p repository.SSOProvider) (*samlRuntime, error) {
+	cfg, err := parseSAMLConfig(p.ConfigJSON)
+	if err != nil {
+		return nil, err
+	}
+	var idpMeta *saml.EntityDescriptor
+	if cfg.IDPMetadataXML != "" {
+		idpMeta, err = ParseSAMLMetadata([]byte(cfg.IDPMetadataXML))
+	} else {
+		idpMeta, err = fetchSAMLMetadata(cfg.IDPMetadataURL, cfg.SkipTLSVerify)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("idp metadata: %w", err)
+	}
+	cert, key, err := parseSPKeyPair(cfg)
+	if err != nil {
+		return nil, err
+	}
+	metadataURL, _ := url.Parse(SAMLEndpoint(cfg.RootURL, p.ID, "metadata"))
+	acsURL, _ := url.Parse(SAMLEndpoint(cfg.RootURL, p.ID, "acs"))
+	sp := &saml.ServiceProvider{
+		EntityID:          cfg.EntityID,
+		Key:               key,
+		Certificate:       cert,
+		MetadataURL:       *metadataURL,
+		AcsURL:            *acsURL,
+		IDPMetadata:       idpMeta,
+		AuthnNameIDFormat: samlNameIDFormat(cfg.NameIDFormat),
+		AllowIDPInitiated: cfg.AllowIDPInitiated,
+	}
+	if cfg.SignRequests {
+		sp.SignatureMethod = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	}
+	if sp.GetSSOBindingLocation(saml.HTTPRedirectBinding) == "" && sp.GetSSOBindingLocation(saml.HTTPPostBinding) == "" {
+		return nil, errors.New("IdP 元数据中没有 Redirect / POST 绑定的 SSO 地址")
+	}
+	return &samlRuntime{id: p.ID, name: p.Name, cfg: cfg, sp: sp}, nil
+}
+
+// ---------------- SSOService 中的 SAML 部分 ----------------
+
+func (s *ssoService) samlRuntime(id int64) (*samlRuntime, error) {
+	s.mu.RLock()
+	rt := s.samlSet[id]
+	s.mu.RUnlock()
+	if rt == nil {
+		return nil, errors.New("SAML 提供商不存在或未启用")
+	}
+	return rt, nil
+}
+
+// SAMLMetadata 生成 SP 元数据 XML（供 IdP 导入）
+func (s *ssoService) SAMLMetadata(id int64) ([]byte, error) {
+	rt, err := s.samlRuntime(id)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := xml.MarshalIndent(rt.sp.Metadata(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), buf...), nil
+}
+
+// BuildSAMLAuthRequest 生成 AuthnRequest；请求 ID 加密后由调用方写入浏览器 Cookie，与发起登录的浏览器绑定
+func (s *ssoService) BuildSAMLAuthRequest(id int64, relayState string) (*SAMLAuthRequest, error) {
+	rt, err := s.samlRuntime(id)
+	if err != nil {
+		return nil, err
+	}
+	binding := saml.HTTPRedirectBinding
+	if rt.cfg.Binding == SAMLBindingPost {
+		binding = saml.HTTPPostBinding
+	}
+	location := rt.sp.GetSSOBindingLocation(binding)
+	if location == "" {
+		// IdP 不支持所选绑定时使用另一种
+		if binding == saml.HTTPRedirectBinding {
+			binding = saml.HTTPPostBinding
+		} else {
+			binding = saml.HTTPRedirectBinding
+		}
+		location = rt.sp.GetSSOBindingLocation(binding)
+	}
+	req, err := rt.sp.MakeAuthenticationRequest(location, binding, saml.HTTPPostBinding)
+	if err != nil {
+		return nil, err
+	}
+	cookie, err := sealCookie(s.flowKey, id, &samlFlow{
+		ProviderID: id, RequestID: req.ID, Expires: time.Now().Add(SAMLRequestTTL).Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if binding == saml.HTTPPostBinding {
+		return &SAMLAuthRequest{PostForm: req.Post(relayState), FlowCookie: cookie}, nil
+	}
+	u, err := req.Redirect(url.QueryEscape(relayState), rt.sp)
+	if err != nil {
+		return nil, err
+	}
+	return &SAMLAuthRequest{RedirectURL: u.String(), FlowCookie: cookie}, nil
+}
+
+// ParseSAMLResponse 校验 ACS 收到的 SAMLResponse（签名、受众、有效期、InResponseTo），提取用户名与角色。
+// InResponseTo 须与 flowCookie 中的请求 ID 一致，防止他人发起的登录响应被提交到当前浏览器；
+// 断言 ID 记录到 NotOnOrAfter，同一断言不能重复使用（IdP 发起的登录没有请求 ID 可消费，依赖该记录防重放）
+func (s *ssoService) ParseSAMLResponse(id int64, r *http.Request, flowCookie string) (*SSOIdentity, error) {
+	rt, err := s.samlRuntime(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	var requestIDs []string
+	var flow samlFlow
+	if flowCookie != "" && openCookie(s.flowKey, id, flowCookie, &flow) && flow.ProviderID == id && now.Unix() <= flow.Expires {
+		requestIDs = []string{flow.RequestID}
+	}
+	assertion, err := rt.sp.ParseResponse(r, requestIDs)
+	if err != nil {
+		var ire *saml.InvalidResponseError
+		if errors.As(err, &ire) {
+			return nil, fmt.Errorf("SAML 响应校验失败: %v", ire.PrivateErr)
+		}
+		return nil, fmt.Errorf("SAML 响应校验失败: %w", err)
+	}
+	// 允许 IdP 发起时库不再校验 InResponseTo：带有请求 ID 的响应仍须属于当前浏览器
+	if assertion.Subject != nil {
+		for _, sc := range assertion.Subject.SubjectConfirmations {
+			if sc.SubjectConfirmationData == nil || sc.SubjectConfirmationData.InResponseTo == "" {
+				continue
+			}
+			if len(requestIDs) == 0 || sc.SubjectConfirmationData.InResponseTo != requestIDs[0] {
+				return nil, errors.New("SAML 响应校验失败: InResponseTo 与本浏览器发起的登录请求不一致")
+			}
+		}
+	}
+	fresh, err := s.repo.ConsumeSAMLAssertion(assertion.ID, samlAssertionExpiry(assertion, now), now)
+	if err != nil {
+		return nil, err
+	}
+	if !fresh {
+		return nil, ErrSAMLAssertionReplayed
+	}
+	return samlIdentity(s.roles, rt.cfg, assertion)
+}
+
+// samlAssertionExpiry 断言最晚失效时间（Conditions 与 SubjectConfirmationData 的 NotOnOrAfter 加允许的时钟偏差）
+func samlAssertionExpiry(assertion *saml.Assertion, now time.Time) time.Time {
+	expires := now.Add(saml.MaxIssueDelay)
+	if assertion.Conditions != nil && assertion.Conditions.NotOnOrAfter.After(expires) {
+		expires = assertion.Conditions.NotOnOrAfter
+	}
+	if assertion.Subject != nil {
+		for _, sc := range assertion.Subject.SubjectConfirmations {
+			if sc.SubjectConfirmationData != nil && sc.SubjectConfirmationData.NotOnOrAfter.After(expires) {
+				expires = sc.SubjectConfirmationData.NotOnOrAfter
+			}
+		}
+	}
+	return expires.Add(saml.MaxClockSkew)
+}
+
+// samlIdentity 从断言中提取用户名（属性或 NameID）与映射角色
+func samlIdentity(roles RoleService, cfg SAMLConfig, assertion *saml.Assertion) (*SSOIdentity, error) {
+	// SAML 角色映射为完全同步（属性变化时降级）
+	ident := &SSOIdentity{Demote: true}
+	if cfg.UsernameAttribute != "" {
+		if vals := samlAttributeValues(assertion, cfg.UsernameAttribute); len(vals) > 0 {
+			ident.Username = strings.TrimSpace(vals[0])
+		}
+	} else if assertion.Subject != nil && assertion.Subject.NameID != nil {
+		ident.Username = strings.TrimSpace(assertion.Subject.NameID.Value)
+	}
+	if ident.Username == "" {
+		return nil, errors.New("无法从 SAML 断言提取用户名")
+	}
+	// transient NameID 每次登录都会变化，此时以用户名作为关联标识
+	ident.Subject = ident.Username
+	if nameID := assertion.Subject; nameID != nil && nameID.NameID != nil && nameID.NameID.Value != "" &&
+		nameID.NameID.Format != string(saml.TransientNameIDFormat) {
+		ident.Subject = nameID.NameID.Value
+	}
+	if cfg.GroupsAttribute != "" {
+		ident.SyncGroups = true
+		ident.Groups = samlAttributeValues(assertion, cfg.GroupsAttribute)
+	}
+	if cfg.RoleAttribute != "" {
+		mapping := make(map[string]string, len(cfg.RoleMapping))
+		for v, r := range cfg.RoleMapping {
+			mapping[strings.ToLower(strings.TrimSpace(v))] = r
+		}
+		var matched []string
+		for _, v := range samlAttributeValues(assertion, cfg.RoleAttribute) {
+			if r, ok := mapping[strings.ToLower(strings.TrimSpace(v))]; ok {
+				matched = append(matched, r)
+			}
+		}
+		if ident.Role = preferRole(roles, matched); ident.Role == "" {
+			ident.Role = RoleUser
+		}
+	}
+	return ident, nil
+}
+
+// samlAttributeValues 按 Name 或 FriendlyName 取属性的全部值
+func samlAttributeValues(assertion *saml.Assertion, name string) []string {
+	var out []string
+	for _, st := range assertion.AttributeStatements {
+		for _, attr := range st.Attributes {
+			if attr.Name != name && attr.FriendlyName != name {
+				continue
+			}
+			for _, v := range attr.Values {
+				out = append(out, v.Value)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,261 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"dvr-manager/internal/repository"
+	"dvr-manager/pkg/db"
+
+	"github.com/crewjam/saml"
+)
+
+// testIdP 测试用 IdP：自签名证书，对断言签名
+type testIdP struct {
+	idp    *saml.IdentityProvider
+	spMeta *saml.EntityDescriptor
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test-idp"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadataURL, _ := url.Parse("https://idp.test/metadata")
+	ssoURL, _ := url.Parse("https://idp.test/sso")
+	ti := &testIdP{}
+	ti.idp = &saml.IdentityProvider{
+		Key:                     key,
+		Certificate:             cert,
+		MetadataURL:             *metadataURL,
+		SSOURL:                  *ssoURL,
+		ServiceProviderProvider: ti,
+	}
+	return ti
+}
+
+// GetServiceProvider 实现 saml.ServiceProviderProvider
+func (ti *testIdP) GetServiceProvider(*http.Request, string) (*saml.EntityDescriptor, error) {
+	if ti.spMeta == nil {
+		return nil, os.ErrNotExist
+	}
+	return ti.spMeta, nil
+}
+
+func (ti *testIdP) metadataXML(t *testing.T) string {
+	t.Helper()
+	buf, err := xml.Marshal(ti.idp.Metadata())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buf)
+}
+
+// respond 处理 SP 的 Redirect 绑定登录请求，返回提交到 ACS 的表单
+func (ti *testIdP) respond(t *testing.T, redirectURL string, session *saml.Session) url.Values {
+	t.Helper()
+	req, err := saml.NewIdpAuthnRequest(ti.idp, httptest.NewRequest(http.MethodGet, redirectURL, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := req.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := (saml.DefaultAssertionMaker{}).MakeAssertion(req, session); err != nil {
+		t.Fatal(err)
+	}
+	form, err := req.PostBinding()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return url.Values{"SAMLResponse": {form.SAMLResponse}, "RelayState": {form.RelayState}}
+}
+
+// respondUnsolicited 生成 IdP 发起的响应（无 InResponseTo）
+func (ti *testIdP) respondUnsolicited(t *testing.T, session *saml.Session) url.Values {
+	t.Helper()
+	req := &saml.IdpAuthnRequest{
+		IDP:                     ti.idp,
+		HTTPRequest:             httptest.NewRequest(http.MethodGet, "https://idp.test/sso", nil),
+		Now:                     saml.TimeNow(),
+		ServiceProviderMetadata: ti.spMeta,
+	}
+	for i := range ti.spMeta.SPSSODescriptors {
+		for j, acs := range ti.spMeta.SPSSODescriptors[i].AssertionConsumerServices {
+			if acs.Binding == saml.HTTPPostBinding {
+				req.SPSSODescriptor = &ti.spMeta.SPSSODescriptors[i]
+				req.ACSEndpoint = &ti.spMeta.SPSSODescriptors[i].AssertionConsumerServices[j]
+			}
+		}
+	}
+	if err := (saml.DefaultAssertionMaker{}).MakeAssertion(req, session); err != nil {
+		t.Fatal(err)
+	}
+	form, err := req.PostBinding()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return url.Values{"SAMLResponse": {form.SAMLResponse}, "RelayState": {form.RelayState}}
+}
+
+func postACS(acsURL string, form url.Values) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, acsURL, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+func TestSSOService_samlLogin(t *testing.T) {
+	if err := db.InitDB(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	ti := newTestIdP(t)
+	cfg, _ := json.Marshal(SAMLConfig{
+		RootURL:           "https://dvr.test",
+		IDPMetadataXML:    ti.metadataXML(t),
+		UsernameAttribute: "uid",
+		RoleAttribute:     "eduPersonAffiliation",
+		RoleMapping:       map[string]string{"DVR-Admins": "admin"},
+	})
+	repo := repository.NewSSORepository()
+	p, err := repo.Create(&repository.SSOProvider{Type: repository.SSOTypeSAML, Name: "corp", Enabled: true, ConfigJSON: string(cfg)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := newTestSSOService(t, repo)
+
+	meta, err := svc.SAMLMetadata(p.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ti.spMeta = &saml.EntityDescriptor{}
+	if err := xml.Unmarshal(meta, ti.spMeta); err != nil {
+		t.Fatal(err)
+	}
+	acsURL := SAMLEndpoint("https://dvr.test", p.ID, "acs")
+
+	authReq, err := svc.BuildSAMLAuthRequest(p.ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	form := ti.respond(t, authReq.RedirectURL, &saml.Session{
+		ID: "s1", NameID: "alice@example.com", UserName: "alice",
+		Groups: []string{"dvr-admins", "staff"},
+	})
+	// 缺少发起登录时的 Cookie（他人获取的响应被提交到当前浏览器）
+	if _, err := svc.ParseSAMLResponse(p.ID, postACS(acsURL, form), ""); err == nil {
+		t.Fatal("expected response without flow cookie to be rejected")
+	}
+	// 另一次登录请求的 Cookie 与 InResponseTo 不一致
+	other, err := svc.BuildSAMLAuthRequest(p.ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.ParseSAMLResponse(p.ID, postACS(acsURL, form), other.FlowCookie); err == nil {
+		t.Fatal("expected response for another request to be rejected")
+	}
+	ident, err := svc.ParseSAMLResponse(p.ID, postACS(acsURL, form), authReq.FlowCookie)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ident.Username != "alice" || ident.Role != "admin" {
+		t.Fatalf("unexpected identity %+v", ident)
+	}
+
+	// 同一响应不能重放（断言 ID 已记录）
+	if _, err := svc.ParseSAMLResponse(p.ID, postACS(acsURL, form), authReq.FlowCookie); err != ErrSAMLAssertionReplayed {
+		t.Fatalf("replayed response: err = %v, want ErrSAMLAssertionReplayed", err)
+	}
+
+	// 篡改断言后签名校验失败
+	authReq, err = svc.BuildSAMLAuthRequest(p.ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	form = ti.respond(t, authReq.RedirectURL, &saml.Session{ID: "s2", NameID: "bob@example.com", UserName: "bob"})
+	raw, _ := base64.StdEncoding.DecodeString(form.Get("SAMLResponse"))
+	form.Set("SAMLResponse", base64.StdEncoding.EncodeToString([]byte(strings.Replace(string(raw), ">bob<", ">root<", 1))))
+	if _, err := svc.ParseSAMLResponse(p.ID, postACS(acsURL, form), authReq.FlowCookie); err == nil {
+		t.Fatal("expected tampered assertion to be rejected")
+	}
+}
+
+func TestSSOService_samlIDPInitiatedReplay(t *testing.T) {
+	if err := db.InitDB(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	ti := newTestIdP(t)
+	cfg, _ := json.Marshal(SAMLConfig{
+		RootURL:           "https://dvr.test",
+		IDPMetadataXML:    ti.metadataXML(t),
+		AllowIDPInitiated: true,
+	})
+	repo := repository.NewSSORepository()
+	p, err := repo.Create(&repository.SSOProvider{Type: repository.SSOTypeSAML, Name: "corp", Enabled: true, ConfigJSON: string(cfg)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := newTestSSOService(t, repo)
+	meta, err := svc.SAMLMetadata(p.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ti.spMeta = &saml.EntityDescriptor{}
+	if err := xml.Unmarshal(meta, ti.spMeta); err != nil {
+		t.Fatal(err)
+	}
+	acsURL := SAMLEndpoint("https://dvr.test", p.ID, "acs")
+
+	form := ti.respondUnsolicited(t, &saml.Session{ID: "s1", NameID: "alice@example.com"})
+	ident, err := svc.ParseSAMLResponse(p.ID, postACS(acsURL, form), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ident.Username != "alice@example.com" {
+		t.Fatalf("unexpected identity %+v", ident)
+	}
+	if _, err := svc.ParseSAMLResponse(p.ID, postACS(acsURL, form), ""); err != ErrSAMLAssertionReplayed {
+		t.Fatalf("replayed IdP-initiated response: err = %v, want ErrSAMLAssertionReplayed", err)
+	}
+
+	// 允许 IdP 发起时，带有请求 ID 的响应仍须与本浏览器的 Cookie 一致
+	authReq, err := svc.BuildSAMLAuthRequest(p.ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	form = ti.respond(t, authReq.RedirectURL, &saml.Session{ID: "s2", NameID: "bob@example.com"})
+	if _, err := svc.ParseSAMLResponse(p.ID, postACS(acsURL, form), ""); err == nil {
+		t.Fatal("expected solicited response without flow cookie to be rejected")
+	}
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// scimCond 过滤条件 attr op value（属性名小写）
+type scimCond struct {
+	attr  string
+	op    string
+	value string
+}
+
+// scimFilter 以 and 连接的条件；为空表示不过滤
+type scimFilter []scimCond
+
+// parseSCIMFilter 解析 RFC 7644 §3.4.2.2 filter 的子集：比较运算 eq / ne / co / sw / ew / pr，
+// 以 and 连接，以及 members[value eq "id"] 形式的复合属性；不支持 or / not / 括号。
+// attrs 为允许的属性（小写）
+func parseSCIMFilter(s string, attrs map[string]bool) (scimFilter, error) {
+	tokens, err := scimTokens(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &scimFilterParser{tokens: tokens, attrs: attrs}
+	var f scimFilter
+	for len(p.tokens) > 0 {
+		if len(f) > 0 {
+			if t := p.next(); t.quoted || strings.ToLower(t.text) != "and" {
+				return nil, invalidFilter("仅支持以 and 连接的条件")
+			}
+		}
+		conds, err := p.cond("")
+		if err != nil {
+			return nil, err
+		}
+		f = append(f, conds...)
+	}
+	return f, nil
+}
+
+func invalidFilter(detail string) error {
+	return scimErr(http.StatusBadRequest, "invalidFilter", detail)
+}
+
+type scimToken struct {
+	text   string
+	quoted bool
+}
+
+// scimTokens 切分为单词、带引号的字符串与方括号
+func scimTokens(s string) ([]scimToken, error) {
+	var tokens []scimToken
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '[' || c == ']':
+			tokens = append(tokens, scimToken{text: string(c)})
+			i++
+		case c == '(' || c == ')':
+			return nil, invalidFilter("不支持括号分组")
+		case c == '"':
+			var b strings.Builder
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				b.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return nil, invalidFilter("字符串缺少结束引号")
+			}
+			tokens = append(tokens, scimToken{text: b.String(), quoted: true})
+			i++
+		default:
+			j := i
+			for j < len(s) && !strings.ContainsRune(" \t[]\"()", rune(s[j])) {
+				j++
+			}
+			tokens = append(tokens, scimToken{text: s[i:j]})
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+type scimFilterParser struct {
+	tokens []scimToken
+	attrs  map[string]bool
+}
+
+func (p *scimFilterParser) next() scimToken {
+	if len(p.tokens) == 0 {
+		return scimToken{}
+	}
+	t := p.tokens[0]
+	p.tokens = p.tokens[1:]
+	return t
+}
+
+// cond 解析一个条件；prefix 为复合属性的父属性（如 members）
+func (p *scimFilterParser) cond(prefix string) ([]scimCond, error) {
+	t := p.next()
+	if t.quoted || t.text == "" {
+		return nil, invalidFilter("缺少属性名")
+	}
+	attr := strings.ToLower(t.text)
+	attr = strings.TrimPrefix(attr, scimUserSchemaPrefix)
+	if prefix != "" {
+		attr = prefix + "." + attr
+	}
+	if len(p.tokens) > 0 && p.tokens[0].text == "[" && !p.tokens[0].quoted {
+		if prefix != "" {
+			return nil, invalidFilter("不支持嵌套的复合属性")
+		}
+		p.next()
+		var conds []scimCond
+		for {
+			c, err := p.cond(attr)
+			if err != nil {
+				return nil, err
+			}
+			conds = append(conds, c...)
+			t := p.next()
+			if t.text == "]" && !t.quoted {
+				return conds, nil
+			}
+			if t.quoted || strings.ToLower(t.text) != "and" {
+				return nil, invalidFilter("复合属性条件须以 ] 结束")
+			}
+		}
+	}
+	if !p.attrs[attr] {
+		return nil, invalidFilter(fmt.Sprintf("不支持按 %s 过滤", t.text))
+	}
+	opTok := p.next()
+	op := strings.ToLower(opTok.text)
+	switch op {
+	case "pr":
+		return []scimCond{{attr: attr, op: op}}, nil
+	case "eq", "ne", "co", "sw", "ew":
+	default:
+		return nil, invalidFilter(fmt.Sprintf("不支持的运算符: %s", opTok.text))
+	}
+	if len(p.tokens) == 0 {
+		return nil, invalidFilter("缺少比较值")
+	}
+	v := p.next()
+	value := v.text
+	if !v.quoted {
+		value = strings.ToLower(value)
+	}
+	return []scimCond{{attr: attr, op: op, value: value}}, nil
+}
+
+// match 全部条件成立；字符串比较不区分大小写，多值属性任一值满足即可
+func (f scimFilter) match(attr func(name string) []string) bool {
+	for _, c := range f {
+		if !c.match(attr(c.attr)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c scimCond) match(values []string) bool {
+	want := strings.ToLower(c.value)
+	if c.op == "ne" {
+		for _, v := range values {
+			if strings.ToLower(v) == want {
+				return false
+			}
+		}
+		return true
+	}
+	for _, v := range values {
+		v = strings.ToLower(v)
+		var ok bool
+		switch c.op {
+		case "pr":
+			ok = v != ""
+		case "eq":
+			ok = v == want
+		case "co":
+			ok = strings.Contains(v, want)
+		case "sw":
+			ok = strings.HasPrefix(v, want)
+		case "ew":
+			ok = strings.HasSuffix(v, want)
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
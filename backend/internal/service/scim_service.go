@@ -0,0 +1,914 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"dvr-manager/internal/repository"
+)
+
+// SCIM 分页：未指定 count 时每页条数与上限
+const (
+	SCIMDefaultCount = 100
+	SCIMMaxCount     = 200
+)
+
+// scimMinTokenLength SCIM_TOKEN 最短长度
+const scimMinTokenLength = 32
+
+// SCIMTokenFromEnv SCIM 接口的 Bearer 令牌（SCIM_TOKEN）；未设置或过短时返回空，SCIM 接口不启用
+func SCIMTokenFromEnv() string {
+	token := strings.TrimSpace(os.Getenv("SCIM_TOKEN"))
+	if token != "" && len(token) < scimMinTokenLength {
+		log.Printf("[SCIM] SCIM_TOKEN 至少 %d 个字符，SCIM 接口未启用", scimMinTokenLength)
+		return ""
+	}
+	return token
+}
+
+// SCIMError SCIM 错误响应（RFC 7644 §3.12），Type 为 scimType（可为空）
+type SCIMError struct {
+	Status int
+	Type   string
+	Detail string
+}
+
+func (e *SCIMError) Error() string { return e.Detail }
+
+func scimErr(status int, scimType, detail string) error {
+	return &SCIMError{Status: status, Type: scimType, Detail: detail}
+}
+
+// SCIMQuery 列表查询：filter 与 1 起始的分页
+type SCIMQuery struct {
+	Filter     string
+	StartIndex int
+	Count      int
+}
+
+// SCIMUser SCIM User 资源对应的账号
+type SCIMUser struct {
+	ID           int64
+	UserName     string
+	ExternalID   string
+	DisplayName  string
+	Email        string
+	Active       bool
+	Groups       []repository.UserGroup
+	Created      time.Time
+	LastModified time.Time
+}
+
+// SCIMMember 组成员
+type SCIMMember struct {
+	UserID   int64
+	UserName string
+}
+
+// SCIMGroup SCIM Group 资源对应的用户组
+type SCIMGroup struct {
+	ID           int64
+	DisplayName  string
+	Members      []SCIMMember
+	Created      time.Time
+	LastModified time.Time
+}
+
+// SCIMName User.name
+type SCIMName struct {
+	Formatted  string `json:"formatted"`
+	GivenName  string `json:"givenName"`
+	FamilyName string `json:"familyName"`
+}
+
+// SCIMEmail User.emails 的元素
+type SCIMEmail struct {
+	Value   string `json:"value"`
+	Type    string `json:"type"`
+	Primary bool   `json:"primary"`
+}
+
+// SCIMUserInput 创建 / 替换用户的请求体（未列出的属性忽略）
+type SCIMUserInput struct {
+	UserName    string      `json:"userName"`
+	ExternalID  string      `json:"externalId"`
+	DisplayName string      `json:"displayName"`
+	Name        *SCIMName   `json:"name"`
+	Emails      []SCIMEmail `json:"emails"`
+	Active      *bool       `json:"active"`
+}
+
+// SCIMMemberRef Group.members 的元素，value 为用户 id
+type SCIMMemberRef struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+}
+
+// SCIMGroupInput 创建 / 替换用户组的请求体
+type SCIMGroupInput struct {
+	DisplayName string          `json:"displayName"`
+	Members     []SCIMMemberRef `json:"members"`
+}
+
+// SCIMPatchOp PATCH 请求中的一项操作
+type SCIMPatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// SCIMService SCIM 2.0 预配：IdP 创建的用户为 source=scim 的账号（无密码，经 SSO 登录），
+// 亦可管理 SSO 登录时创建的账号；本地与 LDAP 账号对 SCIM 不可见。
+// active=false 立即停用账号并吊销会话，删除用户同时删除账号。用户组映射为本系统用户组，
+// SCIM 写入的成员关系来源为 scim，不影响手动添加或 SSO 同步的成员
+type SCIMService interface {
+	ListUsers(q SCIMQuery) ([]SCIMUser, int, error)
+	GetUser(id int64) (*SCIMUser, error)
+	CreateUser(in *SCIMUserInput) (*SCIMUser, error)
+	ReplaceUser(id int64, in *SCIMUserInput) (*SCIMUser, error)
+	PatchUser(id int64, ops []SCIMPatchOp) (*SCIMUser, error)
+	DeleteUser(id int64) (*SCIMUser, error)
+
+	ListGroups(q SCIMQuery) ([]SCIMGroup, int, error)
+	GetGroup(id int64) (*SCIMGroup, error)
+	CreateGroup(in *SCIMGroupInput) (*SCIMGroup, error)
+	ReplaceGroup(id int64, in *SCIMGroupInput) (*SCIMGroup, error)
+	PatchGroup(id int64, ops []SCIMPatchOp) (*SCIMGroup, error)
+	// DeleteGroup 删除由 SCIM 创建的组；管理员创建的组仅移除 SCIM 写入的成员，组本身保留
+	DeleteGroup(id int64) (*SCIMGroup, error)
+}
+
+type scimService struct {
+	users  repository.UserRepository
+	groups repository.GroupRepository
+	auth   AuthService
+	roles  RoleService
+}
+
+// NewSCIMService 创建 SCIM 服务；停用与删除账号经 auth 完成以吊销会话，roles 用于校验 SCIM_DEFAULT_ROLE
+func NewSCIMService(users repository.UserRepository, groups repository.GroupRepository, auth AuthService, roles RoleService) SCIMService {
+	return &scimService{users: users, groups: groups, auth: auth, roles: roles}
+}
+
+// scimDefaultRole SCIM 创建账号的角色（SCIM_DEFAULT_ROLE，默认 user），更多角色通过用户组授予
+func (s *scimService) scimDefaultRole() string {
+	role := strings.TrimSpace(os.Getenv("SCIM_DEFAULT_ROLE"))
+	if role == "" {
+		return RoleUser
+	}
+	if s.roles != nil && !s.roles.Exists(role) {
+		log.Printf("[SCIM] SCIM_DEFAULT_ROLE %q 不存在，使用 user", role)
+		return RoleUser
+	}
+	return role
+}
+
+// scimSSOLinkAllowed SCIM 账号没有密码，无法确认关联，首次 SSO 登录时按用户名自动关联；
+// SCIM_SSO_SOURCES（逗号分隔，如 oidc:1,saml:2）限定允许自动关联的 SSO 来源，未设置时不限
+func scimSSOLinkAllowed(source string) bool {
+	v := strings.TrimSpace(os.Getenv("SCIM_SSO_SOURCES"))
+	if v == "" {
+		return true
+	}
+	for _, s := range strings.Split(v, ",") {
+		if strings.TrimSpace(s) == source {
+			return true
+		}
+	}
+	return false
+}
+
+// scimManaged 账号是否可由 SCIM 管理：SCIM 预配或 SSO 登录创建的账号
+func scimManaged(u *repository.User) bool {
+	return u.Source == repository.SourceSCIM || strings.HasPrefix(u.Source, "oidc:") || strings.HasPrefix(u.Source, "saml:")
+}
+
+func toSCIMUser(u *repository.User) SCIMUser {
+	return SCIMUser{
+		ID: u.ID, UserName: u.Username, ExternalID: u.ExternalID, DisplayName: u.DisplayName, Email: u.Email,
+		Active: !u.Disabled, Groups: u.Groups, Created: u.CreatedAt, LastModified: u.UpdatedAt,
+	}
+}
+
+func (s *scimService) managedUser(id int64) (*repository.User, error) {
+	u, err := s.users.GetByID(id)
+	if errors.Is(err, repository.ErrUserNotFound) || (err == nil && !scimManaged(u)) {
+		return nil, scimErr(http.StatusNotFound, "", "用户不存在")
+	}
+	return u, err
+}
+
+// ListUsers 按 filter 筛选后分页，返回当前页与总数
+func (s *scimService) ListUsers(q SCIMQuery) ([]SCIMUser, int, error) {
+	filter, err := parseSCIMFilter(q.Filter, scimUserAttrs)
+	if err != nil {
+		return nil, 0, err
+	}
+	all, err := s.users.List(repository.UserFilter{})
+	if err != nil {
+		return nil, 0, err
+	}
+	matched := []SCIMUser{}
+	for i := range all {
+		if !scimManaged(&all[i]) {
+			continue
+		}
+		u := toSCIMUser(&all[i])
+		if filter.match(u.attr) {
+			matched = append(matched, u)
+		}
+	}
+	page, total := scimPage(matched, q)
+	return page, total, nil
+}
+
+// GetUser 按 id 查询
+func (s *scimService) GetUser(id int64) (*SCIMUser, error) {
+	u, err := s.managedUser(id)
+	if err != nil {
+		return nil, err
+	}
+	out := toSCIMUser(u)
+	return &out, nil
+}
+
+// CreateUser 以 SCIM_DEFAULT_ROLE 创建 source=scim 的账号；用户名已存在时返回 409 uniqueness
+func (s *scimService) CreateUser(in *SCIMUserInput) (*SCIMUser, error) {
+	st := scimUserState{Active: true}
+	st.applyInput(in)
+	st.UserName = strings.TrimSpace(st.UserName)
+	if st.UserName == "" {
+		return nil, scimErr(http.StatusBadRequest, "invalidValue", "userName 不能为空")
+	}
+	if utf8.RuneCountInString(st.UserName) > 64 {
+		return nil, scimErr(http.StatusBadRequest, "invalidValue", "userName 不能超过 64 个字符")
+	}
+	u, err := s.users.CreateSSO(st.UserName, s.scimDefaultRole(), repository.SourceSCIM)
+	if errors.Is(err, repository.ErrUserExists) {
+		return nil, scimErr(http.StatusConflict, "uniqueness", "用户名已存在")
+	}
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[SCIM] created user %s (role=%s)", u.Username, u.Role)
+	return s.saveUser(u, st)
+}
+
+// ReplaceUser 以请求体替换可写属性（未提供 active 时视为 true）
+func (s *scimService) ReplaceUser(id int64, in *SCIMUserInput) (*SCIMUser, error) {
+	u, err := s.managedUser(id)
+	if err != nil {
+		return nil, err
+	}
+	st := scimUserState{Active: true}
+	st.applyInput(in)
+	if strings.TrimSpace(st.UserName) == "" {
+		st.UserName = u.Username
+	}
+	return s.saveUser(u, st)
+}
+
+// PatchUser 依次应用 add / replace / remove 操作
+func (s *scimService) PatchUser(id int64, ops []SCIMPatchOp) (*SCIMUser, error) {
+	u, err := s.managedUser(id)
+	if err != nil {
+		return nil, err
+	}
+	st := scimUserState{UserName: u.Username, ExternalID: u.ExternalID, DisplayName: u.DisplayName, Email: u.Email, Active: !u.Disabled}
+	for _, op := range ops {
+		if err := st.applyOp(op); err != nil {
+			return nil, err
+		}
+	}
+	return s.saveUser(u, st)
+}
+
+// DeleteUser 删除账号（吊销会话）；不能删除最后一个启用的管理员
+func (s *scimService) DeleteUser(id int64) (*SCIMUser, error) {
+	u, err := s.managedUser(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkLastAdmin(u); err != nil {
+		return nil, err
+	}
+	if err := s.auth.DeleteUser(id); err != nil {
+		return nil, err
+	}
+	out := toSCIMUser(u)
+	return &out, nil
+}
+
+// saveUser 写入 externalId、资料与启用状态；userName 不可修改
+func (s *scimService) saveUser(u *repository.User, st scimUserState) (*SCIMUser, error) {
+	if strings.TrimSpace(st.UserName) != u.Username {
+		return nil, scimErr(http.StatusBadRequest, "mutability", "不支持修改 userName")
+	}
+	if st.ExternalID != u.ExternalID {
+		if err := s.users.SetExternalID(u.ID, strings.TrimSpace(st.ExternalID)); err != nil {
+			return nil, err
+		}
+	}
+	profile := repository.UserProfile{Email: strings.TrimSpace(st.Email), DisplayName: st.displayName()}
+	if profile.Email != u.Email || profile.DisplayName != u.DisplayName {
+		if err := s.users.UpdateProfile(u.ID, profile); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case !st.Active && !u.Disabled:
+		if err := s.checkLastAdmin(u); err != nil {
+			return nil, err
+		}
+		if err := s.auth.SetUserDisabled(u.ID, true, repository.DisabledReasonSCIM); err != nil {
+			return nil, err
+		}
+	case st.Active && u.Disabled && u.DisabledReason == repository.DisabledReasonSCIM:
+		// 仅恢复由 SCIM 停用的账号；管理员停用或到期停用的账号须由管理员启用
+		if err := s.auth.SetUserDisabled(u.ID, false, ""); err != nil {
+			return nil, scimErr(http.StatusBadRequest, "invalidValue", err.Error())
+		}
+	}
+	return s.GetUser(u.ID)
+}
+
+// checkLastAdmin 停用或删除管理员前确认仍有其他启用的管理员
+func (s *scimService) checkLastAdmin(u *repository.User) error {
+	if u.Role != RoleAdmin || u.Disabled {
+		return nil
+	}
+	admins, err := s.users.List(repository.UserFilter{Role: RoleAdmin, Status: "enabled"})
+	if err != nil {
+		return err
+	}
+	if len(admins) <= 1 {
+		return scimErr(http.StatusBadRequest, "", "不能停用或删除最后一个启用的管理员")
+	}
+	return nil
+}
+
+// scimUserState 用户可写属性
+type scimUserState struct {
+	UserName    string
+	ExternalID  string
+	DisplayName string
+	Name        SCIMName
+	Email       string
+	Active      bool
+}
+
+// displayName displayName 优先，其次 name.formatted、givenName + familyName
+func (st *scimUserState) displayName() string {
+	if v := strings.TrimSpace(st.DisplayName); v != "" {
+		return v
+	}
+	if v := strings.TrimSpace(st.Name.Formatted); v != "" {
+		return v
+	}
+	return strings.TrimSpace(strings.TrimSpace(st.Name.GivenName) + " " + strings.TrimSpace(st.Name.FamilyName))
+}
+
+func (st *scimUserState) applyInput(in *SCIMUserInput) {
+	st.UserName = in.UserName
+	st.ExternalID = in.ExternalID
+	st.DisplayName = in.DisplayName
+	if in.Name != nil {
+		st.Name = *in.Name
+	}
+	st.Email = primaryEmail(in.Emails)
+	if in.Active != nil {
+		st.Active = *in.Active
+	}
+}
+
+// primaryEmail primary 为 true 的邮箱，没有时取第一个
+func primaryEmail(list []SCIMEmail) string {
+	for _, e := range list {
+		if e.Primary {
+			return e.Value
+		}
+	}
+	if len(list) > 0 {
+		return list[0].Value
+	}
+	return ""
+}
+
+const scimUserSchemaPrefix = "urn:ietf:params:scim:schemas:core:2.0:user:"
+
+// applyOp 应用一项 PATCH 操作；不支持的属性忽略（如企业扩展属性）
+func (st *scimUserState) applyOp(op SCIMPatchOp) error {
+	kind := strings.ToLower(strings.TrimSpace(op.Op))
+	if kind != "add" && kind != "replace" && kind != "remove" {
+		return scimErr(http.StatusBadRequest, "invalidSyntax", fmt.Sprintf("不支持的操作: %s", op.Op))
+	}
+	path := strings.ToLower(strings.TrimSpace(op.Path))
+	path = strings.TrimPrefix(path, scimUserSchemaPrefix)
+	if path == "" {
+		if kind == "remove" {
+			return scimErr(http.StatusBadRequest, "noTarget", "remove 操作须指定 path")
+		}
+		var attrs map[string]json.RawMessage
+		if err := json.Unmarshal(op.Value, &attrs); err != nil {
+			return scimErr(http.StatusBadRequest, "invalidValue", "无 path 时 value 须为对象")
+		}
+		for k, v := range attrs {
+			if err := st.set(strings.TrimPrefix(strings.ToLower(k), scimUserSchemaPrefix), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if kind == "remove" {
+		return st.set(path, json.RawMessage(`null`))
+	}
+	return st.set(path, op.Value)
+}
+
+// set 设置属性；value 为 null 表示清除
+func (st *scimUserState) set(path string, value json.RawMessage) error {
+	str := func(dst *string) error {
+		if string(value) == "null" {
+			*dst = ""
+			return nil
+		}
+		if err := json.Unmarshal(value, dst); err != nil {
+			return scimErr(http.StatusBadRequest, "invalidValue", fmt.Sprintf("%s 须为字符串", path))
+		}
+		return nil
+	}
+	switch {
+	case path == "username":
+		if string(value) == "null" {
+			return scimErr(http.StatusBadRequest, "mutability", "userName 不能移除")
+		}
+		return str(&st.UserName)
+	case path == "externalid":
+		return str(&st.ExternalID)
+	case path == "displayname":
+		return str(&st.DisplayName)
+	case path == "name":
+		st.Name = SCIMName{}
+		if string(value) != "null" {
+			if err := json.Unmarshal(value, &st.Name); err != nil {
+				return scimErr(http.StatusBadRequest, "invalidValue", "name 须为对象")
+			}
+		}
+		return nil
+	case path == "name.formatted":
+		return str(&st.Name.Formatted)
+	case path == "name.givenname":
+		return str(&st.Name.GivenName)
+	case path == "name.familyname":
+		return str(&st.Name.FamilyName)
+	case path == "emails":
+		var list []SCIMEmail
+		if string(value) != "null" {
+			if err := json.Unmarshal(value, &list); err != nil {
+				return scimErr(http.StatusBadRequest, "invalidValue", "emails 须为数组")
+			}
+		}
+		st.Email = primaryEmail(list)
+		return nil
+	case strings.HasPrefix(path, "emails[") && strings.HasSuffix(path, "].value"):
+		return str(&st.Email)
+	case path == "active":
+		if string(value) == "null" {
+			return nil
+		}
+		active, err := scimBool(value)
+		if err != nil {
+			return err
+		}
+		st.Active = active
+		return nil
+	}
+	return nil
+}
+
+// scimBool 接受 true / false 及其字符串形式（部分 IdP 以 "False" 发送）
+func scimBool(value json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(value, &b); err == nil {
+		return b, nil
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b, nil
+		}
+	}
+	return false, scimErr(http.StatusBadRequest, "invalidValue", "active 须为布尔值")
+}
+
+// attr 过滤时的属性值（属性名小写）
+func (u SCIMUser) attr(name string) []string {
+	switch name {
+	case "id":
+		return []string{strconv.FormatInt(u.ID, 10)}
+	case "username":
+		return []string{u.UserName}
+	case "externalid":
+		return []string{u.ExternalID}
+	case "displayname", "name.formatted":
+		return []string{u.DisplayName}
+	case "emails", "emails.value":
+		return []string{u.Email}
+	case "active":
+		return []string{strconv.FormatBool(u.Active)}
+	}
+	return nil
+}
+
+var scimUserAttrs = map[string]bool{
+	"id": true, "username": true, "externalid": true, "displayname": true, "name.formatted": true,
+	"emails": true, "emails.value": true, "active": true,
+}
+
+var scimGroupAttrs = map[string]bool{
+	"id": true, "displayname": true, "members": true, "members.value": true,
+}
+
+// ---------- 用户组 ----------
+
+func (s *scimService) managedGroup(id int64) (*repository.Group, error) {
+	g, err := s.groups.Get(id)
+	if errors.Is(err, repository.ErrGroupNotFound) {
+		return nil, scimErr(http.StatusNotFound, "", "用户组不存在")
+	}
+	return g, err
+}
+
+// managedUserIDs 可由 SCIM 管理的账号（用于组成员展示与校验）
+func (s *scimService) managedUserIDs() (map[int64]bool, error) {
+	all, err := s.users.List(repository.UserFilter{})
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[int64]bool, len(all))
+	for i := range all {
+		if scimManaged(&all[i]) {
+			ids[all[i].ID] = true
+		}
+	}
+	return ids, nil
+}
+
+// toSCIMGroup 组成员只包含 SCIM 可见的账号
+func (s *scimService) toSCIMGroup(g *repository.Group, managed map[int64]bool) (SCIMGroup, error) {
+	out := SCIMGroup{ID: g.ID, DisplayName: g.Name, Members: []SCIMMember{}, Created: g.CreatedAt, LastModified: g.UpdatedAt}
+	members, err := s.groups.ListMembers(g.ID)
+	if err != nil {
+		return out, err
+	}
+	for _, m := range members {
+		if managed[m.UserID] {
+			out.Members = append(out.Members, SCIMMember{UserID: m.UserID, UserName: m.Username})
+		}
+	}
+	return out, nil
+}
+
+// ListGroups 按 filter 筛选后分页
+func (s *scimService) ListGroups(q SCIMQuery) ([]SCIMGroup, int, error) {
+	filter, err := parseSCIMFilter(q.Filter, scimGroupAttrs)
+	if err != nil {
+		return nil, 0, err
+	}
+	groups, err := s.groups.List()
+	if err != nil {
+		return nil, 0, err
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].ID < groups[j].ID })
+	managed, err := s.managedUserIDs()
+	if err != nil {
+		return nil, 0, err
+	}
+	matched := []SCIMGroup{}
+	for i := range groups {
+		g, err := s.toSCIMGroup(&groups[i], managed)
+		if err != nil {
+			return nil, 0, err
+		}
+		if filter.match(g.attr) {
+			matched = append(matched, g)
+		}
+	}
+	page, total := scimPage(matched, q)
+	return page, total, nil
+}
+
+// GetGroup 按 id 查询
+func (s *scimService) GetGroup(id int64) (*SCIMGroup, error) {
+	g, err := s.managedGroup(id)
+	if err != nil {
+		return nil, err
+	}
+	managed, err := s.managedUserIDs()
+	if err != nil {
+		return nil, err
+	}
+	out, err := s.toSCIMGroup(g, managed)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateGroup 创建 source=scim 的用户组（不授予角色，角色由管理员在组上设置）
+func (s *scimService) CreateGroup(in *SCIMGroupInput) (*SCIMGroup, error) {
+	name, err := scimGroupName(in.DisplayName)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := s.memberIDs(in.Members)
+	if err != nil {
+		return nil, err
+	}
+	g := &repository.Group{Name: name, Source: repository.SourceSCIM}
+	if err := s.groups.Create(g); err != nil {
+		if errors.Is(err, repository.ErrGroupExists) {
+			return nil, scimErr(http.StatusConflict, "uniqueness", "用户组名称已存在")
+		}
+		return nil, err
+	}
+	for _, uid := range ids {
+		if err := s.groups.AddSourceMember(g.ID, uid, repository.SourceSCIM); err != nil {
+			return nil, err
+		}
+	}
+	return s.GetGroup(g.ID)
+}
+
+// ReplaceGroup 替换名称与成员（仅 SCIM 写入的成员关系会被移除）
+func (s *scimService) ReplaceGroup(id int64, in *SCIMGroupInput) (*SCIMGroup, error) {
+	g, err := s.managedGroup(id)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(in.DisplayName) != "" {
+		if err := s.renameGroup(g, in.DisplayName); err != nil {
+			return nil, err
+		}
+	}
+	ids, err := s.memberIDs(in.Members)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.replaceMembers(g.ID, ids); err != nil {
+		return nil, err
+	}
+	return s.GetGroup(id)
+}
+
+// PatchGroup 支持 displayName、members 的 add / replace / remove 及 members[value eq "id"] 的 remove
+func (s *scimService) PatchGroup(id int64, ops []SCIMPatchOp) (*SCIMGroup, error) {
+	g, err := s.managedGroup(id)
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range ops {
+		if err := s.applyGroupOp(g, op); err != nil {
+			return nil, err
+		}
+	}
+	return s.GetGroup(id)
+}
+
+func (s *scimService) applyGroupOp(g *repository.Group, op SCIMPatchOp) error {
+	kind := strings.ToLower(strings.TrimSpace(op.Op))
+	if kind != "add" && kind != "replace" && kind != "remove" {
+		return scimErr(http.StatusBadRequest, "invalidSyntax", fmt.Sprintf("不支持的操作: %s", op.Op))
+	}
+	path := strings.TrimSpace(op.Path)
+	lower := strings.ToLower(path)
+	switch {
+	case lower == "":
+		if kind == "remove" {
+			return scimErr(http.StatusBadRequest, "noTarget", "remove 操作须指定 path")
+		}
+		var in struct {
+			DisplayName *string          `json:"displayName"`
+			Members     *[]SCIMMemberRef `json:"members"`
+		}
+		if err := json.Unmarshal(op.Value, &in); err != nil {
+			return scimErr(http.StatusBadRequest, "invalidValue", "无 path 时 value 须为对象")
+		}
+		if in.DisplayName != nil {
+			if err := s.renameGroup(g, *in.DisplayName); err != nil {
+				return err
+			}
+		}
+		if in.Members != nil {
+			return s.patchMembers(g.ID, kind, *in.Members)
+		}
+		return nil
+	case lower == "displayname":
+		if kind == "remove" {
+			return scimErr(http.StatusBadRequest, "mutability", "displayName 不能移除")
+		}
+		var name string
+		if err := json.Unmarshal(op.Value, &name); err != nil {
+			return scimErr(http.StatusBadRequest, "invalidValue", "displayName 须为字符串")
+		}
+		return s.renameGroup(g, name)
+	case lower == "members":
+		var refs []SCIMMemberRef
+		if len(op.Value) > 0 && string(op.Value) != "null" {
+			if err := json.Unmarshal(op.Value, &refs); err != nil {
+				return scimErr(http.StatusBadRequest, "invalidValue", "members 须为数组")
+			}
+		}
+		if kind == "remove" && len(refs) == 0 {
+			return s.replaceMembers(g.ID, nil)
+		}
+		return s.patchMembers(g.ID, kind, refs)
+	case strings.HasPrefix(lower, "members["):
+		if kind != "remove" {
+			return scimErr(http.StatusBadRequest, "invalidPath", "members[...] 仅支持 remove")
+		}
+		inner := strings.TrimSuffix(path[len("members["):], "]")
+		filter, err := parseSCIMFilter(inner, map[string]bool{"value": true})
+		if err != nil {
+			return scimErr(http.StatusBadRequest, "invalidPath", err.Error())
+		}
+		members, err := s.groups.ListMembers(g.ID)
+		if err != nil {
+			return err
+		}
+		for _, m := range members {
+			id := strconv.FormatInt(m.UserID, 10)
+			if filter.match(func(string) []string { return []string{id} }) {
+				if _, err := s.groups.RemoveSourceMember(g.ID, m.UserID, repository.SourceSCIM); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return nil
+}
+
+func (s *scimService) patchMembers(groupID int64, kind string, refs []SCIMMemberRef) error {
+	ids, err := s.memberIDs(refs)
+	if err != nil {
+		return err
+	}
+	switch kind {
+	case "replace":
+		return s.replaceMembers(groupID, ids)
+	case "remove":
+		for _, uid := range ids {
+			if _, err := s.groups.RemoveSourceMember(groupID, uid, repository.SourceSCIM); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, uid := range ids {
+		if err := s.groups.AddSourceMember(groupID, uid, repository.SourceSCIM); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceMembers 使 SCIM 来源的成员恰为 ids；其他来源的成员关系保持不变
+func (s *scimService) replaceMembers(groupID int64, ids []int64) error {
+	want := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		want[id] = true
+	}
+	members, err := s.groups.ListMembers(groupID)
+	if err != nil {
+		return err
+	}
+	for _, m := range members {
+		if m.Source == repository.SourceSCIM && !want[m.UserID] {
+			if _, err := s.groups.RemoveSourceMember(groupID, m.UserID, repository.SourceSCIM); err != nil {
+				return err
+			}
+		}
+	}
+	for _, id := range ids {
+		if err := s.groups.AddSourceMember(groupID, id, repository.SourceSCIM); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renameGroup 仅 SCIM 创建的组可改名
+func (s *scimService) renameGroup(g *repository.Group, displayName string) error {
+	name, err := scimGroupName(displayName)
+	if err != nil || name == g.Name {
+		return err
+	}
+	if g.Source != repository.SourceSCIM {
+		return scimErr(http.StatusBadRequest, "mutability", "管理员创建的用户组不能通过 SCIM 改名")
+	}
+	g.Name = name
+	if err := s.groups.Update(g); err != nil {
+		if errors.Is(err, repository.ErrGroupExists) {
+			return scimErr(http.StatusConflict, "uniqueness", "用户组名称已存在")
+		}
+		return err
+	}
+	return nil
+}
+
+// DeleteGroup 见接口说明
+func (s *scimService) DeleteGroup(id int64) (*SCIMGroup, error) {
+	out, err := s.GetGroup(id)
+	if err != nil {
+		return nil, err
+	}
+	g, err := s.groups.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if g.Source == repository.SourceSCIM {
+		return out, s.groups.Delete(id)
+	}
+	return out, s.replaceMembers(id, nil)
+}
+
+// memberIDs 解析成员 id，成员须为 SCIM 可见的账号
+func (s *scimService) memberIDs(refs []SCIMMemberRef) ([]int64, error) {
+	if len(refs) == 0 {
+		return nil, nil
+	}
+	managed, err := s.managedUserIDs()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, 0, len(refs))
+	for _, ref := range refs {
+		id, err := strconv.ParseInt(strings.TrimSpace(ref.Value), 10, 64)
+		if err != nil || !managed[id] {
+			return nil, scimErr(http.StatusBadRequest, "invalidValue", fmt.Sprintf("成员不存在: %s", ref.Value))
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func scimGroupName(displayName string) (string, error) {
+	name := strings.TrimSpace(displayName)
+	if name == "" {
+		return "", scimErr(http.StatusBadRequest, "invalidValue", "displayName 不能为空")
+	}
+	if utf8.RuneCountInString(name) > 64 {
+		return "", scimErr(http.StatusBadRequest, "invalidValue", "displayName 不能超过 64 个字符")
+	}
+	return name, nil
+}
+
+func (g SCIMGroup) attr(name string) []string {
+	switch name {
+	case "id":
+		return []string{strconv.FormatInt(g.ID, 10)}
+	case "displayname":
+		return []string{g.DisplayName}
+	case "members", "members.value":
+		ids := make([]string, 0, len(g.Members))
+		for _, m := range g.Members {
+			ids = append(ids, strconv.FormatInt(m.UserID, 10))
+		}
+		return ids
+	}
+	return nil
+}
+
+// scimPage 1 起始的分页（RFC 7644 §3.4.2.4）
+func scimPage[T any](list []T, q SCIMQuery) ([]T, int) {
+	total := len(list)
+	start := q.StartIndex
+	if start < 1 {
+		start = 1
+	}
+	count := q.Count
+	if count < 0 {
+		count = 0
+	}
+	if count > SCIMMaxCount {
+		count = SCIMMaxCount
+	}
+	if start > total {
+		return []T{}, total
+	}
+	end := start - 1 + count
+	if end > total {
+		end = total
+	}
+	return list[start-1 : end], total
+}
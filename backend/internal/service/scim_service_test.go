@@ -0,0 +1,174 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"dvr-manager/internal/repository"
+	"dvr-manager/pkg/db"
+)
+
+func TestSCIMService_userLifecycle(t *testing.T) {
+	if err := db.InitDB(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	users := repository.NewUserRepository()
+	auth := NewAuthService(users, repository.NewIdentityRepository(), nil, nil, nil, nil)
+	svc := NewSCIMService(users, repository.NewGroupRepository(), auth, nil)
+
+	u, err := svc.CreateUser(&SCIMUserInput{
+		UserName: "erin", ExternalID: "ext-erin", Name: &SCIMName{GivenName: "Erin", FamilyName: "Lee"},
+		Emails: []SCIMEmail{{Value: "home@example.com"}, {Value: "erin@example.com", Primary: true}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !u.Active || u.DisplayName != "Erin Lee" || u.Email != "erin@example.com" || u.ExternalID != "ext-erin" {
+		t.Fatalf("created user = %+v", u)
+	}
+	var se *SCIMError
+	if _, err := svc.CreateUser(&SCIMUserInput{UserName: "erin"}); !errors.As(err, &se) || se.Status != http.StatusConflict {
+		t.Fatalf("expected uniqueness conflict, got %v", err)
+	}
+
+	// 本地账号对 SCIM 不可见
+	list, total, err := svc.ListUsers(SCIMQuery{Filter: `userName eq "ADMIN"`, Count: SCIMDefaultCount})
+	if err != nil || total != 0 || len(list) != 0 {
+		t.Fatalf("local admin visible to scim: %v total=%d err=%v", list, total, err)
+	}
+	list, total, err = svc.ListUsers(SCIMQuery{Filter: `externalId eq "ext-erin" and active eq true`, Count: SCIMDefaultCount})
+	if err != nil || total != 1 || list[0].ID != u.ID {
+		t.Fatalf("filter by externalId: %v total=%d err=%v", list, total, err)
+	}
+	if _, _, err := svc.ListUsers(SCIMQuery{Filter: `userName eq "a" or userName eq "b"`}); !errors.As(err, &se) || se.Type != "invalidFilter" {
+		t.Fatalf("expected invalidFilter, got %v", err)
+	}
+
+	// 部分 IdP 以字符串发送布尔值
+	deactivated, err := svc.PatchUser(u.ID, []SCIMPatchOp{{Op: "Replace", Path: "active", Value: json.RawMessage(`"False"`)}})
+	if err != nil || deactivated.Active {
+		t.Fatalf("deactivate: %+v err=%v", deactivated, err)
+	}
+	if _, err := auth.FindOrCreateSSOUser(&SSOIdentity{Subject: "sub-erin", Username: "erin"}, "oidc:1", ""); !errors.Is(err, ErrAccountDisabled) {
+		t.Fatalf("expected deactivated user to be rejected, got %v", err)
+	}
+	reactivated, err := svc.PatchUser(u.ID, []SCIMPatchOp{{Op: "replace", Value: json.RawMessage(`{"active":true}`)}})
+	if err != nil || !reactivated.Active {
+		t.Fatalf("reactivate: %+v err=%v", reactivated, err)
+	}
+	// 管理员停用的账号不随 SCIM 恢复
+	if err := auth.SetUserDisabled(u.ID, true, "离职"); err != nil {
+		t.Fatal(err)
+	}
+	if again, err := svc.PatchUser(u.ID, []SCIMPatchOp{{Op: "replace", Path: "active", Value: json.RawMessage(`true`)}}); err != nil || again.Active {
+		t.Fatalf("admin-disabled user re-enabled by scim: %+v err=%v", again, err)
+	}
+	if err := auth.SetUserDisabled(u.ID, false, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// SCIM 账号没有密码，首次 SSO 登录按用户名自动关联
+	t.Setenv("SCIM_SSO_SOURCES", "oidc:1")
+	if _, err := auth.FindOrCreateSSOUser(&SSOIdentity{Subject: "sub-erin", Username: "erin"}, "saml:2", ""); err == nil {
+		t.Fatal("expected provider outside SCIM_SSO_SOURCES to require link confirmation")
+	}
+	linked, err := auth.FindOrCreateSSOUser(&SSOIdentity{Subject: "sub-erin", Username: "erin"}, "oidc:1", "")
+	if err != nil || linked.ID != u.ID {
+		t.Fatalf("sso login of scim user: %+v err=%v", linked, err)
+	}
+
+	if _, err := svc.PatchUser(u.ID, []SCIMPatchOp{{Op: "replace", Path: "userName", Value: json.RawMessage(`"erin2"`)}}); !errors.As(err, &se) || se.Type != "mutability" {
+		t.Fatalf("expected userName to be immutable, got %v", err)
+	}
+	if _, err := svc.DeleteUser(u.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.GetUser(u.ID); !errors.As(err, &se) || se.Status != http.StatusNotFound {
+		t.Fatalf("expected deleted user to be gone, got %v", err)
+	}
+}
+
+func TestSCIMService_groups(t *testing.T) {
+	if err := db.InitDB(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	users := repository.NewUserRepository()
+	groupRepo := repository.NewGroupRepository()
+	auth := NewAuthService(users, repository.NewIdentityRepository(), nil, nil, nil, nil)
+	svc := NewSCIMService(users, groupRepo, auth, nil)
+
+	var ids []int64
+	for _, name := range []string{"u1", "u2", "u3"} {
+		u, err := svc.CreateUser(&SCIMUserInput{UserName: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, u.ID)
+	}
+	idStr := func(id int64) string { return strconv.FormatInt(id, 10) }
+	ref := func(id int64) string { return `{"value":"` + idStr(id) + `"}` }
+
+	// 管理员创建的组：SCIM 只能管理其写入的成员，不能改名，删除时组保留
+	ops := &repository.Group{Name: "operators", Role: RoleAdmin}
+	if err := groupRepo.Create(ops); err != nil {
+		t.Fatal(err)
+	}
+	if err := groupRepo.AddMember(ops.ID, ids[0], repository.GroupMemberManual); err != nil {
+		t.Fatal(err)
+	}
+	g, err := svc.PatchGroup(ops.ID, []SCIMPatchOp{{Op: "add", Path: "members", Value: json.RawMessage(`[` + ref(ids[0]) + `,` + ref(ids[1]) + `]`)}})
+	if err != nil || len(g.Members) != 2 {
+		t.Fatalf("add members: %+v err=%v", g, err)
+	}
+	g, err = svc.PatchGroup(ops.ID, []SCIMPatchOp{{Op: "remove", Path: `members[value eq "` + idStr(ids[0]) + `"]`}})
+	if err != nil || len(g.Members) != 2 {
+		t.Fatalf("manual membership removed by scim: %+v err=%v", g, err)
+	}
+	var se *SCIMError
+	if _, err := svc.PatchGroup(ops.ID, []SCIMPatchOp{{Op: "replace", Path: "displayName", Value: json.RawMessage(`"ops"`)}}); !errors.As(err, &se) {
+		t.Fatalf("expected rename of manual group to fail, got %v", err)
+	}
+	if _, err := svc.DeleteGroup(ops.ID); err != nil {
+		t.Fatal(err)
+	}
+	members, err := groupRepo.ListMembers(ops.ID)
+	if err != nil || len(members) != 1 || members[0].UserID != ids[0] {
+		t.Fatalf("members after scim delete of manual group: %+v err=%v", members, err)
+	}
+
+	// SCIM 创建的组
+	created, err := svc.CreateGroup(&SCIMGroupInput{DisplayName: "site-a", Members: []SCIMMemberRef{{Value: idStr(ids[2])}}})
+	if err != nil || len(created.Members) != 1 {
+		t.Fatalf("create group: %+v err=%v", created, err)
+	}
+	list, total, err := svc.ListGroups(SCIMQuery{Filter: `displayName eq "SITE-A"`, Count: SCIMDefaultCount})
+	if err != nil || total != 1 || list[0].ID != created.ID {
+		t.Fatalf("filter groups: %v total=%d err=%v", list, total, err)
+	}
+	if _, err := svc.CreateGroup(&SCIMGroupInput{DisplayName: "site-b", Members: []SCIMMemberRef{{Value: "1"}}}); !errors.As(err, &se) || se.Type != "invalidValue" {
+		t.Fatalf("expected local admin to be rejected as member, got %v", err)
+	}
+	if _, err := svc.DeleteGroup(created.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := groupRepo.Get(created.ID); !errors.Is(err, repository.ErrGroupNotFound) {
+		t.Fatalf("expected scim group to be deleted, got %v", err)
+	}
+}
+
+func TestSCIMPage(t *testing.T) {
+	list := []int{1, 2, 3, 4, 5}
+	if page, total := scimPage(list, SCIMQuery{StartIndex: 4, Count: 10}); total != 5 || len(page) != 2 || page[0] != 4 {
+		t.Fatalf("page=%v total=%d", page, total)
+	}
+	if page, _ := scimPage(list, SCIMQuery{StartIndex: 9, Count: 10}); len(page) != 0 {
+		t.Fatalf("page past end = %v", page)
+	}
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"dvr-manager/internal/auth"
+	"dvr-manager/internal/repository"
+)
+
+// 会话吊销原因
+const (
+	RevokeReasonLogout       = "logout"
+	RevokeReasonAdmin        = "admin_revoke"
+	RevokeReasonRoleChange   = "role_change"
+	RevokeReasonUserDeleted  = "user_deleted"
+	RevokeReasonUserDisabled = "user_disabled"
+	RevokeReasonTokenReuse   = "refresh_reuse"
+	RevokeReasonImpersonate  = "impersonation_end"
+)
+
+// ErrSessionInvalid 访问令牌对应的会话不存在、已吊销或用户状态已变化
+var ErrSessionInvalid = errors.New("会话已失效，请重新登录")
+
+// SessionService 服务端会话：访问令牌校验与吊销
+type SessionService interface {
+	// Validate 校验令牌所属会话仍有效、用户仍存在且角色未变化，返回当前用户；
+	// 模拟登录会话另填充 User.Impersonator（发起的管理员）
+	Validate(claims *auth.Claims) (*User, error)
+	Get(id string) (*repository.Session, error)
+	List(userID int64, activeOnly bool) ([]repository.Session, error)
+	// Revoke 吊销单个会话及其刷新令牌
+	Revoke(id, reason string) (bool, error)
+	// RevokeUser 吊销用户全部会话及刷新令牌，返回吊销数量
+	RevokeUser(userID int64, reason string) (int, error)
+}
+
+type sessionService struct {
+	repo        repository.SessionRepository
+	refreshRepo repository.RefreshTokenRepository
+	userRepo    repository.UserRepository
+}
+
+// NewSessionService 创建会话服务
+func NewSessionService(repo repository.SessionRepository, refreshRepo repository.RefreshTokenRepository, userRepo repository.UserRepository) SessionService {
+	return &sessionService{repo: repo, refreshRepo: refreshRepo, userRepo: userRepo}
+}
+
+// Validate 校验会话与用户
+func (s *sessionService) Validate(claims *auth.Claims) (*User, error) {
+	if claims == nil || claims.SessionID == "" || claims.Purpose != "" {
+		return nil, ErrSessionInvalid
+	}
+	sess, err := s.repo.Get(claims.SessionID)
+	if err != nil {
+		if errors.Is(err, repository.ErrSessionNotFound) {
+			return nil, ErrSessionInvalid
+		}
+		return nil, err
+	}
+	if !sess.Active(time.Now()) {
+		return nil, ErrSessionInvalid
+	}
+	u, err := s.userRepo.GetByID(sess.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, ErrSessionInvalid
+		}
+		return nil, err
+	}
+	if u.Username != claims.Username || u.Role != claims.Role {
+		return nil, ErrSessionInvalid
+	}
+	user := toUser(u)
+	if sess.ImpersonatorID != 0 || claims.Actor != nil {
+		actor, err := s.impersonator(sess, claims)
+		if err != nil {
+			return nil, err
+		}
+		user.Impersonator = actor
+	}
+	return user, nil
+}
+
+// impersonator 模拟登录会话的管理员：令牌 act 声明须与会话记录一致，且管理员仍存在
+func (s *sessionService) impersonator(sess *repository.Session, claims *auth.Claims) (*User, error) {
+	if sess.ImpersonatorID == 0 || claims.Actor == nil || claims.Actor.UserID != sess.ImpersonatorID {
+		return nil, ErrSessionInvalid
+	}
+	a, err := s.userRepo.GetByID(sess.ImpersonatorID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, ErrSessionInvalid
+		}
+		return nil, err
+	}
+	if a.Username != claims.Actor.Subject {
+		return nil, ErrSessionInvalid
+	}
+	return toUser(a), nil
+}
+
+// Get 查询会话
+func (s *sessionService) Get(id string) (*repository.Session, error) {
+	return s.repo.Get(id)
+}
+
+// List 列出用户会话
+func (s *sessionService) List(userID int64, activeOnly bool) ([]repository.Session, error) {
+	return s.repo.ListByUser(userID, activeOnly)
+}
+
+// Revoke 吊销单个会话
+func (s *sessionService) Revoke(id, reason string) (bool, error) {
+	ok, err := s.repo.Revoke(id, reason)
+	if err != nil {
+		return false, err
+	}
+	if _, err := s.refreshRepo.RevokeFamily(id); err != nil {
+		return ok, err
+	}
+	return ok, nil
+}
+
+// RevokeUser 吊销用户全部会话
+func (s *sessionService) RevokeUser(userID int64, reason string) (int, error) {
+	ids, err := s.repo.RevokeUser(userID, reason)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := s.refreshRepo.RevokeUser(userID); err != nil {
+		return len(ids), err
+	}
+	return len(ids), nil
+}
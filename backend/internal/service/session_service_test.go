@@ -0,0 +1,115 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"dvr-manager/internal/auth"
+	"dvr-manager/internal/repository"
+	"dvr-manager/pkg/db"
+)
+
+func TestSessionService_roleChangeRevokesSessions(t *testing.T) {
+	dir := t.TempDir()
+	if err := db.InitDB(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	jwt := newTestJWT(t)
+	userRepo := repository.NewUserRepository()
+	refreshRepo := repository.NewRefreshTokenRepository()
+	sessionRepo := repository.NewSessionRepository()
+	sessions := NewSessionService(sessionRepo, refreshRepo, userRepo)
+	authSvc := NewAuthService(userRepo, repository.NewIdentityRepository(), nil, nil, sessions, nil)
+	tokens := NewTokenService(jwt, refreshRepo, sessionRepo, userRepo)
+
+	u, err := authSvc.CreateUser("bob", "Tr0ub4dor&3", "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair, err := tokens.Issue(u, "127.0.0.1", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := jwt.Verify(pair.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.ID == "" || claims.SessionID == "" {
+		t.Fatalf("claims missing jti/sid: %+v", claims)
+	}
+	if _, err := sessions.Validate(claims); err != nil {
+		t.Fatalf("validate before demotion: %v", err)
+	}
+
+	if err := authSvc.UpdateUserRole(u.ID, "user"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sessions.Validate(claims); err != ErrSessionInvalid {
+		t.Fatalf("validate after demotion err=%v want ErrSessionInvalid", err)
+	}
+	if _, _, err := tokens.Refresh(pair.RefreshToken, "127.0.0.1"); err != ErrRefreshTokenInvalid {
+		t.Fatalf("refresh after demotion err=%v want ErrRefreshTokenInvalid", err)
+	}
+}
+
+func TestSessionService_impersonation(t *testing.T) {
+	if err := db.InitDB(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	jwt := newTestJWT(t)
+	userRepo := repository.NewUserRepository()
+	refreshRepo := repository.NewRefreshTokenRepository()
+	sessionRepo := repository.NewSessionRepository()
+	sessions := NewSessionService(sessionRepo, refreshRepo, userRepo)
+	authSvc := NewAuthService(userRepo, repository.NewIdentityRepository(), nil, nil, sessions, nil)
+	tokens := NewTokenService(jwt, refreshRepo, sessionRepo, userRepo)
+
+	admin, err := authSvc.CreateUser("carol", "Tr0ub4dor&3", "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := authSvc.CreateUser("dave", "Tr0ub4dor&3", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair, err := tokens.Impersonate(target, admin, "127.0.0.1", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pair.RefreshToken != "" || pair.ExpiresIn != int64(auth.DefaultImpersonationTTL/time.Second) {
+		t.Fatalf("impersonation pair = %+v", pair)
+	}
+	claims, err := jwt.Verify(pair.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Username != "dave" || claims.Actor == nil || claims.Actor.Subject != "carol" || claims.Actor.UserID != admin.ID {
+		t.Fatalf("claims = %+v actor=%+v", claims, claims.Actor)
+	}
+	u, err := sessions.Validate(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Username != "dave" || u.Impersonator == nil || u.Impersonator.Username != "carol" {
+		t.Fatalf("validated user = %+v impersonator=%+v", u, u.Impersonator)
+	}
+
+	// act 声明须与会话记录一致
+	forged := *claims
+	forged.Actor = nil
+	if _, err := sessions.Validate(&forged); err != ErrSessionInvalid {
+		t.Fatalf("validate without act err=%v want ErrSessionInvalid", err)
+	}
+
+	// 吊销管理员的会话同时结束其发起的模拟登录
+	if _, err := sessions.RevokeUser(admin.ID, RevokeReasonUserDisabled); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sessions.Validate(claims); err != ErrSessionInvalid {
+		t.Fatalf("validate after revoking admin err=%v want ErrSessionInvalid", err)
+	}
+}
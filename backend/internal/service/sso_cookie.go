@@ -0,0 +1,54 @@
+package service
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"strconv"
+)
+
+// sealCookie 将 v 序列化后以 AES-GCM 加密；提供商 ID 作为附加数据，防止 Cookie 被挪用到其他提供商
+func sealCookie(key []byte, providerID int64, v interface{}) (string, error) {
+	plain, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newFlowAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, plain, []byte(strconv.FormatInt(providerID, 10)))
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// openCookie 解密 sealCookie 的结果到 v；Cookie 损坏、被篡改或属于其他提供商时返回 false
+func openCookie(key []byte, providerID int64, value string, v interface{}) bool {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return false
+	}
+	gcm, err := newFlowAEAD(key)
+	if err != nil || len(raw) < gcm.NonceSize() {
+		return false
+	}
+	plain, err := gcm.Open(nil, raw[:gcm.NonceSize()], raw[gcm.NonceSize():], []byte(strconv.FormatInt(providerID, 10)))
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(plain, v) == nil
+}
+
+func newFlowAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
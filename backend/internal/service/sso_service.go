@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"crypto/rand"
+	"crypto/subtle"
 	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
@@ -28,6 +29,18 @@ type OIDCConfig struct {
 	Scopes        []string `json:"scopes"`
 	UsernameClaim string   `json:"username_claim"` // 默认 preferred_username，缺失时回退到 email
 	SkipTLSVerify bool     `json:"skip_tls_verify"`
+	// RoleRules 按 ID Token Claim 映射角色，每次登录应用；为空时新用户为 user 且不改动已有角色
+	RoleRules []OIDCRoleRule `json:"role_rules"`
+	// DenyIfNoMatch 配置了规则但无一命中时拒绝登录（否则视为 user）
+	DenyIfNoMatch bool `json:"deny_if_no_match"`
+	// RoleSync promote（默认，只升不降）/ full（IdP 组变化时降级）
+	RoleSync string `json:"role_sync"`
+	// PostLogoutRedirectURL 在 IdP 登出后返回的地址，默认为 redirect_url 同源的 /login
+	PostLogoutRedirectURL string `json:"post_logout_redirect_url"`
+	// FetchUserInfo 登录时额外请求 UserInfo 端点，其 Claim 补充 / 覆盖 ID Token（同一 sub）
+	FetchUserInfo bool `json:"fetch_userinfo"`
+	// GroupsClaim 组 Claim（支持点路径，如 groups），配置后每次登录按其同步用户组；为空不同步
+	GroupsClaim string `json:"groups_claim"`
 }
 
 // SSOProviderInfo 用于前端展示
@@ -45,32 +58,56 @@ type oidcRuntime struct {
 	provider    *oidc.Provider
 	verifier    *oidc.IDTokenVerifier
 	oauthConfig *oauth2.Config
+	// endSession 发现文档中的 end_session_endpoint，IdP 不支持时为空
+	endSession string
 }
 
-// SSOService SSO 服务（仅 OIDC）
+// SSOService SSO 服务（OIDC / SAML 跳转登录 + LDAP 目录认证）
 type SSOService interface {
 	ListProviders() ([]SSOProviderInfo, error)
 	Reload() error
+	LDAPAuthenticator
 
-	BuildOIDCAuthURL(id int64, state string) (string, error)
-	ExchangeOIDC(ctx context.Context, id int64, code string) (username string, err error)
+	// BuildOIDCAuthURL 生成授权地址（state + nonce + PKCE S256），flowCookie 为加密后的流程状态
+	BuildOIDCAuthURL(id int64) (authURL, flowCookie string, err error)
+	// ExchangeOIDC 校验 state 后用 code + code_verifier 换取 ID Token，并校验 nonce
+	ExchangeOIDC(ctx context.Context, id int64, code, state, flowCookie string) (*SSOIdentity, error)
+	// OIDCLogoutURL SSO 会话登出时结束 IdP 会话的地址；非 OIDC 或 IdP 不支持时返回空
+	OIDCLogoutURL(source, idTokenHint string) string
+
+	SAMLMetadata(id int64) ([]byte, error)
+	// BuildSAMLAuthRequest 生成 AuthnRequest，FlowCookie 为加密后的请求 ID
+	BuildSAMLAuthRequest(id int64, relayState string) (*SAMLAuthRequest, error)
+	// ParseSAMLResponse 校验 ACS 收到的响应；flowCookie 为发起登录时下发的 Cookie
+	ParseSAMLResponse(id int64, r *http.Request, flowCookie string) (*SSOIdentity, error)
 }
 
 type ssoService struct {
-	repo repository.SSORepository
+	repo  repository.SSORepository
+	roles RoleService
 
 	mu      sync.RWMutex
 	oidcSet map[int64]*oidcRuntime
+	ldapSet map[int64]LDAPConfig
+	samlSet map[int64]*samlRuntime
 	all     []repository.SSOProvider
+
+	dialLDAP LDAPDialer
+
+	flowKey []byte // OIDC / SAML 流程 Cookie 的加密密钥（持久化在数据库中，重启与多实例间一致）
 }
 
-// NewSSOService 创建 SSO 服务
-func NewSSOService(repo repository.SSORepository) SSOService {
-	s := &ssoService{repo: repo}
+// NewSSOService 创建 SSO 服务；roles 用于校验与比较身份源映射的角色。流程 Cookie 密钥读取失败时返回错误
+func NewSSOService(repo repository.SSORepository, roles RoleService) (SSOService, error) {
+	key, err := repo.FlowKey()
+	if err != nil {
+		return nil, err
+	}
+	s := &ssoService{repo: repo, roles: roles, dialLDAP: dialLDAP, flowKey: key}
 	if err := s.Reload(); err != nil {
 		fmt.Printf("[SSO] reload providers failed: %v\n", err)
 	}
-	return s
+	return s, nil
 }
 
 // Reload 重新加载所有已启用提供商
@@ -81,10 +118,30 @@ func (s *ssoService) Reload() error {
 	}
 
 	newOIDC := make(map[int64]*oidcRuntime)
+	newLDAP := make(map[int64]LDAPConfig)
+	newSAML := make(map[int64]*samlRuntime)
 	for _, p := range all {
 		if !p.Enabled {
 			continue
 		}
+		if p.Type == repository.SSOTypeLDAP {
+			cfg, err := parseLDAPConfig(p.ConfigJSON)
+			if err != nil {
+				fmt.Printf("[SSO] LDAP provider %d (%s) init failed: %v\n", p.ID, p.Name, err)
+				continue
+			}
+			newLDAP[p.ID] = cfg
+			continue
+		}
+		if p.Type == repository.SSOTypeSAML {
+			rt, err := buildSAMLRuntime(p)
+			if err != nil {
+				fmt.Printf("[SSO] SAML provider %d (%s) init failed: %v\n", p.ID, p.Name, err)
+				continue
+			}
+			newSAML[p.ID] = rt
+			continue
+		}
 		if p.Type != repository.SSOTypeOIDC {
 			continue
 		}
@@ -98,21 +155,30 @@ func (s *ssoService) Reload() error {
 
 	s.mu.Lock()
 	s.oidcSet = newOIDC
+	s.ldapSet = newLDAP
+	s.samlSet = newSAML
 	s.all = all
 	s.mu.Unlock()
 	return nil
 }
 
-// ListProviders 列出已成功加载、且启用的提供商
+// ListProviders 列出已成功加载、且启用的 OIDC / SAML 提供商（LDAP 走用户名密码登录，不单独展示）
 func (s *ssoService) ListProviders() ([]SSOProviderInfo, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	infos := make([]SSOProviderInfo, 0)
 	for _, p := range s.all {
-		if !p.Enabled || p.Type != repository.SSOTypeOIDC {
+		if !p.Enabled {
 			continue
 		}
-		if _, ok := s.oidcSet[p.ID]; !ok {
+		loaded := false
+		switch p.Type {
+		case repository.SSOTypeOIDC:
+			_, loaded = s.oidcSet[p.ID]
+		case repository.SSOTypeSAML:
+			_, loaded = s.samlSet[p.ID]
+		}
+		if !loaded {
 			continue
 		}
 		infos = append(infos, SSOProviderInfo{ID: p.ID, Type: p.Type, Name: p.Name})
@@ -122,6 +188,18 @@ func (s *ssoService) ListProviders() ([]SSOProviderInfo, error) {
 
 // ---------------- OIDC ----------------
 
+// ValidateOIDCConfig 校验 OIDC 配置中的角色规则及映射的角色（管理接口保存前调用）
+func ValidateOIDCConfig(raw string, roles RoleService) error {
+	var cfg OIDCConfig
+	if err := json.Unmarshal([]byte(raw), &cfg); err != nil {
+		return fmt.Errorf("invalid oidc config: %w", err)
+	}
+	if err := validateRoleRules(cfg.RoleRules, cfg.RoleSync); err != nil {
+		return err
+	}
+	return checkRuleRoles(roles, cfg.RoleRules)
+}
+
 func buildOIDCRuntime(p repository.SSOProvider) (*oidcRuntime, error) {
 	var cfg OIDCConfig
 	if err := json.Unmarshal([]byte(p.ConfigJSON), &cfg); err != nil {
@@ -136,6 +214,9 @@ func buildOIDCRuntime(p repository.SSOProvider) (*oidcRuntime, error) {
 	if cfg.UsernameClaim == "" {
 		cfg.UsernameClaim = "preferred_username"
 	}
+	if err := validateRoleRules(cfg.RoleRules, cfg.RoleSync); err != nil {
+		return nil, err
+	}
 
 	httpClient := &http.Client{Timeout: 15 * time.Second}
 	if cfg.SkipTLSVerify {
@@ -150,6 +231,10 @@ func buildOIDCRuntime(p repository.SSOProvider) (*oidcRuntime, error) {
 		return nil, fmt.Errorf("discover issuer: %w", err)
 	}
 	verifier := provider.Verifier(&oidc.Config{ClientID: cfg.ClientID})
+	var discovery struct {
+		EndSessionEndpoint string `json:"end_session_endpoint"`
+	}
+	_ = provider.Claims(&discovery)
 	oauthCfg := &oauth2.Config{
 		ClientID:     cfg.ClientID,
 		ClientSecret: cfg.ClientSecret,
@@ -164,27 +249,55 @@ func buildOIDCRuntime(p repository.SSOProvider) (*oidcRuntime, error) {
 		provider:    provider,
 		verifier:    verifier,
 		oauthConfig: oauthCfg,
+		endSession:  discovery.EndSessionEndpoint,
 	}, nil
 }
 
-// BuildOIDCAuthURL 生成 OIDC 授权 URL
-func (s *ssoService) BuildOIDCAuthURL(id int64, state string) (string, error) {
+// BuildOIDCAuthURL 生成 OIDC 授权 URL；state、nonce、PKCE verifier 加密保存在 Cookie 中
+func (s *ssoService) BuildOIDCAuthURL(id int64) (string, string, error) {
 	s.mu.RLock()
 	rt := s.oidcSet[id]
 	s.mu.RUnlock()
 	if rt == nil {
-		return "", errors.New("OIDC 提供商不存在或未启用")
+		return "", "", errors.New("OIDC 提供商不存在或未启用")
+	}
+	state, err := GenerateState()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := GenerateState()
+	if err != nil {
+		return "", "", err
+	}
+	flow := &oidcFlow{
+		ProviderID: id,
+		State:      state,
+		Verifier:   oauth2.GenerateVerifier(),
+		Nonce:      nonce,
+		Expires:    time.Now().Add(oidcFlowTTL).Unix(),
+	}
+	cookie, err := sealFlow(s.flowKey, flow)
+	if err != nil {
+		return "", "", err
 	}
-	return rt.oauthConfig.AuthCodeURL(state), nil
+	authURL := rt.oauthConfig.AuthCodeURL(state, oauth2.S256ChallengeOption(flow.Verifier), oidc.Nonce(nonce))
+	return authURL, cookie, nil
 }
 
-// ExchangeOIDC 用 authorization code 换取 ID token，并提取用户名
-func (s *ssoService) ExchangeOIDC(ctx context.Context, id int64, code string) (string, error) {
+// ExchangeOIDC 用 authorization code 换取 ID token，提取用户名并按角色规则计算角色
+func (s *ssoService) ExchangeOIDC(ctx context.Context, id int64, code, state, flowCookie string) (*SSOIdentity, error) {
 	s.mu.RLock()
 	rt := s.oidcSet[id]
 	s.mu.RUnlock()
 	if rt == nil {
-		return "", errors.New("OIDC 提供商不存在或未启用")
+		return nil, errors.New("OIDC 提供商不存在或未启用")
+	}
+	flow, err := openFlow(s.flowKey, id, flowCookie, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if err := checkFlowState(flow, state); err != nil {
+		return nil, err
 	}
 
 	httpClient := &http.Client{Timeout: 15 * time.Second}
@@ -195,27 +308,105 @@ func (s *ssoService) ExchangeOIDC(ctx context.Context, id int64, code string) (s
 	}
 	ctx = oidc.ClientContext(ctx, httpClient)
 
-	tok, err := rt.oauthConfig.Exchange(ctx, code)
+	tok, err := rt.oauthConfig.Exchange(ctx, code, oauth2.VerifierOption(flow.Verifier))
 	if err != nil {
-		return "", fmt.Errorf("exchange code: %w", err)
+		return nil, fmt.Errorf("exchange code: %w", err)
 	}
 	rawIDToken, ok := tok.Extra("id_token").(string)
 	if !ok || rawIDToken == "" {
-		return "", errors.New("响应中缺少 id_token")
+		return nil, errors.New("响应中缺少 id_token")
 	}
 	idToken, err := rt.verifier.Verify(ctx, rawIDToken)
 	if err != nil {
-		return "", fmt.Errorf("verify id_token: %w", err)
+		return nil, fmt.Errorf("verify id_token: %w", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(flow.Nonce)) != 1 {
+		return nil, errors.New("id_token nonce 不匹配")
 	}
 	var claims map[string]interface{}
 	if err := idToken.Claims(&claims); err != nil {
-		return "", fmt.Errorf("decode claims: %w", err)
+		return nil, fmt.Errorf("decode claims: %w", err)
+	}
+	if rt.cfg.FetchUserInfo {
+		info, err := rt.provider.UserInfo(ctx, oauth2.StaticTokenSource(tok))
+		if err != nil {
+			return nil, fmt.Errorf("fetch userinfo: %w", err)
+		}
+		if info.Subject != idToken.Subject {
+			return nil, errors.New("userinfo sub 与 id_token 不一致")
+		}
+		var extra map[string]interface{}
+		if err := info.Claims(&extra); err != nil {
+			return nil, fmt.Errorf("decode userinfo: %w", err)
+		}
+		mergeClaims(claims, extra)
 	}
 	username := pickStringClaim(claims, rt.cfg.UsernameClaim, "preferred_username", "email", "sub")
 	if username == "" {
-		return "", errors.New("无法从 id_token 提取用户名")
+		return nil, errors.New("无法从 id_token 提取用户名")
+	}
+	ident, err := oidcIdentity(s.roles, rt.cfg, username, claims)
+	if err != nil {
+		return nil, err
+	}
+	ident.Subject = idToken.Subject
+	ident.IDToken = rawIDToken
+	return ident, nil
+}
+
+// OIDCLogoutURL 根据会话来源生成 IdP 登出地址（RP-Initiated Logout）
+func (s *ssoService) OIDCLogoutURL(source, idTokenHint string) string {
+	var id int64
+	if _, err := fmt.Sscanf(source, repository.SSOTypeOIDC+":%d", &id); err != nil {
+		return ""
+	}
+	s.mu.RLock()
+	rt := s.oidcSet[id]
+	s.mu.RUnlock()
+	if rt == nil || rt.endSession == "" {
+		return ""
+	}
+	u, err := buildEndSessionURL(rt.endSession, rt.cfg.ClientID, idTokenHint, postLogoutRedirect(rt.cfg))
+	if err != nil {
+		return ""
+	}
+	return u
+}
+
+// oidcIdentity 按角色规则生成登录身份；配置了规则但无命中时为 user（或按 deny_if_no_match 拒绝）
+func oidcIdentity(roles RoleService, cfg OIDCConfig, username string, claims map[string]interface{}) (*SSOIdentity, error) {
+	ident := &SSOIdentity{
+		Username:    username,
+		Demote:      cfg.RoleSync == RoleSyncFull,
+		Email:       pickStringClaim(claims, "email"),
+		DisplayName: pickStringClaim(claims, "name"),
+		AvatarURL:   pickStringClaim(claims, "picture"),
+	}
+	if cfg.GroupsClaim != "" {
+		ident.SyncGroups = true
+		ident.Groups = claimStrings(lookupClaim(claims, cfg.GroupsClaim))
+	}
+	if len(cfg.RoleRules) == 0 {
+		return ident, nil
+	}
+	ident.Role = applyRoleRules(roles, cfg.RoleRules, claims)
+	if ident.Role == "" {
+		if cfg.DenyIfNoMatch {
+			return nil, ErrSSONoRoleMatch
+		}
+		ident.Role = RoleUser
+	}
+	return ident, nil
+}
+
+// mergeClaims UserInfo 的 Claim 覆盖 ID Token 中的同名 Claim（sub 除外）
+func mergeClaims(dst, src map[string]interface{}) {
+	for k, v := range src {
+		if k == "sub" {
+			continue
+		}
+		dst[k] = v
 	}
-	return username, nil
 }
 
 func pickStringClaim(claims map[string]interface{}, names ...string) string {
@@ -0,0 +1,277 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"time"
+
+	"dvr-manager/internal/auth"
+	"dvr-manager/internal/repository"
+)
+
+// SSOSession SSO 登录的会话信息
+type SSOSession struct {
+	Source      string // oidc:<id> / saml:<id>
+	IDTokenHint string
+}
+
+// TokenPair 登录 / 刷新后下发的令牌对
+type TokenPair struct {
+	AccessToken      string `json:"token"`
+	RefreshToken     string `json:"refresh_token"`
+	ExpiresIn        int64  `json:"expires_in"`         // 访问令牌剩余秒数
+	RefreshExpiresIn int64  `json:"refresh_expires_in"` // 刷新令牌剩余秒数
+}
+
+var (
+	// ErrRefreshTokenInvalid 刷新令牌无效、过期或已吊销
+	ErrRefreshTokenInvalid = errors.New("刷新令牌无效或已过期")
+	// ErrRefreshTokenReused 检测到已轮换的刷新令牌被再次使用，整条令牌链已吊销
+	ErrRefreshTokenReused = errors.New("刷新令牌已被使用，会话已全部吊销，请重新登录")
+)
+
+// TokenService 访问令牌 + 轮换刷新令牌
+type TokenService interface {
+	// Issue 为一次新登录签发令牌对（新建会话与令牌链）
+	Issue(user *User, clientIP, userAgent string) (*TokenPair, error)
+	// IssueSSO 同 Issue，并在会话上记录 SSO 来源（登出时结束 IdP 会话）
+	IssueSSO(user *User, clientIP, userAgent string, sso SSOSession) (*TokenPair, error)
+	// Refresh 用刷新令牌换取新令牌对；旧刷新令牌立即失效（滑动会话）。账号已停用或不满足登录限制时返回 CheckUserAccess 的错误
+	Refresh(refreshToken, clientIP string) (*TokenPair, *User, error)
+	// Revoke 吊销刷新令牌所属会话及整条令牌链（登出）
+	Revoke(refreshToken string) error
+	// Impersonate 管理员 actor 以 target 身份登录：新建短时会话并签发携带 act 声明的访问令牌，
+	// 不签发刷新令牌，有效期见 auth.ImpersonationTTL
+	Impersonate(target, actor *User, clientIP, userAgent string) (*TokenPair, error)
+}
+
+type tokenService struct {
+	jwt         *auth.JWT
+	repo        repository.RefreshTokenRepository
+	sessionRepo repository.SessionRepository
+	userRepo    repository.UserRepository
+}
+
+// NewTokenService 创建令牌服务
+func NewTokenService(jwt *auth.JWT, repo repository.RefreshTokenRepository, sessionRepo repository.SessionRepository, userRepo repository.UserRepository) TokenService {
+	return &tokenService{jwt: jwt, repo: repo, sessionRepo: sessionRepo, userRepo: userRepo}
+}
+
+// Issue 新建会话并签发令牌对；会话 ID 同时作为刷新令牌链 ID
+func (s *tokenService) Issue(user *User, clientIP, userAgent string) (*TokenPair, error) {
+	return s.IssueSSO(user, clientIP, userAgent, SSOSession{})
+}
+
+// IssueSSO 签发令牌对并记录 SSO 会话信息
+func (s *tokenService) IssueSSO(user *User, clientIP, userAgent string, sso SSOSession) (*TokenPair, error) {
+	sessionID, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	lt := auth.LifetimesForRoles(user.Roles())
+	if err := s.sessionRepo.Create(&repository.Session{
+		ID:          sessionID,
+		UserID:      user.ID,
+		Username:    user.Username,
+		Role:        user.Role,
+		ClientIP:    clientIP,
+		UserAgent:   userAgent,
+		ExpiresAt:   time.Now().Add(lt.Refresh),
+		SSOSource:   sso.Source,
+		IDTokenHint: sso.IDTokenHint,
+	}); err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.RecordLogin(user.ID, clientIP); err != nil {
+		log.Printf("[AUTH] record login of %s: %v", user.Username, err)
+	}
+	return s.issue(user, sessionID, clientIP)
+}
+
+// Impersonate 签发模拟登录令牌；会话记录发起的管理员，过期即失效
+func (s *tokenService) Impersonate(target, actor *User, clientIP, userAgent string) (*TokenPair, error) {
+	sessionID, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	ttl := auth.ImpersonationTTL()
+	if err := s.sessionRepo.Create(&repository.Session{
+		ID:             sessionID,
+		UserID:         target.ID,
+		Username:       target.Username,
+		Role:           target.Role,
+		ClientIP:       clientIP,
+		UserAgent:      userAgent,
+		ExpiresAt:      time.Now().Add(ttl),
+		ImpersonatorID: actor.ID,
+		Impersonator:   actor.Username,
+	}); err != nil {
+		return nil, err
+	}
+	access, err := s.jwt.Generate(auth.Claims{
+		Username:  target.Username,
+		Role:      target.Role,
+		SessionID: sessionID,
+		Actor:     &auth.Actor{Subject: actor.Username, UserID: actor.ID},
+	}, ttl)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{AccessToken: access, ExpiresIn: int64(ttl / time.Second)}, nil
+}
+
+func (s *tokenService) issue(user *User, sessionID, clientIP string) (*TokenPair, error) {
+	pair, rt, err := s.newPair(user, sessionID, clientIP)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(rt); err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// newPair 生成令牌对及待写入的刷新令牌记录（不落库）
+func (s *tokenService) newPair(user *User, sessionID, clientIP string) (*TokenPair, *repository.RefreshToken, error) {
+	lt := auth.LifetimesForRoles(user.Roles())
+	access, err := s.jwt.Generate(auth.Claims{
+		Username:  user.Username,
+		Role:      user.Role,
+		SessionID: sessionID,
+	}, lt.Access)
+	if err != nil {
+		return nil, nil, err
+	}
+	raw, err := randomToken(32)
+	if err != nil {
+		return nil, nil, err
+	}
+	rt := &repository.RefreshToken{
+		FamilyID:  sessionID,
+		UserID:    user.ID,
+		TokenHash: hashToken(raw),
+		ClientIP:  clientIP,
+		ExpiresAt: time.Now().Add(lt.Refresh),
+	}
+	return &TokenPair{
+		AccessToken:      access,
+		RefreshToken:     raw,
+		ExpiresIn:        int64(lt.Access / time.Second),
+		RefreshExpiresIn: int64(lt.Refresh / time.Second),
+	}, rt, nil
+}
+
+// Refresh 轮换刷新令牌；重放已轮换的令牌会吊销整条令牌链。
+// 旧令牌的轮换标记与新令牌的写入在同一事务中完成，签发失败时旧令牌仍可使用
+func (s *tokenService) Refresh(refreshToken, clientIP string) (*TokenPair, *User, error) {
+	if refreshToken == "" {
+		return nil, nil, ErrRefreshTokenInvalid
+	}
+	rt, err := s.repo.GetByHash(hashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, repository.ErrRefreshTokenNotFound) {
+			return nil, nil, ErrRefreshTokenInvalid
+		}
+		return nil, nil, err
+	}
+	if rt.RevokedAt != nil {
+		return nil, nil, ErrRefreshTokenInvalid
+	}
+	if rt.RotatedAt != nil {
+		s.revokeReused(rt)
+		return nil, nil, ErrRefreshTokenReused
+	}
+	if time.Now().After(rt.ExpiresAt) {
+		return nil, nil, ErrRefreshTokenInvalid
+	}
+	sess, err := s.sessionRepo.Get(rt.FamilyID)
+	if err != nil {
+		if errors.Is(err, repository.ErrSessionNotFound) {
+			return nil, nil, ErrRefreshTokenInvalid
+		}
+		return nil, nil, err
+	}
+	if sess.RevokedAt != nil {
+		return nil, nil, ErrRefreshTokenInvalid
+	}
+
+	u, err := s.userRepo.GetByID(rt.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			_, _ = s.repo.RevokeFamily(rt.FamilyID)
+			_, _ = s.sessionRepo.Revoke(rt.FamilyID, RevokeReasonUserDeleted)
+			return nil, nil, ErrRefreshTokenInvalid
+		}
+		return nil, nil, err
+	}
+	user := toUser(u)
+	if err := CheckUserAccess(user, clientIP, time.Now()); err != nil {
+		return nil, nil, err
+	}
+	pair, next, err := s.newPair(user, rt.FamilyID, clientIP)
+	if err != nil {
+		return nil, nil, err
+	}
+	ok, err := s.repo.Rotate(rt.ID, next)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		// 与另一请求并发使用同一令牌
+		s.revokeReused(rt)
+		return nil, nil, ErrRefreshTokenReused
+	}
+	if err := s.sessionRepo.Touch(rt.FamilyID, clientIP, time.Now().Add(time.Duration(pair.RefreshExpiresIn)*time.Second)); err != nil {
+		log.Printf("[AUTH] touch session %s failed: %v", rt.FamilyID, err)
+	}
+	return pair, user, nil
+}
+
+func (s *tokenService) revokeReused(rt *repository.RefreshToken) {
+	if _, err := s.sessionRepo.Revoke(rt.FamilyID, RevokeReasonTokenReuse); err != nil {
+		log.Printf("[AUTH] revoke session %s failed: %v", rt.FamilyID, err)
+	}
+	n, err := s.repo.RevokeFamily(rt.FamilyID)
+	if err != nil {
+		log.Printf("[AUTH] revoke reused refresh token family %s failed: %v", rt.FamilyID, err)
+		return
+	}
+	log.Printf("[AUTH] 检测到刷新令牌重放 - user_id: %d, family: %s, revoked: %d", rt.UserID, rt.FamilyID, n)
+}
+
+// Revoke 吊销会话及整条令牌链；未知令牌视为已吊销
+func (s *tokenService) Revoke(refreshToken string) error {
+	if refreshToken == "" {
+		return nil
+	}
+	rt, err := s.repo.GetByHash(hashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, repository.ErrRefreshTokenNotFound) {
+			return nil
+		}
+		return err
+	}
+	if _, err := s.sessionRepo.Revoke(rt.FamilyID, RevokeReasonLogout); err != nil {
+		return err
+	}
+	_, err = s.repo.RevokeFamily(rt.FamilyID)
+	return err
+}
+
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
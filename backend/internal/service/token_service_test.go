@@ -0,0 +1,100 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"dvr-manager/internal/auth"
+	"dvr-manager/internal/repository"
+	"dvr-manager/pkg/db"
+)
+
+func newTestJWT(t *testing.T) *auth.JWT {
+	t.Helper()
+	jwt, err := auth.NewJWT("test-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jwt
+}
+
+func TestTokenService_refreshRotatesAndDetectsReuse(t *testing.T) {
+	dir := t.TempDir()
+	if err := db.InitDB(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	userRepo := repository.NewUserRepository()
+	u, err := userRepo.Create("alice", "x", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := NewTokenService(newTestJWT(t), repository.NewRefreshTokenRepository(), repository.NewSessionRepository(), userRepo)
+
+	first, err := svc.Issue(toUser(u), "127.0.0.1", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, user, err := svc.Refresh(first.RefreshToken, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != "alice" || second.RefreshToken == first.RefreshToken {
+		t.Fatalf("refresh did not rotate: user=%+v", user)
+	}
+
+	// 重放已轮换的令牌：整条令牌链吊销
+	if _, _, err := svc.Refresh(first.RefreshToken, "127.0.0.1"); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("reuse err=%v want ErrRefreshTokenReused", err)
+	}
+	if _, _, err := svc.Refresh(second.RefreshToken, "127.0.0.1"); !errors.Is(err, ErrRefreshTokenInvalid) {
+		t.Fatalf("family member err=%v want ErrRefreshTokenInvalid", err)
+	}
+}
+
+// collidingRefreshRepo 让新令牌与已有令牌哈希冲突，使 Rotate 在写入新令牌时失败
+type collidingRefreshRepo struct {
+	repository.RefreshTokenRepository
+	hash string
+}
+
+func (r *collidingRefreshRepo) Rotate(id int64, next *repository.RefreshToken) (bool, error) {
+	next.TokenHash = r.hash
+	return r.RefreshTokenRepository.Rotate(id, next)
+}
+
+// 签发新令牌失败时轮换回滚，旧刷新令牌仍可使用（不会被误判为重放）
+func TestTokenService_refreshRollsBackOnIssueFailure(t *testing.T) {
+	if err := db.InitDB(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	userRepo := repository.NewUserRepository()
+	u, err := userRepo.Create("alice", "x", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwt := newTestJWT(t)
+	refreshRepo := repository.NewRefreshTokenRepository()
+	sessionRepo := repository.NewSessionRepository()
+	svc := NewTokenService(jwt, refreshRepo, sessionRepo, userRepo)
+
+	other, err := svc.Issue(toUser(u), "127.0.0.1", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := svc.Issue(toUser(u), "127.0.0.1", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failing := NewTokenService(jwt, &collidingRefreshRepo{RefreshTokenRepository: refreshRepo, hash: hashToken(other.RefreshToken)}, sessionRepo, userRepo)
+	if _, _, err := failing.Refresh(first.RefreshToken, "127.0.0.1"); err == nil || errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("expected insert failure, got %v", err)
+	}
+	if _, _, err := svc.Refresh(first.RefreshToken, "127.0.0.1"); err != nil {
+		t.Fatalf("old refresh token must survive a failed rotation: %v", err)
+	}
+}
@@ -101,6 +101,16 @@ func createTables() error {
 			detail TEXT,
 			status TEXT
 		)`,
+		// 审计哈希链的签名检查点：kind 为 periodic / retention，对 last_id 处记录的哈希签名（Ed25519）
+		`CREATE TABLE IF NOT EXISTS audit_checkpoints (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			created_at TEXT NOT NULL,
+			kind TEXT NOT NULL,
+			last_id INTEGER NOT NULL,
+			last_hash TEXT NOT NULL,
+			key_id TEXT NOT NULL,
+			signature TEXT NOT NULL
+		)`,
 		// 用户表（密码使用 bcrypt 哈希存储；source 标记本地或 SSO 来源）
 		`CREATE TABLE IF NOT EXISTS users (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -121,6 +131,11 @@ func createTables() error {
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 		)`,
+		// 已使用的 SAML 断言 ID（防重放），保留到断言的 NotOnOrAfter
+		`CREATE TABLE IF NOT EXISTS saml_assertions (
+			assertion_id TEXT PRIMARY KEY,
+			expires_at DATETIME NOT NULL
+		)`,
 		// 录像局号 → DVR 真实 URL 缓存（默认保留 30 天，由 RECORD_CACHE_TTL_DAYS 控制）
 		`CREATE TABLE IF NOT EXISTS recording_cache (
 			record_id TEXT PRIMARY KEY,
@@ -128,8 +143,179 @@ func createTables() error {
 			created_at DATETIME NOT NULL,
 			expires_at DATETIME NOT NULL
 		)`,
+		// 刷新令牌（仅存 SHA-256 哈希；family_id 标识一次登录产生的轮换链）
+		`CREATE TABLE IF NOT EXISTS refresh_tokens (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			family_id TEXT NOT NULL,
+			user_id INTEGER NOT NULL,
+			token_hash TEXT UNIQUE NOT NULL,
+			client_ip TEXT,
+			created_at DATETIME NOT NULL,
+			expires_at DATETIME NOT NULL,
+			rotated_at DATETIME,
+			revoked_at DATETIME
+		)`,
+		// 登录会话（id 与刷新令牌 family_id 相同；访问令牌通过 sid 关联，吊销后立即失效）
+		`CREATE TABLE IF NOT EXISTS sessions (
+			id TEXT PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			username TEXT NOT NULL,
+			role TEXT NOT NULL,
+			client_ip TEXT,
+			user_agent TEXT,
+			created_at DATETIME NOT NULL,
+			last_seen_at DATETIME NOT NULL,
+			expires_at DATETIME NOT NULL,
+			revoked_at DATETIME,
+			revoke_reason TEXT
+		)`,
+		// JWT 签名密钥（非对称模式；retired_at 为轮换时间，expires_at 之后不再用于验签）
+		`CREATE TABLE IF NOT EXISTS jwt_keys (
+			kid TEXT PRIMARY KEY,
+			alg TEXT NOT NULL,
+			private_key TEXT NOT NULL,
+			created_at DATETIME NOT NULL,
+			retired_at DATETIME,
+			expires_at DATETIME
+		)`,
+		// 个人访问令牌 / 服务 API Key（仅存 SHA-256 哈希；scopes 逗号分隔）
+		`CREATE TABLE IF NOT EXISTS api_tokens (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			prefix TEXT NOT NULL,
+			token_hash TEXT UNIQUE NOT NULL,
+			scopes TEXT NOT NULL,
+			created_at DATETIME NOT NULL,
+			expires_at DATETIME,
+			last_used_at DATETIME,
+			last_used_ip TEXT,
+			revoked_at DATETIME
+		)`,
+		// 二次验证恢复码（仅存 SHA-256 哈希，一次性使用）
+		`CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			code_hash TEXT NOT NULL,
+			created_at DATETIME NOT NULL,
+			used_at DATETIME
+		)`,
+		// 登录失败计数（scope 为 user / ip），用于退避与临时锁定
+		`CREATE TABLE IF NOT EXISTS login_attempts (
+			scope TEXT NOT NULL,
+			subject TEXT NOT NULL,
+			failures INTEGER NOT NULL DEFAULT 0,
+			last_failure_at DATETIME NOT NULL,
+			locked_until DATETIME,
+			PRIMARY KEY (scope, subject)
+		)`,
+		// 历史密码哈希（修改密码时写入旧哈希，用于禁止重复使用）
+		`CREATE TABLE IF NOT EXISTS password_history (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			password_hash TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		// 角色与权限（permissions 逗号分隔）；内置角色由服务启动时补齐
+		`CREATE TABLE IF NOT EXISTS roles (
+			name TEXT PRIMARY KEY,
+			description TEXT NOT NULL DEFAULT '',
+			permissions TEXT NOT NULL DEFAULT '',
+			builtin INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		// 外部身份关联：SSO 登录按 (provider, subject) 映射用户，而非用户名
+		`CREATE TABLE IF NOT EXISTS user_identities (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			provider TEXT NOT NULL,
+			subject TEXT NOT NULL,
+			username TEXT NOT NULL DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			last_login_at DATETIME,
+			UNIQUE (provider, subject)
+		)`,
+		// DVR 服务器分组（servers 为 JSON 数组），供访问策略引用
+		`CREATE TABLE IF NOT EXISTS dvr_groups (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT UNIQUE NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			servers TEXT NOT NULL DEFAULT '[]',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		// 访问策略：限定主体（用户 / 匿名）可访问的 DVR 分组与录像编号模式（均为 JSON 数组，空表示不限）
+		`CREATE TABLE IF NOT EXISTS access_policies (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			subject_type TEXT NOT NULL,
+			subject_id INTEGER NOT NULL DEFAULT 0,
+			dvr_group_ids TEXT NOT NULL DEFAULT '[]',
+			record_patterns TEXT NOT NULL DEFAULT '[]',
+			enabled INTEGER NOT NULL DEFAULT 1,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		// 用户组：role 为组成员额外获得的角色（空表示不授予），external_name 为 SSO 同步时匹配的 IdP 组名
+		`CREATE TABLE IF NOT EXISTS groups (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT UNIQUE NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			role TEXT NOT NULL DEFAULT '',
+			external_name TEXT NOT NULL DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		// 组成员：source 为 manual（管理员添加）或 SSO 来源（如 oidc:1，登录时按 IdP 组同步）
+		`CREATE TABLE IF NOT EXISTS group_members (
+			group_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			source TEXT NOT NULL DEFAULT 'manual',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (group_id, user_id)
+		)`,
 		// 兼容旧库：尝试为已存在的 users 表添加 source 列（已存在则忽略错误）
 		`ALTER TABLE users ADD COLUMN source TEXT NOT NULL DEFAULT 'local'`,
+		// 审计记录关联的 API 令牌（经 API 令牌认证的请求）
+		`ALTER TABLE audit_log ADD COLUMN api_token_id INTEGER`,
+		// TOTP 二次验证：mfa_secret 为 base32 密钥（启用前为待确认状态），mfa_last_step 防止验证码重放
+		`ALTER TABLE users ADD COLUMN mfa_secret TEXT`,
+		`ALTER TABLE users ADD COLUMN mfa_enabled INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE users ADD COLUMN mfa_last_step INTEGER NOT NULL DEFAULT 0`,
+		// 最近一次设置密码的时间（密码最长有效期）；为空时按 created_at 计算
+		`ALTER TABLE users ADD COLUMN password_changed_at DATETIME`,
+		// 种子账号与管理员重置密码后须由用户本人修改密码
+		`ALTER TABLE users ADD COLUMN must_change_password INTEGER NOT NULL DEFAULT 0`,
+		// SSO 登录的会话：来源与 ID Token（登出时作为 id_token_hint 结束 IdP 会话）
+		`ALTER TABLE sessions ADD COLUMN sso_source TEXT`,
+		`ALTER TABLE sessions ADD COLUMN id_token_hint TEXT`,
+		// 用户资料（SSO 登录时由 IdP 同步）与最近登录
+		`ALTER TABLE users ADD COLUMN email TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE users ADD COLUMN display_name TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE users ADD COLUMN avatar_url TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE users ADD COLUMN last_login_at DATETIME`,
+		`ALTER TABLE users ADD COLUMN last_login_ip TEXT NOT NULL DEFAULT ''`,
+		// 账号停用 / 有效期；login_hours 为允许登录的时段（如 08:00-18:00），allowed_cidrs 为允许的来源网段（JSON 数组）
+		`ALTER TABLE users ADD COLUMN disabled INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE users ADD COLUMN disabled_at DATETIME`,
+		`ALTER TABLE users ADD COLUMN disabled_reason TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE users ADD COLUMN expires_at DATETIME`,
+		`ALTER TABLE users ADD COLUMN login_hours TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE users ADD COLUMN allowed_cidrs TEXT NOT NULL DEFAULT '[]'`,
+		// SCIM 预配：external_id 为 IdP 侧的 externalId；用户组 source 为 manual（管理员创建）或 scim（由 IdP 创建）
+		`ALTER TABLE users ADD COLUMN external_id TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE groups ADD COLUMN source TEXT NOT NULL DEFAULT 'manual'`,
+		// 模拟登录：会话记录发起的管理员，审计记录模拟期间的真实操作者
+		`ALTER TABLE sessions ADD COLUMN impersonator_id INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE sessions ADD COLUMN impersonator TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE audit_log ADD COLUMN impersonator TEXT NOT NULL DEFAULT ''`,
+		// 结构化审计：reason 为原因码，metadata 为 JSON；metadata 为 NULL 表示尚未迁移的历史记录（仅有 detail）
+		`ALTER TABLE audit_log ADD COLUMN reason TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE audit_log ADD COLUMN metadata TEXT`,
+		// 防篡改哈希链：hash = SHA-256(prev_hash + 记录内容)，prev_hash 为前一条（按 id）记录的 hash
+		`ALTER TABLE audit_log ADD COLUMN prev_hash TEXT`,
+		`ALTER TABLE audit_log ADD COLUMN hash TEXT`,
 		// 创建索引
 		`CREATE INDEX IF NOT EXISTS idx_config_key ON config(key)`,
 		`CREATE INDEX IF NOT EXISTS idx_dvr_servers_server ON dvr_servers(server)`,
@@ -138,6 +324,21 @@ func createTables() error {
 		`CREATE INDEX IF NOT EXISTS idx_users_username ON users(username)`,
 		`CREATE INDEX IF NOT EXISTS idx_sso_providers_enabled ON sso_providers(enabled)`,
 		`CREATE INDEX IF NOT EXISTS idx_recording_cache_expires_at ON recording_cache(expires_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family ON refresh_tokens(family_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user ON refresh_tokens(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_refresh_tokens_expires_at ON refresh_tokens(expires_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_api_tokens_user ON api_tokens(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user ON mfa_recovery_codes(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_login_attempts_last_failure ON login_attempts(last_failure_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_password_history_user ON password_history(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_users_last_login_at ON users(last_login_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_user_identities_user ON user_identities(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_users_role ON users(role)`,
+		`CREATE INDEX IF NOT EXISTS idx_access_policies_subject ON access_policies(subject_type, subject_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_group_members_user ON group_members(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_users_source ON users(source)`,
 	}
 
 	for _, query := range queries {
@@ -13,6 +13,9 @@ const Dashboard = lazy(() => import('./pages/Dashboard'));
 const Audit = lazy(() => import('./pages/Audit'));
 const Users = lazy(() => import('./pages/Users'));
 const SsoConfig = lazy(() => import('./pages/SsoConfig'));
+const Roles = lazy(() => import('./pages/Roles'));
+const Groups = lazy(() => import('./pages/Groups'));
+const AccessPolicies = lazy(() => import('./pages/AccessPolicies'));
 
 function PageFallback() {
   return (
@@ -41,7 +44,7 @@ function App() {
             <Route
               path="admin/dashboard"
               element={
-                <AdminRoute>
+                <AdminRoute permission="dashboard:read">
                   <Dashboard />
                 </AdminRoute>
               }
@@ -49,7 +52,7 @@ function App() {
             <Route
               path="admin"
               element={
-                <AdminRoute>
+                <AdminRoute permission="config:read">
                   <Admin />
                 </AdminRoute>
               }
@@ -57,7 +60,7 @@ function App() {
             <Route
               path="admin/audit"
               element={
-                <AdminRoute>
+                <AdminRoute permission="audit:read">
                   <Audit />
                 </AdminRoute>
               }
@@ -65,7 +68,7 @@ function App() {
             <Route
               path="admin/users"
               element={
-                <AdminRoute>
+                <AdminRoute permission="users:read">
                   <Users />
                 </AdminRoute>
               }
@@ -73,11 +76,35 @@ function App() {
             <Route
               path="admin/sso"
               element={
-                <AdminRoute>
+                <AdminRoute permission="sso:manage">
                   <SsoConfig />
                 </AdminRoute>
               }
             />
+            <Route
+              path="admin/roles"
+              element={
+                <AdminRoute permission="roles:manage">
+                  <Roles />
+                </AdminRoute>
+              }
+            />
+            <Route
+              path="admin/groups"
+              element={
+                <AdminRoute permission="users:read">
+                  <Groups />
+                </AdminRoute>
+              }
+            />
+            <Route
+              path="admin/access"
+              element={
+                <AdminRoute permission="access:manage">
+                  <AccessPolicies />
+                </AdminRoute>
+              }
+            />
           </Route>
           <Route path="*" element={<Navigate to="/" replace />} />
         </Routes>
@@ -1,11 +1,12 @@
 import { Navigate } from 'react-router-dom';
-import { useAuthStore } from '../store/authStore';
+import { useAuthStore, hasPermission } from '../store/authStore';
 
-function AdminRoute({ children }) {
+// permission 为字符串或数组，拥有任一权限即可访问
+function AdminRoute({ permission, children }) {
   const { user } = useAuthStore();
+  const perms = Array.isArray(permission) ? permission : [permission];
 
-  // 只有管理员可以访问
-  if (user?.role !== 'admin') {
+  if (!hasPermission(user, ...perms)) {
     return <Navigate to="/" replace />;
   }
 
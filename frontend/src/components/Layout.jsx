@@ -9,6 +9,7 @@ import {
   Form,
   Input,
   Button,
+  Alert,
   message,
 } from 'antd';
 import { Outlet, useNavigate, useLocation, Link } from 'react-router-dom';
@@ -23,10 +24,15 @@ import {
   KeyOutlined,
   CloudOutlined,
   DashboardOutlined,
+  SafetyOutlined,
+  SafetyCertificateOutlined,
+  ApartmentOutlined,
+  UsergroupAddOutlined,
 } from '@ant-design/icons';
-import { useAuthStore } from '../store/authStore';
+import { useAuthStore, hasPermission } from '../store/authStore';
 import { useThemeStore } from '../store/themeStore';
 import { authService } from '../services/authService';
+import MfaSettings from './MfaSettings';
 import './Layout.css';
 
 const { Header, Sider, Content, Footer } = AntLayout;
@@ -35,13 +41,24 @@ function Layout() {
   const [collapsed, setCollapsed] = useState(false);
   const navigate = useNavigate();
   const location = useLocation();
-  const { user, logout } = useAuthStore();
+  const { user, logout, endImpersonation } = useAuthStore();
   const { theme, toggleTheme } = useThemeStore();
   const [pwdOpen, setPwdOpen] = useState(false);
   const [pwdLoading, setPwdLoading] = useState(false);
   const [pwdForm] = Form.useForm();
+  const [mfaOpen, setMfaOpen] = useState(false);
   const [userMenuOpen, setUserMenuOpen] = useState(false);
   const userMenuWrapRef = useRef(null);
+  const mustChangePassword = !!user?.password_change_required;
+  // 模拟登录：管理员以该用户身份查看，不能修改密码与二次验证
+  const impersonator = user?.impersonator;
+
+  // 须修改密码（初始 / 重置密码或已过期）：登录后自动弹出修改密码，其他接口在修改前均返回 403
+  useEffect(() => {
+    if (mustChangePassword) {
+      setPwdOpen(true);
+    }
+  }, [mustChangePassword]);
 
   useEffect(() => {
     if (!userMenuOpen) return undefined;
@@ -62,55 +79,52 @@ function Layout() {
   }, [userMenuOpen]);
 
   const handleLogout = async () => {
-    await logout();
+    const logoutUrl = await logout();
+    if (logoutUrl) {
+      window.location.href = logoutUrl;
+      return;
+    }
     navigate('/login');
   };
 
-  // 根据用户角色显示菜单
+  // 根据角色权限显示菜单
+  const adminMenu = [
+    { key: '/admin/dashboard', icon: <DashboardOutlined />, label: '使用统计', perm: 'dashboard:read' },
+    { key: '/admin', icon: <SettingOutlined />, label: '系统管理', perm: 'config:read' },
+    { key: '/admin/users', icon: <TeamOutlined />, label: '用户管理', perm: 'users:read' },
+    { key: '/admin/groups', icon: <UsergroupAddOutlined />, label: '用户组', perm: 'users:read' },
+    { key: '/admin/roles', icon: <SafetyCertificateOutlined />, label: '角色权限', perm: 'roles:manage' },
+    { key: '/admin/access', icon: <ApartmentOutlined />, label: '访问策略', perm: 'access:manage' },
+    { key: '/admin/sso', icon: <CloudOutlined />, label: 'SSO 配置', perm: 'sso:manage' },
+    { key: '/admin/audit', icon: <AuditOutlined />, label: '审计查询', perm: 'audit:read' },
+  ];
   const menuItems = [
     {
       key: '/',
       icon: <VideoCameraOutlined />,
       label: '录像查询',
     },
-    // 只有管理员可以看到系统管理菜单
-    ...(user?.role === 'admin'
-      ? [
-          {
-            key: '/admin/dashboard',
-            icon: <DashboardOutlined />,
-            label: '使用统计',
-          },
-          {
-            key: '/admin',
-            icon: <SettingOutlined />,
-            label: '系统管理',
-          },
-          {
-            key: '/admin/users',
-            icon: <TeamOutlined />,
-            label: '用户管理',
-          },
-          {
-            key: '/admin/sso',
-            icon: <CloudOutlined />,
-            label: 'SSO 配置',
-          },
-          {
-            key: '/admin/audit',
-            icon: <AuditOutlined />,
-            label: '审计查询',
-          },
-        ]
-      : []),
+    ...adminMenu
+      .filter((item) => hasPermission(user, item.perm))
+      .map(({ perm: _perm, ...item }) => item),
   ];
 
+  const handleEndImpersonation = async () => {
+    await endImpersonation();
+    navigate('/admin/users');
+  };
+
   const handleChangePasswordClick = () => {
     setUserMenuOpen(false);
     pwdForm.resetFields();
     setPwdOpen(true);
   };
 
+  const handleMfaClick = () => {
+    setUserMenuOpen(false);
+    setMfaOpen(true);
+  };
+
   const handleLogoutClick = () => {
     setUserMenuOpen(false);
     handleLogout();
@@ -197,22 +211,36 @@ function Layout() {
                   <Avatar icon={<UserOutlined />} size="small" />
                   <span className="user-info-name">
                     {user?.username || 'User'}
-                    {user?.role === 'admin' && (
-                      <span className="user-info-role">(管理员)</span>
+                    {user?.role && user.role !== 'user' && (
+                      <span className="user-info-role">
+                        ({user.role === 'admin' ? '管理员' : user.role})
+                      </span>
                     )}
                   </span>
                 </Button>
                 {userMenuOpen && (
                   <div className="user-menu-panel" role="menu">
-                    <button
-                      type="button"
-                      className="user-menu-item"
-                      onClick={handleChangePasswordClick}
-                    >
-                      <KeyOutlined />
-                      <span>修改密码</span>
-                    </button>
-                    <div className="user-menu-divider" />
+                    {!impersonator && (
+                      <>
+                        <button
+                          type="button"
+                          className="user-menu-item"
+                          onClick={handleChangePasswordClick}
+                        >
+                          <KeyOutlined />
+                          <span>修改密码</span>
+                        </button>
+                        <button
+                          type="button"
+                          className="user-menu-item"
+                          onClick={handleMfaClick}
+                        >
+                          <SafetyOutlined />
+                          <span>二次验证</span>
+                        </button>
+                        <div className="user-menu-divider" />
+                      </>
+                    )}
                     <button
                       type="button"
                       className="user-menu-item user-menu-item-danger"
@@ -228,6 +256,20 @@ function Layout() {
           </div>
         </Header>
         <Content className="app-content">
+          {impersonator && (
+            <Alert
+              type="warning"
+              showIcon
+              banner
+              style={{ marginBottom: 16 }}
+              message={`正在以 ${user.username} 的身份查看（管理员 ${impersonator} 模拟登录），操作将以双方身份记录审计，不能修改密码或管理设置`}
+              action={
+                <Button size="small" onClick={handleEndImpersonation}>
+                  退出模拟
+                </Button>
+              }
+            />
+          )}
           <Outlet />
         </Content>
         <Footer className="app-footer">
@@ -235,6 +277,8 @@ function Layout() {
         </Footer>
       </AntLayout>
 
+      <MfaSettings open={mfaOpen} onClose={() => setMfaOpen(false)} />
+
       <Modal
         title="修改密码"
         open={pwdOpen}
@@ -243,8 +287,23 @@ function Layout() {
         confirmLoading={pwdLoading}
         okText="确定"
         cancelText="取消"
+        closable={!mustChangePassword}
+        maskClosable={!mustChangePassword}
+        cancelButtonProps={{ style: mustChangePassword ? { display: 'none' } : undefined }}
         destroyOnClose
       >
+        {mustChangePassword && (
+          <Alert
+            type="warning"
+            showIcon
+            style={{ marginBottom: 16 }}
+            message={
+              user?.must_change_password
+                ? '当前为初始密码或管理员重置的密码，请修改后继续使用'
+                : '密码已超过有效期，请修改后继续使用'
+            }
+          />
+        )}
         <Form form={pwdForm} layout="vertical" autoComplete="off">
           <Form.Item
             name="old_password"
@@ -256,10 +315,8 @@ function Layout() {
           <Form.Item
             name="new_password"
             label="新密码"
-            rules={[
-              { required: true, message: '请输入新密码' },
-              { min: 6, message: '密码长度至少 6 位' },
-            ]}
+            extra="长度、字符类型等要求以系统密码策略为准"
+            rules={[{ required: true, message: '请输入新密码' }]}
           >
             <Input.Password autoComplete="new-password" />
           </Form.Item>
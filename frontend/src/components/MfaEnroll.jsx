@@ -0,0 +1,93 @@
+import { useEffect, useState } from 'react';
+import { QRCode, Typography, Input, Button, Space, Spin, Alert, message } from 'antd';
+import { getApiErrorMessage } from '../utils/format';
+
+const { Paragraph, Text } = Typography;
+
+/**
+ * 绑定 TOTP 验证器：展示二维码与密钥，输入验证码确认。
+ * setup() 返回 { secret, otpauth_uri }；onActivate(code) 成功后由调用方处理恢复码。
+ */
+export function MfaEnroll({ setup, onActivate }) {
+  const [data, setData] = useState(null);
+  const [code, setCode] = useState('');
+  const [submitting, setSubmitting] = useState(false);
+  const [error, setError] = useState('');
+
+  useEffect(() => {
+    (async () => {
+      try {
+        const res = await setup();
+        if (res?.success) {
+          setData(res);
+        } else {
+          setError(res?.message || '生成密钥失败');
+        }
+      } catch (err) {
+        setError(getApiErrorMessage(err, '生成密钥失败'));
+      }
+    })();
+  }, [setup]);
+
+  const submit = async () => {
+    if (!/^\d{6}$/.test(code.trim())) {
+      message.error('请输入 6 位验证码');
+      return;
+    }
+    setSubmitting(true);
+    try {
+      await onActivate(code.trim());
+    } finally {
+      setSubmitting(false);
+    }
+  };
+
+  if (error) {
+    return <Alert type="error" message={error} showIcon />;
+  }
+  if (!data) {
+    return <Spin />;
+  }
+
+  return (
+    <Space direction="vertical" style={{ width: '100%' }} align="center">
+      <Text>使用验证器 App（如 Google Authenticator、Microsoft Authenticator）扫描二维码：</Text>
+      <QRCode value={data.otpauth_uri} size={180} />
+      <Paragraph copyable={{ text: data.secret }} style={{ marginBottom: 0 }}>
+        <Text type="secondary">无法扫码时手动输入密钥：</Text>
+        <Text code>{data.secret}</Text>
+      </Paragraph>
+      <Space.Compact style={{ width: 260 }}>
+        <Input
+          value={code}
+          onChange={(e) => setCode(e.target.value)}
+          onPressEnter={submit}
+          placeholder="6 位验证码"
+          maxLength={6}
+          inputMode="numeric"
+          autoComplete="one-time-code"
+        />
+        <Button type="primary" loading={submitting} onClick={submit}>
+          验证并启用
+        </Button>
+      </Space.Compact>
+    </Space>
+  );
+}
+
+/** 恢复码展示：仅显示一次，提示用户妥善保存 */
+export function RecoveryCodes({ codes }) {
+  return (
+    <Space direction="vertical" style={{ width: '100%' }}>
+      <Alert
+        type="warning"
+        showIcon
+        message="请立即保存恢复码"
+        description="每个恢复码只能使用一次，可在丢失验证器时代替验证码登录。关闭后将无法再次查看。"
+      />
+      <Paragraph copyable={{ text: codes.join('\n') }} style={{ marginBottom: 0 }}>
+        <pre style={{ margin: 0, columns: 2 }}>{codes.join('\n')}</pre>
+      </Paragraph>
+    </Space>
+  );
+}
@@ -0,0 +1,125 @@
+import { useCallback, useEffect, useState } from 'react';
+import { Modal, Descriptions, Tag, Button, Space, Input, Spin, message } from 'antd';
+import { authService } from '../services/authService';
+import { getApiErrorMessage } from '../utils/format';
+import { MfaEnroll, RecoveryCodes } from './MfaEnroll';
+
+/** 个人二次验证设置：启用 / 关闭 / 重新生成恢复码 */
+function MfaSettings({ open, onClose }) {
+  const [status, setStatus] = useState(null);
+  const [mode, setMode] = useState('view'); // view | enroll | codes
+  const [codes, setCodes] = useState([]);
+  const [code, setCode] = useState('');
+  const [loading, setLoading] = useState(false);
+
+  const load = useCallback(async () => {
+    try {
+      const res = await authService.getMFAStatus();
+      if (res?.success) setStatus(res.mfa);
+    } catch (err) {
+      message.error(getApiErrorMessage(err, '获取二次验证状态失败'));
+    }
+  }, []);
+
+  useEffect(() => {
+    if (open) {
+      setMode('view');
+      setCode('');
+      load();
+    }
+  }, [open, load]);
+
+  const activate = async (totp) => {
+    try {
+      const res = await authService.activateMFA(totp);
+      if (res?.success) {
+        message.success('二次验证已启用');
+        setCodes(res.recovery_codes || []);
+        setMode('codes');
+        load();
+      }
+    } catch (err) {
+      message.error(getApiErrorMessage(err, '验证失败'));
+    }
+  };
+
+  const withCode = async (fn, okText) => {
+    if (!code.trim()) {
+      message.error('请输入验证码或恢复码');
+      return;
+    }
+    setLoading(true);
+    try {
+      const res = await fn(code.trim());
+      if (res?.success) {
+        message.success(okText);
+        setCode('');
+        if (res.recovery_codes) {
+          setCodes(res.recovery_codes);
+          setMode('codes');
+        }
+        load();
+      }
+    } catch (err) {
+      message.error(getApiErrorMessage(err, '操作失败'));
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  let body;
+  if (!status) {
+    body = <Spin />;
+  } else if (mode === 'enroll') {
+    body = <MfaEnroll setup={authService.setupMFA} onActivate={activate} />;
+  } else if (mode === 'codes') {
+    body = <RecoveryCodes codes={codes} />;
+  } else {
+    body = (
+      <Space direction="vertical" style={{ width: '100%' }}>
+        <Descriptions column={1} size="small">
+          <Descriptions.Item label="状态">
+            {status.enabled ? <Tag color="green">已启用</Tag> : <Tag>未启用</Tag>}
+            {status.required && <Tag color="orange">当前角色强制</Tag>}
+          </Descriptions.Item>
+          {status.enabled && (
+            <Descriptions.Item label="剩余恢复码">{status.recovery_codes_remaining}</Descriptions.Item>
+          )}
+        </Descriptions>
+        {status.enabled ? (
+          <Space.Compact style={{ width: '100%' }}>
+            <Input
+              value={code}
+              onChange={(e) => setCode(e.target.value)}
+              placeholder="验证码或恢复码"
+              autoComplete="one-time-code"
+            />
+            <Button
+              loading={loading}
+              onClick={() => withCode(authService.regenerateRecoveryCodes, '恢复码已重新生成')}
+            >
+              重新生成恢复码
+            </Button>
+            {!status.required && (
+              <Button danger loading={loading} onClick={() => withCode(authService.disableMFA, '二次验证已关闭')}>
+                关闭
+              </Button>
+            )}
+          </Space.Compact>
+        ) : (
+          <Button type="primary" onClick={() => setMode('enroll')}>
+            启用二次验证
+          </Button>
+        )}
+      </Space>
+    );
+  }
+
+  return (
+    <Modal title="二次验证（TOTP）" open={open} onCancel={onClose} footer={null} destroyOnClose>
+      {body}
+    </Modal>
+  );
+}
+
+export default MfaSettings;
@@ -0,0 +1,434 @@
+import { useEffect, useState } from 'react';
+import {
+  Card,
+  Tabs,
+  Table,
+  Button,
+  Space,
+  Modal,
+  Form,
+  Input,
+  Select,
+  Switch,
+  message,
+  Popconfirm,
+  Tag,
+  Typography,
+} from 'antd';
+import { PlusOutlined, EditOutlined, DeleteOutlined, ReloadOutlined } from '@ant-design/icons';
+import { adminService } from '../services/authService';
+
+const { Text } = Typography;
+
+function AccessPolicies() {
+  const [loading, setLoading] = useState(false);
+  const [groups, setGroups] = useState([]);
+  const [policies, setPolicies] = useState([]);
+  const [users, setUsers] = useState([]);
+  const [userGroups, setUserGroups] = useState([]);
+
+  // DVR 分组新建 / 编辑（editing 为 null 表示新建）
+  const [groupOpen, setGroupOpen] = useState(false);
+  const [editingGroup, setEditingGroup] = useState(null);
+  const [groupForm] = Form.useForm();
+
+  // 访问策略新建 / 编辑
+  const [policyOpen, setPolicyOpen] = useState(false);
+  const [editingPolicy, setEditingPolicy] = useState(null);
+  const [policyForm] = Form.useForm();
+  const subjectType = Form.useWatch('subject_type', policyForm);
+
+  const fetchAll = async () => {
+    setLoading(true);
+    try {
+      const [g, p] = await Promise.all([adminService.listDVRGroups(), adminService.listAccessPolicies()]);
+      if (g?.success) setGroups(g.list || []);
+      if (p?.success) setPolicies(p.list || []);
+    } catch (err) {
+      message.error(err?.response?.data?.message || '获取访问策略失败');
+    } finally {
+      setLoading(false);
+    }
+    // 用户与用户组仅用于选择策略主体，无 users:read 时忽略
+    try {
+      const [u, ug] = await Promise.all([adminService.listUsers(), adminService.listGroups()]);
+      if (u?.success) setUsers(u.list || []);
+      if (ug?.success) setUserGroups(ug.list || []);
+    } catch {
+      setUsers([]);
+      setUserGroups([]);
+    }
+  };
+
+  useEffect(() => {
+    fetchAll();
+  }, []);
+
+  const openCreateGroup = () => {
+    setEditingGroup(null);
+    groupForm.setFieldsValue({ name: '', description: '', servers: '' });
+    setGroupOpen(true);
+  };
+
+  const openEditGroup = (record) => {
+    setEditingGroup(record);
+    groupForm.setFieldsValue({
+      name: record.name,
+      description: record.description,
+      servers: (record.servers || []).join('\n'),
+    });
+    setGroupOpen(true);
+  };
+
+  const onSaveGroup = async () => {
+    try {
+      const values = await groupForm.validateFields();
+      const payload = {
+        name: values.name,
+        description: values.description || '',
+        servers: (values.servers || '')
+          .split('\n')
+          .map((s) => s.trim())
+          .filter(Boolean),
+      };
+      const res = editingGroup
+        ? await adminService.updateDVRGroup(editingGroup.id, payload)
+        : await adminService.createDVRGroup(payload);
+      if (res?.success) {
+        message.success(editingGroup ? '分组已更新' : '分组已创建');
+        setGroupOpen(false);
+        fetchAll();
+      } else {
+        message.error(res?.message || '保存失败');
+      }
+    } catch (err) {
+      if (err?.errorFields) return;
+      message.error(err?.response?.data?.message || '保存失败');
+    }
+  };
+
+  const onDeleteGroup = async (record) => {
+    try {
+      const res = await adminService.deleteDVRGroup(record.id);
+      if (res?.success) {
+        message.success('分组已删除');
+        fetchAll();
+      } else {
+        message.error(res?.message || '删除失败');
+      }
+    } catch (err) {
+      message.error(err?.response?.data?.message || '删除失败');
+    }
+  };
+
+  const openCreatePolicy = () => {
+    setEditingPolicy(null);
+    policyForm.setFieldsValue({
+      name: '',
+      subject_type: 'user',
+      subject_id: undefined,
+      dvr_group_ids: [],
+      record_patterns: [],
+      enabled: true,
+    });
+    setPolicyOpen(true);
+  };
+
+  const openEditPolicy = (record) => {
+    setEditingPolicy(record);
+    policyForm.setFieldsValue({
+      name: record.name,
+      subject_type: record.subject_type,
+      subject_id: record.subject_type === 'anonymous' ? undefined : record.subject_id,
+      dvr_group_ids: record.dvr_group_ids,
+      record_patterns: record.record_patterns,
+      enabled: record.enabled,
+    });
+    setPolicyOpen(true);
+  };
+
+  const onSavePolicy = async () => {
+    try {
+      const values = await policyForm.validateFields();
+      const payload = {
+        ...values,
+        subject_id: values.subject_type === 'anonymous' ? 0 : values.subject_id,
+        dvr_group_ids: values.dvr_group_ids || [],
+        record_patterns: values.record_patterns || [],
+      };
+      const res = editingPolicy
+        ? await adminService.updateAccessPolicy(editingPolicy.id, payload)
+        : await adminService.createAccessPolicy(payload);
+      if (res?.success) {
+        message.success(editingPolicy ? '策略已更新' : '策略已创建');
+        setPolicyOpen(false);
+        fetchAll();
+      } else {
+        message.error(res?.message || '保存失败');
+      }
+    } catch (err) {
+      if (err?.errorFields) return;
+      message.error(err?.response?.data?.message || '保存失败');
+    }
+  };
+
+  const onDeletePolicy = async (record) => {
+    try {
+      const res = await adminService.deleteAccessPolicy(record.id);
+      if (res?.success) {
+        message.success('策略已删除');
+        fetchAll();
+      } else {
+        message.error(res?.message || '删除失败');
+      }
+    } catch (err) {
+      message.error(err?.response?.data?.message || '删除失败');
+    }
+  };
+
+  const groupName = (id) => groups.find((g) => g.id === id)?.name || `#${id}`;
+
+  const groupColumns = [
+    { title: '分组', dataIndex: 'name', key: 'name', width: 160 },
+    { title: '说明', dataIndex: 'description', key: 'description', width: 200 },
+    {
+      title: 'DVR 服务器',
+      dataIndex: 'servers',
+      key: 'servers',
+      render: (servers) => (
+        <Space direction="vertical" size={0}>
+          {(servers || []).map((s) => (
+            <Text key={s} code>
+              {s}
+            </Text>
+          ))}
+        </Space>
+      ),
+    },
+    {
+      title: '操作',
+      key: 'action',
+      width: 170,
+      render: (_, record) => (
+        <Space>
+          <Button size="small" icon={<EditOutlined />} onClick={() => openEditGroup(record)}>
+            编辑
+          </Button>
+          <Popconfirm
+            title={`确定删除分组 ${record.name}？`}
+            onConfirm={() => onDeleteGroup(record)}
+            okText="删除"
+            cancelText="取消"
+          >
+            <Button size="small" danger icon={<DeleteOutlined />}>
+              删除
+            </Button>
+          </Popconfirm>
+        </Space>
+      ),
+    },
+  ];
+
+  const policyColumns = [
+    { title: '策略', dataIndex: 'name', key: 'name', width: 160 },
+    {
+      title: '主体',
+      key: 'subject',
+      width: 160,
+      render: (_, record) =>
+        record.subject_type === 'anonymous' ? (
+          <Tag>匿名访问</Tag>
+        ) : record.subject_type === 'group' ? (
+          <Tag color="geekblue">用户组：{record.subject_name || `#${record.subject_id}`}</Tag>
+        ) : (
+          <span>{record.subject_name || `#${record.subject_id}`}</span>
+        ),
+    },
+    {
+      title: 'DVR 分组',
+      dataIndex: 'dvr_group_ids',
+      key: 'dvr_group_ids',
+      render: (ids) =>
+        ids?.length ? (
+          <Space size={[4, 4]} wrap>
+            {ids.map((id) => (
+              <Tag key={id} color="blue">
+                {groupName(id)}
+              </Tag>
+            ))}
+          </Space>
+        ) : (
+          <Text type="secondary">全部</Text>
+        ),
+    },
+    {
+      title: '录像编号',
+      dataIndex: 'record_patterns',
+      key: 'record_patterns',
+      render: (patterns) =>
+        patterns?.length ? (
+          <Space size={[4, 4]} wrap>
+            {patterns.map((p) => (
+              <Tag key={p}>{p}</Tag>
+            ))}
+          </Space>
+        ) : (
+          <Text type="secondary">全部</Text>
+        ),
+    },
+    {
+      title: '状态',
+      dataIndex: 'enabled',
+      key: 'enabled',
+      width: 80,
+      render: (enabled) => (enabled ? <Tag color="green">启用</Tag> : <Tag>停用</Tag>),
+    },
+    {
+      title: '操作',
+      key: 'action',
+      width: 170,
+      render: (_, record) => (
+        <Space>
+          <Button size="small" icon={<EditOutlined />} onClick={() => openEditPolicy(record)}>
+            编辑
+          </Button>
+          <Popconfirm
+            title={`确定删除策略 ${record.name}？`}
+            onConfirm={() => onDeletePolicy(record)}
+            okText="删除"
+            cancelText="取消"
+          >
+            <Button size="small" danger icon={<DeleteOutlined />}>
+              删除
+            </Button>
+          </Popconfirm>
+        </Space>
+      ),
+    },
+  ];
+
+  const tabs = [
+    {
+      key: 'policies',
+      label: '访问策略',
+      children: (
+        <>
+          <Text type="secondary" style={{ display: 'block', marginBottom: 12 }}>
+            未配置已启用策略的用户不受限制；用户本人与其所在用户组的多条策略取并集。录像编号模式支持 * 与 ? 通配符。
+          </Text>
+          <Table rowKey="id" loading={loading} columns={policyColumns} dataSource={policies} pagination={false} />
+        </>
+      ),
+    },
+    {
+      key: 'groups',
+      label: 'DVR 分组',
+      children: (
+        <Table rowKey="id" loading={loading} columns={groupColumns} dataSource={groups} pagination={false} />
+      ),
+    },
+  ];
+
+  return (
+    <Card
+      title="访问策略"
+      extra={
+        <Space>
+          <Button icon={<ReloadOutlined />} onClick={fetchAll}>
+            刷新
+          </Button>
+          <Button icon={<PlusOutlined />} onClick={openCreateGroup}>
+            新建分组
+          </Button>
+          <Button type="primary" icon={<PlusOutlined />} onClick={openCreatePolicy}>
+            新建策略
+          </Button>
+        </Space>
+      }
+    >
+      <Tabs items={tabs} />
+
+      <Modal
+        title={editingGroup ? `编辑分组 - ${editingGroup.name}` : '新建 DVR 分组'}
+        open={groupOpen}
+        onOk={onSaveGroup}
+        onCancel={() => setGroupOpen(false)}
+        okText="保存"
+        cancelText="取消"
+        destroyOnClose
+      >
+        <Form form={groupForm} layout="vertical">
+          <Form.Item name="name" label="分组名称" rules={[{ required: true, message: '请输入分组名称' }]}>
+            <Input autoComplete="off" />
+          </Form.Item>
+          <Form.Item name="description" label="说明">
+            <Input />
+          </Form.Item>
+          <Form.Item
+            name="servers"
+            label="DVR 服务器"
+            extra="每行一个基础 URL，与配置中的 dvr_servers 写法一致"
+            rules={[{ required: true, message: '请输入至少一个服务器' }]}
+          >
+            <Input.TextArea rows={4} placeholder="http://dvr-a:8080/record" />
+          </Form.Item>
+        </Form>
+      </Modal>
+
+      <Modal
+        title={editingPolicy ? `编辑策略 - ${editingPolicy.name}` : '新建访问策略'}
+        open={policyOpen}
+        onOk={onSavePolicy}
+        onCancel={() => setPolicyOpen(false)}
+        okText="保存"
+        cancelText="取消"
+        destroyOnClose
+      >
+        <Form form={policyForm} layout="vertical">
+          <Form.Item name="name" label="策略名称" rules={[{ required: true, message: '请输入策略名称' }]}>
+            <Input autoComplete="off" />
+          </Form.Item>
+          <Form.Item name="subject_type" label="适用对象">
+            <Select
+              options={[
+                { value: 'user', label: '指定用户' },
+                { value: 'group', label: '用户组' },
+                { value: 'anonymous', label: '匿名访问（未登录）' },
+              ]}
+              onChange={() => policyForm.setFieldValue('subject_id', undefined)}
+            />
+          </Form.Item>
+          {subjectType === 'user' && (
+            <Form.Item name="subject_id" label="用户" rules={[{ required: true, message: '请选择用户' }]}>
+              <Select
+                showSearch
+                optionFilterProp="label"
+                options={users.map((u) => ({ value: u.id, label: u.username }))}
+              />
+            </Form.Item>
+          )}
+          {subjectType === 'group' && (
+            <Form.Item name="subject_id" label="用户组" rules={[{ required: true, message: '请选择用户组' }]}>
+              <Select
+                showSearch
+                optionFilterProp="label"
+                options={userGroups.map((g) => ({ value: g.id, label: g.name }))}
+              />
+            </Form.Item>
+          )}
+          <Form.Item name="dvr_group_ids" label="DVR 分组" extra="留空表示不限服务器">
+            <Select mode="multiple" options={groups.map((g) => ({ value: g.id, label: g.name }))} />
+          </Form.Item>
+          <Form.Item name="record_patterns" label="录像编号模式" extra="如 A-*，留空表示不限录像编号">
+            <Select mode="tags" tokenSeparators={[',', ' ']} open={false} />
+          </Form.Item>
+          <Form.Item name="enabled" label="启用" valuePropName="checked">
+            <Switch />
+          </Form.Item>
+        </Form>
+      </Modal>
+    </Card>
+  );
+}
+
+export default AccessPolicies;
@@ -30,10 +30,14 @@ import {
   CheckCircleOutlined,
 } from '@ant-design/icons';
 import { adminService } from '../services/authService';
+import { useAuthStore, hasPermission } from '../store/authStore';
 
 const { Title, Text } = Typography;
 
 function Admin() {
+  const { user } = useAuthStore();
+  // 只读（仅 config:read）时隐藏修改入口
+  const canWrite = hasPermission(user, 'config:write');
   const [loading, setLoading] = useState(false);
   const [servers, setServers] = useState([]);
   const [config, setConfig] = useState(null);
@@ -186,6 +190,7 @@ function Admin() {
         dvr_servers: serverList,
         cors: formValues.cors || {},
         require_auth_for_play: !!formValues.require_auth_for_play,
+        password_policy: formValues.password_policy,
       };
 
       const response = await adminService.updateConfig(configData);
@@ -284,18 +289,22 @@ function Admin() {
           <Button icon={<ReloadOutlined />} onClick={loadData}>
             刷新
           </Button>
-          <Button icon={<ReloadOutlined />} onClick={handleReload} loading={loading}>
-            重载配置
-          </Button>
-          <Button
-            type="primary"
-            icon={<SaveOutlined />}
-            onClick={handleSaveAll}
-            loading={loading}
-            size="large"
-          >
-            保存所有配置
-          </Button>
+          {canWrite && (
+            <>
+              <Button icon={<ReloadOutlined />} onClick={handleReload} loading={loading}>
+                重载配置
+              </Button>
+              <Button
+                type="primary"
+                icon={<SaveOutlined />}
+                onClick={handleSaveAll}
+                loading={loading}
+                size="large"
+              >
+                保存所有配置
+              </Button>
+            </>
+          )}
         </Space>
       </div>
 
@@ -512,6 +521,48 @@ function Admin() {
                       </Form.Item>
                     </Col>
                   </Row>
+                  <Divider orientation="left">密码策略</Divider>
+                  <Row gutter={[24, 16]}>
+                    <Col xs={24} sm={12} lg={8}>
+                      <Form.Item label="最小长度" name={['password_policy', 'min_length']}>
+                        <InputNumber min={6} max={128} style={{ width: '100%' }} addonAfter="位" />
+                      </Form.Item>
+                    </Col>
+                    <Col xs={24} sm={12} lg={8}>
+                      <Form.Item
+                        label="禁止重复使用"
+                        name={['password_policy', 'history_size']}
+                        tooltip="最近 N 次用过的密码（含当前密码）不能再次使用，0 表示不限制"
+                      >
+                        <InputNumber min={0} max={24} style={{ width: '100%' }} addonAfter="次" />
+                      </Form.Item>
+                    </Col>
+                    <Col xs={24} sm={12} lg={8}>
+                      <Form.Item
+                        label="密码有效期"
+                        name={['password_policy', 'max_age_days']}
+                        tooltip="超过有效期后下次登录须修改密码，0 表示永不过期"
+                      >
+                        <InputNumber min={0} max={3650} style={{ width: '100%' }} addonAfter="天" />
+                      </Form.Item>
+                    </Col>
+                  </Row>
+                  <Row gutter={[24, 16]}>
+                    {[
+                      ['require_upper', '须含大写字母'],
+                      ['require_lower', '须含小写字母'],
+                      ['require_digit', '须含数字'],
+                      ['require_symbol', '须含特殊字符'],
+                      ['disallow_common', '禁止常见弱密码'],
+                      ['disallow_username', '禁止包含用户名'],
+                    ].map(([key, label]) => (
+                      <Col xs={12} sm={8} lg={4} key={key}>
+                        <Form.Item label={label} name={['password_policy', key]} valuePropName="checked">
+                          <Switch />
+                        </Form.Item>
+                      </Col>
+                    ))}
+                  </Row>
                 </Form>
               </Card>
             ),
@@ -11,7 +11,12 @@ import {
   DatePicker,
   Tag,
 } from 'antd';
-import { SearchOutlined, ReloadOutlined } from '@ant-design/icons';
+import {
+  SearchOutlined,
+  ReloadOutlined,
+  DownloadOutlined,
+  SafetyCertificateOutlined,
+} from '@ant-design/icons';
 import { adminService } from '../services/authService';
 import { formatDateTime } from '../utils/format';
 
@@ -35,10 +40,13 @@ const ACTION_OPTIONS = [
   { value: 'user_update_role', label: '修改用户角色' },
   { value: 'user_reset_password', label: '重置用户密码' },
   { value: 'user_delete', label: '删除用户' },
+  { value: 'impersonate_start', label: '开始模拟登录' },
+  { value: 'impersonate_end', label: '结束模拟登录' },
   { value: 'sso_create', label: '新增 SSO 提供商' },
   { value: 'sso_update', label: '更新 SSO 提供商' },
   { value: 'sso_toggle', label: 'SSO 启用/停用' },
   { value: 'sso_delete', label: '删除 SSO 提供商' },
+  { value: 'audit_export', label: '导出审计日志' },
 ];
 
 function Audit() {
@@ -47,27 +55,41 @@ function Audit() {
   const [total, setTotal] = useState(0);
   const [page, setPage] = useState(1);
   const [pageSize, setPageSize] = useState(20);
+  const [exporting, setExporting] = useState(false);
+  const [archives, setArchives] = useState([]);
+  const [verifying, setVerifying] = useState(false);
   const [form] = Form.useForm();
 
+  // 列表与导出共用的筛选条件
+  const filterParams = useCallback(() => {
+    const values = form.getFieldsValue();
+    const params = {};
+    if (values.action) params.action = values.action;
+    if (values.username?.trim()) params.username = values.username.trim();
+    if (values.range?.length === 2) {
+      const start = new Date(values.range[0]);
+      const end = new Date(values.range[1]);
+      end.setHours(23, 59, 59, 999);
+      params.from = start.toISOString();
+      params.to = end.toISOString();
+    }
+    return params;
+  }, [form]);
+
   const fetchLogs = useCallback(
     async (pageNum = 1, pageSizeNum = pageSize) => {
       setLoading(true);
       try {
-        const values = form.getFieldsValue();
         const params = {
+          ...filterParams(),
           page: pageNum,
           page_size: pageSizeNum,
         };
-        if (values.action) params.action = values.action;
-        if (values.username?.trim()) params.username = values.username.trim();
-        if (values.range?.length === 2) {
-          const start = new Date(values.range[0]);
-          const end = new Date(values.range[1]);
-          end.setHours(23, 59, 59, 999);
-          params.from = start.toISOString();
-          params.to = end.toISOString();
-        }
-        const res = await adminService.getAuditLogs(params);
+        // 选择归档文件时查询归档（按时间升序），否则查询在线记录
+        const archive = form.getFieldValue('archive');
+        const res = archive
+          ? await adminService.queryAuditArchive(archive, params)
+          : await adminService.getAuditLogs(params);
         if (res?.success) {
           setList(res.list || []);
           setTotal(res.total ?? 0);
@@ -82,11 +104,35 @@ function Audit() {
         setLoading(false);
       }
     },
-    [form, pageSize]
+    [filterParams, pageSize]
   );
 
+  // 按当前筛选条件导出全部匹配记录（不分页）
+  const onExport = async (format) => {
+    setExporting(true);
+    try {
+      const params = { ...filterParams(), format };
+      if (format === 'csv') params.bom = 1;
+      const blob = await adminService.exportAuditLogs(params);
+      const url = URL.createObjectURL(blob);
+      const a = document.createElement('a');
+      a.href = url;
+      a.download = `audit-${Date.now()}.${format}`;
+      a.click();
+      URL.revokeObjectURL(url);
+    } catch (err) {
+      message.error(err?.message || '导出审计日志失败');
+    } finally {
+      setExporting(false);
+    }
+  };
+
   useEffect(() => {
     fetchLogs(1, pageSize);
+    adminService
+      .listAuditArchives()
+      .then((res) => setArchives(res?.list || []))
+      .catch(() => {});
   }, []);
 
   const onSearch = () => {
@@ -106,6 +152,24 @@ function Audit() {
     fetchLogs(pagination.current, pagination.pageSize);
   };
 
+  // 校验审计哈希链与签名检查点
+  const onVerify = async () => {
+    setVerifying(true);
+    try {
+      const res = await adminService.verifyAudit();
+      const report = res?.report;
+      if (report?.ok) {
+        message.success(`审计日志完整：${report.rows} 条记录，${report.checkpoints} 个检查点`);
+      } else if (report?.broken) {
+        message.error(`审计日志在记录 #${report.broken.id} 处断开：${report.broken.message}`, 8);
+      }
+    } catch (err) {
+      message.error(err?.message || '校验失败');
+    } finally {
+      setVerifying(false);
+    }
+  };
+
   const columns = [
     {
       title: '时间',
@@ -124,7 +188,22 @@ function Audit() {
         return opt ? opt.label : action || '-';
       },
     },
-    { title: '用户', dataIndex: 'username', key: 'username', width: 100, ellipsis: true },
+    {
+      title: '用户',
+      dataIndex: 'username',
+      key: 'username',
+      width: 120,
+      ellipsis: true,
+      // 模拟登录期间的操作：被模拟的用户 + 真实管理员
+      render: (v, record) =>
+        record.impersonator ? (
+          <span>
+            {v} <Tag color="orange">{record.impersonator} 模拟</Tag>
+          </span>
+        ) : (
+          v || '-'
+        ),
+    },
     { title: '角色', dataIndex: 'role', key: 'role', width: 80 },
     { title: '客户端 IP', dataIndex: 'client_ip', key: 'client_ip', width: 120 },
     {
@@ -136,6 +215,13 @@ function Audit() {
         v ? <span style={{ wordBreak: 'break-all', display: 'block' }}>{v}</span> : '-',
     },
     { title: '详情', dataIndex: 'detail', key: 'detail', ellipsis: true },
+    {
+      title: '原因码',
+      dataIndex: 'reason',
+      key: 'reason',
+      width: 140,
+      render: (v) => (v ? <Tag>{v}</Tag> : '-'),
+    },
     {
       title: '状态',
       dataIndex: 'status',
@@ -153,6 +239,17 @@ function Audit() {
   return (
     <Card title="审计查询">
       <Form form={form} layout="inline" style={{ marginBottom: 16 }} onFinish={onSearch}>
+        <Form.Item name="archive" label="数据源">
+          <Select
+            style={{ width: 200 }}
+            allowClear
+            placeholder="在线记录"
+            options={archives.map((a) => ({
+              value: a.name,
+              label: `归档 ${a.month}（${a.records} 条）`,
+            }))}
+          />
+        </Form.Item>
         <Form.Item name="range" label="时间范围">
           <RangePicker showTime />
         </Form.Item>
@@ -170,6 +267,15 @@ function Audit() {
             <Button icon={<ReloadOutlined />} onClick={onReset}>
               重置
             </Button>
+            <Button icon={<DownloadOutlined />} loading={exporting} onClick={() => onExport('csv')}>
+              导出 CSV
+            </Button>
+            <Button icon={<DownloadOutlined />} loading={exporting} onClick={() => onExport('jsonl')}>
+              导出 JSONL
+            </Button>
+            <Button icon={<SafetyCertificateOutlined />} loading={verifying} onClick={onVerify}>
+              完整性校验
+            </Button>
           </Space>
         </Form.Item>
       </Form>
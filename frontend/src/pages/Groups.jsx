@@ -0,0 +1,353 @@
+import { useEffect, useState } from 'react';
+import {
+  Card,
+  Table,
+  Button,
+  Space,
+  Modal,
+  Form,
+  Input,
+  Select,
+  message,
+  Popconfirm,
+  Tag,
+  Typography,
+} from 'antd';
+import { PlusOutlined, EditOutlined, DeleteOutlined, ReloadOutlined, TeamOutlined } from '@ant-design/icons';
+import { adminService } from '../services/authService';
+import { useAuthStore, hasPermission } from '../store/authStore';
+import { formatDateTime } from '../utils/format';
+
+const { Text } = Typography;
+
+function Groups() {
+  const { user: currentUser } = useAuthStore();
+  // 仅 users:read 时只读
+  const canWrite = hasPermission(currentUser, 'users:write');
+  const [loading, setLoading] = useState(false);
+  const [list, setList] = useState([]);
+  const [roles, setRoles] = useState([]);
+  const [users, setUsers] = useState([]);
+
+  // 新建 / 编辑（editing 为 null 表示新建）
+  const [open, setOpen] = useState(false);
+  const [editing, setEditing] = useState(null);
+  const [form] = Form.useForm();
+
+  // 成员管理
+  const [memberTarget, setMemberTarget] = useState(null);
+  const [members, setMembers] = useState([]);
+  const [memberUser, setMemberUser] = useState(undefined);
+
+  const fetchList = async () => {
+    setLoading(true);
+    try {
+      const res = await adminService.listGroups();
+      if (res?.success) {
+        setList(res.list || []);
+      } else {
+        message.error(res?.message || '获取用户组失败');
+      }
+    } catch (err) {
+      message.error(err?.response?.data?.message || '获取用户组失败');
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  useEffect(() => {
+    fetchList();
+    adminService
+      .listRoles()
+      .then((res) => res?.success && setRoles(res.list || []))
+      .catch(() => setRoles([]));
+    adminService
+      .listUsers()
+      .then((res) => res?.success && setUsers(res.list || []))
+      .catch(() => setUsers([]));
+  }, []);
+
+  const openCreate = () => {
+    setEditing(null);
+    form.setFieldsValue({ name: '', description: '', role: '', external_name: '' });
+    setOpen(true);
+  };
+
+  const openEdit = (record) => {
+    setEditing(record);
+    form.setFieldsValue({
+      name: record.name,
+      description: record.description,
+      role: record.role,
+      external_name: record.external_name,
+    });
+    setOpen(true);
+  };
+
+  const onSave = async () => {
+    try {
+      const values = await form.validateFields();
+      const payload = { ...values, role: values.role || '' };
+      const res = editing
+        ? await adminService.updateGroup(editing.id, payload)
+        : await adminService.createGroup(payload);
+      if (res?.success) {
+        message.success(editing ? '用户组已更新' : '用户组已创建');
+        setOpen(false);
+        fetchList();
+      } else {
+        message.error(res?.message || '保存失败');
+      }
+    } catch (err) {
+      if (err?.errorFields) return;
+      message.error(err?.response?.data?.message || '保存失败');
+    }
+  };
+
+  const onDelete = async (record) => {
+    try {
+      const res = await adminService.deleteGroup(record.id);
+      if (res?.success) {
+        message.success('用户组已删除');
+        fetchList();
+      } else {
+        message.error(res?.message || '删除失败');
+      }
+    } catch (err) {
+      message.error(err?.response?.data?.message || '删除失败');
+    }
+  };
+
+  const loadMembers = async (group) => {
+    try {
+      const res = await adminService.listGroupMembers(group.id);
+      setMembers(res?.success ? res.list || [] : []);
+    } catch (err) {
+      message.error(err?.response?.data?.message || '获取成员失败');
+    }
+  };
+
+  const openMembers = (record) => {
+    setMemberTarget(record);
+    setMemberUser(undefined);
+    setMembers([]);
+    loadMembers(record);
+  };
+
+  const onAddMember = async () => {
+    if (!memberUser) return;
+    try {
+      const res = await adminService.addGroupMember(memberTarget.id, memberUser);
+      if (res?.success) {
+        message.success('成员已添加');
+        setMemberUser(undefined);
+        loadMembers(memberTarget);
+        fetchList();
+      } else {
+        message.error(res?.message || '添加失败');
+      }
+    } catch (err) {
+      message.error(err?.response?.data?.message || '添加失败');
+    }
+  };
+
+  const onRemoveMember = async (member) => {
+    try {
+      const res = await adminService.removeGroupMember(memberTarget.id, member.user_id);
+      if (res?.success) {
+        message.success('成员已移除');
+        loadMembers(memberTarget);
+        fetchList();
+      } else {
+        message.error(res?.message || '移除失败');
+      }
+    } catch (err) {
+      message.error(err?.response?.data?.message || '移除失败');
+    }
+  };
+
+  const columns = [
+    {
+      title: '用户组',
+      dataIndex: 'name',
+      key: 'name',
+      width: 160,
+      render: (name, record) => (
+        <Space size={4}>
+          {name}
+          {record.source === 'scim' && <Tag color="purple">SCIM</Tag>}
+        </Space>
+      ),
+    },
+    { title: '说明', dataIndex: 'description', key: 'description', width: 200 },
+    {
+      title: '授予角色',
+      dataIndex: 'role',
+      key: 'role',
+      width: 120,
+      render: (role) => (role ? <Tag color="blue">{role}</Tag> : '-'),
+    },
+    {
+      title: 'IdP 组名',
+      dataIndex: 'external_name',
+      key: 'external_name',
+      render: (name) => (name ? <Text code>{name}</Text> : '-'),
+    },
+    { title: '成员数', dataIndex: 'member_count', key: 'member_count', width: 80 },
+    {
+      title: '操作',
+      key: 'action',
+      width: 240,
+      render: (_, record) => (
+        <Space>
+          <Button size="small" icon={<TeamOutlined />} onClick={() => openMembers(record)}>
+            成员
+          </Button>
+          {canWrite && (
+            <>
+              <Button size="small" icon={<EditOutlined />} onClick={() => openEdit(record)}>
+                编辑
+              </Button>
+              <Popconfirm
+                title={`确定删除用户组 ${record.name}？以该组为主体的访问策略将一并删除`}
+                onConfirm={() => onDelete(record)}
+                okText="删除"
+                cancelText="取消"
+              >
+                <Button size="small" danger icon={<DeleteOutlined />}>
+                  删除
+                </Button>
+              </Popconfirm>
+            </>
+          )}
+        </Space>
+      ),
+    },
+  ];
+
+  const memberIds = new Set(members.map((m) => m.user_id));
+
+  return (
+    <Card
+      title="用户组"
+      extra={
+        <Space>
+          <Button icon={<ReloadOutlined />} onClick={fetchList}>
+            刷新
+          </Button>
+          {canWrite && (
+            <Button type="primary" icon={<PlusOutlined />} onClick={openCreate}>
+              新建用户组
+            </Button>
+          )}
+        </Space>
+      }
+    >
+      <Table rowKey="id" loading={loading} columns={columns} dataSource={list} pagination={false} />
+
+      <Modal
+        title={editing ? `编辑用户组 - ${editing.name}` : '新建用户组'}
+        open={open}
+        onOk={onSave}
+        onCancel={() => setOpen(false)}
+        okText="保存"
+        cancelText="取消"
+        destroyOnClose
+      >
+        <Form form={form} layout="vertical">
+          <Form.Item name="name" label="名称" rules={[{ required: true, message: '请输入用户组名称' }]}>
+            <Input autoComplete="off" />
+          </Form.Item>
+          <Form.Item name="description" label="说明">
+            <Input />
+          </Form.Item>
+          <Form.Item name="role" label="授予角色" extra="成员在自身角色之外额外获得该角色的权限；留空表示不授予">
+            <Select
+              allowClear
+              options={roles.map((r) => ({ value: r.name, label: r.description ? `${r.name}（${r.description}）` : r.name }))}
+            />
+          </Form.Item>
+          <Form.Item
+            name="external_name"
+            label="IdP 组名"
+            extra="SSO / LDAP 登录时，IdP 组 Claim 的值或组 DN 的 CN 与此相同（不区分大小写）即自动加入，不再属于时自动移出；留空不同步"
+          >
+            <Input placeholder="dvr-operators" />
+          </Form.Item>
+        </Form>
+      </Modal>
+
+      <Modal
+        title={memberTarget ? `成员 - ${memberTarget.name}` : '成员'}
+        open={!!memberTarget}
+        onCancel={() => setMemberTarget(null)}
+        footer={null}
+        width={640}
+        destroyOnClose
+      >
+        {canWrite && (
+          <Space style={{ marginBottom: 12 }}>
+            <Select
+              showSearch
+              placeholder="选择用户"
+              style={{ width: 260 }}
+              value={memberUser}
+              onChange={setMemberUser}
+              optionFilterProp="label"
+              options={users.filter((u) => !memberIds.has(u.id)).map((u) => ({ value: u.id, label: u.username }))}
+            />
+            <Button type="primary" icon={<PlusOutlined />} onClick={onAddMember} disabled={!memberUser}>
+              添加
+            </Button>
+          </Space>
+        )}
+        <Table
+          rowKey="user_id"
+          size="small"
+          pagination={false}
+          dataSource={members}
+          columns={[
+            { title: '用户', dataIndex: 'username', key: 'username' },
+            {
+              title: '来源',
+              dataIndex: 'source',
+              key: 'source',
+              width: 120,
+              render: (source) => (source === 'manual' ? <Tag>手动添加</Tag> : <Tag color="geekblue">{source}</Tag>),
+            },
+            {
+              title: '加入时间',
+              dataIndex: 'created_at',
+              key: 'created_at',
+              width: 170,
+              render: formatDateTime,
+            },
+            ...(canWrite
+              ? [
+                  {
+                    title: '操作',
+                    key: 'action',
+                    width: 90,
+                    render: (_, member) => (
+                      <Popconfirm
+                        title={`移除成员 ${member.username}？`}
+                        onConfirm={() => onRemoveMember(member)}
+                        okText="移除"
+                        cancelText="取消"
+                      >
+                        <Button size="small" danger>
+                          移除
+                        </Button>
+                      </Popconfirm>
+                    ),
+                  },
+                ]
+              : []),
+          ]}
+        />
+      </Modal>
+    </Card>
+  );
+}
+
+export default Groups;
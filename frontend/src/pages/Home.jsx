@@ -12,6 +12,7 @@ import {
 } from 'antd';
 import { SearchOutlined, PlayCircleOutlined, DownloadOutlined } from '@ant-design/icons';
 import { dvrService } from '../services/authService';
+import { useAuthStore, hasPermission } from '../store/authStore';
 import { getApiErrorMessage } from '../utils/format';
 import VideoPlayer from '../components/VideoPlayer';
 
@@ -25,10 +26,15 @@ function mapPlayError(error) {
   if (error?.response?.status === 404) {
     return '未找到';
   }
+  if (error?.response?.status === 403) {
+    return getApiErrorMessage(error, '无权访问该录像');
+  }
   return getApiErrorMessage(error, '查询失败');
 }
 
 function Home() {
+  const { user } = useAuthStore();
+  const canDownload = hasPermission(user, 'download');
   const [loading, setLoading] = useState(false);
   const [recordIds, setRecordIds] = useState('');
   const [results, setResults] = useState([]);
@@ -91,7 +97,8 @@ function Home() {
                 found: !!r.found,
                 proxyUrl: r.proxy_url || r.proxyUrl || null,
                 playing: false,
-                error: r.found ? undefined : r.message || '未找到',
+                denied: !!r.denied,
+                error: r.found ? undefined : r.denied ? '无权访问该录像' : r.message || '未找到',
               };
             })
           );
@@ -113,12 +120,14 @@ function Home() {
       if (errorMsg === null) {
         return;
       }
+      const denied = error?.response?.status === 403;
       setResults(
         ids.map((id, index) => ({
           key: id || `key-${index}`,
           recordId: id,
           found: false,
           playing: false,
+          denied,
           error: errorMsg,
         }))
       );
@@ -142,7 +151,8 @@ function Home() {
 
   const handleDownload = (recordId, proxyUrl) => {
     const a = document.createElement('a');
-    a.href = proxyUrl;
+    // download=1：服务端校验下载权限并以附件返回
+    a.href = `${proxyUrl}${proxyUrl.includes('?') ? '&' : '?'}download=1`;
     a.download = `${recordId}.mp4`;
     a.rel = 'noopener';
     document.body.appendChild(a);
@@ -166,7 +176,7 @@ function Home() {
         if (found) {
           return <Tag color="success">已找到</Tag>;
         }
-        const errorTag = <Tag color="error">未找到</Tag>;
+        const errorTag = record.denied ? <Tag color="warning">无权访问</Tag> : <Tag color="error">未找到</Tag>;
         return record.error ? <Tooltip title={record.error}>{errorTag}</Tooltip> : errorTag;
       },
     },
@@ -184,13 +194,15 @@ function Home() {
               >
                 {record.playing ? '关闭' : '播放'}
               </Button>
-              <Button
-                type="link"
-                icon={<DownloadOutlined />}
-                onClick={() => handleDownload(record.recordId, record.proxyUrl)}
-              >
-                下载
-              </Button>
+              {canDownload && (
+                <Button
+                  type="link"
+                  icon={<DownloadOutlined />}
+                  onClick={() => handleDownload(record.recordId, record.proxyUrl)}
+                >
+                  下载
+                </Button>
+              )}
             </>
           )}
         </Space>
@@ -1,21 +1,30 @@
-import { useEffect, useState } from 'react';
+import { useCallback, useEffect, useState } from 'react';
 import { Form, Input, Button, message, Divider, Space, Spin } from 'antd';
 import {
   UserOutlined,
   LockOutlined,
   CloudOutlined,
+  SafetyOutlined,
 } from '@ant-design/icons';
-import { useNavigate } from 'react-router-dom';
+import { useLocation, useNavigate } from 'react-router-dom';
 import { useAuthStore } from '../store/authStore';
 import { authService } from '../services/authService';
+import { MfaEnroll, RecoveryCodes } from '../components/MfaEnroll';
+import { getApiErrorMessage } from '../utils/format';
 import './Login.css';
 
 function Login() {
   const [loading, setLoading] = useState(false);
   const navigate = useNavigate();
-  const { login, checkAuth, isAuthenticated } = useAuthStore();
+  const location = useLocation();
+  const { login, confirmSSOLink, completeLogin, checkAuth, isAuthenticated } = useAuthStore();
+  // SSO 身份待关联：{ token, username }（来自 /sso-callback）
+  const [ssoLink, setSsoLink] = useState(location.state?.ssoLink || null);
   const [ssoProviders, setSsoProviders] = useState([]);
   const [checking, setChecking] = useState(true);
+  // 二次验证：{ token, enroll }；recoveryCodes 为登录时完成绑定后待展示的恢复码
+  const [mfa, setMfa] = useState(null);
+  const [pendingLogin, setPendingLogin] = useState(null);
 
   useEffect(() => {
     (async () => {
@@ -45,7 +54,9 @@ function Login() {
     setLoading(true);
     try {
       const result = await login(values.username, values.password);
-      if (result.success) {
+      if (result.success && result.mfa) {
+        setMfa(result.mfa);
+      } else if (result.success) {
         message.success('登录成功');
         navigate('/');
       } else {
@@ -58,6 +69,137 @@ function Login() {
     }
   };
 
+  const onConfirmLink = async (values) => {
+    setLoading(true);
+    try {
+      const result = await confirmSSOLink(ssoLink.token, values.password);
+      if (result.success) {
+        setSsoLink(null);
+        if (result.mfa) {
+          setMfa(result.mfa);
+        } else {
+          message.success('账号已关联，登录成功');
+          navigate('/');
+        }
+      } else {
+        message.error(result.message || '关联失败');
+      }
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  const renderSSOLink = () => (
+    <Form name="sso-link" onFinish={onConfirmLink} autoComplete="off" size="large" layout="vertical" className="login-form">
+      <div style={{ marginBottom: 16 }}>
+        SSO 账号与已有账号 <b>{ssoLink.username}</b> 同名。如果这是你的账号，请输入其密码完成关联；否则请联系管理员。
+      </div>
+      <Form.Item
+        name="password"
+        label="账号密码"
+        rules={[{ required: true, message: '请输入密码' }]}
+        className="login-form-item"
+      >
+        <Input.Password prefix={<LockOutlined className="login-input-icon" />} autoFocus className="login-input" />
+      </Form.Item>
+      <Form.Item className="login-form-item-submit">
+        <Button type="primary" htmlType="submit" block loading={loading} className="login-submit-button">
+          关联并登录
+        </Button>
+      </Form.Item>
+      <Button type="link" block onClick={() => setSsoLink(null)}>
+        返回
+      </Button>
+    </Form>
+  );
+
+  const finishLogin = (res) => {
+    completeLogin(res);
+    message.success('登录成功');
+    navigate('/');
+  };
+
+  const onVerifyMFA = async (values) => {
+    setLoading(true);
+    try {
+      const res = await authService.loginMFA(mfa.token, values.code.trim());
+      if (res?.success) {
+        finishLogin(res);
+      }
+    } catch (error) {
+      message.error(getApiErrorMessage(error, '验证失败'));
+      if (error?.response?.status === 401 && /过期/.test(error?.response?.data?.message || '')) {
+        setMfa(null);
+      }
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  const setupEnroll = useCallback(() => authService.loginMFASetup(mfa?.token), [mfa?.token]);
+
+  const onActivateEnroll = async (code) => {
+    try {
+      const res = await authService.loginMFAActivate(mfa.token, code);
+      if (res?.success) {
+        setPendingLogin(res);
+      }
+    } catch (error) {
+      message.error(getApiErrorMessage(error, '验证失败'));
+    }
+  };
+
+  const renderMFA = () => {
+    if (pendingLogin) {
+      return (
+        <Space direction="vertical" style={{ width: '100%' }}>
+          <RecoveryCodes codes={pendingLogin.recovery_codes || []} />
+          <Button type="primary" block size="large" onClick={() => finishLogin(pendingLogin)}>
+            我已保存，进入系统
+          </Button>
+        </Space>
+      );
+    }
+    if (mfa.enroll) {
+      return (
+        <Space direction="vertical" style={{ width: '100%' }}>
+          <div style={{ textAlign: 'center' }}>当前账号要求启用二次验证，请先绑定验证器</div>
+          <MfaEnroll setup={setupEnroll} onActivate={onActivateEnroll} />
+          <Button type="link" block onClick={() => setMfa(null)}>
+            返回
+          </Button>
+        </Space>
+      );
+    }
+    return (
+      <Form name="login-mfa" onFinish={onVerifyMFA} autoComplete="off" size="large" layout="vertical" className="login-form">
+        <Form.Item
+          name="code"
+          label="二次验证"
+          extra="输入验证器 App 中的 6 位验证码，或使用恢复码"
+          rules={[{ required: true, message: '请输入验证码' }]}
+          className="login-form-item"
+        >
+          <Input
+            prefix={<SafetyOutlined className="login-input-icon" />}
+            placeholder="验证码或恢复码"
+            autoComplete="one-time-code"
+            autoFocus
+            className="login-input"
+          />
+        </Form.Item>
+        <Form.Item className="login-form-item-submit">
+          <Button type="primary" htmlType="submit" block loading={loading} className="login-submit-button">
+            验证
+          </Button>
+        </Form.Item>
+        <Button type="link" block onClick={() => setMfa(null)}>
+          返回
+        </Button>
+      </Form>
+    );
+  };
+
   if (checking) {
     return (
       <div className="login-container" style={{ display: 'flex', alignItems: 'center', justifyContent: 'center' }}>
@@ -132,6 +274,8 @@ function Login() {
         </div>
         
         <div className="login-form-wrapper">
+          {ssoLink ? renderSSOLink() : mfa ? renderMFA() : (
+          <>
           <Form
             name="login"
             onFinish={onFinish}
@@ -203,6 +347,8 @@ function Login() {
               </Space>
             </>
           )}
+          </>
+          )}
         </div>
       </div>
       <div className="login-footer">
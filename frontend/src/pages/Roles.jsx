@@ -0,0 +1,218 @@
+import { useEffect, useState } from 'react';
+import {
+  Card,
+  Table,
+  Button,
+  Space,
+  Modal,
+  Form,
+  Input,
+  Checkbox,
+  message,
+  Popconfirm,
+  Tag,
+  Tooltip,
+} from 'antd';
+import { PlusOutlined, EditOutlined, DeleteOutlined, ReloadOutlined } from '@ant-design/icons';
+import { adminService } from '../services/authService';
+
+function Roles() {
+  const [loading, setLoading] = useState(false);
+  const [list, setList] = useState([]);
+  // 全部可选权限 [{ key, description }]
+  const [permissions, setPermissions] = useState([]);
+
+  // 新建 / 编辑（editing 为 null 表示新建）
+  const [open, setOpen] = useState(false);
+  const [editing, setEditing] = useState(null);
+  const [form] = Form.useForm();
+
+  const fetchList = async () => {
+    setLoading(true);
+    try {
+      const res = await adminService.listRoles();
+      if (res?.success) {
+        setList(res.list || []);
+        setPermissions(res.permissions || []);
+      } else {
+        message.error(res?.message || '获取角色列表失败');
+      }
+    } catch (err) {
+      message.error(err?.response?.data?.message || '获取角色列表失败');
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  useEffect(() => {
+    fetchList();
+  }, []);
+
+  const openCreate = () => {
+    setEditing(null);
+    form.setFieldsValue({ name: '', description: '', permissions: [] });
+    setOpen(true);
+  };
+
+  const openEdit = (record) => {
+    setEditing(record);
+    form.setFieldsValue({
+      name: record.name,
+      description: record.description,
+      permissions: record.permissions,
+    });
+    setOpen(true);
+  };
+
+  const onSave = async () => {
+    try {
+      const values = await form.validateFields();
+      const res = editing
+        ? await adminService.updateRole(editing.name, values)
+        : await adminService.createRole(values);
+      if (res?.success) {
+        message.success(editing ? '角色已更新' : '角色已创建');
+        setOpen(false);
+        fetchList();
+      } else {
+        message.error(res?.message || '保存失败');
+      }
+    } catch (err) {
+      if (err?.errorFields) return;
+      message.error(err?.response?.data?.message || '保存失败');
+    }
+  };
+
+  const onDelete = async (record) => {
+    try {
+      const res = await adminService.deleteRole(record.name);
+      if (res?.success) {
+        message.success('角色已删除');
+        fetchList();
+      } else {
+        message.error(res?.message || '删除失败');
+      }
+    } catch (err) {
+      message.error(err?.response?.data?.message || '删除失败');
+    }
+  };
+
+  const permLabel = (key) => permissions.find((p) => p.key === key)?.description || key;
+
+  const columns = [
+    {
+      title: '角色',
+      dataIndex: 'name',
+      key: 'name',
+      width: 160,
+      render: (name, record) => (
+        <Space>
+          <span>{name}</span>
+          {record.builtin && <Tag>内置</Tag>}
+        </Space>
+      ),
+    },
+    { title: '说明', dataIndex: 'description', key: 'description', width: 220 },
+    {
+      title: '权限',
+      dataIndex: 'permissions',
+      key: 'permissions',
+      render: (perms) => (
+        <Space size={[4, 4]} wrap>
+          {(perms || []).map((p) => (
+            <Tooltip key={p} title={permLabel(p)}>
+              <Tag color="blue">{p}</Tag>
+            </Tooltip>
+          ))}
+        </Space>
+      ),
+    },
+    { title: '用户数', dataIndex: 'user_count', key: 'user_count', width: 80 },
+    {
+      title: '操作',
+      key: 'action',
+      width: 170,
+      render: (_, record) => (
+        <Space>
+          <Button
+            size="small"
+            icon={<EditOutlined />}
+            onClick={() => openEdit(record)}
+            disabled={record.name === 'admin'}
+          >
+            编辑
+          </Button>
+          <Popconfirm
+            title={`确定删除角色 ${record.name}？`}
+            onConfirm={() => onDelete(record)}
+            okText="删除"
+            cancelText="取消"
+            disabled={record.builtin || record.user_count > 0}
+          >
+            <Button
+              size="small"
+              danger
+              icon={<DeleteOutlined />}
+              disabled={record.builtin || record.user_count > 0}
+            >
+              删除
+            </Button>
+          </Popconfirm>
+        </Space>
+      ),
+    },
+  ];
+
+  return (
+    <Card
+      title="角色权限"
+      extra={
+        <Space>
+          <Button icon={<ReloadOutlined />} onClick={fetchList}>
+            刷新
+          </Button>
+          <Button type="primary" icon={<PlusOutlined />} onClick={openCreate}>
+            新建角色
+          </Button>
+        </Space>
+      }
+    >
+      <Table rowKey="name" loading={loading} columns={columns} dataSource={list} pagination={false} />
+
+      <Modal
+        title={editing ? `编辑角色 - ${editing.name}` : '新建角色'}
+        open={open}
+        onOk={onSave}
+        onCancel={() => setOpen(false)}
+        okText="保存"
+        cancelText="取消"
+        destroyOnClose
+      >
+        <Form form={form} layout="vertical">
+          <Form.Item
+            name="name"
+            label="角色名"
+            extra="2~32 位小写字母、数字、- 或 _，以字母开头；创建后不可修改"
+            rules={[{ required: true, message: '请输入角色名' }]}
+          >
+            <Input disabled={!!editing} autoComplete="off" />
+          </Form.Item>
+          <Form.Item name="description" label="说明">
+            <Input />
+          </Form.Item>
+          <Form.Item name="permissions" label="权限">
+            <Checkbox.Group style={{ display: 'flex', flexDirection: 'column', gap: 6 }}>
+              {permissions.map((p) => (
+                <Checkbox key={p.key} value={p.key}>
+                  <code>{p.key}</code> {p.description}
+                </Checkbox>
+              ))}
+            </Checkbox.Group>
+          </Form.Item>
+        </Form>
+      </Modal>
+    </Card>
+  );
+}
+
+export default Roles;
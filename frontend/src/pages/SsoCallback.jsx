@@ -22,14 +22,22 @@ function SsoCallback() {
       setErrorMsg(err);
       return;
     }
+    // IdP 用户名与已有账号冲突：回登录页输入该账号密码确认关联
+    const linkToken = params.get('link_token');
+    if (linkToken) {
+      window.history.replaceState(null, '', '/sso-callback');
+      navigate('/login', { replace: true, state: { ssoLink: { token: linkToken, username: params.get('username') } } });
+      return;
+    }
     const token = params.get('token');
+    const refreshToken = params.get('refresh_token');
     const username = params.get('username');
     const role = params.get('role');
     if (!token || !username) {
       setErrorMsg('SSO 回调缺少 token 或 username');
       return;
     }
-    hydrate({ token, user: { username, role: role || 'user' } });
+    hydrate({ token, refreshToken, user: { username, role: role || 'user' } });
     window.history.replaceState(null, '', '/sso-callback');
     navigate('/', { replace: true });
   }, [hydrate, navigate]);
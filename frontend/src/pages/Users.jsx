@@ -11,6 +11,12 @@ import {
   message,
   Popconfirm,
   Tag,
+  Avatar,
+  Checkbox,
+  Typography,
+  Tooltip,
+  DatePicker,
+  Alert,
 } from 'antd';
 import {
   PlusOutlined,
@@ -18,15 +24,35 @@ import {
   KeyOutlined,
   DeleteOutlined,
   ReloadOutlined,
+  SafetyOutlined,
+  UnlockOutlined,
+  UserOutlined,
+  LinkOutlined,
+  StopOutlined,
+  CheckCircleOutlined,
+  ClockCircleOutlined,
+  EyeOutlined,
 } from '@ant-design/icons';
+import { useNavigate } from 'react-router-dom';
+import dayjs from 'dayjs';
 import { adminService } from '../services/authService';
-import { useAuthStore } from '../store/authStore';
+import { useAuthStore, hasPermission } from '../store/authStore';
 import { formatDateTime } from '../utils/format';
 
+const { Text } = Typography;
+
 function Users() {
-  const { user: currentUser } = useAuthStore();
+  const { user: currentUser, startImpersonation } = useAuthStore();
+  const navigate = useNavigate();
+  // 仅 users:read 时只读
+  const canWrite = hasPermission(currentUser, 'users:write');
+  const canImpersonate = hasPermission(currentUser, 'users:impersonate');
   const [loading, setLoading] = useState(false);
   const [list, setList] = useState([]);
+  // 筛选：q 匹配用户名 / 邮箱 / 显示名
+  const [filters, setFilters] = useState({ q: '', role: undefined, source: '', status: undefined, never_logged_in: false });
+  // 角色列表（内置 + 自定义），用于筛选与分配
+  const [roles, setRoles] = useState([]);
 
   // 新增用户
   const [createOpen, setCreateOpen] = useState(false);
@@ -42,10 +68,30 @@ function Users() {
   const [pwdForm] = Form.useForm();
   const [pwdTarget, setPwdTarget] = useState(null);
 
-  const fetchList = async () => {
+  // 外部身份（SSO subject）关联
+  const [idTarget, setIdTarget] = useState(null);
+  const [identities, setIdentities] = useState([]);
+  const [idForm] = Form.useForm();
+
+  // 批量停用 / 启用
+  const [selectedIds, setSelectedIds] = useState([]);
+  const [disableTargets, setDisableTargets] = useState(null);
+  const [disableForm] = Form.useForm();
+
+  // 有效期与登录限制
+  const [limitTarget, setLimitTarget] = useState(null);
+  const [limitForm] = Form.useForm();
+
+  const fetchList = async (f = filters) => {
     setLoading(true);
     try {
-      const res = await adminService.listUsers();
+      const params = {};
+      if (f.q) params.q = f.q;
+      if (f.role) params.role = f.role;
+      if (f.source) params.source = f.source;
+      if (f.status) params.status = f.status;
+      if (f.never_logged_in) params.never_logged_in = true;
+      const res = await adminService.listUsers(params);
       if (res?.success) {
         setList(res.list || []);
       } else {
@@ -58,10 +104,25 @@ function Users() {
     }
   };
 
+  const fetchRoles = async () => {
+    try {
+      const res = await adminService.listRoles();
+      if (res?.success) setRoles(res.list || []);
+    } catch {
+      // 角色列表仅用于下拉选项，失败时保留空列表
+    }
+  };
+
   useEffect(() => {
     fetchList();
+    fetchRoles();
   }, []);
 
+  const roleOptions = roles.map((r) => ({
+    value: r.name,
+    label: r.description ? `${r.name}（${r.description}）` : r.name,
+  }));
+
   const onCreate = async () => {
     try {
       const values = await createForm.validateFields();
@@ -125,6 +186,194 @@ function Users() {
     }
   };
 
+  const onResetMFA = async (record) => {
+    try {
+      const res = await adminService.resetUserMFA(record.id);
+      if (res?.success) {
+        message.success('二次验证已重置');
+        fetchList();
+      } else {
+        message.error(res?.message || '重置失败');
+      }
+    } catch (err) {
+      message.error(err?.response?.data?.message || '重置失败');
+    }
+  };
+
+  // 模拟登录：以该用户身份查看（复现其权限下的问题），须填写原因
+  const [impersonateTarget, setImpersonateTarget] = useState(null);
+  const [impersonateForm] = Form.useForm();
+
+  const openImpersonate = (record) => {
+    setImpersonateTarget(record);
+    impersonateForm.resetFields();
+  };
+
+  const onImpersonate = async () => {
+    try {
+      const values = await impersonateForm.validateFields();
+      const res = await adminService.impersonateUser(impersonateTarget.id, values.reason);
+      if (!res?.success) {
+        message.error(res?.message || '模拟登录失败');
+        return;
+      }
+      const result = await startImpersonation(res.token);
+      if (!result.success) {
+        message.error(result.message);
+        return;
+      }
+      setImpersonateTarget(null);
+      navigate('/');
+    } catch (err) {
+      if (err?.errorFields) return;
+      message.error(err?.response?.data?.message || '模拟登录失败');
+    }
+  };
+
+  const onUnlock = async (record) => {
+    try {
+      const res = await adminService.unlockUser(record.id);
+      if (res?.success) {
+        message.success('已解除登录锁定');
+        fetchList();
+      } else {
+        message.error(res?.message || '解锁失败');
+      }
+    } catch (err) {
+      message.error(err?.response?.data?.message || '解锁失败');
+    }
+  };
+
+  // reportBulk 汇总批量操作结果，失败项逐个提示
+  const reportBulk = (res, verb) => {
+    const failed = (res?.results || []).filter((r) => !r.success);
+    if (failed.length === 0) {
+      message.success(`已${verb} ${res?.updated ?? 0} 个账号`);
+    } else {
+      message.warning(
+        `已${verb} ${res?.updated ?? 0} 个账号，${failed.length} 个失败：` +
+          failed.map((r) => `${r.username || r.user_id}（${r.message}）`).join('；')
+      );
+    }
+  };
+
+  const openDisable = (ids) => {
+    setDisableTargets(ids);
+    disableForm.resetFields();
+  };
+
+  const onDisable = async () => {
+    try {
+      const values = await disableForm.validateFields();
+      const res = await adminService.disableUsers(disableTargets, values.reason || '');
+      if (res?.success) {
+        reportBulk(res, '停用');
+        setDisableTargets(null);
+        setSelectedIds([]);
+        fetchList();
+      } else {
+        message.error(res?.message || '停用失败');
+      }
+    } catch (err) {
+      if (err?.errorFields) return;
+      message.error(err?.response?.data?.message || '停用失败');
+    }
+  };
+
+  const onEnable = async (ids) => {
+    try {
+      const res = await adminService.enableUsers(ids);
+      if (res?.success) {
+        reportBulk(res, '启用');
+        setSelectedIds([]);
+        fetchList();
+      } else {
+        message.error(res?.message || '启用失败');
+      }
+    } catch (err) {
+      message.error(err?.response?.data?.message || '启用失败');
+    }
+  };
+
+  const openLimits = (record) => {
+    setLimitTarget(record);
+    limitForm.setFieldsValue({
+      expires_at: record.expires_at ? dayjs(record.expires_at) : null,
+      login_hours: record.login_hours || '',
+      allowed_cidrs: record.allowed_cidrs || [],
+    });
+  };
+
+  const onSaveLimits = async () => {
+    try {
+      const values = await limitForm.validateFields();
+      const res = await adminService.updateUserRestrictions(limitTarget.id, {
+        expires_at: values.expires_at ? values.expires_at.toISOString() : null,
+        login_hours: values.login_hours || '',
+        allowed_cidrs: values.allowed_cidrs || [],
+      });
+      if (res?.success) {
+        message.success('登录限制已更新');
+        setLimitTarget(null);
+        fetchList();
+      } else {
+        message.error(res?.message || '保存失败');
+      }
+    } catch (err) {
+      if (err?.errorFields) return;
+      message.error(err?.response?.data?.message || '保存失败');
+    }
+  };
+
+  const fetchIdentities = async (record) => {
+    try {
+      const res = await adminService.listUserIdentities(record.id);
+      if (res?.success) {
+        setIdentities(res.list || []);
+      }
+    } catch (err) {
+      message.error(err?.response?.data?.message || '获取外部身份失败');
+    }
+  };
+
+  const openIdentities = (record) => {
+    setIdTarget(record);
+    setIdentities([]);
+    idForm.resetFields();
+    fetchIdentities(record);
+  };
+
+  const onLinkIdentity = async () => {
+    try {
+      const values = await idForm.validateFields();
+      const res = await adminService.linkUserIdentity(idTarget.id, values.provider.trim(), values.subject.trim());
+      if (res?.success) {
+        message.success('已关联');
+        idForm.resetFields();
+        fetchIdentities(idTarget);
+      } else {
+        message.error(res?.message || '关联失败');
+      }
+    } catch (err) {
+      if (err?.errorFields) return;
+      message.error(err?.response?.data?.message || '关联失败');
+    }
+  };
+
+  const onUnlinkIdentity = async (identity) => {
+    try {
+      const res = await adminService.unlinkUserIdentity(idTarget.id, identity.id);
+      if (res?.success) {
+        message.success('已解除关联');
+        fetchIdentities(idTarget);
+      } else {
+        message.error(res?.message || '解除失败');
+      }
+    } catch (err) {
+      message.error(err?.response?.data?.message || '解除失败');
+    }
+  };
+
   const onDelete = async (record) => {
     try {
       const res = await adminService.deleteUser(record.id);
@@ -141,14 +390,110 @@ function Users() {
 
   const columns = [
     { title: 'ID', dataIndex: 'id', key: 'id', width: 70 },
-    { title: '用户名', dataIndex: 'username', key: 'username' },
+    {
+      title: '用户',
+      dataIndex: 'username',
+      key: 'username',
+      render: (username, record) => (
+        <Space>
+          <Avatar size="small" src={record.avatar_url || undefined} icon={<UserOutlined />} />
+          <Space direction="vertical" size={0}>
+            <Text>
+              {username}
+              {record.display_name && <Text type="secondary">（{record.display_name}）</Text>}
+            </Text>
+            {record.email && <Text type="secondary" style={{ fontSize: 12 }}>{record.email}</Text>}
+          </Space>
+        </Space>
+      ),
+    },
+    { title: '来源', dataIndex: 'source', key: 'source', width: 110 },
     {
       title: '角色',
       dataIndex: 'role',
       key: 'role',
       width: 100,
-      render: (role) =>
-        role === 'admin' ? <Tag color="purple">管理员</Tag> : <Tag>普通用户</Tag>,
+      render: (role) => {
+        if (role === 'admin') return <Tag color="purple">管理员</Tag>;
+        if (role === 'user') return <Tag>普通用户</Tag>;
+        return <Tag color="blue">{role}</Tag>;
+      },
+    },
+    {
+      title: '用户组',
+      dataIndex: 'groups',
+      key: 'groups',
+      width: 160,
+      render: (groups) =>
+        groups?.length ? (
+          <Space size={[4, 4]} wrap>
+            {groups.map((g) => (
+              <Tooltip key={g.id} title={g.role ? `角色：${g.role}` : undefined}>
+                <Tag color={g.source === 'manual' ? 'default' : 'geekblue'}>{g.name}</Tag>
+              </Tooltip>
+            ))}
+          </Space>
+        ) : (
+          '-'
+        ),
+    },
+    {
+      title: '二次验证',
+      dataIndex: 'mfa_enabled',
+      key: 'mfa_enabled',
+      width: 100,
+      render: (enabled) => (enabled ? <Tag color="green">已启用</Tag> : <Tag>未启用</Tag>),
+    },
+    {
+      title: '登录状态',
+      dataIndex: 'locked_until',
+      key: 'locked_until',
+      width: 200,
+      render: (until, record) => {
+        const expired = record.expires_at && dayjs(record.expires_at).isBefore(dayjs());
+        const limits = [
+          record.login_hours && `时段 ${record.login_hours}`,
+          record.allowed_cidrs?.length > 0 && `网段 ${record.allowed_cidrs.join(', ')}`,
+        ].filter(Boolean);
+        return (
+          <Space direction="vertical" size={2}>
+            {record.disabled ? (
+              <Tooltip title={record.disabled_reason === 'expired' ? '到期自动停用' : record.disabled_reason || undefined}>
+                <Tag color="default">已停用</Tag>
+              </Tooltip>
+            ) : expired ? (
+              <Tag color="orange">已过期</Tag>
+            ) : until ? (
+              <Tag color="red">锁定至 {formatDateTime(until)}</Tag>
+            ) : (
+              <Tag color="green">正常</Tag>
+            )}
+            {record.expires_at && !record.disabled && !expired && (
+              <Text type="secondary" style={{ fontSize: 12 }}>有效期至 {formatDateTime(record.expires_at)}</Text>
+            )}
+            {limits.length > 0 && (
+              <Tooltip title={limits.join('；')}>
+                <Tag icon={<ClockCircleOutlined />}>登录限制</Tag>
+              </Tooltip>
+            )}
+          </Space>
+        );
+      },
+    },
+    {
+      title: '最近登录',
+      dataIndex: 'last_login_at',
+      key: 'last_login_at',
+      width: 200,
+      render: (at, record) =>
+        at ? (
+          <Space direction="vertical" size={0}>
+            <span>{formatDateTime(at)}</span>
+            <Text type="secondary" style={{ fontSize: 12 }}>{record.last_login_ip}</Text>
+          </Space>
+        ) : (
+          <Text type="secondary">从未登录</Text>
+        ),
     },
     {
       title: '创建时间',
@@ -167,11 +512,27 @@ function Users() {
     {
       title: '操作',
       key: 'action',
-      width: 280,
+      width: 440,
       render: (_, record) => {
         const isSelf = record.username === currentUser?.username;
+        const impersonateButton = canImpersonate && !isSelf && !record.disabled && (
+          <Button size="small" icon={<EyeOutlined />} onClick={() => openImpersonate(record)}>
+            模拟登录
+          </Button>
+        );
+        if (!canWrite) {
+          return (
+            <Space wrap>
+              <Button size="small" icon={<LinkOutlined />} onClick={() => openIdentities(record)}>
+                外部身份
+              </Button>
+              {impersonateButton}
+            </Space>
+          );
+        }
         return (
           <Space wrap>
+            {impersonateButton}
             <Button
               size="small"
               icon={<EditOutlined />}
@@ -187,6 +548,44 @@ function Users() {
             >
               重置密码
             </Button>
+            <Button size="small" icon={<LinkOutlined />} onClick={() => openIdentities(record)}>
+              外部身份
+            </Button>
+            <Button
+              size="small"
+              icon={<ClockCircleOutlined />}
+              onClick={() => openLimits(record)}
+              disabled={isSelf}
+            >
+              登录限制
+            </Button>
+            {record.disabled ? (
+              <Button size="small" icon={<CheckCircleOutlined />} onClick={() => onEnable([record.id])}>
+                启用
+              </Button>
+            ) : (
+              <Button size="small" icon={<StopOutlined />} onClick={() => openDisable([record.id])} disabled={isSelf}>
+                停用
+              </Button>
+            )}
+            {record.locked_until && (
+              <Button size="small" icon={<UnlockOutlined />} onClick={() => onUnlock(record)}>
+                解锁
+              </Button>
+            )}
+            {record.mfa_enabled && (
+              <Popconfirm
+                title="确认重置该用户的二次验证？"
+                description="用户需重新绑定验证器，旧恢复码全部作废"
+                okText="重置"
+                cancelText="取消"
+                onConfirm={() => onResetMFA(record)}
+              >
+                <Button size="small" icon={<SafetyOutlined />}>
+                  重置 MFA
+                </Button>
+              </Popconfirm>
+            )}
             <Popconfirm
               title="确认删除该用户？"
               okText="删除"
@@ -210,23 +609,147 @@ function Users() {
       title="用户管理"
       extra={
         <Space>
-          <Button icon={<ReloadOutlined />} onClick={fetchList}>
+          <Button icon={<ReloadOutlined />} onClick={() => fetchList()}>
             刷新
           </Button>
-          <Button type="primary" icon={<PlusOutlined />} onClick={() => setCreateOpen(true)}>
-            新增用户
-          </Button>
+          {canWrite && selectedIds.length > 0 && (
+            <>
+              <Button icon={<StopOutlined />} onClick={() => openDisable(selectedIds)}>
+                批量停用（{selectedIds.length}）
+              </Button>
+              <Popconfirm
+                title={`确认启用选中的 ${selectedIds.length} 个账号？`}
+                okText="启用"
+                cancelText="取消"
+                onConfirm={() => onEnable(selectedIds)}
+              >
+                <Button icon={<CheckCircleOutlined />}>批量启用</Button>
+              </Popconfirm>
+            </>
+          )}
+          {canWrite && (
+            <Button type="primary" icon={<PlusOutlined />} onClick={() => setCreateOpen(true)}>
+              新增用户
+            </Button>
+          )}
         </Space>
       }
     >
+      <Space wrap style={{ marginBottom: 16 }}>
+        <Input.Search
+          allowClear
+          placeholder="用户名 / 邮箱 / 显示名"
+          style={{ width: 240 }}
+          value={filters.q}
+          onChange={(e) => setFilters({ ...filters, q: e.target.value })}
+          onSearch={(q) => fetchList({ ...filters, q })}
+        />
+        <Select
+          allowClear
+          placeholder="角色"
+          style={{ width: 120 }}
+          value={filters.role}
+          onChange={(role) => {
+            const next = { ...filters, role };
+            setFilters(next);
+            fetchList(next);
+          }}
+          options={roles.map((r) => ({ value: r.name, label: r.name }))}
+        />
+        <Input
+          allowClear
+          placeholder="来源，如 local / oidc:1 / scim"
+          style={{ width: 180 }}
+          value={filters.source}
+          onChange={(e) => setFilters({ ...filters, source: e.target.value })}
+          onPressEnter={() => fetchList()}
+        />
+        <Select
+          allowClear
+          placeholder="状态"
+          style={{ width: 110 }}
+          value={filters.status}
+          onChange={(status) => {
+            const next = { ...filters, status };
+            setFilters(next);
+            fetchList(next);
+          }}
+          options={[
+            { value: 'enabled', label: '启用' },
+            { value: 'disabled', label: '已停用' },
+          ]}
+        />
+        <Checkbox
+          checked={filters.never_logged_in}
+          onChange={(e) => {
+            const next = { ...filters, never_logged_in: e.target.checked };
+            setFilters(next);
+            fetchList(next);
+          }}
+        >
+          仅从未登录
+        </Checkbox>
+      </Space>
       <Table
         rowKey="id"
         loading={loading}
         columns={columns}
         dataSource={list}
         pagination={false}
+        rowSelection={
+          canWrite
+            ? {
+                selectedRowKeys: selectedIds,
+                onChange: setSelectedIds,
+                getCheckboxProps: (record) => ({ disabled: record.username === currentUser?.username }),
+              }
+            : undefined
+        }
       />
 
+      <Modal
+        title={disableTargets?.length > 1 ? `停用 ${disableTargets.length} 个账号` : '停用账号'}
+        open={!!disableTargets}
+        onOk={onDisable}
+        onCancel={() => setDisableTargets(null)}
+        okText="停用"
+        okButtonProps={{ danger: true }}
+        cancelText="取消"
+        destroyOnClose
+      >
+        <Form form={disableForm} layout="vertical">
+          <Form.Item name="reason" label="停用原因" extra="停用后立即吊销其全部会话，账号与历史记录保留，可随时重新启用">
+            <Input placeholder="如：合同到期" maxLength={200} />
+          </Form.Item>
+        </Form>
+      </Modal>
+
+      <Modal
+        title={`登录限制 - ${limitTarget?.username || ''}`}
+        open={!!limitTarget}
+        onOk={onSaveLimits}
+        onCancel={() => setLimitTarget(null)}
+        okText="保存"
+        cancelText="取消"
+        destroyOnClose
+      >
+        <Form form={limitForm} layout="vertical">
+          <Form.Item name="expires_at" label="有效期至" extra="到期后无法登录，并由定时任务自动停用；留空表示长期有效">
+            <DatePicker showTime style={{ width: '100%' }} />
+          </Form.Item>
+          <Form.Item
+            name="login_hours"
+            label="允许登录时段"
+            extra="服务器本地时间，HH:MM-HH:MM，多个时段以逗号分隔，支持跨零点（如 22:00-06:00）；留空不限"
+          >
+            <Input placeholder="08:00-18:00" />
+          </Form.Item>
+          <Form.Item name="allowed_cidrs" label="允许的来源 IP / 网段" extra="输入后回车添加；留空不限">
+            <Select mode="tags" placeholder="10.0.0.0/8" tokenSeparators={[',', ' ']} open={false} />
+          </Form.Item>
+        </Form>
+      </Modal>
+
       <Modal
         title="新增用户"
         open={createOpen}
@@ -255,12 +778,7 @@ function Users() {
             <Input.Password autoComplete="new-password" />
           </Form.Item>
           <Form.Item name="role" label="角色" rules={[{ required: true }]}>
-            <Select
-              options={[
-                { value: 'user', label: '普通用户' },
-                { value: 'admin', label: '管理员' },
-              ]}
-            />
+            <Select options={roleOptions} />
           </Form.Item>
         </Form>
       </Modal>
@@ -276,12 +794,7 @@ function Users() {
       >
         <Form form={roleForm} layout="vertical">
           <Form.Item name="role" label="角色" rules={[{ required: true }]}>
-            <Select
-              options={[
-                { value: 'user', label: '普通用户' },
-                { value: 'admin', label: '管理员' },
-              ]}
-            />
+            <Select options={roleOptions} />
           </Form.Item>
         </Form>
       </Modal>
@@ -308,6 +821,92 @@ function Users() {
           </Form.Item>
         </Form>
       </Modal>
+
+      <Modal
+        title={`外部身份 - ${idTarget?.username || ''}`}
+        open={!!idTarget}
+        onCancel={() => setIdTarget(null)}
+        footer={null}
+        width={720}
+        destroyOnClose
+      >
+        <Table
+          rowKey="id"
+          size="small"
+          pagination={false}
+          dataSource={identities}
+          locale={{ emptyText: '未关联外部身份' }}
+          columns={[
+            { title: '来源', dataIndex: 'provider', key: 'provider', width: 100 },
+            { title: 'Subject', dataIndex: 'subject', key: 'subject', ellipsis: true },
+            { title: 'IdP 用户名', dataIndex: 'username', key: 'username', width: 120 },
+            {
+              title: '最近登录',
+              dataIndex: 'last_login_at',
+              key: 'last_login_at',
+              width: 170,
+              render: (at) => (at ? formatDateTime(at) : '-'),
+            },
+            {
+              title: '操作',
+              key: 'action',
+              width: 90,
+              render: (_, identity) => (
+                <Popconfirm
+                  title="确认解除关联？"
+                  description="解除后该 IdP 身份再次登录时需重新关联"
+                  okText="解除"
+                  cancelText="取消"
+                  onConfirm={() => onUnlinkIdentity(identity)}
+                >
+                  <Button size="small" danger>
+                    解除
+                  </Button>
+                </Popconfirm>
+              ),
+            },
+          ]}
+        />
+        <Form form={idForm} layout="inline" style={{ marginTop: 16 }} onFinish={onLinkIdentity}>
+          <Form.Item name="provider" rules={[{ required: true, message: '请输入来源' }]}>
+            <Input placeholder="来源，如 oidc:1" style={{ width: 140 }} />
+          </Form.Item>
+          <Form.Item name="subject" rules={[{ required: true, message: '请输入 subject' }]}>
+            <Input placeholder="IdP subject（OIDC sub / SAML NameID）" style={{ width: 300 }} />
+          </Form.Item>
+          <Form.Item>
+            <Button type="primary" htmlType="submit" icon={<LinkOutlined />}>
+              关联
+            </Button>
+          </Form.Item>
+        </Form>
+      </Modal>
+
+      <Modal
+        title={`模拟登录：${impersonateTarget?.username || ''}`}
+        open={!!impersonateTarget}
+        onOk={onImpersonate}
+        onCancel={() => setImpersonateTarget(null)}
+        okText="开始模拟"
+        cancelText="取消"
+        destroyOnClose
+      >
+        <Alert
+          type="info"
+          showIcon
+          style={{ marginBottom: 16 }}
+          message="将以该用户的权限查看系统，令牌短时有效且不可续期；期间的操作以双方身份记录审计，不能修改密码或管理设置"
+        />
+        <Form form={impersonateForm} layout="vertical" autoComplete="off">
+          <Form.Item
+            name="reason"
+            label="原因"
+            rules={[{ required: true, whitespace: true, message: '请填写原因（如工单号）' }]}
+          >
+            <Input placeholder="如：工单 #1234 用户反馈无法播放录像" />
+          </Form.Item>
+        </Form>
+      </Modal>
     </Card>
   );
 }
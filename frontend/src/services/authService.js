@@ -21,9 +21,55 @@ api.interceptors.request.use(
   (error) => Promise.reject(error)
 );
 
+// 同一时刻只发起一次刷新：刷新令牌一次性使用，并发刷新会被服务端判定为重放
+let refreshPromise = null;
+
+function refreshAccessToken() {
+  if (!refreshPromise) {
+    const refreshToken = useAuthStore.getState().refreshToken;
+    refreshPromise = (refreshToken
+      ? axios.post(`${API_BASE_URL}/auth/refresh`, { refresh_token: refreshToken })
+      : Promise.reject(new Error('no refresh token'))
+    )
+      .then(({ data }) => {
+        useAuthStore.getState().hydrate({
+          token: data.token,
+          refreshToken: data.refresh_token,
+          user: data.user,
+        });
+        return data.token;
+      })
+      .finally(() => {
+        refreshPromise = null;
+      });
+  }
+  return refreshPromise;
+}
+
 api.interceptors.response.use(
   (response) => response.data,
-  (error) => {
+  async (error) => {
+    const original = error.config;
+    const isAuthCall =
+      original?.url?.startsWith('/auth/login') ||
+      original?.url?.startsWith('/auth/refresh') ||
+      original?.url?.startsWith('/auth/sso/link');
+    if (error.response?.status === 401 && original && !original._retried && !isAuthCall) {
+      original._retried = true;
+      try {
+        const token = await refreshAccessToken();
+        original.headers.Authorization = `Bearer ${token}`;
+        return api(original);
+      } catch {
+        // 刷新失败：落入下方登出逻辑
+      }
+    }
+    if (error.response?.status === 401 && useAuthStore.getState().impersonation) {
+      // 模拟登录令牌到期或被吊销：恢复管理员登录状态
+      await useAuthStore.getState().endImpersonation(false);
+      window.location.href = '/admin/users';
+      return Promise.reject(error);
+    }
     if (error.response?.status === 401) {
       useAuthStore.getState().logout(false);
       if (!window.location.pathname.startsWith('/login')) {
@@ -43,14 +89,20 @@ api.interceptors.response.use(
 export const authService = {
   login: async (username, password) => api.post('/auth/login', { username, password }),
 
-  verifyToken: async (token) => {
-    const response = await api.get('/auth/me', {
-      headers: { Authorization: `Bearer ${token}` },
-    });
+  // 登录第二步（二次验证）：code 为 TOTP 验证码或恢复码
+  loginMFA: async (mfaToken, code) => api.post('/auth/login/mfa', { mfa_token: mfaToken, code }),
+  loginMFASetup: async (mfaToken) => api.post('/auth/login/mfa/setup', { mfa_token: mfaToken }),
+  loginMFAActivate: async (mfaToken, code) =>
+    api.post('/auth/login/mfa/activate', { mfa_token: mfaToken, code }),
+
+  verifyToken: async () => {
+    const response = await api.get('/auth/me');
     return response.user;
   },
 
-  logout: async () => api.post('/auth/logout'),
+  refresh: refreshAccessToken,
+
+  logout: async (refreshToken) => api.post('/auth/logout', { refresh_token: refreshToken }),
 
   changePassword: async (oldPassword, newPassword) =>
     api.post('/auth/change-password', {
@@ -58,7 +110,16 @@ export const authService = {
       new_password: newPassword,
     }),
 
+  getMFAStatus: async () => api.get('/auth/mfa'),
+  setupMFA: async () => api.post('/auth/mfa/setup'),
+  activateMFA: async (code) => api.post('/auth/mfa/activate', { code }),
+  disableMFA: async (code) => api.post('/auth/mfa/disable', { code }),
+  regenerateRecoveryCodes: async (code) => api.post('/auth/mfa/recovery-codes', { code }),
+
   listSSOProviders: async () => api.get('/auth/sso/providers'),
+  // SSO 身份与同名账号冲突时，输入该账号密码确认关联
+  confirmSSOLink: async (linkToken, password) =>
+    api.post('/auth/sso/link', { link_token: linkToken, password }),
 
   ssoLoginURL: (provider) => {
     const base = API_BASE_URL.replace(/\/$/, '');
@@ -83,19 +144,54 @@ export const adminService = {
   updateDVRServers: async (servers) => api.post('/admin/dvr-servers', { servers }),
   reloadConfig: async () => api.post('/admin/reload'),
   getAuditLogs: async (params = {}) => api.get('/admin/audit', { params }),
+  exportAuditLogs: async (params = {}) =>
+    api.get('/admin/audit/export', { params, responseType: 'blob' }),
+  listAuditArchives: async () => api.get('/admin/audit/archives'),
+  verifyAudit: async () => api.get('/admin/audit/verify'),
+  queryAuditArchive: async (name, params = {}) =>
+    api.get(`/admin/audit/archives/${encodeURIComponent(name)}`, { params }),
   getDashboardStats: async (params = {}) => api.get('/admin/dashboard/stats', { params }),
-  listUsers: async () => api.get('/admin/users'),
+  listUsers: async (params) => api.get('/admin/users', { params }),
   createUser: async ({ username, password, role }) =>
     api.post('/admin/users', { username, password, role }),
   updateUserRole: async (id, role) => api.put(`/admin/users/${id}/role`, { role }),
   resetUserPassword: async (id, newPassword) =>
     api.post(`/admin/users/${id}/reset-password`, { new_password: newPassword }),
   deleteUser: async (id) => api.delete(`/admin/users/${id}`),
+  resetUserMFA: async (id) => api.delete(`/admin/users/${id}/mfa`),
+  unlockUser: async (id) => api.post(`/admin/users/${id}/unlock`),
+  impersonateUser: async (id, reason) => api.post(`/admin/users/${id}/impersonate`, { reason }),
+  disableUsers: async (userIds, reason) => api.post('/admin/users/disable', { user_ids: userIds, reason }),
+  enableUsers: async (userIds) => api.post('/admin/users/enable', { user_ids: userIds }),
+  updateUserRestrictions: async (id, payload) => api.put(`/admin/users/${id}/restrictions`, payload),
+  listUserIdentities: async (id) => api.get(`/admin/users/${id}/identities`),
+  linkUserIdentity: async (id, provider, subject) =>
+    api.post(`/admin/users/${id}/identities`, { provider, subject }),
+  unlinkUserIdentity: async (id, identityId) => api.delete(`/admin/users/${id}/identities/${identityId}`),
   listSSOProvidersAdmin: async () => api.get('/admin/sso/providers'),
   createSSOProvider: async (payload) => api.post('/admin/sso/providers', payload),
   updateSSOProvider: async (id, payload) => api.put(`/admin/sso/providers/${id}`, payload),
   toggleSSOProvider: async (id) => api.post(`/admin/sso/providers/${id}/toggle`),
   deleteSSOProvider: async (id) => api.delete(`/admin/sso/providers/${id}`),
+  listRoles: async () => api.get('/admin/roles'),
+  createRole: async (payload) => api.post('/admin/roles', payload),
+  updateRole: async (name, payload) => api.put(`/admin/roles/${encodeURIComponent(name)}`, payload),
+  deleteRole: async (name) => api.delete(`/admin/roles/${encodeURIComponent(name)}`),
+  listGroups: async () => api.get('/admin/groups'),
+  createGroup: async (payload) => api.post('/admin/groups', payload),
+  updateGroup: async (id, payload) => api.put(`/admin/groups/${id}`, payload),
+  deleteGroup: async (id) => api.delete(`/admin/groups/${id}`),
+  listGroupMembers: async (id) => api.get(`/admin/groups/${id}/members`),
+  addGroupMember: async (id, userId) => api.post(`/admin/groups/${id}/members`, { user_id: userId }),
+  removeGroupMember: async (id, userId) => api.delete(`/admin/groups/${id}/members/${userId}`),
+  listDVRGroups: async () => api.get('/admin/dvr-groups'),
+  createDVRGroup: async (payload) => api.post('/admin/dvr-groups', payload),
+  updateDVRGroup: async (id, payload) => api.put(`/admin/dvr-groups/${id}`, payload),
+  deleteDVRGroup: async (id) => api.delete(`/admin/dvr-groups/${id}`),
+  listAccessPolicies: async () => api.get('/admin/access-policies'),
+  createAccessPolicy: async (payload) => api.post('/admin/access-policies', payload),
+  updateAccessPolicy: async (id, payload) => api.put(`/admin/access-policies/${id}`, payload),
+  deleteAccessPolicy: async (id) => api.delete(`/admin/access-policies/${id}`),
 };
 
 export default api;
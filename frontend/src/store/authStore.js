@@ -3,38 +3,113 @@ import { persist, createJSONStorage } from 'zustand/middleware';
 import { authService } from '../services/authService';
 import { getApiErrorMessage } from '../utils/format';
 
+// loginResult 登录类接口的响应：需二次验证时返回挑战令牌，否则直接完成登录
+function loginResult(response, completeLogin) {
+  if (response.mfa_required || response.mfa_enroll_required) {
+    return {
+      success: true,
+      mfa: { token: response.mfa_token, enroll: !!response.mfa_enroll_required },
+    };
+  }
+  completeLogin(response);
+  return { success: true };
+}
+
+function loginError(error) {
+  const retryAfter = error?.response?.data?.retry_after;
+  const msg = getApiErrorMessage(error, '登录失败');
+  return { success: false, message: retryAfter ? `${msg}（${retryAfter} 秒后可重试）` : msg };
+}
+
 const useAuthStore = create(
   persist(
     (set, get) => ({
       token: null,
+      refreshToken: null,
       user: null,
+      // 模拟登录期间暂存的管理员登录状态（token / refreshToken / user），退出模拟时恢复
+      impersonation: null,
 
+      // 启用二次验证的账号返回 mfa（挑战令牌），需调用 completeLogin 完成登录
       login: async (username, password) => {
         try {
           const response = await authService.login(username, password);
-          set({
-            token: response.token,
-            user: response.user,
-          });
-          return { success: true };
+          return loginResult(response, get().completeLogin);
         } catch (error) {
-          return { success: false, message: getApiErrorMessage(error, '登录失败') };
+          return loginError(error);
         }
       },
 
+      // SSO 身份关联确认：成功后与密码登录相同（可能进入二次验证）
+      confirmSSOLink: async (linkToken, password) => {
+        try {
+          const response = await authService.confirmSSOLink(linkToken, password);
+          return loginResult(response, get().completeLogin);
+        } catch (error) {
+          return loginError(error);
+        }
+      },
+
+      completeLogin: (response) => {
+        set({
+          token: response.token,
+          refreshToken: response.refresh_token,
+          user: response.user,
+        });
+      },
+
+      // 返回 IdP 登出地址（OIDC 会话），调用方应跳转以结束 IdP 会话
       logout: async (callServer = true) => {
+        if (get().impersonation) {
+          await get().endImpersonation(callServer);
+        }
+        let logoutUrl = null;
+        if (callServer) {
+          try {
+            const res = await authService.logout(get().refreshToken);
+            logoutUrl = res?.logout_url || null;
+          } catch {
+            // ignore
+          }
+        }
+        set({ token: null, refreshToken: null, user: null });
+        return logoutUrl;
+      },
+
+      // 以目标用户身份登录：暂存管理员登录状态，换用模拟登录令牌（不可刷新）
+      startImpersonation: async (token) => {
+        const { token: adminToken, refreshToken, user, impersonation } = get();
+        set({
+          impersonation: impersonation || { token: adminToken, refreshToken, user },
+          token,
+          refreshToken: null,
+        });
+        try {
+          const impersonated = await authService.verifyToken();
+          set({ user: impersonated });
+          return { success: true };
+        } catch (error) {
+          await get().endImpersonation(false);
+          return { success: false, message: getApiErrorMessage(error, '模拟登录失败') };
+        }
+      },
+
+      // 结束模拟登录（吊销模拟会话）并恢复管理员登录状态
+      endImpersonation: async (callServer = true) => {
+        const saved = get().impersonation;
+        if (!saved) return;
         if (callServer) {
           try {
-            await authService.logout();
+            await authService.logout(null);
           } catch {
             // ignore
           }
         }
-        set({ token: null, user: null });
+        set({ ...saved, impersonation: null });
       },
 
-      hydrate: ({ token, user }) => {
-        set({ token, user });
+      hydrate: ({ token, refreshToken, user }) => {
+        set({ token, refreshToken: refreshToken ?? get().refreshToken, user });
       },
 
       checkAuth: async () => {
@@ -44,13 +119,13 @@ const useAuthStore = create(
         }
 
         try {
-          const user = await authService.verifyToken(token);
+          const user = await authService.verifyToken();
           set({ user });
           return true;
         } catch (error) {
           const status = error?.response?.status;
           if (status === 401 || status === 403) {
-            set({ token: null, user: null });
+            set({ token: null, refreshToken: null, user: null });
             return false;
           }
           // 网络/5xx：保留 token，避免误登出
@@ -63,9 +138,20 @@ const useAuthStore = create(
     {
       name: 'auth-storage',
       storage: createJSONStorage(() => localStorage),
-      partialize: (state) => ({ token: state.token, user: state.user }),
+      partialize: (state) => ({
+        token: state.token,
+        refreshToken: state.refreshToken,
+        user: state.user,
+        impersonation: state.impersonation,
+      }),
     }
   )
 );
 
-export { useAuthStore };
+// hasPermission 当前用户的角色是否拥有任一指定权限（与后端 RequirePermission 一致）
+function hasPermission(user, ...perms) {
+  const granted = user?.permissions || [];
+  return perms.some((p) => granted.includes(p));
+}
+
+export { useAuthStore, hasPermission };